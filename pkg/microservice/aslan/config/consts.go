@@ -187,6 +187,23 @@ const (
 	JobK8sBlueGreenRelease JobType = "k8s-blue-green-release"
 	JobK8sCanaryDeploy     JobType = "k8s-canary-deploy"
 	JobK8sCanaryRelease    JobType = "k8s-canary-release"
+	JobIstioCanary         JobType = "istio-canary"
+	JobCanaryAnalysis      JobType = "canary-analysis"
+)
+
+// header match types of istio canary jobs.
+const (
+	IstioMatchExact  = "exact"
+	IstioMatchPrefix = "prefix"
+	IstioMatchRegex  = "regex"
+)
+
+// conditions of canary analysis metrics, the measurement passes when the value compared with the threshold meets it.
+const (
+	AnalysisConditionLT  = "lt"
+	AnalysisConditionLTE = "lte"
+	AnalysisConditionGT  = "gt"
+	AnalysisConditionGTE = "gte"
 )
 
 type ApproveOrReject string
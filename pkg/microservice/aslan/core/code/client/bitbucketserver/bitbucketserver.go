@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucketserver
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client"
+	"github.com/koderover/zadig/pkg/tool/bitbucketserver"
+)
+
+type Config struct {
+	Address     string `json:"address"`
+	AccessToken string `json:"access_token"`
+	EnableProxy bool   `json:"enable_proxy"`
+}
+
+type Client struct {
+	Client *bitbucketserver.Client
+}
+
+func (c *Config) Open(id int, logger *zap.SugaredLogger) (client.CodeHostClient, error) {
+	return &Client{
+		Client: bitbucketserver.NewClient(c.Address, c.AccessToken, config.ProxyHTTPSAddr(), c.EnableProxy),
+	}, nil
+}
+
+func (c *Client) ListBranches(opt client.ListOpt) ([]*client.Branch, error) {
+	branches, err := c.Client.ListBranches(opt.Namespace, opt.ProjectName, opt.Key, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Branch
+	for _, o := range branches {
+		res = append(res, &client.Branch{
+			Name: o.DisplayID,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListTags(opt client.ListOpt) ([]*client.Tag, error) {
+	tags, err := c.Client.ListTags(opt.Namespace, opt.ProjectName, opt.Key, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Tag
+	for _, tag := range tags {
+		res = append(res, &client.Tag{
+			Name: tag.DisplayID,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListPrs(opt client.ListOpt) ([]*client.PullRequest, error) {
+	prs, err := c.Client.ListPullRequests(opt.Namespace, opt.ProjectName, bitbucketserver.PullRequestStateOpen, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.PullRequest
+	for _, o := range prs {
+		if opt.TargeBr != "" && o.ToRef.DisplayID != opt.TargeBr {
+			continue
+		}
+		pr := &client.PullRequest{
+			ID:           o.ID,
+			Number:       o.ID,
+			State:        o.State,
+			Title:        o.Title,
+			SourceBranch: o.FromRef.DisplayID,
+			TargetBranch: o.ToRef.DisplayID,
+			CreatedAt:    o.CreatedDate / 1000,
+			UpdatedAt:    o.UpdatedDate / 1000,
+		}
+		if o.Author.User != nil {
+			pr.User = o.Author.User.Name
+			pr.AuthorUsername = o.Author.User.Name
+		}
+		res = append(res, pr)
+	}
+	return res, nil
+}
+
+// ListNamespaces lists the projects of bitbucket server, repositories always belong to a project.
+func (c *Client) ListNamespaces(keyword string) ([]*client.Namespace, error) {
+	projects, err := c.Client.ListProjects(keyword, 1, 1000)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Namespace
+	for _, o := range projects {
+		res = append(res, &client.Namespace{
+			Name: o.Name,
+			Path: o.Key,
+			Kind: client.GroupKind,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListProjects(opt client.ListOpt) ([]*client.Project, error) {
+	repos, err := c.Client.ListRepositories(opt.Namespace, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Project
+	for _, repo := range repos {
+		res = append(res, &client.Project{
+			ID:        repo.ID,
+			Name:      repo.Slug,
+			Namespace: repo.Project.Key,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client"
+	"github.com/koderover/zadig/pkg/tool/gitea"
+)
+
+type Config struct {
+	Address     string `json:"address"`
+	AccessToken string `json:"access_token"`
+	EnableProxy bool   `json:"enable_proxy"`
+}
+
+type Client struct {
+	Client *gitea.Client
+}
+
+func (c *Config) Open(id int, logger *zap.SugaredLogger) (client.CodeHostClient, error) {
+	return &Client{
+		Client: gitea.NewClient(c.Address, c.AccessToken, config.ProxyHTTPSAddr(), c.EnableProxy),
+	}, nil
+}
+
+func (c *Client) ListBranches(opt client.ListOpt) ([]*client.Branch, error) {
+	branches, err := c.Client.ListBranches(opt.Namespace, opt.ProjectName, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Branch
+	for _, o := range branches {
+		res = append(res, &client.Branch{
+			Name:      o.Name,
+			Protected: o.Protected,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListTags(opt client.ListOpt) ([]*client.Tag, error) {
+	tags, err := c.Client.ListTags(opt.Namespace, opt.ProjectName, opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.Tag
+	for _, tag := range tags {
+		res = append(res, &client.Tag{
+			Name:       tag.Name,
+			Message:    tag.Message,
+			ZipballURL: tag.ZipballURL,
+			TarballURL: tag.TarballURL,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListPrs(opt client.ListOpt) ([]*client.PullRequest, error) {
+	prs, err := c.Client.ListPullRequests(opt.Namespace, opt.ProjectName, "open", opt.Page, opt.PerPage)
+	if err != nil {
+		return nil, err
+	}
+	var res []*client.PullRequest
+	for _, o := range prs {
+		if opt.TargeBr != "" && o.Base.Ref != opt.TargeBr {
+			continue
+		}
+		res = append(res, &client.PullRequest{
+			ID:             int(o.ID),
+			State:          o.State,
+			User:           o.User.Login,
+			Number:         o.Number,
+			AuthorUsername: o.User.Login,
+			Title:          o.Title,
+			SourceBranch:   o.Head.Ref,
+			TargetBranch:   o.Base.Ref,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListNamespaces(keyword string) ([]*client.Namespace, error) {
+	user, err := c.Client.GetAuthenticatedUser()
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := c.Client.ListOrganizations()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*client.Namespace{{
+		Name: user.Login,
+		Path: user.Login,
+		Kind: client.UserKind,
+	}}
+	for _, o := range orgs {
+		res = append(res, &client.Namespace{
+			Name: o.UserName,
+			Path: o.UserName,
+			Kind: client.OrgKind,
+		})
+	}
+	return res, nil
+}
+
+func (c *Client) ListProjects(opt client.ListOpt) ([]*client.Project, error) {
+	var repos []*gitea.Repository
+	var err error
+	switch opt.NamespaceType {
+	case client.OrgKind:
+		repos, err = c.Client.ListOrgRepositories(opt.Namespace, opt.Page, opt.PerPage)
+	default:
+		var user *gitea.User
+		user, err = c.Client.GetAuthenticatedUser()
+		if err != nil {
+			return nil, err
+		}
+		repos, err = c.Client.SearchUserRepositories(user.ID, opt.Key, opt.Page, opt.PerPage)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*client.Project
+	for _, repo := range repos {
+		res = append(res, &client.Project{
+			ID:            int(repo.ID),
+			Name:          repo.Name,
+			Description:   repo.Description,
+			DefaultBranch: repo.DefaultBranch,
+			Namespace:     repo.Owner.Login,
+		})
+	}
+	return res, nil
+}
@@ -23,8 +23,10 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/bitbucketserver"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/codehub"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/gerrit"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/gitea"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/gitee"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/github"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/code/client/gitlab"
@@ -37,11 +39,13 @@ type ClientConfig interface {
 }
 
 var ClientsConfig = map[string]func() ClientConfig{
-	setting.SourceFromGitlab:  func() ClientConfig { return new(gitlab.Config) },
-	setting.SourceFromGithub:  func() ClientConfig { return new(github.Config) },
-	setting.SourceFromGerrit:  func() ClientConfig { return new(gerrit.Config) },
-	setting.SourceFromCodeHub: func() ClientConfig { return new(codehub.Config) },
-	setting.SourceFromGitee:   func() ClientConfig { return new(gitee.Config) },
+	setting.SourceFromGitlab:          func() ClientConfig { return new(gitlab.Config) },
+	setting.SourceFromGithub:          func() ClientConfig { return new(github.Config) },
+	setting.SourceFromGerrit:          func() ClientConfig { return new(gerrit.Config) },
+	setting.SourceFromCodeHub:         func() ClientConfig { return new(codehub.Config) },
+	setting.SourceFromGitee:           func() ClientConfig { return new(gitee.Config) },
+	setting.SourceFromGitea:           func() ClientConfig { return new(gitea.Config) },
+	setting.SourceFromBitbucketServer: func() ClientConfig { return new(bitbucketserver.Config) },
 }
 
 func OpenClient(ch *systemconfig.CodeHost, log *zap.SugaredLogger) (client.CodeHostClient, error) {
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	templatemodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models/template"
+)
+
+// EnvServiceVersion records a deployment of the service in the env, the service can be rolled back to it later.
+type EnvServiceVersion struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"          json:"id,omitempty"`
+	ProductName string             `bson:"product_name"           json:"product_name"`
+	EnvName     string             `bson:"env_name"               json:"env_name"`
+	Namespace   string             `bson:"namespace"              json:"namespace"`
+	ServiceName string             `bson:"service_name"           json:"service_name"`
+	// Revision increases every time the service is deployed in the env.
+	Revision int64 `bson:"revision"               json:"revision"`
+	// Service keeps the revision of the service template, the images and the renderset deployed.
+	Service *ProductService `bson:"service"                json:"service"`
+	// Yaml is the rendered manifests of the k8s yaml service.
+	Yaml string `bson:"yaml,omitempty"         json:"yaml,omitempty"`
+	// RenderChart, ReleaseName, ReleaseRevision and ValuesYaml are only for helm services,
+	// ValuesYaml is the values merged from all the override values.
+	RenderChart     *templatemodels.RenderChart `bson:"render_chart,omitempty" json:"render_chart,omitempty"`
+	ReleaseName     string                      `bson:"release_name,omitempty" json:"release_name,omitempty"`
+	ReleaseRevision int                         `bson:"release_revision"       json:"release_revision"`
+	ValuesYaml      string                      `bson:"values_yaml,omitempty"  json:"values_yaml,omitempty"`
+	// WorkflowName and TaskID are set when the service is deployed by a workflow task.
+	WorkflowName string `bson:"workflow_name,omitempty" json:"workflow_name,omitempty"`
+	TaskID       int64  `bson:"task_id,omitempty"       json:"task_id,omitempty"`
+	CreateBy     string `bson:"create_by"               json:"create_by"`
+	CreateTime   int64  `bson:"create_time"             json:"create_time"`
+}
+
+func (EnvServiceVersion) TableName() string {
+	return "env_service_version"
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	IMAppTypeLark     = "feishu"
+	IMAppTypeDingTalk = "dingding"
+	IMAppTypeSlack    = "slack"
+)
+
+// IMApp is the app of lark, dingtalk or slack which receives the callbacks of the approval cards.
+type IMApp struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty"        json:"id,omitempty"`
+	Name string             `bson:"name"                 json:"name"`
+	// Type is the same as the webhook type of the notification.
+	Type string `bson:"type"                 json:"type"`
+	// AppID and AppSecret are the app key and secret of lark and dingtalk apps.
+	AppID     string `bson:"app_id"               json:"app_id"`
+	AppSecret string `bson:"app_secret"           json:"app_secret"`
+	// VerificationToken verifies the card callbacks of lark.
+	VerificationToken string `bson:"verification_token"   json:"verification_token"`
+	// EncryptKey decrypts and verifies the card.action.trigger events of lark, it is optional.
+	EncryptKey string `bson:"encrypt_key"          json:"encrypt_key"`
+	// SigningSecret verifies the interactivity requests of slack.
+	SigningSecret string `bson:"signing_secret"       json:"signing_secret"`
+	UpdateTime    int64  `bson:"update_time"          json:"update_time"`
+}
+
+func (IMApp) TableName() string {
+	return "im_app"
+}
+
+// IMUserBinding maps the user of an IM app to the zadig user.
+type IMUserBinding struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"        json:"id,omitempty"`
+	IMAppID    string             `bson:"im_app_id"            json:"im_app_id"`
+	IMUserID   string             `bson:"im_user_id"           json:"im_user_id"`
+	UserID     string             `bson:"user_id"              json:"user_id"`
+	UserName   string             `bson:"user_name"            json:"user_name"`
+	UpdateTime int64              `bson:"update_time"          json:"update_time"`
+}
+
+func (IMUserBinding) TableName() string {
+	return "im_user_binding"
+}
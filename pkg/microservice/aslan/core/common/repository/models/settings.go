@@ -23,9 +23,18 @@ type SystemSetting struct {
 	WorkflowConcurrency int64              `bson:"workflow_concurrency" json:"workflow_concurrency"`
 	BuildConcurrency    int64              `bson:"build_concurrency" json:"build_concurrency"`
 	DefaultLogin        string             `bson:"default_login" json:"default_login"`
+	WorkflowQuota       *WorkflowQuota     `bson:"workflow_quota" json:"workflow_quota"`
 	UpdateTime          int64              `bson:"update_time" json:"update_time"`
 }
 
+// WorkflowQuota limits the running workflow tasks of a project or a cluster, 0 means no limit.
+type WorkflowQuota struct {
+	DefaultProjectConcurrency int64            `bson:"default_project_concurrency" json:"default_project_concurrency"`
+	ProjectConcurrency        map[string]int64 `bson:"project_concurrency"         json:"project_concurrency"`
+	DefaultClusterConcurrency int64            `bson:"default_cluster_concurrency" json:"default_cluster_concurrency"`
+	ClusterConcurrency        map[string]int64 `bson:"cluster_concurrency"         json:"cluster_concurrency"`
+}
+
 func (SystemSetting) TableName() string {
 	return "system_setting"
 }
@@ -47,6 +47,7 @@ type WorkflowTask struct {
 	Error               string             `bson:"error,omitempty"           json:"error,omitempty"`
 	IsRestart           bool               `bson:"is_restart"                json:"is_restart"`
 	MultiRun            bool               `bson:"multi_run"                 json:"multi_run"`
+	Priority            int                `bson:"priority"                  json:"priority"`
 }
 
 func (WorkflowTask) TableName() string {
@@ -62,6 +63,7 @@ type StageTask struct {
 	Approval  *Approval     `bson:"approval"      json:"approval"`
 	Jobs      []*JobTask    `bson:"jobs"          json:"jobs"`
 	Error     string        `bson:"error"         json:"error"`
+	When      string        `bson:"when"          json:"when,omitempty"`
 }
 
 type JobTask struct {
@@ -74,8 +76,15 @@ type JobTask struct {
 	Error      string        `bson:"error"               json:"error"`
 	Timeout    int64         `bson:"timeout"             json:"timeout"`
 	Retry      int64         `bson:"retry"               json:"retry"`
+	RetryCount int64         `bson:"retry_count"         json:"retry_count"`
 	Spec       interface{}   `bson:"spec"                json:"spec"`
 	Outputs    []*Output     `bson:"outputs"             json:"outputs"`
+	// OriginName is the name of the workflow job this task is generated from.
+	OriginName string   `bson:"origin_name"         json:"origin_name"`
+	DependsOn  []string `bson:"depends_on"          json:"depends_on,omitempty"`
+	When       string   `bson:"when"                json:"when,omitempty"`
+	// Matrix holds the values of the matrix cell this task is fanned out for.
+	Matrix map[string]string `bson:"matrix,omitempty"    json:"matrix,omitempty"`
 }
 
 type JobTaskCustomDeploySpec struct {
@@ -91,15 +100,17 @@ type JobTaskCustomDeploySpec struct {
 }
 
 type JobTaskDeploySpec struct {
-	Env                string     `bson:"env"                              json:"env"                                 yaml:"env"`
-	ServiceName        string     `bson:"service_name"                     json:"service_name"                        yaml:"service_name"`
-	ServiceType        string     `bson:"service_type"                     json:"service_type"                        yaml:"service_type"`
-	ServiceModule      string     `bson:"service_module"                   json:"service_module"                      yaml:"service_module"`
-	SkipCheckRunStatus bool       `bson:"skip_check_run_status"            json:"skip_check_run_status"               yaml:"skip_check_run_status"`
-	Image              string     `bson:"image"                            json:"image"                               yaml:"image"`
-	ClusterID          string     `bson:"cluster_id"                       json:"cluster_id"                          yaml:"cluster_id"`
-	Timeout            int        `bson:"timeout"                          json:"timeout"                             yaml:"timeout"`
-	ReplaceResources   []Resource `bson:"replace_resources"                json:"replace_resources"                   yaml:"replace_resources"`
+	Env                string             `bson:"env"                              json:"env"                                 yaml:"env"`
+	ServiceName        string             `bson:"service_name"                     json:"service_name"                        yaml:"service_name"`
+	ServiceType        string             `bson:"service_type"                     json:"service_type"                        yaml:"service_type"`
+	ServiceModule      string             `bson:"service_module"                   json:"service_module"                      yaml:"service_module"`
+	SkipCheckRunStatus bool               `bson:"skip_check_run_status"            json:"skip_check_run_status"               yaml:"skip_check_run_status"`
+	Image              string             `bson:"image"                            json:"image"                               yaml:"image"`
+	ClusterID          string             `bson:"cluster_id"                       json:"cluster_id"                          yaml:"cluster_id"`
+	Timeout            int                `bson:"timeout"                          json:"timeout"                             yaml:"timeout"`
+	ReplaceResources   []Resource         `bson:"replace_resources"                json:"replace_resources"                   yaml:"replace_resources"`
+	HealthCheck        *DeployHealthCheck `bson:"health_check,omitempty"           json:"health_check,omitempty"              yaml:"health_check,omitempty"`
+	Events             *Events            `bson:"events,omitempty"                 json:"events,omitempty"                    yaml:"events,omitempty"`
 }
 
 type Resource struct {
@@ -119,6 +130,8 @@ type JobTaskHelmDeploySpec struct {
 	ReleaseName        string                   `bson:"release_name"                     json:"release_name"                        yaml:"release_name"`
 	Timeout            int                      `bson:"timeout"                          json:"timeout"                             yaml:"timeout"`
 	ReplaceResources   []Resource               `bson:"replace_resources"                json:"replace_resources"                   yaml:"replace_resources"`
+	HealthCheck        *DeployHealthCheck       `bson:"health_check,omitempty"           json:"health_check,omitempty"              yaml:"health_check,omitempty"`
+	Events             *Events                  `bson:"events,omitempty"                 json:"events,omitempty"                    yaml:"events,omitempty"`
 }
 
 type ImageAndServiceModule struct {
@@ -129,6 +142,8 @@ type ImageAndServiceModule struct {
 type JobTaskFreestyleSpec struct {
 	Properties JobProperties `bson:"properties"          json:"properties"        yaml:"properties"`
 	Steps      []*StepTask   `bson:"steps"               json:"steps"             yaml:"steps"`
+	// StepMarkerNonce is generated for every run of the job to tell the step markers from the output of steps.
+	StepMarkerNonce string `bson:"step_marker_nonce"   json:"step_marker_nonce" yaml:"step_marker_nonce"`
 }
 
 type JobTaskPluginSpec struct {
@@ -201,6 +216,59 @@ type JobTaskCanaryReleaseSpec struct {
 	Events         *Events `bson:"events"                 json:"events"                yaml:"events"`
 }
 
+type JobTaskIstioCanarySpec struct {
+	ClusterID      string `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
+	Namespace      string `bson:"namespace"              json:"namespace"             yaml:"namespace"`
+	K8sServiceName string `bson:"k8s_service_name"       json:"k8s_service_name"      yaml:"k8s_service_name"`
+	WorkloadType   string `bson:"workload_type"          json:"workload_type"         yaml:"workload_type"`
+	WorkloadName   string `bson:"workload_name"          json:"workload_name"         yaml:"workload_name"`
+	ContainerName  string `bson:"container_name"         json:"container_name"        yaml:"container_name"`
+	Image          string `bson:"image"                  json:"image"                 yaml:"image"`
+	// Continued is true when the canary was started by the job quoted as from_job.
+	Continued bool                `bson:"continued"              json:"continued"             yaml:"continued"`
+	Steps     []*IstioCanaryStep  `bson:"steps"                  json:"steps"                 yaml:"steps"`
+	Headers   []*IstioHeaderMatch `bson:"headers"                json:"headers"               yaml:"headers"`
+	// CurrentWeight is the percentage of traffic routed to the canary now.
+	CurrentWeight int `bson:"current_weight"         json:"current_weight"        yaml:"current_weight"`
+	// unit is minute.
+	DeployTimeout int64   `bson:"deploy_timeout"         json:"deploy_timeout"        yaml:"deploy_timeout"`
+	Events        *Events `bson:"events"                 json:"events"                yaml:"events"`
+}
+
+type JobTaskCanaryAnalysisSpec struct {
+	PrometheusAddress string            `bson:"prometheus_address"     json:"prometheus_address"    yaml:"prometheus_address"`
+	PrometheusToken   string            `bson:"prometheus_token"       json:"prometheus_token"      yaml:"prometheus_token"`
+	Metrics           []*AnalysisMetric `bson:"metrics"                json:"metrics"               yaml:"metrics"`
+	// unit is second.
+	Interval        int64                     `bson:"interval"               json:"interval"              yaml:"interval"`
+	Count           int                       `bson:"count"                  json:"count"                 yaml:"count"`
+	FailureLimit    int                       `bson:"failure_limit"          json:"failure_limit"         yaml:"failure_limit"`
+	Rollback        bool                      `bson:"rollback"               json:"rollback"              yaml:"rollback"`
+	RollbackTargets []*AnalysisRollbackTarget `bson:"rollback_targets"       json:"rollback_targets"      yaml:"rollback_targets"`
+	Measurements    []*AnalysisMeasurement    `bson:"measurements"           json:"measurements"          yaml:"measurements"`
+	Events          *Events                   `bson:"events"                 json:"events"                yaml:"events"`
+}
+
+// AnalysisRollbackTarget is the canary or blue deployment created by the job quoted by the analysis job.
+type AnalysisRollbackTarget struct {
+	JobType            string `bson:"job_type"               json:"job_type"              yaml:"job_type"`
+	ClusterID          string `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
+	Namespace          string `bson:"namespace"              json:"namespace"             yaml:"namespace"`
+	K8sServiceName     string `bson:"k8s_service_name"       json:"k8s_service_name"      yaml:"k8s_service_name"`
+	WorkloadType       string `bson:"workload_type"          json:"workload_type"         yaml:"workload_type"`
+	WorkloadName       string `bson:"workload_name"          json:"workload_name"         yaml:"workload_name"`
+	BlueK8sServiceName string `bson:"blue_k8s_service_name"  json:"blue_k8s_service_name" yaml:"blue_k8s_service_name"`
+	BlueWorkloadName   string `bson:"blue_workload_name"     json:"blue_workload_name"    yaml:"blue_workload_name"`
+}
+
+type AnalysisMeasurement struct {
+	Metric string  `bson:"metric"                 json:"metric"                yaml:"metric"`
+	Value  float64 `bson:"value"                  json:"value"                 yaml:"value"`
+	Passed bool    `bson:"passed"                 json:"passed"                yaml:"passed"`
+	Error  string  `bson:"error"                  json:"error"                 yaml:"error"`
+	Time   int64   `bson:"time"                   json:"time"                  yaml:"time"`
+}
+
 type Event struct {
 	EventType string `bson:"event_type"             json:"event_type"            yaml:"event_type"`
 	Time      string `bson:"time"                   json:"time"                  yaml:"time"`
@@ -231,6 +299,12 @@ type StepTask struct {
 	Error     string          `bson:"error"          json:"error"        yaml:"error"`
 	StepType  config.StepType `bson:"type"           json:"type"         yaml:"type"`
 	Onfailure bool            `bson:"on_failure"     json:"on_failure"   yaml:"on_failure"`
+	RunIf     string          `bson:"run_if"         json:"run_if"       yaml:"run_if"`
+	Timeout   int64           `bson:"timeout"        json:"timeout"      yaml:"timeout"`
+	Status    config.Status   `bson:"status"         json:"status"       yaml:"status"`
+	ExitCode  int             `bson:"exit_code"      json:"exit_code"    yaml:"exit_code"`
+	StartTime int64           `bson:"start_time"     json:"start_time"   yaml:"start_time"`
+	EndTime   int64           `bson:"end_time"       json:"end_time"     yaml:"end_time"`
 	// step input params,differ form steps
 	Spec interface{} `bson:"spec"           json:"spec"   yaml:"spec"`
 	// step output results,like testing results,differ form steps
@@ -241,12 +315,15 @@ type WorkflowTaskCtx struct {
 	WorkflowName      string
 	ProjectName       string
 	TaskID            int64
+	TaskCreator       string
 	DockerHost        string
 	Workspace         string
 	DistDir           string
 	DockerMountDir    string
 	ConfigMapMountDir string
 	WorkflowKeyVals   []*KeyVal
+	WorkflowParams    []*Param
+	HookPayload       *HookPayload
 	GlobalContextGet  func(key string) (string, bool)
 	GlobalContextSet  func(key, value string)
 	GlobalContextEach func(f func(k, v string) bool)
@@ -317,14 +317,25 @@ type ProductDistribute struct {
 }
 
 type NotifyCtl struct {
-	Enabled         bool     `bson:"enabled"                       yaml:"enabled"                       json:"enabled"`
-	WebHookType     string   `bson:"webhook_type"                  yaml:"webhook_type"                  json:"webhook_type"`
-	WeChatWebHook   string   `bson:"weChat_webHook,omitempty"      yaml:"weChat_webHook,omitempty"      json:"weChat_webHook,omitempty"`
-	DingDingWebHook string   `bson:"dingding_webhook,omitempty"    yaml:"dingding_webhook,omitempty"    json:"dingding_webhook,omitempty"`
-	FeiShuWebHook   string   `bson:"feishu_webhook,omitempty"      yaml:"feishu_webhook,omitempty"      json:"feishu_webhook,omitempty"`
-	AtMobiles       []string `bson:"at_mobiles,omitempty"          yaml:"at_mobiles,omitempty"          json:"at_mobiles,omitempty"`
-	IsAtAll         bool     `bson:"is_at_all,omitempty"           yaml:"is_at_all,omitempty"           json:"is_at_all,omitempty"`
-	NotifyTypes     []string `bson:"notify_type"                   yaml:"notify_type"                   json:"notify_type"`
+	Enabled         bool           `bson:"enabled"                       yaml:"enabled"                       json:"enabled"`
+	WebHookType     string         `bson:"webhook_type"                  yaml:"webhook_type"                  json:"webhook_type"`
+	WeChatWebHook   string         `bson:"weChat_webHook,omitempty"      yaml:"weChat_webHook,omitempty"      json:"weChat_webHook,omitempty"`
+	DingDingWebHook string         `bson:"dingding_webhook,omitempty"    yaml:"dingding_webhook,omitempty"    json:"dingding_webhook,omitempty"`
+	FeiShuWebHook   string         `bson:"feishu_webhook,omitempty"      yaml:"feishu_webhook,omitempty"      json:"feishu_webhook,omitempty"`
+	SlackWebHook    string         `bson:"slack_webhook,omitempty"       yaml:"slack_webhook,omitempty"       json:"slack_webhook,omitempty"`
+	MSTeamsWebHook  string         `bson:"msteams_webhook,omitempty"     yaml:"msteams_webhook,omitempty"     json:"msteams_webhook,omitempty"`
+	WebHookNotify   *WebhookNotify `bson:"webhook_notify,omitempty"      yaml:"webhook_notify,omitempty"      json:"webhook_notify,omitempty"`
+	EmailRecipients []string       `bson:"email_recipients,omitempty"    yaml:"email_recipients,omitempty"    json:"email_recipients,omitempty"`
+	IMAppID         string         `bson:"im_app_id,omitempty"           yaml:"im_app_id,omitempty"           json:"im_app_id,omitempty"`
+	AtMobiles       []string       `bson:"at_mobiles,omitempty"          yaml:"at_mobiles,omitempty"          json:"at_mobiles,omitempty"`
+	IsAtAll         bool           `bson:"is_at_all,omitempty"           yaml:"is_at_all,omitempty"           json:"is_at_all,omitempty"`
+	NotifyTypes     []string       `bson:"notify_type"                   yaml:"notify_type"                   json:"notify_type"`
+}
+
+// WebhookNotify posts the notification as JSON to the address, the body is signed with HMAC-SHA256 if the secret is set.
+type WebhookNotify struct {
+	Address string `bson:"address"                       yaml:"address"                       json:"address"`
+	Secret  string `bson:"secret,omitempty"              yaml:"secret,omitempty"              json:"secret,omitempty"`
 }
 
 type TaskInfo struct {
@@ -366,6 +377,9 @@ type HookPayload struct {
 	CommitID       string `bson:"commit_id"        json:"commit_id,omitempty"`
 	DeliveryID     string `bson:"delivery_id"      json:"delivery_id,omitempty"`
 	CodehostID     int    `bson:"codehost_id"      json:"codehost_id"`
+	// EventType and ChangedFiles are used by the conditions of workflow v4 stages and jobs.
+	EventType    string   `bson:"event_type,omitempty"    json:"event_type,omitempty"`
+	ChangedFiles []string `bson:"changed_files,omitempty" json:"changed_files,omitempty"`
 }
 
 type TargetArgs struct {
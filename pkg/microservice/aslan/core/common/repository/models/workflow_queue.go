@@ -33,6 +33,12 @@ type WorkflowQueue struct {
 	TaskRevoker  string             `bson:"task_revoker,omitempty"                     json:"task_revoker,omitempty"`
 	CreateTime   int64              `bson:"create_time"                                json:"create_time,omitempty"`
 	MultiRun     bool               `bson:"multi_run"                                  json:"multi_run"`
+	Priority     int                `bson:"priority"                                   json:"priority"`
+	ClusterIDs   []string           `bson:"cluster_ids"                                json:"cluster_ids"`
+	// Owner is the aslan instance running the task, it holds the task until LeaseExpireTime and renews the lease
+	// while it is alive, the task is resumed by another instance after the lease expired.
+	Owner           string `bson:"owner,omitempty"                            json:"owner,omitempty"`
+	LeaseExpireTime int64  `bson:"lease_expire_time,omitempty"                json:"lease_expire_time,omitempty"`
 }
 
 func (WorkflowQueue) TableName() string {
@@ -41,11 +41,17 @@ type WorkflowV4 struct {
 	UpdatedBy      string             `bson:"updated_by"          yaml:"updated_by"   json:"updated_by"`
 	UpdateTime     int64              `bson:"update_time"         yaml:"update_time"  json:"update_time"`
 	MultiRun       bool               `bson:"multi_run"           yaml:"multi_run"    json:"multi_run"`
+	Priority       int                `bson:"priority"            yaml:"priority"     json:"priority"`
 	NotifyCtls     []*NotifyCtl       `bson:"notify_ctls"         yaml:"notify_ctls"  json:"notify_ctls"`
 	HookCtls       []*WorkflowV4Hook  `bson:"hook_ctl"            yaml:"-"            json:"hook_ctl"`
+	GeneralHooks   []*GeneralHook     `bson:"general_hooks"       yaml:"-"            json:"general_hooks"`
+	UpstreamHooks  []*UpstreamHook    `bson:"upstream_hooks"      yaml:"-"            json:"upstream_hooks"`
+	RegistryHooks  []*RegistryHook    `bson:"registry_hooks"      yaml:"-"            json:"registry_hooks"`
 	NotificationID string             `bson:"notification_id"     yaml:"-"            json:"notification_id"`
 	HookPayload    *HookPayload       `bson:"hook_payload"        yaml:"-"            json:"hook_payload,omitempty"`
 	BaseName       string             `bson:"base_name"           yaml:"-"            json:"base_name"`
+	// TriggerChain holds the upstream workflows which triggered the task one by one, to break the trigger loops.
+	TriggerChain []string `bson:"trigger_chain,omitempty" yaml:"-"            json:"trigger_chain,omitempty"`
 }
 
 type WorkflowStage struct {
@@ -53,6 +59,8 @@ type WorkflowStage struct {
 	Parallel bool      `bson:"parallel"      yaml:"parallel"     json:"parallel"`
 	Approval *Approval `bson:"approval"      yaml:"approval"     json:"approval"`
 	Jobs     []*Job    `bson:"jobs"          yaml:"jobs"         json:"jobs"`
+	// the stage is skipped when the condition is false, see pkg/util/condition for the syntax.
+	When string `bson:"when"          yaml:"when,omitempty"   json:"when,omitempty"`
 }
 
 type Approval struct {
@@ -78,6 +86,10 @@ type Job struct {
 	// only for webhook workflow args to skip some tasks.
 	Skipped bool        `bson:"skipped"        yaml:"skipped"  json:"skipped"`
 	Spec    interface{} `bson:"spec"           yaml:"spec"     json:"spec"`
+	// names of the jobs to wait for, the job runs as soon as all of them passed regardless of the stage order.
+	DependsOn []string `bson:"depends_on"     yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	// the job is skipped when the condition is false, see pkg/util/condition for the syntax.
+	When string `bson:"when"           yaml:"when,omitempty"       json:"when,omitempty"`
 }
 
 type CustomDeployJobSpec struct {
@@ -107,11 +119,20 @@ type FreestyleJobSpec struct {
 	Properties *JobProperties `bson:"properties"     yaml:"properties"    json:"properties"`
 	Steps      []*Step        `bson:"steps"          yaml:"steps"         json:"steps"`
 	Outputs    []*Output      `bson:"outputs"        yaml:"outputs"       json:"outputs"`
+	Matrix     []*MatrixAxis  `bson:"matrix"         yaml:"matrix,omitempty" json:"matrix,omitempty"`
 }
 
 type ZadigBuildJobSpec struct {
 	DockerRegistryID string             `bson:"docker_registry_id"     yaml:"docker_registry_id"     json:"docker_registry_id"`
 	ServiceAndBuilds []*ServiceAndBuild `bson:"service_and_builds"     yaml:"service_and_builds"     json:"service_and_builds"`
+	Matrix           []*MatrixAxis      `bson:"matrix"                 yaml:"matrix,omitempty"       json:"matrix,omitempty"`
+	Retry            int64              `bson:"retry"                  yaml:"retry,omitempty"        json:"retry,omitempty"`
+}
+
+// MatrixAxis is one dimension of the job matrix, the job fans out into one job task for each combination of the values.
+type MatrixAxis struct {
+	Name   string   `bson:"name"           yaml:"name"          json:"name"`
+	Values []string `bson:"values"         yaml:"values"        json:"values"`
 }
 
 type ServiceAndBuild struct {
@@ -133,6 +154,39 @@ type ZadigDeployJobSpec struct {
 	// 当 source 为 fromjob 时需要，指定部署镜像来源是上游哪一个构建任务
 	JobName          string             `bson:"job_name"             yaml:"job_name"             json:"job_name"`
 	ServiceAndImages []*ServiceAndImage `bson:"service_and_images"   yaml:"service_and_images"   json:"service_and_images"`
+	// HealthCheck verifies the services after they are deployed, it is skipped when not set.
+	HealthCheck *DeployHealthCheck `bson:"health_check,omitempty" yaml:"health_check,omitempty" json:"health_check,omitempty"`
+}
+
+// DeployHealthCheck is retried until all the checks pass, the deploy fails if they do not pass within the window.
+type DeployHealthCheck struct {
+	// unit is second.
+	Window   int64 `bson:"window"                 json:"window"                yaml:"window"`
+	Interval int64 `bson:"interval"               json:"interval"              yaml:"interval"`
+	// Rollback restores the previous images or values of the service when the checks failed.
+	Rollback          bool                 `bson:"rollback"               json:"rollback"              yaml:"rollback"`
+	HTTPProbes        []*HTTPProbe         `bson:"http_probes"            json:"http_probes"           yaml:"http_probes"`
+	Scripts           []*HealthCheckScript `bson:"scripts"                json:"scripts"               yaml:"scripts"`
+	PrometheusAddress string               `bson:"prometheus_address"     json:"prometheus_address"    yaml:"prometheus_address"`
+	PrometheusToken   string               `bson:"prometheus_token"       json:"prometheus_token"      yaml:"prometheus_token"`
+	Metrics           []*AnalysisMetric    `bson:"metrics"                json:"metrics"               yaml:"metrics"`
+}
+
+// HTTPProbe passes when the response has the expected status code, any status below 400 is expected if not set.
+// $Namespace$, $EnvName$, $Product$ and $Service$ in the url are replaced for every service deployed.
+// The probes are sent by aslan, so the envs in the other clusters should be probed by addresses exposed out of the cluster.
+type HTTPProbe struct {
+	Name           string `bson:"name"                   json:"name"                  yaml:"name"`
+	URL            string `bson:"url"                    json:"url"                   yaml:"url"`
+	Method         string `bson:"method"                 json:"method"                yaml:"method"`
+	ExpectedStatus int    `bson:"expected_status"        json:"expected_status"       yaml:"expected_status"`
+}
+
+// HealthCheckScript is run by sh in a job pod in the namespace of the env, it passes when the script exits with 0.
+type HealthCheckScript struct {
+	Name   string `bson:"name"                   json:"name"                  yaml:"name"`
+	Image  string `bson:"image"                  json:"image"                 yaml:"image"`
+	Script string `bson:"script"                 json:"script"                yaml:"script"`
 }
 
 type ServiceAndImage struct {
@@ -153,10 +207,13 @@ type TestModule struct {
 }
 
 type BlueGreenDeployJobSpec struct {
-	ClusterID        string             `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
-	Namespace        string             `bson:"namespace"              json:"namespace"             yaml:"namespace"`
-	DockerRegistryID string             `bson:"docker_registry_id"     json:"docker_registry_id"    yaml:"docker_registry_id"`
-	Targets          []*BlueGreenTarget `bson:"targets"                json:"targets"               yaml:"targets"`
+	ClusterID        string `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
+	Namespace        string `bson:"namespace"              json:"namespace"             yaml:"namespace"`
+	DockerRegistryID string `bson:"docker_registry_id"     json:"docker_registry_id"    yaml:"docker_registry_id"`
+	// Env is the zadig env to deploy to, the cluster and namespace are taken from it when set,
+	// helm envs are not supported since the next upgrade would revert the switch.
+	Env     string             `bson:"env"                    json:"env"                   yaml:"env"`
+	Targets []*BlueGreenTarget `bson:"targets"                json:"targets"               yaml:"targets"`
 }
 
 type BlueGreenReleaseJobSpec struct {
@@ -177,10 +234,13 @@ type BlueGreenTarget struct {
 }
 
 type CanaryDeployJobSpec struct {
-	ClusterID        string          `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
-	Namespace        string          `bson:"namespace"              json:"namespace"             yaml:"namespace"`
-	DockerRegistryID string          `bson:"docker_registry_id"     json:"docker_registry_id"    yaml:"docker_registry_id"`
-	Targets          []*CanaryTarget `bson:"targets"                json:"targets"               yaml:"targets"`
+	ClusterID        string `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
+	Namespace        string `bson:"namespace"              json:"namespace"             yaml:"namespace"`
+	DockerRegistryID string `bson:"docker_registry_id"     json:"docker_registry_id"    yaml:"docker_registry_id"`
+	// Env is the zadig env to deploy to, the cluster and namespace are taken from it when set,
+	// helm envs are not supported since the next upgrade would revert the canary release.
+	Env     string          `bson:"env"                    json:"env"                   yaml:"env"`
+	Targets []*CanaryTarget `bson:"targets"                json:"targets"               yaml:"targets"`
 }
 
 type CanaryReleaseJobSpec struct {
@@ -200,6 +260,66 @@ type CanaryTarget struct {
 	WorkloadType  string `bson:"workload_type"          json:"workload_type"         yaml:"workload_type"`
 }
 
+type IstioCanaryJobSpec struct {
+	ClusterID        string `bson:"cluster_id"             json:"cluster_id"            yaml:"cluster_id"`
+	Namespace        string `bson:"namespace"              json:"namespace"             yaml:"namespace"`
+	DockerRegistryID string `bson:"docker_registry_id"     json:"docker_registry_id"    yaml:"docker_registry_id"`
+	// FromJob continues the canary started by another istio canary job, so that
+	// the traffic can be shifted again after the approval of a later stage.
+	FromJob string              `bson:"from_job"               json:"from_job"              yaml:"from_job"`
+	Steps   []*IstioCanaryStep  `bson:"steps"                  json:"steps"                 yaml:"steps"`
+	Headers []*IstioHeaderMatch `bson:"headers"                json:"headers"               yaml:"headers"`
+	// unit is minute.
+	DeployTimeout int64                `bson:"deploy_timeout"         json:"deploy_timeout"        yaml:"deploy_timeout"`
+	Targets       []*IstioCanaryTarget `bson:"targets"                json:"targets"               yaml:"targets"`
+}
+
+// IstioCanaryStep routes the percentage of traffic to the canary, then pauses before the next step.
+type IstioCanaryStep struct {
+	Weight int `bson:"weight"                 json:"weight"                yaml:"weight"`
+	// unit is minute.
+	Pause int64 `bson:"pause"                  json:"pause"                 yaml:"pause"`
+}
+
+// IstioHeaderMatch routes all the requests with the header to the canary, regardless of the weight.
+type IstioHeaderMatch struct {
+	Key string `bson:"key"                    json:"key"                   yaml:"key"`
+	// MatchType is one of exact, prefix and regex, exact by default.
+	MatchType string `bson:"match_type"             json:"match_type"            yaml:"match_type"`
+	Value     string `bson:"value"                  json:"value"                 yaml:"value"`
+}
+
+type IstioCanaryTarget struct {
+	K8sServiceName string `bson:"k8s_service_name"       json:"k8s_service_name"      yaml:"k8s_service_name"`
+	ContainerName  string `bson:"container_name"         json:"container_name"        yaml:"container_name"`
+	Image          string `bson:"image"                  json:"image"                 yaml:"image"`
+	WorkloadName   string `bson:"workload_name"          json:"workload_name"         yaml:"workload_name"`
+	WorkloadType   string `bson:"workload_type"          json:"workload_type"         yaml:"workload_type"`
+}
+
+type CanaryAnalysisJobSpec struct {
+	// FromJob is the canary or blue-green deploy job, which is rolled back when the analysis failed.
+	FromJob           string            `bson:"from_job"               json:"from_job"              yaml:"from_job"`
+	Rollback          bool              `bson:"rollback"               json:"rollback"              yaml:"rollback"`
+	PrometheusAddress string            `bson:"prometheus_address"     json:"prometheus_address"    yaml:"prometheus_address"`
+	PrometheusToken   string            `bson:"prometheus_token"       json:"prometheus_token"      yaml:"prometheus_token"`
+	Metrics           []*AnalysisMetric `bson:"metrics"                json:"metrics"               yaml:"metrics"`
+	// unit is second, the interval before each measurement.
+	Interval int64 `bson:"interval"               json:"interval"              yaml:"interval"`
+	Count    int   `bson:"count"                  json:"count"                 yaml:"count"`
+	// FailureLimit is the number of failed measurements tolerated.
+	FailureLimit int `bson:"failure_limit"          json:"failure_limit"         yaml:"failure_limit"`
+}
+
+// AnalysisMetric is measured by the PromQL query, which should result in a single value.
+type AnalysisMetric struct {
+	Name  string `bson:"name"                   json:"name"                  yaml:"name"`
+	Query string `bson:"query"                  json:"query"                 yaml:"query"`
+	// Condition is one of lt, lte, gt and gte.
+	Condition string  `bson:"condition"              json:"condition"             yaml:"condition"`
+	Threshold float64 `bson:"threshold"              json:"threshold"             yaml:"threshold"`
+}
+
 type JobProperties struct {
 	Timeout         int64               `bson:"timeout"                json:"timeout"               yaml:"timeout"`
 	Retry           int64               `bson:"retry"                  json:"retry"                 yaml:"retry"`
@@ -227,12 +347,15 @@ type JobProperties struct {
 type Step struct {
 	Name     string          `bson:"name"           json:"name"             yaml:"name"`
 	Timeout  int64           `bson:"timeout"        json:"timeout"          yaml:"timeout"`
+	RunIf    string          `bson:"run_if"         json:"run_if"           yaml:"run_if,omitempty"`
 	StepType config.StepType `bson:"type"           json:"type"             yaml:"type"`
 	Spec     interface{}     `bson:"spec"           json:"spec"             yaml:"spec"`
 }
 
 type Output struct {
-	Name        string `bson:"name"           json:"name"             yaml:"name"`
+	Name string `bson:"name"           json:"name"             yaml:"name"`
+	// Type is one of string, json and file, default string.
+	Type        string `bson:"type"           json:"type"             yaml:"type,omitempty"`
 	Description string `bson:"description"    json:"description"      yaml:"description"`
 }
 
@@ -247,6 +370,69 @@ type WorkflowV4Hook struct {
 	WorkflowArg         *WorkflowV4         `bson:"workflow_arg"              json:"workflow_arg"`
 }
 
+// GeneralHook triggers the workflow by the webhook of any outside system, the values picked from the payload
+// are set to the params of the workflow and the variables of its jobs.
+type GeneralHook struct {
+	Name        string                `bson:"name"                      json:"name"`
+	Enabled     bool                  `bson:"enabled"                   json:"enabled"`
+	Description string                `bson:"description,omitempty"     json:"description,omitempty"`
+	Secret      string                `bson:"secret"                    json:"secret"`
+	Filter      string                `bson:"filter,omitempty"          json:"filter,omitempty"`
+	Mappings    []*GeneralHookMapping `bson:"mappings"                  json:"mappings"`
+	WorkflowArg *WorkflowV4           `bson:"workflow_arg"              json:"workflow_arg"`
+}
+
+// GeneralHookMapping picks a value from the payload by the json path, e.g. $.resources[0].tag,
+// or renders the go template with the payload, and sets it to the workflow param named Key,
+// or to the variable Key of the job if JobName is set.
+type GeneralHookMapping struct {
+	JobName  string `bson:"job_name,omitempty"        json:"job_name,omitempty"`
+	Key      string `bson:"key"                       json:"key"`
+	Path     string `bson:"path,omitempty"            json:"path,omitempty"`
+	Template string `bson:"template,omitempty"        json:"template,omitempty"`
+	Default  string `bson:"default,omitempty"         json:"default,omitempty"`
+}
+
+// UpstreamHook triggers the workflow when a task of the upstream workflow, which may belong to another project,
+// finishes with one of the statuses.
+type UpstreamHook struct {
+	Name         string                 `bson:"name"                      json:"name"`
+	Enabled      bool                   `bson:"enabled"                   json:"enabled"`
+	Description  string                 `bson:"description,omitempty"     json:"description,omitempty"`
+	WorkflowName string                 `bson:"workflow_name"             json:"workflow_name"`
+	Statuses     []config.Status        `bson:"statuses"                  json:"statuses"`
+	Mappings     []*UpstreamHookMapping `bson:"mappings"                  json:"mappings"`
+	WorkflowArg  *WorkflowV4            `bson:"workflow_arg"              json:"workflow_arg"`
+}
+
+// UpstreamHookMapping renders Value with the variables of the upstream task, e.g. {{.job.build.output.VERSION}}
+// or {{.job.build.<service>.<service module>.IMAGE}}, and sets it to the workflow param named Key,
+// or to the variable Key of the job if JobName is set.
+type UpstreamHookMapping struct {
+	JobName string `bson:"job_name,omitempty"        json:"job_name,omitempty"`
+	Key     string `bson:"key"                       json:"key"`
+	Value   string `bson:"value"                     json:"value"`
+}
+
+// RegistryHook triggers the workflow when a tag matching TagRegex is pushed to the image repo of the registry,
+// by the notifications of harbor or docker distribution, or by polling the tags of the repo.
+// The new image is deployed to the service by the zadig deploy job named JobName.
+type RegistryHook struct {
+	Name          string      `bson:"name"                      json:"name"`
+	Enabled       bool        `bson:"enabled"                   json:"enabled"`
+	Description   string      `bson:"description,omitempty"     json:"description,omitempty"`
+	RegistryID    string      `bson:"registry_id"               json:"registry_id"`
+	Repo          string      `bson:"repo"                      json:"repo"`
+	TagRegex      string      `bson:"tag_regex,omitempty"       json:"tag_regex,omitempty"`
+	Secret        string      `bson:"secret"                    json:"secret"`
+	Polling       bool        `bson:"polling"                   json:"polling"`
+	JobName       string      `bson:"job_name"                  json:"job_name"`
+	ServiceName   string      `bson:"service_name"              json:"service_name"`
+	ServiceModule string      `bson:"service_module"            json:"service_module"`
+	PolledTags    []string    `bson:"polled_tags"               json:"-"`
+	WorkflowArg   *WorkflowV4 `bson:"workflow_arg"              json:"workflow_arg"`
+}
+
 type Param struct {
 	Name        string `bson:"name"             json:"name"             yaml:"name"`
 	Description string `bson:"description"      json:"description"      yaml:"description"`
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+// EnvServiceVersionRetention is the number of versions kept for a service in the env, the older ones are
+// removed when a new version is created.
+const EnvServiceVersionRetention = 20
+
+type EnvServiceVersionColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewEnvServiceVersionColl() *EnvServiceVersionColl {
+	name := models.EnvServiceVersion{}.TableName()
+	return &EnvServiceVersionColl{Collection: mongotool.Database(config.MongoDatabase()).Collection(name), coll: name}
+}
+
+func (c *EnvServiceVersionColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *EnvServiceVersionColl) EnsureIndex(ctx context.Context) error {
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "product_name", Value: 1},
+			bson.E{Key: "env_name", Value: 1},
+			bson.E{Key: "service_name", Value: 1},
+			bson.E{Key: "revision", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := c.Indexes().CreateOne(ctx, mod)
+
+	return err
+}
+
+// Create saves the version with the next revision of the env service.
+func (c *EnvServiceVersionColl) Create(args *models.EnvServiceVersion) error {
+	if args == nil {
+		return errors.New("nil env service version")
+	}
+
+	revision, err := NewCounterColl().GetNextSeq(fmt.Sprintf("envservice:%s:%s:%s", args.ProductName, args.EnvName, args.ServiceName))
+	if err != nil {
+		return err
+	}
+	args.Revision = revision
+	args.CreateTime = time.Now().Unix()
+
+	if _, err = c.InsertOne(context.TODO(), args); err != nil {
+		return err
+	}
+
+	if revision <= EnvServiceVersionRetention {
+		return nil
+	}
+	query := bson.M{
+		"product_name": args.ProductName,
+		"env_name":     args.EnvName,
+		"service_name": args.ServiceName,
+		"revision":     bson.M{"$lte": revision - EnvServiceVersionRetention},
+	}
+	_, err = c.DeleteMany(context.TODO(), query)
+	return err
+}
+
+// List returns the versions of the env service in pages, the latest first, and the total number of the versions.
+func (c *EnvServiceVersionColl) List(productName, envName, serviceName string, page, perPage int) ([]*models.EnvServiceVersion, int64, error) {
+	query := bson.M{"product_name": productName, "env_name": envName, "service_name": serviceName}
+
+	ctx := context.Background()
+	count, err := c.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var resp []*models.EnvServiceVersion
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	if page > 0 && perPage > 0 {
+		opts.SetSkip(int64((page - 1) * perPage)).SetLimit(int64(perPage))
+	}
+	cursor, err := c.Collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = cursor.All(ctx, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp, count, nil
+}
+
+// GetLatest returns the version deployed last, it returns mongo.ErrNoDocuments if there is no version.
+func (c *EnvServiceVersionColl) GetLatest(productName, envName, serviceName string) (*models.EnvServiceVersion, error) {
+	query := bson.M{"product_name": productName, "env_name": envName, "service_name": serviceName}
+
+	resp := new(models.EnvServiceVersion)
+	opts := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+	err := c.FindOne(context.TODO(), query, opts).Decode(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *EnvServiceVersionColl) Find(productName, envName, serviceName string, revision int64) (*models.EnvServiceVersion, error) {
+	query := bson.M{"product_name": productName, "env_name": envName, "service_name": serviceName, "revision": revision}
+
+	resp := new(models.EnvServiceVersion)
+	err := c.FindOne(context.TODO(), query).Decode(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DeleteByEnv removes all the versions of the env when it is deleted.
+func (c *EnvServiceVersionColl) DeleteByEnv(productName, envName string) error {
+	query := bson.M{"product_name": productName, "env_name": envName}
+	_, err := c.DeleteMany(context.TODO(), query)
+	return err
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+type IMAppColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewIMAppColl() *IMAppColl {
+	name := models.IMApp{}.TableName()
+	return &IMAppColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func (c *IMAppColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *IMAppColl) EnsureIndex(ctx context.Context) error {
+	return nil
+}
+
+func (c *IMAppColl) Create(ctx context.Context, args *models.IMApp) error {
+	if args == nil {
+		return errors.New("im app is nil")
+	}
+	args.UpdateTime = time.Now().Unix()
+
+	_, err := c.InsertOne(ctx, args)
+	return err
+}
+
+func (c *IMAppColl) List(ctx context.Context) ([]*models.IMApp, error) {
+	resp := make([]*models.IMApp, 0)
+	cursor, err := c.Collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &resp)
+	return resp, err
+}
+
+func (c *IMAppColl) GetByID(ctx context.Context, idString string) (*models.IMApp, error) {
+	id, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(models.IMApp)
+	err = c.FindOne(ctx, bson.M{"_id": id}).Decode(resp)
+	return resp, err
+}
+
+func (c *IMAppColl) Update(ctx context.Context, idString string, args *models.IMApp) error {
+	if args == nil {
+		return errors.New("im app is nil")
+	}
+	id, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		return err
+	}
+	args.ID = id
+	args.UpdateTime = time.Now().Unix()
+
+	_, err = c.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": args})
+	return err
+}
+
+func (c *IMAppColl) DeleteByID(ctx context.Context, idString string) error {
+	id, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+type IMUserBindingColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewIMUserBindingColl() *IMUserBindingColl {
+	name := models.IMUserBinding{}.TableName()
+	return &IMUserBindingColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func (c *IMUserBindingColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *IMUserBindingColl) EnsureIndex(ctx context.Context) error {
+	mod := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "im_app_id", Value: 1},
+			bson.E{Key: "im_user_id", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := c.Indexes().CreateOne(ctx, mod)
+	return err
+}
+
+func (c *IMUserBindingColl) Find(imAppID, imUserID string) (*models.IMUserBinding, error) {
+	resp := new(models.IMUserBinding)
+	query := bson.M{"im_app_id": imAppID, "im_user_id": imUserID}
+	err := c.FindOne(context.TODO(), query).Decode(resp)
+	return resp, err
+}
+
+// Upsert binds the IM user to the zadig user, the previous binding of the IM user is replaced.
+func (c *IMUserBindingColl) Upsert(args *models.IMUserBinding) error {
+	if args == nil {
+		return errors.New("im user binding is nil")
+	}
+	args.UpdateTime = time.Now().Unix()
+
+	query := bson.M{"im_app_id": args.IMAppID, "im_user_id": args.IMUserID}
+	change := bson.M{"$set": bson.M{
+		"user_id":     args.UserID,
+		"user_name":   args.UserName,
+		"update_time": args.UpdateTime,
+	}}
+	_, err := c.UpdateOne(context.TODO(), query, change, options.Update().SetUpsert(true))
+	return err
+}
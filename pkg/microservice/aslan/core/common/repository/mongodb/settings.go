@@ -79,6 +79,16 @@ func (c *SystemSettingColl) UpdateConcurrencySetting(workflowConcurrency, buildC
 	return err
 }
 
+func (c *SystemSettingColl) UpdateWorkflowQuota(quota *models.WorkflowQuota) error {
+	id, _ := primitive.ObjectIDFromHex(setting.LocalClusterID)
+	change := bson.M{"$set": bson.M{
+		"workflow_quota": quota,
+	}}
+	query := bson.M{"_id": id}
+	_, err := c.UpdateOne(context.TODO(), query, change)
+	return err
+}
+
 func (c *SystemSettingColl) InitSystemSettings() error {
 	_, err := c.Get()
 	// if we didn't find anything
@@ -19,6 +19,7 @@ package mongodb
 import (
 	"context"
 	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -124,3 +125,76 @@ func (c *WorkflowQueueColl) Update(args *models.WorkflowQueue) error {
 	_, err := c.UpdateOne(context.TODO(), query, change)
 	return err
 }
+
+// unownedQuery matches the tasks without owner, or whose owner has not renewed the lease in time.
+func unownedQuery(now int64) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"owner": bson.M{"$in": []interface{}{nil, ""}}},
+		{"lease_expire_time": bson.M{"$lt": now}},
+	}}
+}
+
+// Claim sets the status and the owner of the task if it is in one of the statuses and not held by another alive
+// owner, the check and the update are atomic, so only one aslan instance claims the task.
+func (c *WorkflowQueueColl) Claim(args *models.WorkflowQueue, statuses []config.Status, owner string, lease time.Duration) (bool, error) {
+	if args == nil {
+		return false, errors.New("nil workflow queue")
+	}
+
+	now := time.Now()
+	query := bson.M{
+		"task_id":       args.TaskID,
+		"workflow_name": args.WorkflowName,
+		"create_time":   args.CreateTime,
+		"status":        bson.M{"$in": statuses},
+	}
+	for k, v := range unownedQuery(now.Unix()) {
+		query[k] = v
+	}
+	change := bson.M{"$set": bson.M{
+		"status":            args.Status,
+		"owner":             owner,
+		"lease_expire_time": now.Add(lease).Unix(),
+	}}
+
+	res, err := c.UpdateOne(context.TODO(), query, change)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// Release sets the status of the task whose owner is gone, and removes the owner.
+func (c *WorkflowQueueColl) Release(args *models.WorkflowQueue, from config.Status) (bool, error) {
+	if args == nil {
+		return false, errors.New("nil workflow queue")
+	}
+
+	query := bson.M{
+		"task_id":       args.TaskID,
+		"workflow_name": args.WorkflowName,
+		"create_time":   args.CreateTime,
+		"status":        from,
+	}
+	for k, v := range unownedQuery(time.Now().Unix()) {
+		query[k] = v
+	}
+	change := bson.M{
+		"$set":   bson.M{"status": args.Status},
+		"$unset": bson.M{"owner": "", "lease_expire_time": ""},
+	}
+
+	res, err := c.UpdateOne(context.TODO(), query, change)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// RenewLease extends the leases of all the tasks held by the owner.
+func (c *WorkflowQueueColl) RenewLease(owner string, lease time.Duration) error {
+	query := bson.M{"owner": owner}
+	change := bson.M{"$set": bson.M{"lease_expire_time": time.Now().Add(lease).Unix()}}
+	_, err := c.UpdateMany(context.TODO(), query, change)
+	return err
+}
@@ -221,6 +221,91 @@ func (c *WorkflowTaskv4Coll) Update(idString string, obj *models.WorkflowTask) e
 	return err
 }
 
+// UpdateWithoutApproveUsers updates the task like Update, but leaves the approve
+// users of every stage untouched, since their decisions are written by
+// UpdateStageApproveUser concurrently.
+func (c *WorkflowTaskv4Coll) UpdateWithoutApproveUsers(idString string, obj *models.WorkflowTask) error {
+	if obj == nil {
+		return fmt.Errorf("nil object")
+	}
+	id, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		return fmt.Errorf("invalid id")
+	}
+	set, err := toBsonM(obj)
+	if err != nil {
+		return err
+	}
+	delete(set, "_id")
+	delete(set, "stages")
+	for i, stage := range obj.Stages {
+		stageSet, err := toBsonM(stage)
+		if err != nil {
+			return err
+		}
+		delete(stageSet, "approval")
+		for key, value := range stageSet {
+			set[fmt.Sprintf("stages.%d.%s", i, key)] = value
+		}
+		if stage.Approval == nil {
+			set[fmt.Sprintf("stages.%d.approval", i)] = nil
+			continue
+		}
+		approval, err := toBsonM(stage.Approval)
+		if err != nil {
+			return err
+		}
+		delete(approval, "approve_users")
+		for key, value := range approval {
+			set[fmt.Sprintf("stages.%d.approval.%s", i, key)] = value
+		}
+	}
+
+	_, err = c.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+func toBsonM(obj interface{}) (bson.M, error) {
+	data, err := bson.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	res := bson.M{}
+	if err := bson.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateStageApproveUser records the decision of an approve user, it only
+// succeeds when the user has not approved or rejected the stage yet.
+func (c *WorkflowTaskv4Coll) UpdateStageApproveUser(workflowName string, taskID int64, stageIndex, userIndex int, user *models.User) error {
+	if user == nil {
+		return fmt.Errorf("nil approve user")
+	}
+	userKey := fmt.Sprintf("stages.%d.approval.approve_users.%d", stageIndex, userIndex)
+	query := bson.M{
+		"workflow_name":                workflowName,
+		"task_id":                      taskID,
+		userKey + ".user_id":           user.UserID,
+		userKey + ".reject_or_approve": "",
+	}
+	change := bson.M{"$set": bson.M{
+		userKey + ".reject_or_approve": user.RejectOrApprove,
+		userKey + ".comment":           user.Comment,
+		userKey + ".operation_time":    user.OperationTime,
+	}}
+
+	res, err := c.UpdateOne(context.TODO(), query, change)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s has approved or rejected already", user.UserName)
+	}
+	return nil
+}
+
 func (c *WorkflowTaskv4Coll) DeleteByWorkflowName(workflowName string) error {
 	query := bson.M{"workflow_name": workflowName}
 	change := bson.M{"$set": bson.M{
@@ -42,6 +42,10 @@ type ListWorkflowV4Option struct {
 	ProjectName string
 	DisplayName string
 	Names       []string
+	// Upstream lists the workflows triggered by the tasks of the upstream workflow.
+	Upstream string
+	// RegistryPolling lists the workflows polling the registries for new tags.
+	RegistryPolling bool
 }
 
 func NewWorkflowV4Coll() *WorkflowV4Coll {
@@ -157,6 +161,12 @@ func (c *WorkflowV4Coll) List(opt *ListWorkflowV4Option, pageNum, pageSize int64
 	if len(opt.Names) > 0 {
 		query["name"] = bson.M{"$in": opt.Names}
 	}
+	if opt.Upstream != "" {
+		query["upstream_hooks.workflow_name"] = opt.Upstream
+	}
+	if opt.RegistryPolling {
+		query["registry_hooks.polling"] = true
+	}
 	count, err := c.CountDocuments(context.TODO(), query)
 	if err != nil {
 		return nil, count, err
@@ -222,6 +232,38 @@ func (c *WorkflowV4Coll) Update(idString string, obj *models.WorkflowV4) error {
 	return err
 }
 
+// InitRegistryHookPolledTags saves the tags polled by the registry hook for the first time, nothing is changed if
+// the tags have been saved by another poller.
+func (c *WorkflowV4Coll) InitRegistryHookPolledTags(workflowName, hookName string, tags []string) error {
+	filter := bson.M{"name": workflowName, "registry_hooks": bson.M{"$elemMatch": bson.M{"name": hookName, "polled_tags": nil}}}
+	update := bson.M{"$set": bson.M{"registry_hooks.$.polled_tags": tags}}
+
+	_, err := c.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// ClaimRegistryHookPolledTag adds the tag to the polled tags of the registry hook, which must have been polled before.
+// It returns false if the tag has been added by another poller or notification, so every tag is deployed once.
+func (c *WorkflowV4Coll) ClaimRegistryHookPolledTag(workflowName, hookName, tag string) (bool, error) {
+	filter := bson.M{"name": workflowName, "registry_hooks": bson.M{"$elemMatch": bson.M{"name": hookName, "polled_tags": bson.M{"$type": "array"}}}}
+	update := bson.M{"$addToSet": bson.M{"registry_hooks.$.polled_tags": tag}}
+
+	res, err := c.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// RemoveRegistryHookPolledTags removes the tags which are no longer in the registry from the polled tags of the registry hook.
+func (c *WorkflowV4Coll) RemoveRegistryHookPolledTags(workflowName, hookName string, tags []string) error {
+	filter := bson.M{"name": workflowName, "registry_hooks.name": hookName}
+	update := bson.M{"$pull": bson.M{"registry_hooks.$.polled_tags": bson.M{"$in": tags}}}
+
+	_, err := c.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
 func (c *WorkflowV4Coll) DeleteByID(idString string) error {
 	id, err := primitive.ObjectIDFromHex(idString)
 	if err != nil {
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucketserver
+
+import (
+	"strconv"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	gitservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/git"
+	"github.com/koderover/zadig/pkg/tool/bitbucketserver"
+)
+
+type Client struct {
+	*bitbucketserver.Client
+}
+
+func NewClient(address, accessToken, proxyAddress string, enableProxy bool) *Client {
+	return &Client{
+		Client: bitbucketserver.NewClient(address, accessToken, proxyAddress, enableProxy),
+	}
+}
+
+func (c *Client) CreateWebHook(owner, repo string) (string, error) {
+	hook, err := c.CreateWebhook(owner, repo, &bitbucketserver.Webhook{
+		Name: "zadig",
+		URL:  config.WebHookURL(),
+		Events: []string{
+			string(bitbucketserver.EventTypeRefsChanged),
+			string(bitbucketserver.EventTypePROpened),
+			string(bitbucketserver.EventTypePRFromRefUpdated),
+		},
+		Configuration: map[string]string{"secret": gitservice.GetHookSecret()},
+		Active:        true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(hook.ID), nil
+}
+
+func (c *Client) DeleteWebHook(owner, repo, hookID string) error {
+	id, err := strconv.Atoi(hookID)
+	if err != nil {
+		return err
+	}
+	return c.DeleteWebhook(owner, repo, id)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"strconv"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	gitservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/git"
+	"github.com/koderover/zadig/pkg/tool/gitea"
+)
+
+type Client struct {
+	*gitea.Client
+}
+
+func NewClient(address, accessToken, proxyAddress string, enableProxy bool) *Client {
+	return &Client{
+		Client: gitea.NewClient(address, accessToken, proxyAddress, enableProxy),
+	}
+}
+
+func (c *Client) CreateWebHook(owner, repo string) (string, error) {
+	hook, err := c.CreateHook(owner, repo, &gitea.Hook{
+		Type: "gitea",
+		Config: map[string]string{
+			"url":          config.WebHookURL(),
+			"content_type": "json",
+			"secret":       gitservice.GetHookSecret(),
+		},
+		Events: []string{"push", "pull_request"},
+		Active: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(hook.ID, 10), nil
+}
+
+func (c *Client) DeleteWebHook(owner, repo, hookID string) error {
+	id, err := strconv.ParseInt(hookID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return c.DeleteHook(owner, repo, id)
+}
@@ -29,7 +29,7 @@ func (c *Client) CreateWebHook(owner, repo string) (string, error) {
 	hook, err := c.CreateHook(context.TODO(), owner, repo, &git.Hook{
 		URL:    config.WebHookURL(),
 		Secret: gitservice.GetHookSecret(),
-		Events: []string{git.PushEvent, git.PullRequestEvent, git.BranchOrTagCreateEvent, git.CheckRunEvent},
+		Events: []string{git.PushEvent, git.PullRequestEvent, git.BranchOrTagCreateEvent, git.CheckRunEvent, git.CommentEvent},
 	})
 	if err != nil {
 		return "", err
@@ -0,0 +1,206 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+const (
+	// ApproveActionKey is the key of the signed action token in the values of the card buttons.
+	ApproveActionKey = "action"
+	// imUserTokenExpiration is how long an IM user has to bind the zadig account after clicking an approval button.
+	imUserTokenExpiration = 30 * time.Minute
+)
+
+// ApproveAction is the decision carried by an approval button, it is signed so that the callbacks can not forge it.
+type ApproveAction struct {
+	WorkflowName string `json:"workflow_name"`
+	StageName    string `json:"stage_name"`
+	TaskID       int64  `json:"task_id"`
+	Approve      bool   `json:"approve"`
+	ExpireTime   int64  `json:"expire_time"`
+}
+
+// IMUserToken proves the IM user verified by the callback when the user binds the zadig account.
+type IMUserToken struct {
+	IMAppID    string `json:"im_app_id"`
+	IMUserID   string `json:"im_user_id"`
+	ExpireTime int64  `json:"expire_time"`
+}
+
+func NewApproveActionToken(workflowName, stageName string, taskID int64, approve bool, expiration time.Duration) (string, error) {
+	return signToken(&ApproveAction{
+		WorkflowName: workflowName,
+		StageName:    stageName,
+		TaskID:       taskID,
+		Approve:      approve,
+		ExpireTime:   time.Now().Add(expiration).Unix(),
+	})
+}
+
+func ParseApproveActionToken(token string) (*ApproveAction, error) {
+	action := &ApproveAction{}
+	if err := parseToken(token, action); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > action.ExpireTime {
+		return nil, errors.New("approve action is expired")
+	}
+	return action, nil
+}
+
+func NewIMUserToken(imAppID, imUserID string) (string, error) {
+	return signToken(&IMUserToken{
+		IMAppID:    imAppID,
+		IMUserID:   imUserID,
+		ExpireTime: time.Now().Add(imUserTokenExpiration).Unix(),
+	})
+}
+
+func ParseIMUserToken(token string) (*IMUserToken, error) {
+	imUser := &IMUserToken{}
+	if err := parseToken(token, imUser); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > imUser.ExpireTime {
+		return nil, errors.New("im user token is expired")
+	}
+	return imUser, nil
+}
+
+// signToken encodes the payload as base64 json followed by its HMAC-SHA256 signed with the secret key of zadig.
+func signToken(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + tokenSignature(encoded), nil
+}
+
+func parseToken(token string, payload interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(tokenSignature(parts[0]))) {
+		return errors.New("invalid token signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, payload)
+}
+
+func tokenSignature(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(configbase.SecretKey()))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GetIMApproveCallbackURL is the endpoint receiving the callbacks of the approval cards sent by the IM app.
+func GetIMApproveCallbackURL(imAppID string) string {
+	return fmt.Sprintf("%s/api/aslan/workflow/v4/workflowtask/approve/callback/%s", configbase.SystemAddress(), imAppID)
+}
+
+// sendApproveCard sends the approval notification with buttons to approve or reject the stage, the clicks are
+// sent to the callback of the IM app, which records the decision for the zadig user bound to the IM user.
+func (w *Service) sendApproveCard(notify *models.NotifyCtl, title, content string, larkCard *LarkCard, task *models.WorkflowTask, stageName string) error {
+	expiration := 60 * time.Minute
+	for _, stage := range task.Stages {
+		if stage.Name == stageName && stage.Approval != nil && stage.Approval.Timeout > 0 {
+			expiration = time.Duration(stage.Approval.Timeout) * time.Minute
+		}
+	}
+	approveToken, err := NewApproveActionToken(task.WorkflowName, stageName, task.TaskID, true, expiration)
+	if err != nil {
+		return err
+	}
+	rejectToken, err := NewApproveActionToken(task.WorkflowName, stageName, task.TaskID, false, expiration)
+	if err != nil {
+		return err
+	}
+
+	switch notify.WebHookType {
+	case feiShuType:
+		larkCard.AddI18NElementsZhcnCallbackActions([]*Action{
+			{
+				Tag:   feishuTagButton,
+				Text:  TextElem{Content: "通过", Tag: feiShuTagText},
+				Type:  "primary",
+				Value: map[string]string{ApproveActionKey: approveToken},
+			},
+			{
+				Tag:   feishuTagButton,
+				Text:  TextElem{Content: "拒绝", Tag: feiShuTagText},
+				Type:  "danger",
+				Value: map[string]string{ApproveActionKey: rejectToken},
+			},
+		})
+		return w.sendFeishuMessage(notify.FeiShuWebHook, larkCard)
+	case slackType:
+		message := newSlackMessage(title, content)
+		message.Blocks = append(message.Blocks, &SlackBlock{
+			Type: "actions",
+			Elements: []*SlackElement{
+				{
+					Type:     "button",
+					Text:     &SlackText{Type: "plain_text", Text: "Approve"},
+					ActionID: "approve",
+					Value:    approveToken,
+					Style:    "primary",
+				},
+				{
+					Type:     "button",
+					Text:     &SlackText{Type: "plain_text", Text: "Reject"},
+					ActionID: "reject",
+					Value:    rejectToken,
+					Style:    "danger",
+				},
+			},
+		})
+		_, err := w.SendMessageRequest(notify.SlackWebHook, message)
+		return err
+	case dingDingType:
+		callbackURL := GetIMApproveCallbackURL(notify.IMAppID)
+		message := &DingDingActionCardMessage{
+			MsgType: "actionCard",
+			ActionCard: &DingDingActionCard{
+				Title:          plainTitle(title),
+				Text:           content,
+				BtnOrientation: "1",
+				Btns: []*DingDingActionCardButton{
+					{Title: "通过", ActionURL: callbackURL + "?" + url.Values{ApproveActionKey: {approveToken}}.Encode()},
+					{Title: "拒绝", ActionURL: callbackURL + "?" + url.Values{ApproveActionKey: {rejectToken}}.Encode()},
+				},
+			},
+		}
+		_, err := w.SendMessageRequest(notify.DingDingWebHook, message)
+		return err
+	}
+	return w.sendNotification(title, content, notify, larkCard, task)
+}
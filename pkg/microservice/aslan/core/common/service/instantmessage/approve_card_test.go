@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing approve card tokens", func() {
+
+	BeforeEach(func() {
+		viper.Set(setting.ENVSecretKey, "secret")
+	})
+
+	Context("approve action token", func() {
+		It("should parse the signed action", func() {
+			token, err := NewApproveActionToken("workflow", "stage", 3, true, time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			action, err := ParseApproveActionToken(token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(action.WorkflowName).To(Equal("workflow"))
+			Expect(action.StageName).To(Equal("stage"))
+			Expect(action.TaskID).To(Equal(int64(3)))
+			Expect(action.Approve).To(BeTrue())
+		})
+		It("should reject the expired action", func() {
+			token, err := NewApproveActionToken("workflow", "stage", 3, true, -time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = ParseApproveActionToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject the action with a forged payload", func() {
+			token, err := NewApproveActionToken("workflow", "stage", 3, false, time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			forged, err := signToken(&ApproveAction{WorkflowName: "workflow", StageName: "stage", TaskID: 3, Approve: true, ExpireTime: time.Now().Add(time.Minute).Unix()})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = ParseApproveActionToken(strings.Split(forged, ".")[0] + "." + strings.Split(token, ".")[1])
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject the action signed with another secret key", func() {
+			token, err := NewApproveActionToken("workflow", "stage", 3, true, time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			viper.Set(setting.ENVSecretKey, "another")
+			_, err = ParseApproveActionToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject malformed tokens", func() {
+			_, err := ParseApproveActionToken("malformed")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("im user token", func() {
+		It("should parse the signed im user", func() {
+			token, err := NewIMUserToken("app", "user")
+			Expect(err).NotTo(HaveOccurred())
+			imUser, err := ParseIMUserToken(token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imUser.IMAppID).To(Equal("app"))
+			Expect(imUser.IMUserID).To(Equal("user"))
+		})
+		It("should reject the expired im user", func() {
+			token, err := signToken(&IMUserToken{IMAppID: "app", IMUserID: "user", ExpireTime: time.Now().Add(-time.Minute).Unix()})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = ParseIMUserToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -26,6 +26,23 @@ type DingDingMessage struct {
 	At       *DingDingAt       `json:"at"`
 }
 
+type DingDingActionCardMessage struct {
+	MsgType    string              `json:"msgtype"`
+	ActionCard *DingDingActionCard `json:"actionCard"`
+}
+
+type DingDingActionCard struct {
+	Title          string                      `json:"title"`
+	Text           string                      `json:"text"`
+	BtnOrientation string                      `json:"btnOrientation"`
+	Btns           []*DingDingActionCardButton `json:"btns"`
+}
+
+type DingDingActionCardButton struct {
+	Title     string `json:"title"`
+	ActionURL string `json:"actionURL"`
+}
+
 type DingDingMarkDown struct {
 	Title string `json:"title"`
 	Text  string `json:"text"`
@@ -0,0 +1,243 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	emailmongodb "github.com/koderover/zadig/pkg/microservice/systemconfig/core/email/repository/mongodb"
+	userclient "github.com/koderover/zadig/pkg/shared/client/user"
+	"github.com/koderover/zadig/pkg/tool/log"
+	"github.com/koderover/zadig/pkg/tool/mail"
+)
+
+const emailType = "email"
+
+//go:embed workflow_task_email.html
+var workflowTaskEmailTemplate string
+
+//go:embed workflow_approve_email.html
+var workflowApproveEmailTemplate string
+
+type workflowTaskEmail struct {
+	Title     string
+	Task      *models.WorkflowTask
+	StartTime string
+	Duration  string
+	Jobs      []*jobTaskEmail
+	DetailURL string
+}
+
+type jobTaskEmail struct {
+	Name   string
+	Type   string
+	Status string
+}
+
+type workflowApproveEmail struct {
+	UserName    string
+	StageName   string
+	Description string
+	Task        *models.WorkflowTask
+	StartTime   string
+	ApproveURL  string
+	RejectURL   string
+}
+
+// sendWorkflowTaskEmail sends the summary of the task to every recipient.
+func (w *Service) sendWorkflowTaskEmail(recipients []string, title string, task *models.WorkflowTask) error {
+	recipients = emailRecipients(recipients)
+	if len(recipients) == 0 {
+		return errors.New("email recipients are empty")
+	}
+	args := newWorkflowTaskEmail(title, task)
+	body, err := renderEmail(workflowTaskEmailTemplate, args)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := sendEmail(recipient, args.Title, body); err != nil {
+			log.Errorf("failed to send workflow task email to %s, err: %s", recipient, err)
+		}
+	}
+	return nil
+}
+
+// emailRecipients drops the blank and duplicated addresses.
+func emailRecipients(recipients []string) []string {
+	ret := []string{}
+	seen := sets.NewString()
+	for _, recipient := range recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" || seen.Has(recipient) {
+			continue
+		}
+		seen.Insert(recipient)
+		ret = append(ret, recipient)
+	}
+	return ret
+}
+
+func newWorkflowTaskEmail(title string, task *models.WorkflowTask) *workflowTaskEmail {
+	workflowNotification := &workflowTaskNotification{
+		Task:        task,
+		BaseURI:     configbase.SystemAddress(),
+		WebHookType: emailType,
+		TotalTime:   time.Now().Unix() - task.StartTime,
+	}
+	args := &workflowTaskEmail{
+		Title:     plainTitle(title),
+		Task:      task,
+		DetailURL: getWorkflowTaskDetailURL(task),
+	}
+	args.StartTime, _ = getWorkflowTaskTplExec("{{ getStartTime .Task.StartTime}}", workflowNotification)
+	args.Duration, _ = getWorkflowTaskTplExec("{{ getDuration .TotalTime}}", workflowNotification)
+	for _, stage := range task.Stages {
+		for _, job := range stage.Jobs {
+			jobNotification := &jobTaskNotification{Job: job, WebHookType: emailType}
+			jobEmail := &jobTaskEmail{Name: job.Name}
+			jobEmail.Type, _ = getJobTaskTplExec("{{jobType .Job.JobType }}", jobNotification)
+			jobEmail.Status, _ = getJobTaskTplExec("{{taskStatus .Job.Status }}", jobNotification)
+			args.Jobs = append(args.Jobs, jobEmail)
+		}
+	}
+	return args
+}
+
+// sendApproveEmails sends every approver who has not made a decision a personal email with the links to approve or reject.
+func (w *Service) sendApproveEmails(task *models.WorkflowTask, stageName string) error {
+	approval, approvers := pendingApprovers(task, stageName)
+	if len(approvers) == 0 {
+		return nil
+	}
+	uids := []string{}
+	userNames := map[string]string{}
+	for _, user := range approvers {
+		uids = append(uids, user.UserID)
+		userNames[user.UserID] = user.UserName
+	}
+	users, err := userclient.New().ListUsers(&userclient.SearchArgs{UIDs: uids})
+	if err != nil {
+		return fmt.Errorf("failed to list approve users, err: %s", err)
+	}
+
+	subject := fmt.Sprintf("工作流 %s #%d 等待审批", task.WorkflowName, task.TaskID)
+	for _, user := range users {
+		if user.Email == "" {
+			log.Warnf("approve user %s has no email", user.Account)
+			continue
+		}
+		body, err := renderApproveEmail(task, stageName, approval, userNames[user.UID])
+		if err != nil {
+			return err
+		}
+		if err := sendEmail(user.Email, subject, body); err != nil {
+			log.Errorf("failed to send approve email to %s, err: %s", user.Email, err)
+		}
+	}
+	return nil
+}
+
+// pendingApprovers returns the enabled approval of the stage and the approvers who have not made a decision.
+func pendingApprovers(task *models.WorkflowTask, stageName string) (*models.Approval, []*models.User) {
+	var approval *models.Approval
+	for _, stage := range task.Stages {
+		if stage.Name == stageName {
+			approval = stage.Approval
+		}
+	}
+	if approval == nil || !approval.Enabled {
+		return nil, nil
+	}
+	approvers := []*models.User{}
+	for _, user := range approval.ApproveUsers {
+		if user.RejectOrApprove != "" {
+			continue
+		}
+		approvers = append(approvers, user)
+	}
+	return approval, approvers
+}
+
+func renderApproveEmail(task *models.WorkflowTask, stageName string, approval *models.Approval, userName string) (string, error) {
+	workflowNotification := &workflowTaskNotification{Task: task, WebHookType: emailType}
+	startTime, _ := getWorkflowTaskTplExec("{{ getStartTime .Task.StartTime}}", workflowNotification)
+	return renderEmail(workflowApproveEmailTemplate, &workflowApproveEmail{
+		UserName:    userName,
+		StageName:   stageName,
+		Description: approval.Description,
+		Task:        task,
+		StartTime:   startTime,
+		ApproveURL:  getWorkflowTaskApproveURL(task, stageName, true),
+		RejectURL:   getWorkflowTaskApproveURL(task, stageName, false),
+	})
+}
+
+func getWorkflowTaskDetailURL(task *models.WorkflowTask) string {
+	return fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d", configbase.SystemAddress(), task.ProjectName, task.WorkflowName, task.TaskID)
+}
+
+// getWorkflowTaskApproveURL links to the task page, which asks the user to confirm the decision on the stage.
+func getWorkflowTaskApproveURL(task *models.WorkflowTask, stageName string, approve bool) string {
+	v := url.Values{}
+	v.Add("approve_stage", stageName)
+	v.Add("approve", fmt.Sprintf("%t", approve))
+	return getWorkflowTaskDetailURL(task) + "?" + v.Encode()
+}
+
+func renderEmail(tpl string, args interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New("email").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, args); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func sendEmail(to, subject, body string) error {
+	email, err := emailmongodb.NewEmailHostColl().Find()
+	if err != nil {
+		return fmt.Errorf("failed to find email host, err: %s", err)
+	}
+	if email == nil {
+		return errors.New("email host is not configured")
+	}
+	return mail.SendEmail(&mail.EmailParams{
+		From:     email.Username,
+		To:       to,
+		Subject:  subject,
+		Host:     email.Name,
+		UserName: email.Username,
+		Password: email.Password,
+		Port:     email.Port,
+		Body:     body,
+	})
+}
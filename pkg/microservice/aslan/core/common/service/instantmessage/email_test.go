@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing email", func() {
+
+	var task *models.WorkflowTask
+
+	BeforeEach(func() {
+		viper.Set(setting.ENVSystemAddress, "https://zadig.example.com")
+		task = &models.WorkflowTask{
+			TaskID:       3,
+			WorkflowName: "release",
+			ProjectName:  "demo",
+			TaskCreator:  "alice",
+			StartTime:    time.Now().Add(-time.Minute).Unix(),
+			Stages: []*models.StageTask{
+				{
+					Name: "build",
+					Jobs: []*models.JobTask{
+						{Name: "build-app", JobType: string(config.JobZadigBuild), Status: config.StatusPassed},
+						{Name: "run-script", JobType: string(config.JobFreestyle), Status: config.StatusFailed},
+					},
+				},
+				{
+					Name: "deploy",
+					Approval: &models.Approval{
+						Enabled:     true,
+						Description: "check the <changelog>",
+						ApproveUsers: []*models.User{
+							{UserID: "u1", UserName: "bob"},
+							{UserID: "u2", UserName: "carol", RejectOrApprove: config.Approve},
+							{UserID: "u3", UserName: "dave"},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		viper.Set(setting.ENVSystemAddress, "")
+	})
+
+	Context("emailRecipients", func() {
+		It("should drop the blank and duplicated addresses", func() {
+			Expect(emailRecipients([]string{" a@example.com", "", "b@example.com", "a@example.com ", "  "})).To(Equal([]string{"a@example.com", "b@example.com"}))
+			Expect(emailRecipients(nil)).To(BeEmpty())
+		})
+	})
+
+	Context("workflow task email", func() {
+		It("should render the summary of the task", func() {
+			args := newWorkflowTaskEmail("### 工作流 release #3 执行失败", task)
+			Expect(args.Title).To(Equal("工作流 release #3 执行失败"))
+			Expect(args.DetailURL).To(Equal("https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3"))
+			Expect(args.StartTime).To(Equal(time.Unix(task.StartTime, 0).Format("2006-01-02 15:04:05")))
+			Expect(args.Jobs).To(Equal([]*jobTaskEmail{
+				{Name: "build-app", Type: "构建", Status: "执行成功"},
+				{Name: "run-script", Type: "通用任务", Status: "执行失败"},
+			}))
+
+			body, err := renderEmail(workflowTaskEmailTemplate, args)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(ContainSubstring("工作流 release #3 执行失败"))
+			Expect(body).To(ContainSubstring("执行用户：alice"))
+			Expect(body).To(ContainSubstring("构建：build-app"))
+			Expect(body).To(ContainSubstring("状态：执行失败"))
+			Expect(body).To(ContainSubstring(`href="https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3"`))
+		})
+		It("should escape the content of the task", func() {
+			task.TaskCreator = "<script>alert(1)</script>"
+			body, err := renderEmail(workflowTaskEmailTemplate, newWorkflowTaskEmail("title", task))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).NotTo(ContainSubstring("<script>"))
+			Expect(body).To(ContainSubstring("&lt;script&gt;"))
+		})
+	})
+
+	Context("approve email", func() {
+		It("should find the approvers who have not made a decision", func() {
+			approval, approvers := pendingApprovers(task, "deploy")
+			Expect(approval).To(Equal(task.Stages[1].Approval))
+			Expect(approvers).To(HaveLen(2))
+			Expect(approvers[0].UserName).To(Equal("bob"))
+			Expect(approvers[1].UserName).To(Equal("dave"))
+		})
+		It("should find no approvers of the stage without an enabled approval", func() {
+			_, approvers := pendingApprovers(task, "build")
+			Expect(approvers).To(BeEmpty())
+
+			task.Stages[1].Approval.Enabled = false
+			_, approvers = pendingApprovers(task, "deploy")
+			Expect(approvers).To(BeEmpty())
+		})
+		It("should link to the decisions on the stage", func() {
+			Expect(getWorkflowTaskApproveURL(task, "deploy", true)).To(Equal("https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3?approve=true&approve_stage=deploy"))
+			Expect(getWorkflowTaskApproveURL(task, "deploy", false)).To(Equal("https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3?approve=false&approve_stage=deploy"))
+		})
+		It("should render the personal approve email", func() {
+			body, err := renderApproveEmail(task, "deploy", task.Stages[1].Approval, "bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(ContainSubstring("hi bob，您好"))
+			Expect(body).To(ContainSubstring("工作流 release #3 的阶段 deploy 等待您的审批。"))
+			Expect(body).To(ContainSubstring("审批说明：check the &lt;changelog&gt;"))
+			Expect(body).To(ContainSubstring(`href="https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3?approve=true&amp;approve_stage=deploy"`))
+			Expect(body).To(ContainSubstring(`href="https://zadig.example.com/v1/projects/detail/demo/pipelines/custom/release/3?approve=false&amp;approve_stage=deploy"`))
+		})
+		It("should leave out the empty description", func() {
+			task.Stages[1].Approval.Description = ""
+			body, err := renderApproveEmail(task, "deploy", task.Stages[1].Approval, "bob")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).NotTo(ContainSubstring("审批说明"))
+		})
+	})
+})
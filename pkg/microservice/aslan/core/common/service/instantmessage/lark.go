@@ -72,10 +72,11 @@ type Field struct {
 }
 
 type Action struct {
-	Tag  string   `json:"tag"`
-	Text TextElem `json:"text"`
-	Type string   `json:"type"`
-	URL  string   `json:"url"`
+	Tag   string            `json:"tag"`
+	Text  TextElem          `json:"text"`
+	Type  string            `json:"type"`
+	URL   string            `json:"url,omitempty"`
+	Value map[string]string `json:"value,omitempty"`
 }
 
 type ZhCn struct {
@@ -179,6 +180,20 @@ func (lc *LarkCard) AddI18NElementsZhcnAction(content, url string) {
 	lc.I18NElements.ZhCn = append(lc.I18NElements.ZhCn, zhcnElem)
 }
 
+// AddI18NElementsZhcnCallbackActions adds the buttons whose values are sent to the callback of the lark app when clicked.
+func (lc *LarkCard) AddI18NElementsZhcnCallbackActions(actions []*Action) {
+	if lc.I18NElements == nil {
+		lc.I18NElements = &I18NElements{
+			ZhCn: make([]*ZhCn, 0),
+		}
+	}
+	zhcnElem := &ZhCn{
+		Actions: actions,
+		Tag:     feishuTagAction,
+	}
+	lc.I18NElements.ZhCn = append(lc.I18NElements.ZhCn, zhcnElem)
+}
+
 func (w *Service) sendFeishuMessage(uri string, lcMsg *LarkCard) error {
 	message := LarkCardReq{
 		MsgType: feishuCardType,
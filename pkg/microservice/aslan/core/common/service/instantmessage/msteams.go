@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"strings"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+)
+
+const (
+	msTeamsType             = "msteams"
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+)
+
+type MSTeamsMessage struct {
+	Type        string               `json:"type"`
+	Attachments []*MSTeamsAttachment `json:"attachments"`
+}
+
+type MSTeamsAttachment struct {
+	ContentType string        `json:"contentType"`
+	Content     *AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string                `json:"$schema"`
+	Type    string                `json:"type"`
+	Version string                `json:"version"`
+	Body    []*AdaptiveCardBlock  `json:"body"`
+	Actions []*AdaptiveCardAction `json:"actions,omitempty"`
+}
+
+type AdaptiveCardBlock struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Wrap      bool   `json:"wrap"`
+	Size      string `json:"size,omitempty"`
+	Weight    string `json:"weight,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Separator bool   `json:"separator,omitempty"`
+}
+
+type AdaptiveCardAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func (w *Service) sendMSTeamsMessage(uri, title, content string, status config.Status) error {
+	_, err := w.SendMessageRequest(uri, newMSTeamsMessage(title, content, status))
+	return err
+}
+
+// newMSTeamsMessage converts the markdown notification to adaptive card, every line of the content is a text block
+// since teams ignores single line breaks, and a paragraph of a single link is converted to an action.
+func newMSTeamsMessage(title, content string, status config.Status) *MSTeamsMessage {
+	card := &AdaptiveCard{
+		Schema:  adaptiveCardSchema,
+		Type:    "AdaptiveCard",
+		Version: adaptiveCardVersion,
+		Body: []*AdaptiveCardBlock{{
+			Type:   "TextBlock",
+			Text:   plainTitle(title),
+			Wrap:   true,
+			Size:   "Large",
+			Weight: "Bolder",
+			Color:  getAdaptiveCardColorWithStatus(status),
+		}},
+	}
+	for _, paragraph := range markdownParagraphs(content) {
+		if link := markdownButtonRegex.FindStringSubmatch(paragraph); link != nil {
+			card.Actions = append(card.Actions, &AdaptiveCardAction{
+				Type:  "Action.OpenUrl",
+				Title: link[1],
+				URL:   link[2],
+			})
+			continue
+		}
+		for idx, line := range strings.Split(paragraph, "\n") {
+			card.Body = append(card.Body, &AdaptiveCardBlock{
+				Type:      "TextBlock",
+				Text:      strings.TrimSpace(line),
+				Wrap:      true,
+				Separator: idx == 0,
+			})
+		}
+	}
+	return &MSTeamsMessage{
+		Type: "message",
+		Attachments: []*MSTeamsAttachment{{
+			ContentType: adaptiveCardContentType,
+			Content:     card,
+		}},
+	}
+}
+
+func getAdaptiveCardColorWithStatus(status config.Status) string {
+	switch status {
+	case config.StatusPassed:
+		return "Good"
+	case config.StatusFailed, config.StatusTimeout, config.StatusReject:
+		return "Attention"
+	case config.StatusCancelled:
+		return "Warning"
+	}
+	return "Default"
+}
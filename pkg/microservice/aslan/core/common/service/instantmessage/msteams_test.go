@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+)
+
+var _ = Describe("Testing ms teams message", func() {
+
+	It("converts the lines to text blocks and the single link to an action", func() {
+		content := "## workflow-1 #1 failed\n\n" +
+			"**Project**: demo\n**Creator**: admin\n\n" +
+			"---\n\n" +
+			"[Click for details](http://zadig.example.com/task/1)"
+		message := newMSTeamsMessage("### workflow-1 #1 failed", content, config.StatusFailed)
+		Expect(message.Type).To(Equal("message"))
+		Expect(message.Attachments).To(HaveLen(1))
+		Expect(message.Attachments[0].ContentType).To(Equal(adaptiveCardContentType))
+
+		card := message.Attachments[0].Content
+		Expect(card.Body).To(HaveLen(3))
+		Expect(card.Body[0].Text).To(Equal("workflow-1 #1 failed"))
+		Expect(card.Body[0].Color).To(Equal("Attention"))
+		Expect(card.Body[1].Text).To(Equal("**Project**: demo"))
+		Expect(card.Body[1].Separator).To(BeTrue())
+		Expect(card.Body[2].Text).To(Equal("**Creator**: admin"))
+		Expect(card.Body[2].Separator).To(BeFalse())
+		Expect(card.Actions).To(HaveLen(1))
+		Expect(card.Actions[0].Title).To(Equal("Click for details"))
+		Expect(card.Actions[0].URL).To(Equal("http://zadig.example.com/task/1"))
+	})
+
+	It("colors the title by the status", func() {
+		Expect(getAdaptiveCardColorWithStatus(config.StatusPassed)).To(Equal("Good"))
+		Expect(getAdaptiveCardColorWithStatus(config.StatusCancelled)).To(Equal("Warning"))
+		Expect(getAdaptiveCardColorWithStatus(config.StatusRunning)).To(Equal("Default"))
+	})
+})
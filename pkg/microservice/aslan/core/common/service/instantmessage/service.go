@@ -83,7 +83,7 @@ type wechatNotification struct {
 	IsAtAll     bool       `json:"is_at_all"`
 }
 
-func (w *Service) SendMessageRequest(uri string, message interface{}) ([]byte, error) {
+func (w *Service) SendMessageRequest(uri string, message interface{}, rfs ...httpclient.RequestFunc) ([]byte, error) {
 	c := httpclient.New()
 
 	// 使用代理
@@ -93,7 +93,7 @@ func (w *Service) SendMessageRequest(uri string, message interface{}) ([]byte, e
 		fmt.Printf("send message is using proxy:%s\n", proxies[0].GetProxyURL())
 	}
 
-	res, err := c.Post(uri, httpclient.SetBody(message))
+	res, err := c.Post(uri, append([]httpclient.RequestFunc{httpclient.SetBody(message)}, rfs...)...)
 	if err != nil {
 		return nil, err
 	}
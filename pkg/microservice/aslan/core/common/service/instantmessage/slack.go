@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	slackType = "slack"
+	// slackTextMaxLength is the max length of the text in a slack block.
+	slackTextMaxLength   = 3000
+	slackHeaderMaxLength = 150
+	// slackMaxBlocks is the max number of blocks in a slack message.
+	slackMaxBlocks = 50
+)
+
+var (
+	markdownHeadingRegex = regexp.MustCompile(`(?m)^#+ *`)
+	markdownLinkRegex    = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	markdownButtonRegex  = regexp.MustCompile(`^\[([^\]]*)\]\(([^)]*)\)$`)
+)
+
+type SlackMessage struct {
+	Text   string        `json:"text"`
+	Blocks []*SlackBlock `json:"blocks"`
+}
+
+type SlackBlock struct {
+	Type     string          `json:"type"`
+	Text     *SlackText      `json:"text,omitempty"`
+	Elements []*SlackElement `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackElement struct {
+	Type     string     `json:"type"`
+	Text     *SlackText `json:"text"`
+	URL      string     `json:"url,omitempty"`
+	ActionID string     `json:"action_id,omitempty"`
+	Value    string     `json:"value,omitempty"`
+	Style    string     `json:"style,omitempty"`
+}
+
+func (w *Service) sendSlackMessage(uri, title, content string) error {
+	_, err := w.SendMessageRequest(uri, newSlackMessage(title, content))
+	return err
+}
+
+// newSlackMessage converts the markdown notification to Block Kit message, paragraphs of the content are converted
+// to sections and a paragraph of a single link is converted to a button.
+func newSlackMessage(title, content string) *SlackMessage {
+	title = plainTitle(title)
+	message := &SlackMessage{
+		Text: title,
+		Blocks: []*SlackBlock{{
+			Type: "header",
+			Text: &SlackText{Type: "plain_text", Text: truncate(title, slackHeaderMaxLength)},
+		}},
+	}
+	for _, paragraph := range markdownParagraphs(content) {
+		if link := markdownButtonRegex.FindStringSubmatch(paragraph); link != nil {
+			message.Blocks = append(message.Blocks, &SlackBlock{
+				Type: "actions",
+				Elements: []*SlackElement{{
+					Type: "button",
+					Text: &SlackText{Type: "plain_text", Text: link[1]},
+					URL:  link[2],
+				}},
+			})
+			continue
+		}
+		message.Blocks = append(message.Blocks, &SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: truncate(slackMarkdown(paragraph), slackTextMaxLength)},
+		})
+	}
+	if len(message.Blocks) > slackMaxBlocks {
+		message.Blocks = append(message.Blocks[:slackMaxBlocks-1], collapseSlackBlocks(message.Blocks[slackMaxBlocks-1:]))
+	}
+	return message
+}
+
+// collapseSlackBlocks merges the blocks over the limit of slack into a single section, buttons are kept as links.
+func collapseSlackBlocks(blocks []*SlackBlock) *SlackBlock {
+	texts := []string{}
+	for _, block := range blocks {
+		if block.Text != nil {
+			texts = append(texts, block.Text.Text)
+		}
+		for _, element := range block.Elements {
+			texts = append(texts, fmt.Sprintf("<%s|%s>", element.URL, element.Text.Text))
+		}
+	}
+	return &SlackBlock{
+		Type: "section",
+		Text: &SlackText{Type: "mrkdwn", Text: truncate(strings.Join(texts, "\n\n"), slackTextMaxLength)},
+	}
+}
+
+// slackMarkdown converts the markdown of the notification templates to slack mrkdwn.
+func slackMarkdown(content string) string {
+	content = strings.ReplaceAll(content, "**", "*")
+	return markdownLinkRegex.ReplaceAllString(content, "<$2|$1>")
+}
+
+// markdownParagraphs splits the content rendered for markdown webhooks into paragraphs, the title and
+// the headings are dropped since cards have their own title.
+func markdownParagraphs(content string) []string {
+	resp := []string{}
+	lines := strings.SplitN(content, "\n", 2)
+	if len(lines) < 2 {
+		return resp
+	}
+	for _, paragraph := range strings.Split(markdownHeadingRegex.ReplaceAllString(lines[1], ""), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" || paragraph == "---" {
+			continue
+		}
+		resp = append(resp, paragraph)
+	}
+	return resp
+}
+
+func plainTitle(title string) string {
+	return strings.TrimSpace(markdownHeadingRegex.ReplaceAllString(title, ""))
+}
+
+func truncate(content string, length int) string {
+	runes := []rune(content)
+	if len(runes) <= length {
+		return content
+	}
+	return string(runes[:length-3]) + "..."
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing slack message", func() {
+
+	content := "## workflow-1 #1 passed\n\n" +
+		"**Project**: demo\n**Creator**: admin\n\n" +
+		"**Details**: [task](http://zadig.example.com/task/1)\n\n" +
+		"---\n\n" +
+		"[Click for details](http://zadig.example.com/task/1)"
+
+	It("converts the paragraphs to sections and the single link to a button", func() {
+		message := newSlackMessage("### workflow-1 #1 passed", content)
+		Expect(message.Text).To(Equal("workflow-1 #1 passed"))
+		Expect(message.Blocks).To(HaveLen(4))
+		Expect(message.Blocks[0].Type).To(Equal("header"))
+		Expect(message.Blocks[0].Text.Text).To(Equal("workflow-1 #1 passed"))
+		Expect(message.Blocks[1].Type).To(Equal("section"))
+		Expect(message.Blocks[1].Text.Text).To(Equal("*Project*: demo\n*Creator*: admin"))
+		Expect(message.Blocks[2].Text.Text).To(Equal("*Details*: <http://zadig.example.com/task/1|task>"))
+		Expect(message.Blocks[3].Type).To(Equal("actions"))
+		Expect(message.Blocks[3].Elements[0].Text.Text).To(Equal("Click for details"))
+		Expect(message.Blocks[3].Elements[0].URL).To(Equal("http://zadig.example.com/task/1"))
+	})
+
+	It("truncates long texts", func() {
+		message := newSlackMessage(strings.Repeat("t", 200), "title\n\n"+strings.Repeat("c", 4000))
+		Expect([]rune(message.Blocks[0].Text.Text)).To(HaveLen(slackHeaderMaxLength))
+		Expect([]rune(message.Blocks[1].Text.Text)).To(HaveLen(slackTextMaxLength))
+	})
+
+	It("collapses the blocks over the limit", func() {
+		paragraphs := []string{"title"}
+		for i := 0; i < 60; i++ {
+			paragraphs = append(paragraphs, fmt.Sprintf("job-%d passed", i))
+		}
+		paragraphs = append(paragraphs, "[Click for details](http://zadig.example.com/task/1)")
+		message := newSlackMessage("workflow-1 #1 passed", strings.Join(paragraphs, "\n\n"))
+		Expect(message.Blocks).To(HaveLen(slackMaxBlocks))
+		last := message.Blocks[slackMaxBlocks-1]
+		Expect(last.Type).To(Equal("section"))
+		Expect(last.Text.Text).To(HavePrefix("job-48 passed\n\njob-49 passed"))
+		Expect(last.Text.Text).To(HaveSuffix("<http://zadig.example.com/task/1|Click for details>"))
+	})
+})
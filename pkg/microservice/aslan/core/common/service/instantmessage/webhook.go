@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+const (
+	webhookType = "webhook"
+	// webhookSignatureHeader carries the hex encoded HMAC-SHA256 of the body, prefixed with "sha256=".
+	webhookSignatureHeader = "X-Zadig-Signature-256"
+	webhookEventHeader     = "X-Zadig-Event"
+	webhookEventWorkflow   = "workflow_task"
+)
+
+type WebhookNotification struct {
+	Event               string        `json:"event"`
+	Title               string        `json:"title"`
+	Content             string        `json:"content"`
+	ProjectName         string        `json:"project_name"`
+	WorkflowName        string        `json:"workflow_name"`
+	WorkflowDisplayName string        `json:"workflow_display_name"`
+	TaskID              int64         `json:"task_id"`
+	Status              config.Status `json:"status"`
+	TaskCreator         string        `json:"task_creator"`
+	CreateTime          int64         `json:"create_time"`
+	StartTime           int64         `json:"start_time"`
+	EndTime             int64         `json:"end_time"`
+	DetailURL           string        `json:"detail_url"`
+}
+
+// sendWebhookMessage posts the notification together with the summary of the task as JSON.
+func (w *Service) sendWebhookMessage(notify *models.WebhookNotify, title, content string, task *models.WorkflowTask) error {
+	if notify == nil || notify.Address == "" {
+		return errors.New("webhook address is empty")
+	}
+	message := &WebhookNotification{
+		Event:               webhookEventWorkflow,
+		Title:               plainTitle(title),
+		Content:             content,
+		ProjectName:         task.ProjectName,
+		WorkflowName:        task.WorkflowName,
+		WorkflowDisplayName: task.WorkflowDisplayName,
+		TaskID:              task.TaskID,
+		Status:              task.Status,
+		TaskCreator:         task.TaskCreator,
+		CreateTime:          task.CreateTime,
+		StartTime:           task.StartTime,
+		EndTime:             task.EndTime,
+		DetailURL:           fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d", configbase.SystemAddress(), task.ProjectName, task.WorkflowName, task.TaskID),
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"Content-Type":     "application/json",
+		webhookEventHeader: webhookEventWorkflow,
+	}
+	if notify.Secret != "" {
+		headers[webhookSignatureHeader] = "sha256=" + signWebhookBody(notify.Secret, body)
+	}
+	_, err = w.SendMessageRequest(notify.Address, body, httpclient.SetHeaders(headers))
+	return err
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
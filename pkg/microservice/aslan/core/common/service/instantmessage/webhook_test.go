@@ -0,0 +1,36 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instantmessage
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing webhook message", func() {
+
+	It("signs the body with HMAC-SHA256", func() {
+		// test case 2 of RFC 4231
+		Expect(signWebhookBody("Jefe", []byte("what do ya want for nothing?"))).
+			To(Equal("5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"))
+	})
+
+	It("changes the signature with the secret", func() {
+		body := []byte(`{"event":"workflow_task"}`)
+		Expect(signWebhookBody("secret-1", body)).NotTo(Equal(signWebhookBody("secret-2", body)))
+	})
+})
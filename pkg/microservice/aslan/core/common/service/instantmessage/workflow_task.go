@@ -35,7 +35,7 @@ import (
 	"github.com/koderover/zadig/pkg/types/step"
 )
 
-func (w *Service) SendWorkflowTaskAproveNotifications(workflowName string, taskID int64) error {
+func (w *Service) SendWorkflowTaskAproveNotifications(workflowName, stageName string, taskID int64) error {
 	resp, err := w.workflowV4Coll.Find(workflowName)
 	if err != nil {
 		errMsg := fmt.Sprintf("failed to find workflowv4, err: %s", err)
@@ -56,13 +56,26 @@ func (w *Service) SendWorkflowTaskAproveNotifications(workflowName string, taskI
 		if !notify.Enabled {
 			continue
 		}
+		// approve emails are sent to the approvers instead of the recipients of the notification.
+		if notify.WebHookType == emailType {
+			if err := w.sendApproveEmails(task, stageName); err != nil {
+				log.Errorf("failed to send approve emails, err: %s", err)
+			}
+			continue
+		}
 		title, content, larkCard, err := w.getApproveNotificationContent(notify, task)
 		if err != nil {
 			errMsg := fmt.Sprintf("failed to get notification content, err: %s", err)
 			log.Error(errMsg)
 			return errors.New(errMsg)
 		}
-		if err := w.sendNotification(title, content, notify, larkCard); err != nil {
+		if notify.IMAppID != "" {
+			if err := w.sendApproveCard(notify, title, content, larkCard, task, stageName); err != nil {
+				log.Errorf("failed to send approve card, err: %s", err)
+			}
+			continue
+		}
+		if err := w.sendNotification(title, content, notify, larkCard, task); err != nil {
 			log.Errorf("failed to send notification, err: %s", err)
 		}
 	}
@@ -104,7 +117,7 @@ func (w *Service) SendWorkflowTaskNotifications(task *models.WorkflowTask) error
 				log.Error(errMsg)
 				return errors.New(errMsg)
 			}
-			if err := w.sendNotification(title, content, notify, larkCard); err != nil {
+			if err := w.sendNotification(title, content, notify, larkCard, task); err != nil {
 				log.Errorf("failed to send notification, err: %s", err)
 			}
 		}
@@ -392,7 +405,7 @@ func getJobTaskTplExec(tplcontent string, args *jobTaskNotification) (string, er
 	return buffer.String(), nil
 }
 
-func (w *Service) sendNotification(title, content string, notify *models.NotifyCtl, card *LarkCard) error {
+func (w *Service) sendNotification(title, content string, notify *models.NotifyCtl, card *LarkCard, task *models.WorkflowTask) error {
 	switch notify.WebHookType {
 	case dingDingType:
 		if err := w.sendDingDingMessage(notify.DingDingWebHook, title, content, notify.AtMobiles); err != nil {
@@ -402,6 +415,22 @@ func (w *Service) sendNotification(title, content string, notify *models.NotifyC
 		if err := w.sendFeishuMessage(notify.FeiShuWebHook, card); err != nil {
 			return err
 		}
+	case emailType:
+		if err := w.sendWorkflowTaskEmail(notify.EmailRecipients, title, task); err != nil {
+			return err
+		}
+	case slackType:
+		if err := w.sendSlackMessage(notify.SlackWebHook, title, content); err != nil {
+			return err
+		}
+	case msTeamsType:
+		if err := w.sendMSTeamsMessage(notify.MSTeamsWebHook, title, content, task.Status); err != nil {
+			return err
+		}
+	case webhookType:
+		if err := w.sendWebhookMessage(notify.WebHookNotify, title, content, task); err != nil {
+			return err
+		}
 	default:
 		if err := w.SendWeChatWorkMessage(weChatTextTypeMarkdown, notify.WeChatWebHook, content); err != nil {
 			return err
@@ -49,7 +49,7 @@ func Init(agentID string, addresses []string) {
 		log.Fatalf("Failed to init producer for nsq service")
 	}
 	sender.SetLogger(stdlog.New(os.Stdout, "nsq producer:", 0), nsq.LogLevelError)
-	err = nsqClient.EnsureNsqdTopics([]string{setting.TopicCronjob, setting.TopicCancel, setting.TopicProcess})
+	err = nsqClient.EnsureNsqdTopics([]string{setting.TopicCronjob, setting.TopicCancel, setting.TopicProcess, setting.TopicApprove})
 	if err != nil {
 		log.Fatalf("cannot ensure cronjob topic in nsq")
 	}
@@ -0,0 +1,220 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmnotify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+	"github.com/koderover/zadig/pkg/tool/codehub"
+	"github.com/koderover/zadig/pkg/tool/gerrit"
+	gitlabtool "github.com/koderover/zadig/pkg/tool/git/gitlab"
+	giteetool "github.com/koderover/zadig/pkg/tool/gitee"
+)
+
+// gerritVerifiedLabel is the label voted by workflow v4 tasks on gerrit changes.
+const gerritVerifiedLabel = "Verified"
+
+// commitStatus is the status of a workflow v4 task reported to the commit of the merge request.
+type commitStatus struct {
+	name        string
+	state       config.Status
+	targetURL   string
+	description string
+}
+
+func newCommitStatus(workflowArgs *models.WorkflowV4, taskID int64, state config.Status) *commitStatus {
+	return &commitStatus{
+		name:        fmt.Sprintf("zadig/%s", workflowArgs.Name),
+		state:       state,
+		targetURL:   fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d", configbase.SystemAddress(), workflowArgs.Project, workflowArgs.Name, taskID),
+		description: fmt.Sprintf("Workflow [%s] is %s.", workflowArgs.Name, commitStatusDescription(state)),
+	}
+}
+
+func commitStatusDescription(state config.Status) string {
+	switch state {
+	case config.StatusQueued:
+		return "queued"
+	case config.StatusRunning:
+		return "running"
+	case config.StatusPassed:
+		return "success"
+	case config.StatusCancelled:
+		return "cancelled"
+	case config.StatusTimeout:
+		return "timeout"
+	case config.StatusReject:
+		return "rejected"
+	default:
+		return "failed"
+	}
+}
+
+// UpdateCommitStatusForWorkflowV4 reports the status of the workflow v4 task to the commit of the merge request on
+// gitlab, gitee, codehub and gerrit, github is left to the check runs.
+func (s *Service) UpdateCommitStatusForWorkflowV4(workflowArgs *models.WorkflowV4, taskID int64, state config.Status) error {
+	hook := workflowArgs.HookPayload
+	if hook == nil || !hook.IsPr {
+		return nil
+	}
+	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
+	if err != nil {
+		return fmt.Errorf("failed to get codehost %d: %s", hook.CodehostID, err)
+	}
+	return updateCommitStatus(ch, hook, newCommitStatus(workflowArgs, taskID, state))
+}
+
+func updateCommitStatus(ch *systemconfig.CodeHost, hook *models.HookPayload, status *commitStatus) error {
+	switch strings.ToLower(ch.Type) {
+	case setting.SourceFromGitlab:
+		return updateGitlabCommitStatus(ch, hook, status)
+	case setting.SourceFromGitee:
+		return updateGiteeCheckRun(ch, hook, status)
+	case setting.SourceFromCodeHub:
+		return updateCodehubCommitStatus(ch, hook, status)
+	case setting.SourceFromGerrit:
+		return updateGerritVerified(ch, hook, status)
+	}
+	return nil
+}
+
+func updateGitlabCommitStatus(ch *systemconfig.CodeHost, hook *models.HookPayload, status *commitStatus) error {
+	cli, err := gitlabtool.NewClient(ch.ID, ch.Address, ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
+	if err != nil {
+		return fmt.Errorf("create gitlab client failed err: %s", err)
+	}
+	_, _, err = cli.Commits.SetCommitStatus(fmt.Sprintf("%s/%s", hook.Owner, hook.Repo), hook.CommitID, &gitlab.SetCommitStatusOptions{
+		State:       gitlabCommitState(status.state),
+		Name:        gitlab.String(status.name),
+		TargetURL:   gitlab.String(status.targetURL),
+		Description: gitlab.String(status.description),
+	})
+	return err
+}
+
+func gitlabCommitState(state config.Status) gitlab.BuildStateValue {
+	switch state {
+	case config.StatusQueued:
+		return gitlab.Pending
+	case config.StatusRunning:
+		return gitlab.Running
+	case config.StatusPassed:
+		return gitlab.Success
+	case config.StatusCancelled:
+		return gitlab.Canceled
+	default:
+		return gitlab.Failed
+	}
+}
+
+func updateGiteeCheckRun(ch *systemconfig.CodeHost, hook *models.HookPayload, status *commitStatus) error {
+	cli := giteetool.NewClient(ch.ID, ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
+	return cli.UpsertCheckRun(ch.AccessToken, hook.Owner, hook.Repo, giteeCheckRun(hook, status))
+}
+
+func giteeCheckRun(hook *models.HookPayload, status *commitStatus) *giteetool.CheckRun {
+	checkRun := &giteetool.CheckRun{
+		Name:       status.name,
+		HeadSha:    hook.CommitID,
+		DetailsURL: status.targetURL,
+		Output: &giteetool.CheckRunOutput{
+			Title:   status.description,
+			Summary: status.description,
+		},
+	}
+	switch status.state {
+	case config.StatusQueued:
+		checkRun.Status = giteetool.CheckRunStatusQueued
+	case config.StatusRunning:
+		checkRun.Status = giteetool.CheckRunStatusInProgress
+	default:
+		checkRun.Status = giteetool.CheckRunStatusCompleted
+		switch status.state {
+		case config.StatusPassed:
+			checkRun.Conclusion = giteetool.CheckRunConclusionSuccess
+		case config.StatusCancelled:
+			checkRun.Conclusion = giteetool.CheckRunConclusionCancelled
+		case config.StatusTimeout:
+			checkRun.Conclusion = giteetool.CheckRunConclusionTimedOut
+		default:
+			checkRun.Conclusion = giteetool.CheckRunConclusionFailure
+		}
+	}
+	return checkRun
+}
+
+func updateCodehubCommitStatus(ch *systemconfig.CodeHost, hook *models.HookPayload, status *commitStatus) error {
+	cli := codehub.NewCodeHubClient(ch.AccessKey, ch.SecretKey, ch.Region, config.ProxyHTTPSAddr(), ch.EnableProxy)
+	return cli.SetCommitStatus(hook.Owner, hook.Repo, hook.CommitID, &codehub.CommitStatus{
+		State:       codehubCommitState(status.state),
+		Name:        status.name,
+		TargetURL:   status.targetURL,
+		Description: status.description,
+	})
+}
+
+func codehubCommitState(state config.Status) string {
+	switch state {
+	case config.StatusQueued:
+		return codehub.CommitStatePending
+	case config.StatusRunning:
+		return codehub.CommitStateRunning
+	case config.StatusPassed:
+		return codehub.CommitStateSuccess
+	case config.StatusCancelled:
+		return codehub.CommitStateCanceled
+	default:
+		return codehub.CommitStateFailed
+	}
+}
+
+// updateGerritVerified votes the Verified label of the change, gerrit has no pending state so the queued task
+// is not reported and the running task resets the vote.
+func updateGerritVerified(ch *systemconfig.CodeHost, hook *models.HookPayload, status *commitStatus) error {
+	score, ok := gerritVerifiedScore(status.state)
+	if !ok {
+		return nil
+	}
+	changeID, err := strconv.Atoi(hook.MergeRequestID)
+	if err != nil {
+		return fmt.Errorf("invalid gerrit change number %s", hook.MergeRequestID)
+	}
+	cli := gerrit.NewClient(ch.Address, ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
+	return cli.SetReview(hook.Repo, changeID, fmt.Sprintf("%s %s", status.description, status.targetURL), gerritVerifiedLabel, score, hook.CommitID)
+}
+
+func gerritVerifiedScore(state config.Status) (string, bool) {
+	switch state {
+	case config.StatusQueued:
+		return "", false
+	case config.StatusRunning, config.StatusCancelled:
+		return "0", true
+	case config.StatusPassed:
+		return "+1", true
+	default:
+		return "-1", true
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmnotify
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/codehub"
+	giteetool "github.com/koderover/zadig/pkg/tool/gitee"
+)
+
+var _ = Describe("Testing commit status", func() {
+
+	It("should describe the status of the task", func() {
+		status := newCommitStatus(&models.WorkflowV4{Name: "build", Project: "demo"}, 3, config.StatusReject)
+		Expect(status.name).To(Equal("zadig/build"))
+		Expect(status.targetURL).To(HaveSuffix("/v1/projects/detail/demo/pipelines/custom/build/3"))
+		Expect(status.description).To(Equal("Workflow [build] is rejected."))
+	})
+
+	Context("state mapping", func() {
+		type mapping struct {
+			state   config.Status
+			gitlab  gitlab.BuildStateValue
+			codehub string
+			gerrit  string
+		}
+		mappings := []mapping{
+			{config.StatusQueued, gitlab.Pending, codehub.CommitStatePending, ""},
+			{config.StatusRunning, gitlab.Running, codehub.CommitStateRunning, "0"},
+			{config.StatusPassed, gitlab.Success, codehub.CommitStateSuccess, "+1"},
+			{config.StatusCancelled, gitlab.Canceled, codehub.CommitStateCanceled, "0"},
+			{config.StatusFailed, gitlab.Failed, codehub.CommitStateFailed, "-1"},
+			{config.StatusTimeout, gitlab.Failed, codehub.CommitStateFailed, "-1"},
+			{config.StatusReject, gitlab.Failed, codehub.CommitStateFailed, "-1"},
+		}
+
+		It("should map the task status to the gitlab commit state", func() {
+			for _, m := range mappings {
+				Expect(gitlabCommitState(m.state)).To(Equal(m.gitlab), string(m.state))
+			}
+		})
+		It("should map the task status to the codehub commit state", func() {
+			for _, m := range mappings {
+				Expect(codehubCommitState(m.state)).To(Equal(m.codehub), string(m.state))
+			}
+		})
+		It("should map the task status to the gerrit verified vote", func() {
+			for _, m := range mappings {
+				score, ok := gerritVerifiedScore(m.state)
+				Expect(ok).To(Equal(m.gerrit != ""), string(m.state))
+				Expect(score).To(Equal(m.gerrit), string(m.state))
+			}
+		})
+	})
+
+	Context("giteeCheckRun", func() {
+		hook := &models.HookPayload{CommitID: "abc"}
+		newStatus := func(state config.Status) *commitStatus {
+			return &commitStatus{name: "zadig/build", state: state, targetURL: "http://zadig/task/1", description: "Workflow [build] is running."}
+		}
+
+		It("should report the queued and running task as incomplete", func() {
+			checkRun := giteeCheckRun(hook, newStatus(config.StatusQueued))
+			Expect(checkRun.Status).To(Equal(giteetool.CheckRunStatusQueued))
+			Expect(checkRun.Conclusion).To(BeEmpty())
+
+			checkRun = giteeCheckRun(hook, newStatus(config.StatusRunning))
+			Expect(checkRun.Name).To(Equal("zadig/build"))
+			Expect(checkRun.HeadSha).To(Equal("abc"))
+			Expect(checkRun.DetailsURL).To(Equal("http://zadig/task/1"))
+			Expect(checkRun.Output.Title).To(Equal("Workflow [build] is running."))
+			Expect(checkRun.Status).To(Equal(giteetool.CheckRunStatusInProgress))
+			Expect(checkRun.Conclusion).To(BeEmpty())
+		})
+		It("should conclude the finished task", func() {
+			for state, conclusion := range map[config.Status]string{
+				config.StatusPassed:    giteetool.CheckRunConclusionSuccess,
+				config.StatusCancelled: giteetool.CheckRunConclusionCancelled,
+				config.StatusTimeout:   giteetool.CheckRunConclusionTimedOut,
+				config.StatusFailed:    giteetool.CheckRunConclusionFailure,
+				config.StatusReject:    giteetool.CheckRunConclusionFailure,
+			} {
+				checkRun := giteeCheckRun(hook, newStatus(state))
+				Expect(checkRun.Status).To(Equal(giteetool.CheckRunStatusCompleted), string(state))
+				Expect(checkRun.Conclusion).To(Equal(conclusion), string(state))
+			}
+		})
+	})
+})
@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scmnotify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/github"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+)
+
+// ReplyPullRequestComment posts a new comment to the pull request, it is used to answer the commands
+// commented by users. Github is commented through the issue api since the comment client leaves it to git checks.
+func (s *Service) ReplyPullRequestComment(mainRepo *models.MainHookRepo, prID int, body string) error {
+	ch, err := systemconfig.New().GetCodeHost(mainRepo.CodehostID)
+	if err != nil {
+		return fmt.Errorf("failed to get codehost %d: %v", mainRepo.CodehostID, err)
+	}
+	if strings.ToLower(ch.Type) == setting.SourceFromGithub {
+		cli := github.NewClient(ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
+		_, err := cli.CreateIssueComment(context.TODO(), mainRepo.GetRepoNamespace(), mainRepo.RepoName, prID, body)
+		return err
+	}
+
+	return s.Client.Comment(&models.Notification{
+		CodehostID: mainRepo.CodehostID,
+		PrID:       prID,
+		ProjectID:  strings.TrimLeft(mainRepo.GetRepoNamespace()+"/"+mainRepo.RepoName, "/"),
+		ErrInfo:    body,
+		RepoOwner:  mainRepo.GetRepoNamespace(),
+		RepoName:   mainRepo.RepoName,
+	})
+}
@@ -654,6 +654,15 @@ func (s *Service) CreateGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4, t
 		return nil
 	}
 
+	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
+	if err != nil {
+		log.Errorf("Failed to get codeHost, err:%v", err)
+		return e.ErrGithubUpdateStatus.AddErr(err)
+	}
+	if strings.ToLower(ch.Type) != setting.SourceFromGithub {
+		return updateCommitStatus(ch, hook, newCommitStatus(workflowArgs, taskID, config.StatusQueued))
+	}
+
 	ghApp, err := github.GetGithubAppClientByOwner(hook.Owner)
 	if err != nil {
 		log.Errorf("getGithubAppClient failed, err:%v", err)
@@ -684,11 +693,6 @@ func (s *Service) CreateGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4, t
 	}
 
 	log.Infof("Init GitHub status")
-	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
-	if err != nil {
-		log.Errorf("Failed to get codeHost, err:%v", err)
-		return e.ErrGithubUpdateStatus.AddErr(err)
-	}
 	gc := github.NewClient(ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
 
 	return gc.UpdateCheckStatus(&github.StatusOptions{
@@ -712,6 +716,15 @@ func (s *Service) UpdateGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4, t
 		return nil
 	}
 
+	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
+	if err != nil {
+		log.Errorf("Failed to get codeHost, err:%v", err)
+		return e.ErrGithubUpdateStatus.AddErr(err)
+	}
+	if strings.ToLower(ch.Type) != setting.SourceFromGithub {
+		return updateCommitStatus(ch, hook, newCommitStatus(workflowArgs, taskID, config.StatusQueued))
+	}
+
 	ghApp, err := github.GetGithubAppClientByOwner(hook.Owner)
 	if err != nil {
 		log.Errorf("getGithubAppClient failed, err:%v", err)
@@ -742,11 +755,6 @@ func (s *Service) UpdateGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4, t
 	}
 
 	log.Info("Start to update GitHub status to running")
-	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
-	if err != nil {
-		log.Errorf("Failed to get codeHost, err:%v", err)
-		return e.ErrGithubUpdateStatus.AddErr(err)
-	}
 	gc := github.NewClient(ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
 
 	return gc.UpdateCheckStatus(&github.StatusOptions{
@@ -770,6 +778,15 @@ func (s *Service) CompleteGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4,
 		return nil
 	}
 
+	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
+	if err != nil {
+		log.Errorf("Failed to get codeHost, err:%v", err)
+		return e.ErrGithubUpdateStatus.AddErr(err)
+	}
+	if strings.ToLower(ch.Type) != setting.SourceFromGithub {
+		return updateCommitStatus(ch, hook, newCommitStatus(workflowArgs, taskID, status))
+	}
+
 	ghApp, err := github.GetGithubAppClientByOwner(hook.Owner)
 	if err != nil {
 		log.Errorf("getGithubAppClient failed, err:%v", err)
@@ -801,11 +818,6 @@ func (s *Service) CompleteGitCheckForWorkflowV4(workflowArgs *models.WorkflowV4,
 
 	ciStatus := getCheckStatus(status)
 	log.Infof("Start to update GitHub status to %s", ciStatus)
-	ch, err := systemconfig.New().GetCodeHost(hook.CodehostID)
-	if err != nil {
-		log.Errorf("Failed to get codeHost, err:%v", err)
-		return e.ErrGithubUpdateStatus.AddErr(err)
-	}
 	gc := github.NewClient(ch.AccessToken, config.ProxyHTTPSAddr(), ch.EnableProxy)
 
 	return gc.UpdateCheckStatus(&github.StatusOptions{
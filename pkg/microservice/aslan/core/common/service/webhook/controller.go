@@ -27,7 +27,9 @@ import (
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/bitbucketserver"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/codehub"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/gitea"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/gitee"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/github"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/gitlab"
@@ -169,6 +171,10 @@ func removeWebhook(t *task, logger *zap.Logger) {
 		cl = codehub.NewClient(t.ak, t.sk, t.region, config.ProxyHTTPSAddr(), t.enableProxy)
 	case setting.SourceFromGitee:
 		cl = gitee.NewClient(t.ID, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
+	case setting.SourceFromGitea:
+		cl = gitea.NewClient(t.address, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
+	case setting.SourceFromBitbucketServer:
+		cl = bitbucketserver.NewClient(t.address, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
 	default:
 		t.err = fmt.Errorf("invaild source: %s", t.from)
 		t.doneCh <- struct{}{}
@@ -248,6 +254,10 @@ func addWebhook(t *task, logger *zap.Logger) {
 		cl = codehub.NewClient(t.ak, t.sk, t.region, config.ProxyHTTPSAddr(), t.enableProxy)
 	case setting.SourceFromGitee:
 		cl = gitee.NewClient(t.ID, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
+	case setting.SourceFromGitea:
+		cl = gitea.NewClient(t.address, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
+	case setting.SourceFromBitbucketServer:
+		cl = bitbucketserver.NewClient(t.address, t.token, config.ProxyHTTPSAddr(), t.enableProxy)
 	default:
 		t.err = fmt.Errorf("invaild source: %s", t.from)
 		t.doneCh <- struct{}{}
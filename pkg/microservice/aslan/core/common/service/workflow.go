@@ -216,7 +216,8 @@ func ProcessWebhook(updatedHooks, currentHooks interface{}, name string, logger
 			}
 
 			switch ch.Type {
-			case setting.SourceFromGithub, setting.SourceFromGitlab, setting.SourceFromCodeHub, setting.SourceFromGitee:
+			case setting.SourceFromGithub, setting.SourceFromGitlab, setting.SourceFromCodeHub, setting.SourceFromGitee,
+				setting.SourceFromGitea, setting.SourceFromBitbucketServer:
 				err = webhook.NewClient().RemoveWebHook(&webhook.TaskOption{
 					ID:          ch.ID,
 					Name:        wh.name,
@@ -253,7 +254,8 @@ func ProcessWebhook(updatedHooks, currentHooks interface{}, name string, logger
 			}
 
 			switch ch.Type {
-			case setting.SourceFromGithub, setting.SourceFromGitlab, setting.SourceFromCodeHub, setting.SourceFromGitee:
+			case setting.SourceFromGithub, setting.SourceFromGitlab, setting.SourceFromCodeHub, setting.SourceFromGitee,
+				setting.SourceFromGitea, setting.SourceFromBitbucketServer:
 				err = webhook.NewClient().AddWebHook(&webhook.TaskOption{
 					ID:        ch.ID,
 					Name:      wh.name,
@@ -0,0 +1,277 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflowcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nsqio/go-nsq"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/instantmessage"
+	nsqservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/nsq"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// approval events may be lost when nsq is unavailable, so the waiting stage
+// still checks the approval in database with this interval.
+const approveCheckInterval = 30 * time.Second
+
+// approveWaiters holds the wake-up channels of the stages waiting for approval in this aslan instance.
+type approveWaiters struct {
+	m map[string]chan struct{}
+	sync.RWMutex
+}
+
+var globalApproveWaiters approveWaiters
+
+func init() {
+	globalApproveWaiters.m = make(map[string]chan struct{})
+}
+
+type ApproveMessage struct {
+	WorkflowName string `json:"workflow_name"`
+	StageName    string `json:"stage_name"`
+	TaskID       int64  `json:"task_id"`
+}
+
+// ApproveHandler wakes up the local stage waiting for approval when an approval is made on any aslan replica.
+type ApproveHandler struct {
+	Logger *zap.SugaredLogger
+}
+
+func (h *ApproveHandler) HandleMessage(message *nsq.Message) error {
+	msg := &ApproveMessage{}
+	if err := json.Unmarshal(message.Body, msg); err != nil {
+		h.Logger.Errorf("unmarshal approve message error: %v", err)
+		return nil
+	}
+	globalApproveWaiters.notify(approveKey(msg.WorkflowName, msg.TaskID, msg.StageName))
+	return nil
+}
+
+func approveKey(workflowName string, taskID int64, stageName string) string {
+	return fmt.Sprintf("%s-%d-%s", workflowName, taskID, stageName)
+}
+
+// ApproveStage records the decision of the user on the stage in database, then
+// wakes up the workflow controller waiting for it, which may live in another aslan replica.
+func ApproveStage(workflowName, stageName, userName, userID, comment string, taskID int64, approve bool) error {
+	task, err := commonrepo.NewworkflowTaskv4Coll().Find(workflowName, taskID)
+	if err != nil {
+		return fmt.Errorf("find workflow %s ID %d error: %v", workflowName, taskID, err)
+	}
+	stageIndex := -1
+	for i, stage := range task.Stages {
+		if stage.Name == stageName {
+			stageIndex = i
+			break
+		}
+	}
+	if stageIndex < 0 {
+		return fmt.Errorf("workflow %s ID %d stage %s not found", workflowName, taskID, stageName)
+	}
+	stage := task.Stages[stageIndex]
+	if stage.Approval == nil || !stage.Approval.Enabled || stage.Status != config.StatusRunning || stage.Approval.RejectOrApprove != "" {
+		return fmt.Errorf("workflow %s ID %d stage %s do not need approve", workflowName, taskID, stageName)
+	}
+
+	userIndex := -1
+	for i, user := range stage.Approval.ApproveUsers {
+		if user.UserID != userID {
+			continue
+		}
+		if user.RejectOrApprove != "" {
+			return fmt.Errorf("%s have %s already", userName, user.RejectOrApprove)
+		}
+		userIndex = i
+		break
+	}
+	if userIndex < 0 {
+		return fmt.Errorf("user %s has no authority to approve", userName)
+	}
+
+	user := &commonmodels.User{
+		UserID:          userID,
+		UserName:        userName,
+		RejectOrApprove: config.Reject,
+		Comment:         comment,
+		OperationTime:   time.Now().Unix(),
+	}
+	if approve {
+		user.RejectOrApprove = config.Approve
+	}
+	if err := commonrepo.NewworkflowTaskv4Coll().UpdateStageApproveUser(workflowName, taskID, stageIndex, userIndex, user); err != nil {
+		return err
+	}
+
+	key := approveKey(workflowName, taskID, stageName)
+	body, _ := json.Marshal(&ApproveMessage{WorkflowName: workflowName, StageName: stageName, TaskID: taskID})
+	if err := nsqservice.Publish(setting.TopicApprove, body); err != nil {
+		log.Warnf("publish approve message of %s error: %v", key, err)
+		// the waiting stage will find the approval by its periodic check if it lives in another replica.
+		globalApproveWaiters.notify(key)
+	}
+	return nil
+}
+
+func waitiForApprove(ctx context.Context, stage *commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) error {
+	if stage.Approval == nil {
+		return nil
+	}
+	if !stage.Approval.Enabled {
+		return nil
+	}
+	if stage.Approval.Timeout == 0 {
+		stage.Approval.Timeout = 60
+	}
+	key := approveKey(workflowCtx.WorkflowName, workflowCtx.TaskID, stage.Name)
+	wakeup := globalApproveWaiters.register(key)
+	defer func() {
+		globalApproveWaiters.unregister(key)
+		ack()
+	}()
+
+	// the stage may have been approved before the task was resumed.
+	approved, latestApproveCount, err := syncApproval(stage, workflowCtx, logger)
+	if err != nil {
+		stage.Status = config.StatusReject
+		return err
+	}
+	if approved {
+		return nil
+	}
+	if err := instantmessage.NewWeChatClient().SendWorkflowTaskAproveNotifications(workflowCtx.WorkflowName, stage.Name, workflowCtx.TaskID); err != nil {
+		logger.Errorf("send approve notification failed, error: %v", err)
+	}
+
+	timeout := time.After(time.Duration(stage.Approval.Timeout) * time.Minute)
+	ticker := time.NewTicker(approveCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stage.Status = config.StatusCancelled
+			return fmt.Errorf("workflow was canceled")
+
+		case <-timeout:
+			stage.Status = config.StatusCancelled
+			return fmt.Errorf("workflow timeout")
+		case <-wakeup:
+		case <-ticker.C:
+		}
+		approved, approveCount, err := syncApproval(stage, workflowCtx, logger)
+		if err != nil {
+			stage.Status = config.StatusReject
+			return err
+		}
+		if approved {
+			return nil
+		}
+		if approveCount > latestApproveCount {
+			ack()
+			latestApproveCount = approveCount
+		}
+	}
+}
+
+// syncApproval loads the decisions of approve users from database and checks whether the stage is approved.
+func syncApproval(stage *commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger) (bool, int, error) {
+	task, err := commonrepo.NewworkflowTaskv4Coll().Find(workflowCtx.WorkflowName, workflowCtx.TaskID)
+	if err != nil {
+		logger.Errorf("find workflow task %s:%d error: %v", workflowCtx.WorkflowName, workflowCtx.TaskID, err)
+	} else {
+		for _, stageInColl := range task.Stages {
+			if stageInColl.Name == stage.Name {
+				mergeApproval(stage.Approval, stageInColl.Approval)
+			}
+		}
+	}
+	return isApproved(stage.Approval)
+}
+
+// mergeApproval copies the decisions recorded in database to the approval held by the workflow controller.
+func mergeApproval(approval, approvalInColl *commonmodels.Approval) {
+	if approval == nil || approvalInColl == nil {
+		return
+	}
+	for _, userInColl := range approvalInColl.ApproveUsers {
+		if userInColl.RejectOrApprove == "" {
+			continue
+		}
+		for _, user := range approval.ApproveUsers {
+			if user.UserID == userInColl.UserID && user.RejectOrApprove == "" {
+				user.RejectOrApprove = userInColl.RejectOrApprove
+				user.Comment = userInColl.Comment
+				user.OperationTime = userInColl.OperationTime
+			}
+		}
+	}
+}
+
+func isApproved(approval *commonmodels.Approval) (bool, int, error) {
+	approveCount := 0
+	for _, user := range approval.ApproveUsers {
+		if user.RejectOrApprove == config.Reject {
+			approval.RejectOrApprove = config.Reject
+			return false, approveCount, fmt.Errorf("%s reject this task", user.UserName)
+		}
+		if user.RejectOrApprove == config.Approve {
+			approveCount++
+		}
+	}
+	if approveCount >= approval.NeededApprovers {
+		approval.RejectOrApprove = config.Approve
+		return true, approveCount, nil
+	}
+	return false, approveCount, nil
+}
+
+func (c *approveWaiters) register(key string) chan struct{} {
+	c.Lock()
+	defer c.Unlock()
+	ch := make(chan struct{}, 1)
+	c.m[key] = ch
+	return ch
+}
+
+func (c *approveWaiters) unregister(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.m, key)
+}
+
+func (c *approveWaiters) notify(key string) {
+	c.RLock()
+	defer c.RUnlock()
+	ch, ok := c.m[key]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
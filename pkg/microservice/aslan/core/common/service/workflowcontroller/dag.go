@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflowcontroller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/workflowcontroller/jobcontroller"
+)
+
+// jobNode is a job in the dependency graph of a workflow task.
+type jobNode struct {
+	job      *commonmodels.JobTask
+	stage    *stageGate
+	upstream []*jobNode
+	done     chan struct{}
+}
+
+// stageGate starts the stage and waits for its approval when the first job of the stage is ready to run,
+// and updates the stage status after all jobs of the stage are finished.
+type stageGate struct {
+	stage   *commonmodels.StageTask
+	once    sync.Once
+	err     error
+	mu      sync.Mutex
+	started bool
+	pending int
+}
+
+func hasJobDependency(stages []*commonmodels.StageTask) bool {
+	for _, stage := range stages {
+		for _, job := range stage.Jobs {
+			if len(job.DependsOn) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RunJobDAG schedules every job as soon as its upstream jobs passed, jobs without depends_on
+// keep waiting for the previous stage, and for the previous job when the stage is not parallel.
+func RunJobDAG(ctx context.Context, stages []*commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, concurrency int, logger *zap.SugaredLogger, ack func()) error {
+	nodes, err := buildJobGraph(stages)
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	workers := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *jobNode) {
+			defer wg.Done()
+			defer close(node.done)
+			defer node.stage.finishJob(logger, ack)
+
+			for _, upstream := range node.upstream {
+				<-upstream.done
+				if upstream.job.Status != config.StatusPassed && upstream.job.Status != config.StatusSkipped {
+					logger.Infof("job %s not run,upstream job %s status: %s", node.job.Name, upstream.job.Name, upstream.job.Status)
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err := node.stage.start(ctx, workflowCtx, logger, ack); err != nil {
+				return
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-workers }()
+			jobcontroller.RunJob(ctx, node.job, workflowCtx, logger, ack)
+		}(node)
+	}
+	wg.Wait()
+	return nil
+}
+
+func buildJobGraph(stages []*commonmodels.StageTask) ([]*jobNode, error) {
+	nodes := []*jobNode{}
+	stageNodes := make([][]*jobNode, len(stages))
+	originNodes := make(map[string][]*jobNode)
+	for i, stage := range stages {
+		gate := &stageGate{stage: stage, pending: len(stage.Jobs)}
+		for _, job := range stage.Jobs {
+			node := &jobNode{job: job, stage: gate, done: make(chan struct{})}
+			nodes = append(nodes, node)
+			stageNodes[i] = append(stageNodes[i], node)
+			originNodes[job.OriginName] = append(originNodes[job.OriginName], node)
+		}
+	}
+
+	for i, stage := range stages {
+		for j, node := range stageNodes[i] {
+			if len(node.job.DependsOn) > 0 {
+				for _, name := range node.job.DependsOn {
+					// jobs skipped when creating the task are not in the graph, nothing to wait for.
+					node.upstream = append(node.upstream, originNodes[name]...)
+				}
+				continue
+			}
+			if i > 0 {
+				node.upstream = append(node.upstream, stageNodes[i-1]...)
+			}
+			if !stage.Parallel && j > 0 {
+				node.upstream = append(node.upstream, stageNodes[i][j-1])
+			}
+		}
+	}
+
+	// 0: not visited, 1: visiting, 2: visited
+	states := make(map[*jobNode]int)
+	var visit func(node *jobNode) error
+	visit = func(node *jobNode) error {
+		switch states[node] {
+		case 1:
+			return fmt.Errorf("job %s has circular dependency", node.job.Name)
+		case 2:
+			return nil
+		}
+		states[node] = 1
+		for _, upstream := range node.upstream {
+			if err := visit(upstream); err != nil {
+				return err
+			}
+		}
+		states[node] = 2
+		return nil
+	}
+	for _, node := range nodes {
+		if err := visit(node); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (g *stageGate) start(ctx context.Context, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) error {
+	g.once.Do(func() {
+		g.mu.Lock()
+		g.started = true
+		g.mu.Unlock()
+
+		stage := g.stage
+		// stage already finished before the task was resumed.
+		if stage.Status == config.StatusPassed || stage.Status == config.StatusSkipped {
+			return
+		}
+		if skip := skipStage(stage, workflowCtx, logger); skip {
+			g.err = fmt.Errorf("stage %s status: %s", stage.Name, stage.Status)
+			ack()
+			return
+		}
+		stage.Status = config.StatusRunning
+		if stage.StartTime == 0 {
+			stage.StartTime = time.Now().Unix()
+		}
+		ack()
+		logger.Infof("start stage: %s,status: %s", stage.Name, stage.Status)
+		if err := waitiForApprove(ctx, stage, workflowCtx, logger, ack); err != nil {
+			stage.Error = err.Error()
+			g.err = err
+		}
+	})
+	return g.err
+}
+
+func (g *stageGate) finishJob(logger *zap.SugaredLogger, ack func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pending--
+	if g.pending > 0 || !g.started {
+		return
+	}
+	stage := g.stage
+	if g.err == nil {
+		updateStageStatus(stage)
+	}
+	stage.EndTime = time.Now().Unix()
+	logger.Infof("finish stage: %s,status: %s", stage.Name, stage.Status)
+	ack()
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/kube/updater"
+	"github.com/koderover/zadig/pkg/tool/prometheus"
+)
+
+const (
+	defaultHealthCheckWindow   = 5 * time.Minute
+	defaultHealthCheckInterval = 10 * time.Second
+	httpProbeTimeout           = 10 * time.Second
+)
+
+// healthCheckTarget is the deployed service to verify, scripts are run in the namespace of it.
+type healthCheckTarget struct {
+	EnvName     string
+	Namespace   string
+	ServiceName string
+	KubeClient  crClient.Client
+}
+
+type healthCheckItem struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// runHealthCheck runs the checks every interval until all of them pass, checks passed once are not run again.
+// It returns an error if the checks do not pass within the window.
+func runHealthCheck(ctx context.Context, check *commonmodels.DeployHealthCheck, target *healthCheckTarget, events *commonmodels.Events, ack func(), logger *zap.SugaredLogger) error {
+	window := time.Duration(check.Window) * time.Second
+	if window <= 0 {
+		window = defaultHealthCheckWindow
+	}
+	interval := time.Duration(check.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	pending := healthCheckItems(check, target, logger)
+	for {
+		failed := []*healthCheckItem{}
+		for _, item := range pending {
+			if err := item.run(checkCtx); err != nil {
+				events.Error(fmt.Sprintf("%s: %v", item.name, err))
+				failed = append(failed, item)
+				continue
+			}
+			events.Info(fmt.Sprintf("%s passed", item.name))
+		}
+		ack()
+		if len(failed) == 0 {
+			return nil
+		}
+		pending = failed
+
+		select {
+		case <-checkCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("health check of service %s did not pass within %s", target.ServiceName, window)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func healthCheckItems(check *commonmodels.DeployHealthCheck, target *healthCheckTarget, logger *zap.SugaredLogger) []*healthCheckItem {
+	items := []*healthCheckItem{}
+	for _, probe := range check.HTTPProbes {
+		probe := probe
+		items = append(items, &healthCheckItem{
+			name: fmt.Sprintf("http probe %s", probe.Name),
+			run:  func(ctx context.Context) error { return runHTTPProbe(ctx, probe) },
+		})
+	}
+	for _, script := range check.Scripts {
+		script := script
+		items = append(items, &healthCheckItem{
+			name: fmt.Sprintf("script %s", script.Name),
+			run:  func(ctx context.Context) error { return runHealthCheckScript(ctx, script, target, logger) },
+		})
+	}
+	if len(check.Metrics) > 0 {
+		client := prometheus.NewClient(check.PrometheusAddress, check.PrometheusToken)
+		for _, metric := range check.Metrics {
+			metric := metric
+			items = append(items, &healthCheckItem{
+				name: fmt.Sprintf("metric %s", metric.Name),
+				run: func(ctx context.Context) error {
+					measurement := measureMetric(client, metric, time.Now())
+					if measurement.Error != "" {
+						return fmt.Errorf("query error: %s", measurement.Error)
+					}
+					if !measurement.Passed {
+						return fmt.Errorf("%v %s %v failed", measurement.Value, metric.Condition, metric.Threshold)
+					}
+					return nil
+				},
+			})
+		}
+	}
+	return items
+}
+
+func runHTTPProbe(ctx context.Context, probe *commonmodels.HTTPProbe) error {
+	method := probe.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, probe.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: httpProbeTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if (probe.ExpectedStatus == 0 && resp.StatusCode < http.StatusBadRequest) || resp.StatusCode == probe.ExpectedStatus {
+		return nil
+	}
+	return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+}
+
+// runHealthCheckScript runs the script in a k8s job, the job is deleted when it ends.
+func runHealthCheckScript(ctx context.Context, script *commonmodels.HealthCheckScript, target *healthCheckTarget, logger *zap.SugaredLogger) error {
+	jobName := fmt.Sprintf("zadig-health-check-%d", time.Now().UnixNano())
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: target.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: int32Ptr(0),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "health-check",
+							Image:   script.Image,
+							Command: []string{"/bin/sh", "-c", script.Script},
+							Env: []corev1.EnvVar{
+								{Name: "ENV_NAME", Value: target.EnvName},
+								{Name: "NAMESPACE", Value: target.Namespace},
+								{Name: "SERVICE_NAME", Value: target.ServiceName},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := updater.CreateJob(job, target.KubeClient); err != nil {
+		return fmt.Errorf("create job error: %v", err)
+	}
+	defer func() {
+		if err := updater.DeleteJob(target.Namespace, jobName, target.KubeClient); err != nil {
+			logger.Errorf("failed to delete health check job %s/%s: %v", target.Namespace, jobName, err)
+		}
+	}()
+
+	// the script should end before the window of the health check is exceeded.
+	timeout := int(defaultHealthCheckWindow / time.Minute)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = int(time.Until(deadline)/time.Minute) + 1
+	}
+	status := waitPlainJobEnd(ctx, timeout, target.Namespace, jobName, target.KubeClient, logger)
+	if status != config.StatusPassed {
+		return fmt.Errorf("script ended with status %s", status)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing health check", func() {
+
+	var server *httptest.Server
+	var requests int32
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&requests, 0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			switch r.URL.Path {
+			case "/healthz":
+				w.WriteHeader(http.StatusOK)
+			case "/created":
+				if r.Method != http.MethodPost {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			case "/flaky":
+				// fails the first request only
+				if n == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("runHTTPProbe", func() {
+		It("should pass with any status below 400 if the expected status is not set", func() {
+			Expect(runHTTPProbe(context.Background(), &commonmodels.HTTPProbe{Name: "healthz", URL: server.URL + "/healthz"})).To(Succeed())
+		})
+		It("should fail with the status of errors", func() {
+			err := runHTTPProbe(context.Background(), &commonmodels.HTTPProbe{Name: "error", URL: server.URL + "/error"})
+			Expect(err).To(MatchError("unexpected status code 500"))
+		})
+		It("should check the expected status with the method", func() {
+			probe := &commonmodels.HTTPProbe{Name: "created", URL: server.URL + "/created", Method: http.MethodPost, ExpectedStatus: http.StatusCreated}
+			Expect(runHTTPProbe(context.Background(), probe)).To(Succeed())
+
+			probe.ExpectedStatus = http.StatusOK
+			Expect(runHTTPProbe(context.Background(), probe)).To(MatchError("unexpected status code 201"))
+		})
+		It("should fail if the server is unreachable", func() {
+			url := server.URL
+			server.Close()
+			Expect(runHTTPProbe(context.Background(), &commonmodels.HTTPProbe{Name: "healthz", URL: url + "/healthz"})).NotTo(Succeed())
+		})
+	})
+
+	Context("runHealthCheck", func() {
+		target := &healthCheckTarget{EnvName: "dev", Namespace: "project-env-dev", ServiceName: "web"}
+		logger := zap.NewNop().Sugar()
+
+		It("should pass when all the probes pass", func() {
+			events := &commonmodels.Events{}
+			acked := 0
+			check := &commonmodels.DeployHealthCheck{HTTPProbes: []*commonmodels.HTTPProbe{{Name: "healthz", URL: server.URL + "/healthz"}}}
+			Expect(runHealthCheck(context.Background(), check, target, events, func() { acked++ }, logger)).To(Succeed())
+			Expect(*events).To(HaveLen(1))
+			Expect((*events)[0].Message).To(Equal("http probe healthz passed"))
+			Expect(acked).To(Equal(1))
+		})
+
+		It("should retry the failed probes only", func() {
+			events := &commonmodels.Events{}
+			check := &commonmodels.DeployHealthCheck{Window: 10, Interval: 1, HTTPProbes: []*commonmodels.HTTPProbe{
+				{Name: "flaky", URL: server.URL + "/flaky"},
+			}}
+			Expect(runHealthCheck(context.Background(), check, target, events, func() {}, logger)).To(Succeed())
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+			Expect(*events).To(HaveLen(2))
+			Expect((*events)[0].EventType).To(Equal("error"))
+			Expect((*events)[1].Message).To(Equal("http probe flaky passed"))
+		})
+
+		It("should fail when the probes do not pass within the window", func() {
+			events := &commonmodels.Events{}
+			check := &commonmodels.DeployHealthCheck{Window: 1, Interval: 1, HTTPProbes: []*commonmodels.HTTPProbe{
+				{Name: "healthz", URL: server.URL + "/healthz"},
+				{Name: "error", URL: server.URL + "/error"},
+			}}
+			err := runHealthCheck(context.Background(), check, target, events, func() {}, logger)
+			Expect(err).To(MatchError("health check of service web did not pass within 1s"))
+		})
+
+		It("should return the error of the context when it is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			check := &commonmodels.DeployHealthCheck{HTTPProbes: []*commonmodels.HTTPProbe{{Name: "healthz", URL: server.URL + "/healthz"}}}
+			err := runHealthCheck(ctx, check, target, &commonmodels.Events{}, func() {}, logger)
+			Expect(err).To(Equal(context.Canceled))
+		})
+	})
+
+	Context("waitWorkloadsRolledOut", func() {
+		newDeployment := func(name string, generation int64, status appsv1.DeploymentStatus) *appsv1.Deployment {
+			return &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev", Generation: generation},
+				Status:     status,
+			}
+		}
+		resources := []commonmodels.Resource{{Name: "web", Kind: setting.Deployment}}
+
+		It("should return when the workloads are rolled out", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(
+				newDeployment("web", 2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, AvailableReplicas: 2}),
+			).Build()
+			Expect(waitWorkloadsRolledOut(context.Background(), "dev", resources, time.Second, kubeClient)).To(Succeed())
+		})
+
+		It("should fail if the new spec is not observed within the timeout", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(
+				newDeployment("web", 2, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, AvailableReplicas: 2}),
+			).Build()
+			err := waitWorkloadsRolledOut(context.Background(), "dev", resources, 100*time.Millisecond, kubeClient)
+			Expect(err).To(MatchError("dev/web is not ready within 100ms"))
+		})
+
+		It("should fail if the workload is not found", func() {
+			kubeClient := fake.NewClientBuilder().Build()
+			err := waitWorkloadsRolledOut(context.Background(), "dev", resources, 100*time.Millisecond, kubeClient)
+			Expect(err).To(MatchError("dev/web is not ready within 100ms: deployment dev/web not found"))
+		})
+	})
+})
@@ -31,15 +31,28 @@ import (
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/types/job"
+	"github.com/koderover/zadig/pkg/util/condition"
 	"github.com/koderover/zadig/pkg/util/rand"
 )
 
+const (
+	retryBaseInterval = 10 * time.Second
+	retryMaxInterval  = 5 * time.Minute
+)
+
 type JobCtl interface {
 	Run(ctx context.Context)
 	// do some clean stuff when workflow finished, like collect reports or clean up resources.
 	Clean(ctx context.Context)
 }
 
+// JobResumer is implemented by jobs running as K8s jobs, which can re-attach
+// to the K8s job created before aslan restarted instead of running it again.
+type JobResumer interface {
+	Resume(ctx context.Context)
+}
+
 func initJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) JobCtl {
 	var jobCtl JobCtl
 	switch job.JobType {
@@ -59,6 +72,10 @@ func initJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTas
 		jobCtl = NewBlueGreenDeployJobCtl(job, workflowCtx, ack, logger)
 	case string(config.JobK8sBlueGreenRelease):
 		jobCtl = NewBlueGreenReleaseJobCtl(job, workflowCtx, ack, logger)
+	case string(config.JobIstioCanary):
+		jobCtl = NewIstioCanaryJobCtl(job, workflowCtx, ack, logger)
+	case string(config.JobCanaryAnalysis):
+		jobCtl = NewCanaryAnalysisJobCtl(job, workflowCtx, ack, logger)
 	default:
 		jobCtl = NewFreestyleJobCtl(job, workflowCtx, ack, logger)
 	}
@@ -66,16 +83,39 @@ func initJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTas
 }
 
 func runJob(ctx context.Context, job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) {
+	// job already finished before the task was resumed.
+	if job.Status == config.StatusPassed || job.Status == config.StatusSkipped {
+		logger.Infof("skip finished job: %s,status: %s", job.Name, job.Status)
+		return
+	}
+	// job was running when aslan restarted, try to re-attach to its K8s job.
+	resume := job.Status == config.StatusRunning && job.K8sJobName != ""
+	if !resume {
+		run, err := EvaluateCondition(job.When, workflowCtx)
+		if err != nil {
+			logError(job, fmt.Sprintf("evaluate condition of job %s error: %v", job.Name, err), logger)
+			ack()
+			return
+		}
+		if !run {
+			logger.Infof("skip job: %s,condition: %s", job.Name, job.When)
+			job.Status = config.StatusSkipped
+			ack()
+			return
+		}
+	}
 	// render global variables for every job.
 	workflowCtx.GlobalContextEach(func(k, v string) bool {
 		b, _ := json.Marshal(job)
-		replacedString := strings.ReplaceAll(string(b), fmt.Sprintf(setting.RenderValueTemplate, k), v)
+		replacedString := strings.ReplaceAll(string(b), fmt.Sprintf(setting.RenderValueTemplate, k), jsonEscape(v))
 		json.Unmarshal([]byte(replacedString), &job)
 		return true
 	})
 	job.Status = config.StatusRunning
-	job.StartTime = time.Now().Unix()
-	job.K8sJobName = getJobName(workflowCtx.WorkflowName, workflowCtx.TaskID)
+	if !resume {
+		job.StartTime = time.Now().Unix()
+		job.K8sJobName = getJobName(workflowCtx.WorkflowName, workflowCtx.TaskID)
+	}
 	ack()
 
 	logger.Infof("start job: %s,status: %s", job.Name, job.Status)
@@ -86,7 +126,87 @@ func runJob(ctx context.Context, job *commonmodels.JobTask, workflowCtx *commonm
 	}()
 	jobCtl := initJobCtl(job, workflowCtx, logger, ack)
 
-	jobCtl.Run(ctx)
+	resumer, resumable := jobCtl.(JobResumer)
+	switch {
+	case resume && resumable:
+		logger.Infof("resume job: %s,k8s job: %s", job.Name, job.K8sJobName)
+		resumer.Resume(ctx)
+	case resume:
+		// deploy and release jobs change the env step by step, running them again from the beginning
+		// re-applies the changes, so they are failed and left to the users to retry.
+		logError(job, fmt.Sprintf("job %s was interrupted by the restart of aslan and can not be resumed", job.Name), logger)
+		return
+	default:
+		jobCtl.Run(ctx)
+	}
+
+	for job.RetryCount < job.Retry && (job.Status == config.StatusFailed || job.Status == config.StatusTimeout) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryBackoff(job.RetryCount)):
+		}
+		job.RetryCount++
+		logger.Infof("retry job: %s,retry count: %d,last error: %s", job.Name, job.RetryCount, job.Error)
+		job.Status = config.StatusRunning
+		job.Error = ""
+		job.K8sJobName = getJobName(workflowCtx.WorkflowName, workflowCtx.TaskID)
+		ack()
+		initJobCtl(job, workflowCtx, logger, ack).Run(ctx)
+	}
+}
+
+// retryBackoff returns the interval before the next retry of a failed job, doubled on each retry.
+func retryBackoff(retryCount int64) time.Duration {
+	backoff := retryBaseInterval
+	for i := int64(0); i < retryCount && backoff < retryMaxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > retryMaxInterval {
+		return retryMaxInterval
+	}
+	return backoff
+}
+
+// RunJob runs a single job, used by the workflow controller to schedule jobs by their dependencies.
+func RunJob(ctx context.Context, job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) {
+	runJob(ctx, job, workflowCtx, logger, ack)
+}
+
+// EvaluateCondition evaluates the condition of a stage or job against the workflow params, key values,
+// trigger info and the global context which holds the outputs of upstream jobs.
+func EvaluateCondition(when string, workflowCtx *commonmodels.WorkflowTaskCtx) (bool, error) {
+	if strings.TrimSpace(when) == "" {
+		return true, nil
+	}
+	vars := map[string]string{
+		"project":                 workflowCtx.ProjectName,
+		"workflow.name":           workflowCtx.WorkflowName,
+		"workflow.task.id":        fmt.Sprintf("%d", workflowCtx.TaskID),
+		"workflow.trigger.event":  "manual",
+		"workflow.trigger.branch": "",
+	}
+	for _, param := range workflowCtx.WorkflowParams {
+		vars[strings.Join([]string{"workflow", "params", param.Name}, ".")] = param.Value
+	}
+	for _, kv := range workflowCtx.WorkflowKeyVals {
+		vars[strings.Join([]string{"workflow", "keyvals", kv.Key}, ".")] = kv.Value
+	}
+	if hook := workflowCtx.HookPayload; hook != nil {
+		vars["workflow.trigger.event"] = hook.EventType
+		if hook.EventType == "" && hook.IsPr {
+			vars["workflow.trigger.event"] = string(config.HookEventPr)
+		}
+		vars["workflow.trigger.branch"] = hook.Branch
+		vars["workflow.trigger.commit_id"] = hook.CommitID
+		vars["workflow.trigger.merge_request_id"] = hook.MergeRequestID
+		vars["workflow.trigger.changed_files"] = strings.Join(hook.ChangedFiles, ",")
+	}
+	workflowCtx.GlobalContextEach(func(k, v string) bool {
+		vars[k] = v
+		return true
+	})
+	return condition.Evaluate(when, vars)
 }
 
 func RunJobs(ctx context.Context, jobs []*commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, concurrency int, logger *zap.SugaredLogger, ack func()) {
@@ -204,3 +324,18 @@ func logError(job *commonmodels.JobTask, msg string, logger *zap.SugaredLogger)
 	job.Status = config.StatusFailed
 	job.Error = msg
 }
+
+// setJobOutputs saves the outputs of the job in global context, so the following jobs
+// can refer them as {{.job.<job name>.output.<output name>}}, or {{.workflow.<job name>.<output name>}}.
+func setJobOutputs(workflowCtx *commonmodels.WorkflowTaskCtx, jobName string, outputs []*job.JobOutput) {
+	for _, output := range outputs {
+		workflowCtx.GlobalContextSet(strings.Join([]string{"workflow", jobName, output.Name}, "."), output.Value)
+		workflowCtx.GlobalContextSet(strings.Join([]string{"job", jobName, "output", output.Name}, "."), output.Value)
+	}
+}
+
+// jsonEscape escapes the value so that it can be rendered into a json string, for example an output in json.
+func jsonEscape(value string) string {
+	b, _ := json.Marshal(value)
+	return string(b[1 : len(b)-1])
+}
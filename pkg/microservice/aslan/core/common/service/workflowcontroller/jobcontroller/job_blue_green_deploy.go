@@ -23,6 +23,9 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	crClient "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -30,7 +33,6 @@ import (
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
-	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
 	"github.com/koderover/zadig/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/pkg/tool/kube/updater"
 )
@@ -90,14 +92,41 @@ func (c *BlueGreenDeployJobCtl) run(ctx context.Context) error {
 	}
 	selector := labels.Set(service.Spec.Selector).AsSelector()
 
-	deployment, exist, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
-	if err != nil || !exist {
-		msg := fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
-		logError(c.job, msg, c.logger)
-		c.jobTaskSpec.Events.Error(msg)
-		return errors.New(msg)
+	kind := workloadKind(c.jobTaskSpec.WorkloadType)
+	var (
+		workloadLabels  map[string]string
+		blueObjectMeta  *metav1.ObjectMeta
+		blueSelector    *metav1.LabelSelector
+		bluePodTemplate *corev1.PodTemplateSpec
+		blueDeployment  *appsv1.Deployment
+		blueStatefulSet *appsv1.StatefulSet
+	)
+	if c.jobTaskSpec.WorkloadType == setting.StatefulSet {
+		statefulSet, exist, err := getter.GetStatefulSet(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
+		if err != nil || !exist {
+			msg := fmt.Sprintf("statefulset: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
+			logError(c.job, msg, c.logger)
+			c.jobTaskSpec.Events.Error(msg)
+			return errors.New(msg)
+		}
+		// the blue statefulset shares the headless service of the origin one, the ones with volume claim
+		// templates are rejected when the task is created.
+		blueStatefulSet = statefulSet.DeepCopy()
+		workloadLabels = statefulSet.Labels
+		blueObjectMeta, blueSelector, bluePodTemplate = &blueStatefulSet.ObjectMeta, blueStatefulSet.Spec.Selector, &blueStatefulSet.Spec.Template
+	} else {
+		deployment, exist, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
+		if err != nil || !exist {
+			msg := fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
+			logError(c.job, msg, c.logger)
+			c.jobTaskSpec.Events.Error(msg)
+			return errors.New(msg)
+		}
+		blueDeployment = deployment.DeepCopy()
+		workloadLabels = deployment.Labels
+		blueObjectMeta, blueSelector, bluePodTemplate = &blueDeployment.ObjectMeta, blueDeployment.Spec.Selector, &blueDeployment.Spec.Template
 	}
-	for _, container := range deployment.Spec.Template.Spec.Containers {
+	for _, container := range bluePodTemplate.Spec.Containers {
 		if container.Name != c.jobTaskSpec.ContainerName {
 			continue
 		}
@@ -106,9 +135,9 @@ func (c *BlueGreenDeployJobCtl) run(ctx context.Context) error {
 		break
 	}
 	// if label not exist, we think this was the first time to deploy, so we need to add the label
-	if previousLabel, ok := deployment.ObjectMeta.Labels[config.BlueGreenVerionLabelName]; !ok {
+	if previousLabel, ok := workloadLabels[config.BlueGreenVerionLabelName]; !ok {
 		c.jobTaskSpec.FirstDeploy = true
-		c.jobTaskSpec.Events.Info(fmt.Sprintf("deployment %s was the first time blue-green deploy by zadig", c.jobTaskSpec.WorkloadName))
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("%s %s was the first time blue-green deploy by zadig", kind, c.jobTaskSpec.WorkloadName))
 		c.ack()
 
 		pods, err := getter.ListPods(c.jobTaskSpec.Namespace, selector, c.kubeClient)
@@ -174,25 +203,29 @@ func (c *BlueGreenDeployJobCtl) run(ctx context.Context) error {
 	}
 	c.jobTaskSpec.Events.Info(fmt.Sprintf("blue service: %s created", c.jobTaskSpec.BlueK8sServiceName))
 	c.ack()
-	blueDeployment := deployment.DeepCopy()
-	blueDeployment.Name = c.jobTaskSpec.BlueWorkloadName
-	for i, container := range blueDeployment.Spec.Template.Spec.Containers {
+	blueObjectMeta.Name = c.jobTaskSpec.BlueWorkloadName
+	for i, container := range bluePodTemplate.Spec.Containers {
 		if container.Name != c.jobTaskSpec.ContainerName {
 			continue
 		}
-		blueDeployment.Spec.Template.Spec.Containers[i].Image = c.jobTaskSpec.Image
-	}
-	blueDeployment.Labels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
-	blueDeployment.Spec.Selector.MatchLabels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
-	blueDeployment.Spec.Template.Labels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
-	blueDeployment.ObjectMeta.ResourceVersion = ""
-	if err := updater.CreateOrPatchDeployment(blueDeployment, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("create blue deployment: %s error: %v", c.jobTaskSpec.BlueWorkloadName, err)
+		bluePodTemplate.Spec.Containers[i].Image = c.jobTaskSpec.Image
+	}
+	blueObjectMeta.Labels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
+	blueSelector.MatchLabels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
+	bluePodTemplate.Labels[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
+	blueObjectMeta.ResourceVersion = ""
+	if blueStatefulSet != nil {
+		err = updater.CreateOrPatchStatefulSet(blueStatefulSet, c.kubeClient)
+	} else {
+		err = updater.CreateOrPatchDeployment(blueDeployment, c.kubeClient)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("create blue %s: %s error: %v", kind, c.jobTaskSpec.BlueWorkloadName, err)
 		logError(c.job, msg, c.logger)
 		c.jobTaskSpec.Events.Error(msg)
 		return errors.New(msg)
 	}
-	c.jobTaskSpec.Events.Info(fmt.Sprintf("blue deployment: %s created", c.jobTaskSpec.BlueWorkloadName))
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("blue %s: %s created", kind, c.jobTaskSpec.BlueWorkloadName))
 	c.ack()
 	return nil
 }
@@ -207,24 +240,25 @@ func (c *BlueGreenDeployJobCtl) wait(ctx context.Context) {
 
 		case <-timeout:
 			c.job.Status = config.StatusTimeout
-			msg := fmt.Sprintf("timeout waiting for the blue deployment: %s to run", c.jobTaskSpec.BlueWorkloadName)
+			msg := fmt.Sprintf("timeout waiting for the blue %s: %s to run", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.BlueWorkloadName)
 			c.jobTaskSpec.Events.Info(msg)
 			return
 
 		default:
 			time.Sleep(time.Second * 2)
-			d, found, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.BlueWorkloadName, c.kubeClient)
-			if err != nil || !found {
+			ready, err := workloadReady(c.jobTaskSpec.Namespace, c.jobTaskSpec.BlueWorkloadName, c.jobTaskSpec.WorkloadType, c.kubeClient)
+			if err != nil {
 				c.logger.Errorf(
-					"failed to check deployment ready status %s/%s - %v",
+					"failed to check %s ready status %s/%s - %v",
+					workloadKind(c.jobTaskSpec.WorkloadType),
 					c.jobTaskSpec.Namespace,
 					c.jobTaskSpec.BlueWorkloadName,
 					err,
 				)
 			} else {
-				if wrapper.Deployment(d).Ready() {
+				if ready {
 					c.job.Status = config.StatusPassed
-					msg := fmt.Sprintf("blue-green deployment: %s create successfully", c.jobTaskSpec.BlueWorkloadName)
+					msg := fmt.Sprintf("blue-green %s: %s create successfully", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.BlueWorkloadName)
 					c.jobTaskSpec.Events.Info(msg)
 					return
 				}
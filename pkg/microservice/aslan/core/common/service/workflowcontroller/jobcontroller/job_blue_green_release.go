@@ -79,8 +79,8 @@ func (c *BlueGreenReleaseJobCtl) Clean(ctx context.Context) {
 		return
 	}
 	// clear intermediate state resources
-	if err := updater.DeleteDeploymentAndWait(c.jobTaskSpec.Namespace, c.jobTaskSpec.BlueWorkloadName, kubeClient); err != nil {
-		c.logger.Errorf("delete old deployment error: %v", err)
+	if err := deleteWorkloadAndWait(c.jobTaskSpec.Namespace, c.jobTaskSpec.BlueWorkloadName, c.jobTaskSpec.WorkloadType, kubeClient); err != nil {
+		c.logger.Errorf("delete blue %s error: %v", workloadKind(c.jobTaskSpec.WorkloadType), err)
 	}
 	// if it was the first time blue-green deployment, clean the origin labels.
 	if service.Spec.Selector[config.BlueGreenVerionLabelName] == config.OriginVersion {
@@ -123,13 +123,14 @@ func (c *BlueGreenReleaseJobCtl) Run(ctx context.Context) {
 		logError(c.job, msg, c.logger)
 		return
 	}
+	kind := workloadKind(c.jobTaskSpec.WorkloadType)
 	service.Spec.Selector[config.BlueGreenVerionLabelName] = c.jobTaskSpec.Version
 	if err := updater.CreateOrPatchService(service, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("point service: %s to deployment: %s failed: %v", c.jobTaskSpec.K8sServiceName, c.jobTaskSpec.BlueWorkloadName, err)
+		msg := fmt.Sprintf("point service: %s to %s: %s failed: %v", c.jobTaskSpec.K8sServiceName, kind, c.jobTaskSpec.BlueWorkloadName, err)
 		logError(c.job, msg, c.logger)
 		return
 	}
-	c.jobTaskSpec.Events.Info(fmt.Sprintf("point service: %s to deployment: %s success", c.jobTaskSpec.K8sServiceName, c.jobTaskSpec.BlueWorkloadName))
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("point service: %s to %s: %s success", c.jobTaskSpec.K8sServiceName, kind, c.jobTaskSpec.BlueWorkloadName))
 	c.ack()
 
 	blueServiceName := c.jobTaskSpec.BlueK8sServiceName
@@ -139,11 +140,11 @@ func (c *BlueGreenReleaseJobCtl) Run(ctx context.Context) {
 		c.jobTaskSpec.Events.Error(msg)
 		c.ack()
 	}
-	if err := updater.DeleteDeploymentAndWait(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("delete old deployment: %s failed: %v", c.jobTaskSpec.WorkloadName, err)
+	if err := deleteWorkloadAndWait(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.jobTaskSpec.WorkloadType, c.kubeClient); err != nil {
+		msg := fmt.Sprintf("delete old %s: %s failed: %v", kind, c.jobTaskSpec.WorkloadName, err)
 		logError(c.job, msg, c.logger)
 		return
 	}
-	c.jobTaskSpec.Events.Info(fmt.Sprintf("blue green deployment succeed, now service point to deployemt: %s", c.jobTaskSpec.BlueWorkloadName))
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("blue green deployment succeed, now service point to %s: %s", kind, c.jobTaskSpec.BlueWorkloadName))
 	c.job.Status = config.StatusPassed
 }
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	crClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
+	"github.com/koderover/zadig/pkg/tool/kube/updater"
+	"github.com/koderover/zadig/pkg/tool/kube/util"
+	"github.com/koderover/zadig/pkg/tool/prometheus"
+)
+
+// CanaryAnalysisJobCtl measures the metrics of the canary by Prometheus queries, and rolls back the
+// canary or blue-green deployment created by the quoted job when too many measurements failed.
+type CanaryAnalysisJobCtl struct {
+	job         *commonmodels.JobTask
+	workflowCtx *commonmodels.WorkflowTaskCtx
+	logger      *zap.SugaredLogger
+	jobTaskSpec *commonmodels.JobTaskCanaryAnalysisSpec
+	ack         func()
+}
+
+func NewCanaryAnalysisJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, ack func(), logger *zap.SugaredLogger) *CanaryAnalysisJobCtl {
+	jobTaskSpec := &commonmodels.JobTaskCanaryAnalysisSpec{}
+	if err := commonmodels.IToi(job.Spec, jobTaskSpec); err != nil {
+		logger.Error(err)
+	}
+	if jobTaskSpec.Events == nil {
+		jobTaskSpec.Events = &commonmodels.Events{}
+	}
+	job.Spec = jobTaskSpec
+	return &CanaryAnalysisJobCtl{
+		job:         job,
+		workflowCtx: workflowCtx,
+		logger:      logger,
+		ack:         ack,
+		jobTaskSpec: jobTaskSpec,
+	}
+}
+
+func (c *CanaryAnalysisJobCtl) Clean(ctx context.Context) {}
+
+func (c *CanaryAnalysisJobCtl) Run(ctx context.Context) {
+	client := prometheus.NewClient(c.jobTaskSpec.PrometheusAddress, c.jobTaskSpec.PrometheusToken)
+	failures := 0
+	for i := 0; i < c.jobTaskSpec.Count; i++ {
+		select {
+		case <-ctx.Done():
+			c.job.Status = config.StatusCancelled
+			return
+		case <-time.After(time.Duration(c.jobTaskSpec.Interval) * time.Second):
+		}
+		for _, metric := range c.jobTaskSpec.Metrics {
+			measurement := measureMetric(client, metric, time.Now())
+			c.jobTaskSpec.Measurements = append(c.jobTaskSpec.Measurements, measurement)
+			if measurement.Passed {
+				c.jobTaskSpec.Events.Info(fmt.Sprintf("metric %s: %v %s %v passed", metric.Name, measurement.Value, metric.Condition, metric.Threshold))
+				continue
+			}
+			failures++
+			if measurement.Error != "" {
+				c.jobTaskSpec.Events.Error(fmt.Sprintf("metric %s: query error: %s", metric.Name, measurement.Error))
+			} else {
+				c.jobTaskSpec.Events.Error(fmt.Sprintf("metric %s: %v %s %v failed", metric.Name, measurement.Value, metric.Condition, metric.Threshold))
+			}
+		}
+		c.ack()
+		if failures > c.jobTaskSpec.FailureLimit {
+			logError(c.job, fmt.Sprintf("canary analysis failed, %d measurements failed, the limit is %d", failures, c.jobTaskSpec.FailureLimit), c.logger)
+			if c.jobTaskSpec.Rollback {
+				c.rollback()
+			}
+			return
+		}
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("canary analysis passed, %d measurements failed", failures))
+	c.job.Status = config.StatusPassed
+}
+
+// measureMetric queries the metric at the time and checks the value against the threshold.
+func measureMetric(client *prometheus.Client, metric *commonmodels.AnalysisMetric, ts time.Time) *commonmodels.AnalysisMeasurement {
+	measurement := &commonmodels.AnalysisMeasurement{Metric: metric.Name, Time: ts.Unix()}
+	value, err := client.Query(metric.Query, ts)
+	if err != nil {
+		measurement.Error = err.Error()
+		return measurement
+	}
+	measurement.Value = value
+	switch metric.Condition {
+	case config.AnalysisConditionLT:
+		measurement.Passed = value < metric.Threshold
+	case config.AnalysisConditionLTE:
+		measurement.Passed = value <= metric.Threshold
+	case config.AnalysisConditionGT:
+		measurement.Passed = value > metric.Threshold
+	case config.AnalysisConditionGTE:
+		measurement.Passed = value >= metric.Threshold
+	}
+	return measurement
+}
+
+// rollback deletes the canary or blue deployment, the stable deployment still serves all the traffic then.
+func (c *CanaryAnalysisJobCtl) rollback() {
+	for _, target := range c.jobTaskSpec.RollbackTargets {
+		if err := c.rollbackTarget(target); err != nil {
+			msg := fmt.Sprintf("roll back %s error: %v", target.K8sServiceName, err)
+			c.logger.Error(msg)
+			c.jobTaskSpec.Events.Error(msg)
+			continue
+		}
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("%s rolled back", target.K8sServiceName))
+	}
+	c.ack()
+}
+
+func (c *CanaryAnalysisJobCtl) rollbackTarget(target *commonmodels.AnalysisRollbackTarget) error {
+	if target.WorkloadName == "" {
+		return nil
+	}
+	switch config.JobType(target.JobType) {
+	case config.JobK8sCanaryDeploy, config.JobK8sBlueGreenDeploy:
+		kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), target.ClusterID)
+		if err != nil {
+			return fmt.Errorf("can't init k8s client: %v", err)
+		}
+		return rollbackWorkload(target, kubeClient)
+	case config.JobIstioCanary:
+		istioCtl := NewIstioCanaryJobCtl(&commonmodels.JobTask{
+			Spec: &commonmodels.JobTaskIstioCanarySpec{
+				ClusterID:      target.ClusterID,
+				Namespace:      target.Namespace,
+				K8sServiceName: target.K8sServiceName,
+				WorkloadName:   target.WorkloadName,
+			},
+		}, c.workflowCtx, c.ack, c.logger)
+		if err := istioCtl.initClients(); err != nil {
+			return err
+		}
+		return istioCtl.rollback(context.TODO())
+	}
+	return nil
+}
+
+// rollbackWorkload deletes the canary workload, or the blue service and workload of the blue-green deployment.
+func rollbackWorkload(target *commonmodels.AnalysisRollbackTarget, kubeClient crClient.Client) error {
+	if config.JobType(target.JobType) == config.JobK8sCanaryDeploy {
+		return deleteWorkloadAndWait(target.Namespace, target.WorkloadName+CanaryDeploymentSuffix, target.WorkloadType, kubeClient)
+	}
+	if err := util.IgnoreNotFoundError(updater.DeleteService(target.Namespace, target.BlueK8sServiceName, kubeClient)); err != nil {
+		return err
+	}
+	return deleteWorkloadAndWait(target.Namespace, target.BlueWorkloadName, target.WorkloadType, kubeClient)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+	"github.com/koderover/zadig/pkg/tool/log"
+	"github.com/koderover/zadig/pkg/tool/prometheus"
+)
+
+var _ = Describe("Testing canary analysis job", func() {
+
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		log.Init(&log.Config{Level: "debug"})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/query" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Query().Get("query") {
+			case "error_rate":
+				fmt.Fprint(w, `{"status":"success","data":{"resultType":"scalar","result":[1435781451.781,"0.5"]}}`)
+			case "latency":
+				fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1435781451.781,"200"]}]}}`)
+			default:
+				fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("measureMetric", func() {
+		It("should check the value against the threshold", func() {
+			client := prometheus.NewClient(server.URL, "")
+			for _, c := range []struct {
+				condition string
+				threshold float64
+				passed    bool
+			}{
+				{config.AnalysisConditionLT, 1, true},
+				{config.AnalysisConditionLT, 0.5, false},
+				{config.AnalysisConditionLTE, 0.5, true},
+				{config.AnalysisConditionGT, 0.5, false},
+				{config.AnalysisConditionGTE, 0.5, true},
+				{config.AnalysisConditionGTE, 1, false},
+			} {
+				metric := &commonmodels.AnalysisMetric{Name: "errors", Query: "error_rate", Condition: c.condition, Threshold: c.threshold}
+				measurement := measureMetric(client, metric, time.Unix(100, 0))
+				Expect(measurement.Metric).To(Equal("errors"))
+				Expect(measurement.Time).To(Equal(int64(100)))
+				Expect(measurement.Value).To(Equal(0.5))
+				Expect(measurement.Error).To(BeEmpty())
+				Expect(measurement.Passed).To(Equal(c.passed), "%s %v", c.condition, c.threshold)
+			}
+		})
+		It("should read the value of the single sample", func() {
+			client := prometheus.NewClient(server.URL, "")
+			metric := &commonmodels.AnalysisMetric{Name: "latency", Query: "latency", Condition: config.AnalysisConditionLTE, Threshold: 200}
+			measurement := measureMetric(client, metric, time.Now())
+			Expect(measurement.Value).To(Equal(float64(200)))
+			Expect(measurement.Passed).To(BeTrue())
+		})
+		It("should fail the measurement when the query fails", func() {
+			client := prometheus.NewClient(server.URL, "")
+			metric := &commonmodels.AnalysisMetric{Name: "broken", Query: "rate(", Condition: config.AnalysisConditionLT, Threshold: 1}
+			measurement := measureMetric(client, metric, time.Now())
+			Expect(measurement.Passed).To(BeFalse())
+			Expect(measurement.Error).To(ContainSubstring("parse error"))
+		})
+	})
+
+	Context("CanaryAnalysisJobCtl", func() {
+		passing := &commonmodels.AnalysisMetric{Name: "errors", Query: "error_rate", Condition: config.AnalysisConditionLT, Threshold: 1}
+		failing := &commonmodels.AnalysisMetric{Name: "latency", Query: "latency", Condition: config.AnalysisConditionLT, Threshold: 100}
+
+		var acks int
+		newJobCtl := func(spec *commonmodels.JobTaskCanaryAnalysisSpec) *CanaryAnalysisJobCtl {
+			acks = 0
+			spec.PrometheusAddress = server.URL
+			spec.Events = &commonmodels.Events{}
+			return &CanaryAnalysisJobCtl{
+				job:         &commonmodels.JobTask{Spec: spec},
+				logger:      zap.NewNop().Sugar(),
+				jobTaskSpec: spec,
+				ack:         func() { acks++ },
+			}
+		}
+		messages := func(events *commonmodels.Events) []string {
+			msgs := []string{}
+			for _, event := range *events {
+				msgs = append(msgs, event.Message)
+			}
+			return msgs
+		}
+
+		It("should pass when all the measurements passed", func() {
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{Metrics: []*commonmodels.AnalysisMetric{passing}, Count: 3})
+			ctl.Run(context.TODO())
+			Expect(ctl.job.Status).To(Equal(config.StatusPassed))
+			Expect(ctl.jobTaskSpec.Measurements).To(HaveLen(3))
+			Expect(acks).To(Equal(3))
+		})
+		It("should pass when the failed measurements do not exceed the limit", func() {
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{Metrics: []*commonmodels.AnalysisMetric{passing, failing}, Count: 2, FailureLimit: 2})
+			ctl.Run(context.TODO())
+			Expect(ctl.job.Status).To(Equal(config.StatusPassed))
+			Expect(ctl.jobTaskSpec.Measurements).To(HaveLen(4))
+			Expect(messages(ctl.jobTaskSpec.Events)).To(ContainElement("canary analysis passed, 2 measurements failed"))
+		})
+		It("should stop as soon as the failed measurements exceed the limit", func() {
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{Metrics: []*commonmodels.AnalysisMetric{failing}, Count: 5, FailureLimit: 1})
+			ctl.Run(context.TODO())
+			Expect(ctl.job.Status).To(Equal(config.StatusFailed))
+			Expect(ctl.job.Error).To(Equal("canary analysis failed, 2 measurements failed, the limit is 1"))
+			Expect(ctl.jobTaskSpec.Measurements).To(HaveLen(2))
+			Expect(messages(ctl.jobTaskSpec.Events)).NotTo(ContainElement(ContainSubstring("rolled back")))
+		})
+		It("should count the query errors as failures", func() {
+			broken := &commonmodels.AnalysisMetric{Name: "broken", Query: "rate(", Condition: config.AnalysisConditionLT, Threshold: 1}
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{Metrics: []*commonmodels.AnalysisMetric{broken}, Count: 1})
+			ctl.Run(context.TODO())
+			Expect(ctl.job.Status).To(Equal(config.StatusFailed))
+			Expect(messages(ctl.jobTaskSpec.Events)).To(ContainElement(ContainSubstring("metric broken: query error")))
+		})
+		It("should roll back the targets when the analysis failed", func() {
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{
+				Metrics:         []*commonmodels.AnalysisMetric{failing},
+				Count:           1,
+				Rollback:        true,
+				RollbackTargets: []*commonmodels.AnalysisRollbackTarget{{JobType: string(config.JobK8sCanaryDeploy), K8sServiceName: "app"}},
+			})
+			ctl.Run(context.TODO())
+			Expect(ctl.job.Status).To(Equal(config.StatusFailed))
+			Expect(messages(ctl.jobTaskSpec.Events)).To(ContainElement("app rolled back"))
+			Expect(acks).To(Equal(2))
+		})
+		It("should be cancelled when the context is done", func() {
+			ctl := newJobCtl(&commonmodels.JobTaskCanaryAnalysisSpec{Metrics: []*commonmodels.AnalysisMetric{passing}, Count: 1, Interval: 60})
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+			ctl.Run(ctx)
+			Expect(ctl.job.Status).To(Equal(config.StatusCancelled))
+			Expect(ctl.jobTaskSpec.Measurements).To(BeEmpty())
+		})
+	})
+
+	Context("rollbackWorkload", func() {
+		It("should delete the canary deployment only", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app" + CanaryDeploymentSuffix, Namespace: "dev"}},
+			).Build()
+			target := &commonmodels.AnalysisRollbackTarget{JobType: string(config.JobK8sCanaryDeploy), Namespace: "dev", WorkloadName: "app"}
+			Expect(rollbackWorkload(target, kubeClient)).NotTo(HaveOccurred())
+
+			_, found, err := getter.GetDeployment("dev", "app"+CanaryDeploymentSuffix, kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			_, found, err = getter.GetDeployment("dev", "app", kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+		})
+		It("should delete the blue service and deployment", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "app-blue", Namespace: "dev"}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app-blue", Namespace: "dev"}},
+			).Build()
+			target := &commonmodels.AnalysisRollbackTarget{
+				JobType:            string(config.JobK8sBlueGreenDeploy),
+				Namespace:          "dev",
+				WorkloadName:       "app",
+				BlueK8sServiceName: "app-blue",
+				BlueWorkloadName:   "app-blue",
+			}
+			Expect(rollbackWorkload(target, kubeClient)).NotTo(HaveOccurred())
+
+			_, found, err := getter.GetService("dev", "app-blue", kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			_, found, err = getter.GetDeployment("dev", "app-blue", kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+		It("should ignore the blue resources already deleted", func() {
+			target := &commonmodels.AnalysisRollbackTarget{
+				JobType:            string(config.JobK8sBlueGreenDeploy),
+				Namespace:          "dev",
+				WorkloadName:       "app",
+				BlueK8sServiceName: "app-blue",
+				BlueWorkloadName:   "app-blue",
+			}
+			Expect(rollbackWorkload(target, fake.NewClientBuilder().Build())).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -24,13 +24,15 @@ import (
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	crClient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
-	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
 	"github.com/koderover/zadig/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/pkg/tool/kube/updater"
 )
@@ -93,15 +95,46 @@ func (c *CanaryDeployJobCtl) run(ctx context.Context) error {
 		return errors.New(msg)
 	}
 
-	deployment, exist, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
-	if err != nil || !exist {
-		msg := fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
+	kind := workloadKind(c.jobTaskSpec.WorkloadType)
+	if strings.HasSuffix(c.jobTaskSpec.WorkloadName, CanaryDeploymentSuffix) {
+		msg := fmt.Sprintf("canary %s already exists", kind)
 		logError(c.job, msg, c.logger)
 		c.jobTaskSpec.Events.Error(msg)
 		return errors.New(msg)
 	}
+	c.jobTaskSpec.CanaryWorkloadName = c.jobTaskSpec.WorkloadName + CanaryDeploymentSuffix
+
+	var (
+		canaryObjectMeta  *metav1.ObjectMeta
+		canaryPodTemplate *corev1.PodTemplateSpec
+		canaryDeployment  *appsv1.Deployment
+		canaryStatefulSet *appsv1.StatefulSet
+	)
+	if c.jobTaskSpec.WorkloadType == setting.StatefulSet {
+		statefulSet, exist, err := getter.GetStatefulSet(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
+		if err != nil || !exist {
+			msg := fmt.Sprintf("statefulset: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
+			logError(c.job, msg, c.logger)
+			c.jobTaskSpec.Events.Error(msg)
+			return errors.New(msg)
+		}
+		canaryStatefulSet = statefulSet
+		canaryStatefulSet.Spec.Replicas = int32Ptr(int32(c.jobTaskSpec.CanaryReplica))
+		canaryObjectMeta, canaryPodTemplate = &canaryStatefulSet.ObjectMeta, &canaryStatefulSet.Spec.Template
+	} else {
+		deployment, exist, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
+		if err != nil || !exist {
+			msg := fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err)
+			logError(c.job, msg, c.logger)
+			c.jobTaskSpec.Events.Error(msg)
+			return errors.New(msg)
+		}
+		canaryDeployment = deployment
+		canaryDeployment.Spec.Replicas = int32Ptr(int32(c.jobTaskSpec.CanaryReplica))
+		canaryObjectMeta, canaryPodTemplate = &canaryDeployment.ObjectMeta, &canaryDeployment.Spec.Template
+	}
 
-	for _, container := range deployment.Spec.Template.Spec.Containers {
+	for _, container := range canaryPodTemplate.Spec.Containers {
 		if container.Name != c.jobTaskSpec.ContainerName {
 			continue
 		}
@@ -110,29 +143,26 @@ func (c *CanaryDeployJobCtl) run(ctx context.Context) error {
 		break
 	}
 
-	if strings.HasSuffix(deployment.Name, CanaryDeploymentSuffix) {
-		msg := "canary deployment already exists"
-		logError(c.job, msg, c.logger)
-		c.jobTaskSpec.Events.Error(msg)
-		return errors.New(msg)
-	}
-	deployment.Name = deployment.Name + CanaryDeploymentSuffix
-	c.jobTaskSpec.CanaryWorkloadName = deployment.Name
-	deployment.Spec.Replicas = int32Ptr(int32(c.jobTaskSpec.CanaryReplica))
-	deployment.ObjectMeta.ResourceVersion = ""
-	for i := range deployment.Spec.Template.Spec.Containers {
-		if deployment.Spec.Template.Spec.Containers[i].Name == c.jobTaskSpec.ContainerName {
-			deployment.Spec.Template.Spec.Containers[i].Image = c.jobTaskSpec.Image
+	canaryObjectMeta.Name = c.jobTaskSpec.CanaryWorkloadName
+	canaryObjectMeta.ResourceVersion = ""
+	for i := range canaryPodTemplate.Spec.Containers {
+		if canaryPodTemplate.Spec.Containers[i].Name == c.jobTaskSpec.ContainerName {
+			canaryPodTemplate.Spec.Containers[i].Image = c.jobTaskSpec.Image
 			break
 		}
 	}
-	if err := updater.CreateOrPatchDeployment(deployment, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("create canary deployment: %s failed: %v", c.jobTaskSpec.CanaryWorkloadName, err)
+	if canaryStatefulSet != nil {
+		err = updater.CreateOrPatchStatefulSet(canaryStatefulSet, c.kubeClient)
+	} else {
+		err = updater.CreateOrPatchDeployment(canaryDeployment, c.kubeClient)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("create canary %s: %s failed: %v", kind, c.jobTaskSpec.CanaryWorkloadName, err)
 		logError(c.job, msg, c.logger)
 		c.jobTaskSpec.Events.Error(msg)
 		return errors.New(msg)
 	}
-	msg := fmt.Sprintf("canary deployment: %s created", deployment.Name)
+	msg := fmt.Sprintf("canary %s: %s created", kind, c.jobTaskSpec.CanaryWorkloadName)
 	c.jobTaskSpec.Events.Info(msg)
 	c.ack()
 	return nil
@@ -148,24 +178,25 @@ func (c *CanaryDeployJobCtl) wait(ctx context.Context) {
 
 		case <-timeout:
 			c.job.Status = config.StatusTimeout
-			msg := fmt.Sprintf("timeout waiting for the canary deployment: %s to run", c.jobTaskSpec.CanaryWorkloadName)
+			msg := fmt.Sprintf("timeout waiting for the canary %s: %s to run", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.CanaryWorkloadName)
 			c.jobTaskSpec.Events.Info(msg)
 			return
 
 		default:
 			time.Sleep(time.Second * 2)
-			d, found, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.CanaryWorkloadName, c.kubeClient)
-			if err != nil || !found {
+			ready, err := workloadReady(c.jobTaskSpec.Namespace, c.jobTaskSpec.CanaryWorkloadName, c.jobTaskSpec.WorkloadType, c.kubeClient)
+			if err != nil {
 				c.logger.Errorf(
-					"failed to check deployment ready status %s/%s - %v",
+					"failed to check %s ready status %s/%s - %v",
+					workloadKind(c.jobTaskSpec.WorkloadType),
 					c.jobTaskSpec.Namespace,
 					c.jobTaskSpec.CanaryWorkloadName,
 					err,
 				)
 			} else {
-				if wrapper.Deployment(d).Ready() {
+				if ready {
 					c.job.Status = config.StatusPassed
-					msg := fmt.Sprintf("canary deployment: %s create successfully", c.jobTaskSpec.CanaryWorkloadName)
+					msg := fmt.Sprintf("canary %s: %s create successfully", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.CanaryWorkloadName)
 					c.jobTaskSpec.Events.Info(msg)
 					return
 				}
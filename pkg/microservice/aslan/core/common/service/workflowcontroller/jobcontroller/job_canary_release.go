@@ -28,9 +28,6 @@ import (
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
-	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
-	"github.com/koderover/zadig/pkg/tool/kube/getter"
-	"github.com/koderover/zadig/pkg/tool/kube/updater"
 	"github.com/pkg/errors"
 )
 
@@ -69,8 +66,8 @@ func (c *CanaryReleaseJobCtl) Clean(ctx context.Context) {
 	}
 
 	canarydeploymentName := c.jobTaskSpec.WorkloadName + CanaryDeploymentSuffix
-	if err := updater.DeleteDeploymentAndWait(c.jobTaskSpec.Namespace, canarydeploymentName, kubeClient); err != nil {
-		c.logger.Errorf("delete canary deployment %s error: %v", canarydeploymentName, err)
+	if err := deleteWorkloadAndWait(c.jobTaskSpec.Namespace, canarydeploymentName, c.jobTaskSpec.WorkloadType, kubeClient); err != nil {
+		c.logger.Errorf("delete canary %s %s error: %v", workloadKind(c.jobTaskSpec.WorkloadType), canarydeploymentName, err)
 	}
 }
 
@@ -91,23 +88,24 @@ func (c *CanaryReleaseJobCtl) run(ctx context.Context) error {
 		return errors.New(msg)
 	}
 
+	kind := workloadKind(c.jobTaskSpec.WorkloadType)
 	canarydeploymentName := c.jobTaskSpec.WorkloadName + CanaryDeploymentSuffix
-	if err := updater.DeleteDeploymentAndWait(c.jobTaskSpec.Namespace, canarydeploymentName, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("delete canary deployment %s error: %v", canarydeploymentName, err)
+	if err := deleteWorkloadAndWait(c.jobTaskSpec.Namespace, canarydeploymentName, c.jobTaskSpec.WorkloadType, c.kubeClient); err != nil {
+		msg := fmt.Sprintf("delete canary %s %s error: %v", kind, canarydeploymentName, err)
 		logError(c.job, msg, c.logger)
 		c.jobTaskSpec.Events.Error(msg)
 		return errors.New(msg)
 	}
-	msg := fmt.Sprintf("canary deployment: %s deleted", canarydeploymentName)
+	msg := fmt.Sprintf("canary %s: %s deleted", kind, canarydeploymentName)
 	c.jobTaskSpec.Events.Info(msg)
 	c.ack()
-	if err := updater.UpdateDeploymentImage(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.jobTaskSpec.ContainerName, c.jobTaskSpec.Image, c.kubeClient); err != nil {
-		msg := fmt.Sprintf("update deployment: %s image error: %v", c.jobTaskSpec.WorkloadName, err)
+	if err := updateWorkloadImage(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.jobTaskSpec.WorkloadType, c.jobTaskSpec.ContainerName, c.jobTaskSpec.Image, c.kubeClient); err != nil {
+		msg := fmt.Sprintf("update %s: %s image error: %v", kind, c.jobTaskSpec.WorkloadName, err)
 		logError(c.job, msg, c.logger)
 		c.jobTaskSpec.Events.Error(msg)
 		return errors.New(msg)
 	}
-	msg = fmt.Sprintf("updating deployment: %s image", c.jobTaskSpec.WorkloadName)
+	msg = fmt.Sprintf("updating %s: %s image", kind, c.jobTaskSpec.WorkloadName)
 	c.jobTaskSpec.Events.Info(msg)
 	c.ack()
 	return nil
@@ -123,24 +121,25 @@ func (c *CanaryReleaseJobCtl) wait(ctx context.Context) {
 
 		case <-timeout:
 			c.job.Status = config.StatusTimeout
-			msg := fmt.Sprintf("timeout waiting for the deployment: %s to run", c.jobTaskSpec.WorkloadName)
+			msg := fmt.Sprintf("timeout waiting for the %s: %s to run", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.WorkloadName)
 			c.jobTaskSpec.Events.Info(msg)
 			return
 
 		default:
 			time.Sleep(time.Second * 2)
-			d, found, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.kubeClient)
-			if err != nil || !found {
+			ready, err := workloadReady(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.jobTaskSpec.WorkloadType, c.kubeClient)
+			if err != nil {
 				c.logger.Errorf(
-					"failed to check deployment ready status %s/%s - %v",
+					"failed to check %s ready status %s/%s - %v",
+					workloadKind(c.jobTaskSpec.WorkloadType),
 					c.jobTaskSpec.Namespace,
 					c.jobTaskSpec.WorkloadName,
 					err,
 				)
 			} else {
-				if wrapper.Deployment(d).Ready() {
+				if ready {
 					c.job.Status = config.StatusPassed
-					msg := fmt.Sprintf("deployment: %s image updateed successfully", c.jobTaskSpec.WorkloadName)
+					msg := fmt.Sprintf("%s: %s image updateed successfully", workloadKind(c.jobTaskSpec.WorkloadType), c.jobTaskSpec.WorkloadName)
 					c.jobTaskSpec.Events.Info(msg)
 					return
 				}
@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -31,6 +32,7 @@ import (
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/kube"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
 	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
@@ -55,6 +57,9 @@ func NewDeployJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.Workfl
 	if err := commonmodels.IToi(job.Spec, jobTaskSpec); err != nil {
 		logger.Error(err)
 	}
+	if jobTaskSpec.HealthCheck != nil && jobTaskSpec.Events == nil {
+		jobTaskSpec.Events = &commonmodels.Events{}
+	}
 	return &DeployJobCtl{
 		job:         job,
 		workflowCtx: workflowCtx,
@@ -72,9 +77,60 @@ func (c *DeployJobCtl) Run(ctx context.Context) {
 	}
 	if c.jobTaskSpec.SkipCheckRunStatus {
 		c.job.Status = config.StatusPassed
+	} else {
+		c.wait(ctx)
+	}
+	if c.job.Status == config.StatusPassed && c.jobTaskSpec.HealthCheck != nil {
+		c.healthCheck(ctx)
+	}
+	if c.job.Status == config.StatusPassed {
+		c.createEnvServiceVersion()
+	}
+}
+
+// healthCheck verifies the service, and restores the images replaced when the checks failed,
+// the job fails after the restored workloads are ready, so the following jobs run against the previous version.
+func (c *DeployJobCtl) healthCheck(ctx context.Context) {
+	target := &healthCheckTarget{
+		EnvName:     c.jobTaskSpec.Env,
+		Namespace:   c.namespace,
+		ServiceName: c.jobTaskSpec.ServiceName,
+		KubeClient:  c.kubeClient,
+	}
+	checkErr := runHealthCheck(ctx, c.jobTaskSpec.HealthCheck, target, c.jobTaskSpec.Events, c.ack, c.logger)
+	if checkErr == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		c.job.Status = config.StatusCancelled
+		return
+	}
+	if !c.jobTaskSpec.HealthCheck.Rollback {
+		logError(c.job, checkErr.Error(), c.logger)
 		return
 	}
-	c.wait(ctx)
+	for _, resource := range c.jobTaskSpec.ReplaceResources {
+		if err := updateWorkloadImage(c.namespace, resource.Name, resource.Kind, resource.Container, resource.Origin, c.kubeClient); err != nil {
+			msg := fmt.Sprintf("failed to restore image of %s/%s/%s: %v", c.namespace, resource.Name, resource.Container, err)
+			c.logger.Error(msg)
+			c.jobTaskSpec.Events.Error(msg)
+			continue
+		}
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("image of %s/%s restored to %s", resource.Name, resource.Container, resource.Origin))
+	}
+	c.ack()
+
+	if err := waitWorkloadsRolledOut(ctx, c.namespace, c.jobTaskSpec.ReplaceResources, time.Duration(c.timeout())*time.Second, c.kubeClient); err != nil {
+		if ctx.Err() != nil {
+			c.job.Status = config.StatusCancelled
+			return
+		}
+		c.jobTaskSpec.Events.Error(fmt.Sprintf("restored workloads are not ready: %v", err))
+	} else {
+		c.jobTaskSpec.Events.Info("restored workloads are ready")
+	}
+	logError(c.job, checkErr.Error(), c.logger)
+	c.ack()
 }
 
 func (c *DeployJobCtl) run(ctx context.Context) error {
@@ -355,6 +411,72 @@ func (c *DeployJobCtl) wait(ctx context.Context) {
 	}
 }
 
+// createEnvServiceVersion records the images deployed, so the service can be rolled back to this version later.
+func (c *DeployJobCtl) createEnvServiceVersion() {
+	env, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{
+		Name:    c.workflowCtx.ProjectName,
+		EnvName: c.jobTaskSpec.Env,
+	})
+	if err != nil {
+		c.logger.Errorf("failed to find env %s, err: %s", c.jobTaskSpec.Env, err)
+		return
+	}
+	prodSvc, ok := env.GetServiceMap()[c.jobTaskSpec.ServiceName]
+	if !ok {
+		return
+	}
+
+	// the job only updates the images of the workloads, so the manifests deployed are the last recorded ones with the new images.
+	last, err := commonrepo.NewEnvServiceVersionColl().GetLatest(env.ProductName, env.EnvName, prodSvc.ServiceName)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.logger.Warnf("failed to find the latest version of service %s in env %s, err: %s", prodSvc.ServiceName, env.EnvName, err)
+	}
+
+	version := newDeployedServiceVersion(env, prodSvc, last, c.jobTaskSpec.ServiceModule, c.jobTaskSpec.Image)
+	version.WorkflowName = c.workflowCtx.WorkflowName
+	version.TaskID = c.workflowCtx.TaskID
+	version.CreateBy = c.workflowCtx.TaskCreator
+	if err := commonrepo.NewEnvServiceVersionColl().Create(version); err != nil {
+		c.logger.Errorf("failed to create version of service %s in env %s, err: %s", prodSvc.ServiceName, env.EnvName, err)
+	}
+}
+
+// newDeployedServiceVersion returns the version of the service in the env after the image of the container is replaced,
+// the renderset comes from the service or the env, the containers and the yaml from the last version if there is one.
+// The containers of the service in the env are used only for the first version, since the deploy jobs don't write the
+// images back to the env.
+func newDeployedServiceVersion(env *commonmodels.Product, prodSvc *commonmodels.ProductService, last *commonmodels.EnvServiceVersion, containerName, image string) *commonmodels.EnvServiceVersion {
+	containers := prodSvc.Containers
+	if last != nil && last.Service != nil && len(last.Service.Containers) > 0 {
+		containers = last.Service.Containers
+	}
+	svc := *prodSvc
+	svc.Containers = make([]*commonmodels.Container, 0, len(containers))
+	for _, container := range containers {
+		newContainer := *container
+		if container.Name == containerName {
+			newContainer.Image = image
+		}
+		svc.Containers = append(svc.Containers, &newContainer)
+	}
+	if svc.Render == nil && env.Render != nil {
+		render := *env.Render
+		svc.Render = &render
+	}
+
+	version := &commonmodels.EnvServiceVersion{
+		ProductName: env.ProductName,
+		EnvName:     env.EnvName,
+		Namespace:   env.Namespace,
+		ServiceName: svc.ServiceName,
+		Service:     &svc,
+	}
+	if last != nil && last.Service != nil && last.Yaml != "" {
+		version.Yaml = kube.ReplaceContainerImages(last.Yaml, last.Service.Containers, svc.Containers)
+	}
+	return version
+}
+
 func (c *DeployJobCtl) timeout() int {
 	if c.jobTaskSpec.Timeout == 0 {
 		c.jobTaskSpec.Timeout = setting.DeployTimeout
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing deploy job", func() {
+
+	Context("newDeployedServiceVersion", func() {
+		env := &commonmodels.Product{
+			ProductName: "project",
+			EnvName:     "dev",
+			Namespace:   "project-env-dev",
+			Render:      &commonmodels.RenderInfo{Name: "project-dev", Revision: 3, ProductTmpl: "project"},
+		}
+		prodSvc := &commonmodels.ProductService{
+			ServiceName: "web",
+			ProductName: "project",
+			Type:        "k8s",
+			Revision:    2,
+			Containers: []*commonmodels.Container{
+				{Name: "web", Image: "koderover/web:v1"},
+				{Name: "sidecar", Image: "koderover/sidecar:v1"},
+			},
+		}
+
+		It("should replace the image of the container only", func() {
+			version := newDeployedServiceVersion(env, prodSvc, nil, "web", "koderover/web:v2")
+			Expect(version.ServiceName).To(Equal("web"))
+			Expect(version.Namespace).To(Equal("project-env-dev"))
+			Expect(version.Service.Containers[0].Image).To(Equal("koderover/web:v2"))
+			Expect(version.Service.Containers[1].Image).To(Equal("koderover/sidecar:v1"))
+			Expect(prodSvc.Containers[0].Image).To(Equal("koderover/web:v1"))
+			Expect(version.Yaml).To(BeEmpty())
+		})
+
+		It("should record the renderset of the env if the service has none", func() {
+			version := newDeployedServiceVersion(env, prodSvc, nil, "web", "koderover/web:v2")
+			Expect(version.Service.Render).To(Equal(env.Render))
+			Expect(version.Service.Render).NotTo(BeIdenticalTo(env.Render))
+			Expect(prodSvc.Render).To(BeNil())
+		})
+
+		It("should record the renderset of the service", func() {
+			svc := *prodSvc
+			svc.Render = &commonmodels.RenderInfo{Name: "project-dev", Revision: 2, ProductTmpl: "project"}
+			version := newDeployedServiceVersion(env, &svc, nil, "web", "koderover/web:v2")
+			Expect(version.Service.Render.Revision).To(Equal(int64(2)))
+		})
+
+		It("should record the yaml of the last version with the new image", func() {
+			last := &commonmodels.EnvServiceVersion{
+				Service: &commonmodels.ProductService{Containers: prodSvc.Containers},
+				Yaml:    "containers:\n- name: web\n  image: koderover/web:v1\n- name: sidecar\n  image: koderover/sidecar:v1\n",
+			}
+			version := newDeployedServiceVersion(env, prodSvc, last, "web", "koderover/web:v2")
+			Expect(version.Yaml).To(Equal("containers:\n- name: web\n  image: koderover/web:v2\n- name: sidecar\n  image: koderover/sidecar:v1\n"))
+		})
+
+		It("should replace the image in the containers of the last version", func() {
+			last := &commonmodels.EnvServiceVersion{
+				Service: &commonmodels.ProductService{Containers: []*commonmodels.Container{
+					{Name: "web", Image: "koderover/web:v2"},
+					{Name: "sidecar", Image: "koderover/sidecar:v2"},
+				}},
+				Yaml: "containers:\n- name: web\n  image: koderover/web:v2\n- name: sidecar\n  image: koderover/sidecar:v2\n",
+			}
+			version := newDeployedServiceVersion(env, prodSvc, last, "web", "koderover/web:v3")
+			Expect(version.Service.Containers[0].Image).To(Equal("koderover/web:v3"))
+			Expect(version.Service.Containers[1].Image).To(Equal("koderover/sidecar:v2"))
+			Expect(version.Service.Revision).To(Equal(int64(2)))
+			Expect(last.Service.Containers[0].Image).To(Equal("koderover/web:v2"))
+			Expect(version.Yaml).To(Equal("containers:\n- name: web\n  image: koderover/web:v3\n- name: sidecar\n  image: koderover/sidecar:v2\n"))
+		})
+	})
+})
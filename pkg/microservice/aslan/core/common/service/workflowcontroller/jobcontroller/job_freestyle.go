@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -28,14 +29,14 @@ import (
 	"k8s.io/client-go/rest"
 	crClient "sigs.k8s.io/controller-runtime/pkg/client"
 
-	zadigconfig "github.com/koderover/zadig/pkg/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/workflowcontroller/stepcontroller"
 	"github.com/koderover/zadig/pkg/setting"
 	"github.com/koderover/zadig/pkg/tool/dockerhost"
-	krkubeclient "github.com/koderover/zadig/pkg/tool/kube/client"
 	"github.com/koderover/zadig/pkg/tool/kube/updater"
+	"github.com/koderover/zadig/pkg/types/job"
+	"github.com/koderover/zadig/pkg/util"
 )
 
 const (
@@ -84,6 +85,25 @@ func (c *FreestyleJobCtl) Run(ctx context.Context) {
 	c.complete(ctx)
 }
 
+// Resume waits for the K8s job started before aslan restarted, the job will
+// be created again if it no longer exists.
+func (c *FreestyleJobCtl) Resume(ctx context.Context) {
+	if err := c.prepare(ctx); err != nil {
+		return
+	}
+	if err := c.initKubeClients(); err != nil {
+		return
+	}
+	if !k8sJobExists(c.jobTaskSpec.Properties.Namespace, c.job.K8sJobName, c.kubeclient) {
+		c.logger.Infof("k8s job %s not found, create it again", c.job.K8sJobName)
+		if err := c.run(ctx); err != nil {
+			return
+		}
+	}
+	c.wait(ctx)
+	c.complete(ctx)
+}
+
 func (c *FreestyleJobCtl) prepare(ctx context.Context) error {
 	// set default timeout
 	if c.jobTaskSpec.Properties.Timeout <= 0 {
@@ -106,29 +126,13 @@ func (c *FreestyleJobCtl) prepare(ctx context.Context) error {
 }
 
 func (c *FreestyleJobCtl) run(ctx context.Context) error {
-	// get kube client
-	hubServerAddr := config.HubServerAddress()
-	switch c.jobTaskSpec.Properties.ClusterID {
-	case setting.LocalClusterID:
-		c.jobTaskSpec.Properties.Namespace = zadigconfig.Namespace()
-		c.kubeclient = krkubeclient.Client()
-		c.clientset = krkubeclient.Clientset()
-		c.restConfig = krkubeclient.RESTConfig()
-	default:
-		c.jobTaskSpec.Properties.Namespace = setting.AttachedClusterNamespace
-
-		crClient, clientset, restConfig, err := GetK8sClients(hubServerAddr, c.jobTaskSpec.Properties.ClusterID)
-		if err != nil {
-			logError(c.job, err.Error(), c.logger)
-			return err
-		}
-		c.kubeclient = crClient
-		c.clientset = clientset
-		c.restConfig = restConfig
+	if err := c.initKubeClients(); err != nil {
+		return err
 	}
 
 	// decide which docker host to use.
 	// TODO: do not use code in warpdrive moudule, should move to a public place
+	hubServerAddr := config.HubServerAddress()
 	dockerhosts := dockerhost.NewDockerHosts(hubServerAddr, c.logger)
 	c.jobTaskSpec.Properties.DockerHost = dockerhosts.GetBestHost(dockerhost.ClusterID(c.jobTaskSpec.Properties.ClusterID), "")
 
@@ -154,6 +158,7 @@ func (c *FreestyleJobCtl) run(ctx context.Context) error {
 	}
 
 	c.jobTaskSpec.Properties.DockerHost = dockerHost
+	c.jobTaskSpec.StepMarkerNonce = strings.ReplaceAll(util.UUID(), "-", "")
 
 	jobCtxBytes, err := yaml.Marshal(BuildJobExcutorContext(c.jobTaskSpec, c.job, c.workflowCtx, c.logger))
 	if err != nil {
@@ -219,9 +224,98 @@ func (c *FreestyleJobCtl) run(ctx context.Context) error {
 	return nil
 }
 
+func (c *FreestyleJobCtl) initKubeClients() error {
+	namespace, kubeclient, clientset, restConfig, err := getJobRuntimeClients(c.jobTaskSpec.Properties.ClusterID)
+	if err != nil {
+		logError(c.job, err.Error(), c.logger)
+		return err
+	}
+	c.jobTaskSpec.Properties.Namespace = namespace
+	c.kubeclient = kubeclient
+	c.clientset = clientset
+	c.restConfig = restConfig
+	return nil
+}
+
 func (c *FreestyleJobCtl) wait(ctx context.Context) {
 	status := waitJobEndWithFile(ctx, int(c.jobTaskSpec.Properties.Timeout), c.jobTaskSpec.Properties.Namespace, c.job.K8sJobName, true, c.kubeclient, c.clientset, c.restConfig, c.logger)
 	c.job.Status = status
+	// the step results are synced for timeout and cancelled jobs too, the steps ended before are kept.
+	c.syncStepResults()
+}
+
+// syncStepResults records the status of every step reported by the job executor.
+func (c *FreestyleJobCtl) syncStepResults() {
+	results, err := getStepResults(c.jobTaskSpec.Properties.Namespace, c.job.K8sJobName, c.kubeclient, c.clientset, c.restConfig)
+	if err != nil {
+		c.logger.Warnf("get step results of job %s error: %v", c.job.Name, err)
+		return
+	}
+	resultMap := make(map[string]*job.StepResult, len(results))
+	for _, result := range results {
+		resultMap[result.Name] = result
+	}
+	for _, step := range c.jobTaskSpec.Steps {
+		result, ok := resultMap[step.Name]
+		if !ok {
+			continue
+		}
+		step.Status = config.Status(result.Status)
+		step.Error = result.Error
+		if result.Status == job.StepStatusTimeout && c.job.Error == "" {
+			c.job.Error = result.Error
+		}
+	}
+	c.job.Spec = c.jobTaskSpec
+	c.ack()
+}
+
+// syncStepLogs records the exit code and duration of every step from the markers in the job log,
+// and the status of steps when the step results were not read after the job ended.
+func (c *FreestyleJobCtl) syncStepLogs(jobLog string) {
+	stepLogs := job.SplitStepLogs(jobLog, c.jobTaskSpec.StepMarkerNonce)
+	if len(stepLogs) == 0 {
+		return
+	}
+	stepLogMap := make(map[string]*job.StepLog, len(stepLogs))
+	for _, stepLog := range stepLogs {
+		stepLogMap[stepLog.Name] = stepLog
+	}
+	for _, step := range c.jobTaskSpec.Steps {
+		stepLog, ok := stepLogMap[step.Name]
+		if !ok {
+			continue
+		}
+		step.ExitCode = stepLog.ExitCode
+		step.StartTime = stepLog.StartTime
+		step.EndTime = stepLog.EndTime
+		if step.Status == "" && stepLog.Status != "" {
+			step.Status = config.Status(stepLog.Status)
+			step.Error = stepLog.Error
+		}
+	}
+	c.job.Spec = c.jobTaskSpec
+}
+
+// endInterruptedSteps marks the steps left without status by a job timeout or cancellation with the status of the job,
+// they have no end marker since the executor is killed while running them.
+func (c *FreestyleJobCtl) endInterruptedSteps() {
+	if c.job.Status != config.StatusTimeout && c.job.Status != config.StatusCancelled {
+		return
+	}
+	for _, step := range c.jobTaskSpec.Steps {
+		if step.Status != "" && step.Status != config.StatusRunning {
+			continue
+		}
+		if step.StartTime == 0 {
+			continue
+		}
+		step.Status = c.job.Status
+		if step.EndTime == 0 {
+			step.EndTime = time.Now().Unix()
+		}
+	}
+	c.job.Spec = c.jobTaskSpec
 }
 
 func (c *FreestyleJobCtl) complete(ctx context.Context) {
@@ -242,23 +336,37 @@ func (c *FreestyleJobCtl) complete(ctx context.Context) {
 		}()
 	}()
 
-	// get job outputs info from pod terminate message.
-	outputs, err := getJobOutput(c.jobTaskSpec.Properties.Namespace, c.job.Name, jobLabel, c.kubeclient)
+	// get job outputs info from object storage, or from pod terminate message if there is no object storage.
+	// outputs of failed jobs are collected too.
+	var outputs []*job.JobOutput
+	var err error
+	if len(c.job.Outputs) > 0 {
+		if storage, storageErr := jobOutputStorage(c.workflowCtx.WorkflowName, c.workflowCtx.TaskID, c.job.Name, c.job.K8sJobName); storageErr == nil {
+			outputs, err = getJobOutputFromStorage(storage)
+		} else {
+			outputs, err = getJobOutput(c.jobTaskSpec.Properties.Namespace, c.job.Name, jobLabel, c.kubeclient)
+		}
+	}
 	if err != nil {
 		c.logger.Error(err)
-		c.job.Error = err.Error()
+		// a failed job may stop before its outputs are written, keep the error of the job.
+		if c.job.Status == config.StatusPassed {
+			c.job.Error = err.Error()
+		}
 	}
 
-	// write jobs output info to globalcontext so other job can use like this $(jobName.outputName)
-	for _, output := range outputs {
-		c.workflowCtx.GlobalContextSet(strings.Join([]string{"workflow", c.job.Name, output.Name}, "."), output.Value)
-	}
+	// write jobs output info to globalcontext so other job can use like this {{.job.jobName.output.outputName}}
+	setJobOutputs(c.workflowCtx, c.job.Name, outputs)
 
-	if err := saveContainerLog(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient); err != nil {
+	jobLog, err := saveContainerLog(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient)
+	if err != nil {
 		c.logger.Error(err)
 		c.job.Error = err.Error()
+		c.endInterruptedSteps()
 		return
 	}
+	c.syncStepLogs(jobLog)
+	c.endInterruptedSteps()
 	if err := stepcontroller.SummarizeSteps(ctx, c.workflowCtx, &c.jobTaskSpec.Properties.Paths, c.jobTaskSpec.Steps, c.logger); err != nil {
 		c.logger.Error(err)
 		c.job.Error = err.Error()
@@ -281,7 +389,7 @@ func BuildJobExcutorContext(jobTaskSpec *commonmodels.JobTaskFreestyleSpec, job
 		outputs = append(outputs, output.Name)
 	}
 
-	return &JobContext{
+	jobCtx := &JobContext{
 		Name:         job.Name,
 		Envs:         envVars,
 		SecretEnvs:   secretEnvVars,
@@ -289,7 +397,28 @@ func BuildJobExcutorContext(jobTaskSpec *commonmodels.JobTaskFreestyleSpec, job
 		Workspace:    workflowCtx.Workspace,
 		TaskID:       workflowCtx.TaskID,
 		Outputs:      outputs,
+		OutputTypes:  outputTypes(job.Outputs),
 		Steps:        jobTaskSpec.Steps,
 		Paths:        jobTaskSpec.Properties.Paths,
+		// the nonce is not exposed to steps as an env var.
+		StepMarkerNonce: jobTaskSpec.StepMarkerNonce,
+	}
+	if len(outputs) > 0 {
+		storage, err := jobOutputStorage(workflowCtx.WorkflowName, workflowCtx.TaskID, job.Name, job.K8sJobName)
+		if err != nil {
+			logger.Warnf("%v, the outputs are written to the termination message, which is limited to 4096 bytes and does not support file outputs", err)
+		}
+		jobCtx.OutputStorage = storage
+	}
+	return jobCtx
+}
+
+func outputTypes(outputs []*commonmodels.Output) map[string]job.OutputType {
+	resp := map[string]job.OutputType{}
+	for _, output := range outputs {
+		if output.Type != "" {
+			resp[output.Name] = job.OutputType(output.Type)
+		}
 	}
+	return resp
 }
@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing freestyle job", func() {
+
+	newJobCtl := func(status config.Status) *FreestyleJobCtl {
+		return &FreestyleJobCtl{
+			job: &commonmodels.JobTask{Status: status},
+			jobTaskSpec: &commonmodels.JobTaskFreestyleSpec{Steps: []*commonmodels.StepTask{
+				{Name: "git", Status: config.StatusPassed, StartTime: 100, EndTime: 105},
+				{Name: "shell", StartTime: 105},
+				{Name: "archive"},
+			}},
+		}
+	}
+
+	It("marks the interrupted step with the status of the timeout job", func() {
+		c := newJobCtl(config.StatusTimeout)
+		c.endInterruptedSteps()
+		Expect(c.jobTaskSpec.Steps[0].Status).To(Equal(config.StatusPassed))
+		Expect(c.jobTaskSpec.Steps[1].Status).To(Equal(config.StatusTimeout))
+		Expect(c.jobTaskSpec.Steps[1].EndTime).To(BeNumerically(">", 105))
+		Expect(c.jobTaskSpec.Steps[2].Status).To(BeEmpty())
+	})
+
+	It("marks the interrupted step with the status of the cancelled job", func() {
+		c := newJobCtl(config.StatusCancelled)
+		c.endInterruptedSteps()
+		Expect(c.jobTaskSpec.Steps[1].Status).To(Equal(config.StatusCancelled))
+	})
+
+	It("keeps the steps of finished jobs", func() {
+		c := newJobCtl(config.StatusFailed)
+		c.endInterruptedSteps()
+		Expect(c.jobTaskSpec.Steps[1].Status).To(BeEmpty())
+	})
+})
@@ -34,6 +34,7 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
+	helmrelease "helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/rest"
@@ -72,6 +73,10 @@ func NewHelmDeployJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.Wo
 	if err := commonmodels.IToi(job.Spec, jobTaskSpec); err != nil {
 		logger.Error(err)
 	}
+	if jobTaskSpec.HealthCheck != nil && jobTaskSpec.Events == nil {
+		jobTaskSpec.Events = &commonmodels.Events{}
+	}
+	job.Spec = jobTaskSpec
 	return &HelmDeployJobCtl{
 		job:         job,
 		workflowCtx: workflowCtx,
@@ -127,7 +132,8 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 		chartPath                string
 		replaceValuesMap         map[string]interface{}
 		renderInfo               *commonmodels.RenderSet
-		helmClient               helmclient.Client
+		helmClient               *helmtool.HelmClient
+		release                  *helmrelease.Release
 	)
 
 	c.logger.Infof("start helm deploy, productName %s serviceName %s containerName %v namespace %s", c.workflowCtx.ProjectName,
@@ -315,6 +321,8 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 	}
 
 	releaseName := c.jobTaskSpec.ReleaseName
+	// the release is rolled back to the previous revision when the health check failed.
+	prevRevision := 0
 
 	ensureUpgrade := func() error {
 		hrs, errHistory := helmClient.ListReleaseHistory(releaseName, 10)
@@ -328,6 +336,7 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 		}
 		releaseutil.Reverse(hrs, releaseutil.SortByRevision)
 		rel := hrs[0]
+		prevRevision = rel.Version
 
 		if rel.Info.Status.IsPending() {
 			return fmt.Errorf("failed to upgrade release: %s with exceptional status: %s", releaseName, rel.Info.Status)
@@ -359,7 +368,7 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 	c.logger.Infof("start to upgrade helm chart, release name: %s, chart name: %s, version: %s", chartSpec.ReleaseName, chartSpec.ChartName, chartSpec.Version)
 	done := make(chan bool)
 	go func(chan bool) {
-		if _, err = helmClient.InstallOrUpgradeChart(ctx, &chartSpec, nil); err != nil {
+		if release, err = helmClient.InstallOrUpgradeChart(ctx, &chartSpec, nil); err != nil {
 			err = errors.WithMessagef(
 				err,
 				"failed to upgrade helm chart %s/%s",
@@ -381,6 +390,11 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 		return
 	}
 
+	// the values in renderset are kept when the release is not rolled back, since they are deployed.
+	if c.jobTaskSpec.HealthCheck != nil && c.healthCheck(ctx, helmClient, prevRevision) {
+		return
+	}
+
 	//替换环境变量中的chartInfos
 	for _, chartInfo := range renderInfo.ChartInfos {
 		if chartInfo.ServiceName == c.jobTaskSpec.ServiceName {
@@ -403,7 +417,94 @@ func (c *HelmDeployJobCtl) Run(ctx context.Context) {
 		logError(c.job, err.Error(), c.logger)
 		return
 	}
+	if jobStatusFailed(c.job.Status) {
+		return
+	}
 	c.job.Status = config.StatusPassed
+
+	c.createEnvServiceVersion(productInfo, renderChart, release, replacedMergedValuesYaml)
+}
+
+// createEnvServiceVersion records the chart and values deployed, so the service can be rolled back to this version later.
+func (c *HelmDeployJobCtl) createEnvServiceVersion(env *commonmodels.Product, renderChart *templatemodels.RenderChart, release *helmrelease.Release, valuesYaml string) {
+	prodSvc, ok := env.GetServiceMap()[c.jobTaskSpec.ServiceName]
+	if !ok {
+		return
+	}
+
+	images := make(map[string]string)
+	for _, svcAndContainer := range c.jobTaskSpec.ImageAndModules {
+		images[strings.TrimSuffix(svcAndContainer.ServiceModule, "_"+c.jobTaskSpec.ServiceName)] = svcAndContainer.Image
+	}
+	svc := *prodSvc
+	svc.Containers = make([]*commonmodels.Container, 0, len(prodSvc.Containers))
+	for _, container := range prodSvc.Containers {
+		newContainer := *container
+		if image, ok := images[container.Name]; ok {
+			newContainer.Image = image
+		}
+		svc.Containers = append(svc.Containers, &newContainer)
+	}
+
+	version := &commonmodels.EnvServiceVersion{
+		ProductName:  env.ProductName,
+		EnvName:      env.EnvName,
+		Namespace:    env.Namespace,
+		ServiceName:  svc.ServiceName,
+		Service:      &svc,
+		RenderChart:  renderChart,
+		ReleaseName:  c.jobTaskSpec.ReleaseName,
+		ValuesYaml:   valuesYaml,
+		WorkflowName: c.workflowCtx.WorkflowName,
+		TaskID:       c.workflowCtx.TaskID,
+		CreateBy:     c.workflowCtx.TaskCreator,
+	}
+	if release != nil {
+		version.ReleaseRevision = release.Version
+	}
+	if err := commonrepo.NewEnvServiceVersionColl().Create(version); err != nil {
+		c.logger.Errorf("failed to create version of service %s in env %s, err: %s", svc.ServiceName, env.EnvName, err)
+	}
+}
+
+// healthCheck verifies the release, and rolls it back to the previous revision when the checks failed,
+// it returns whether the release is rolled back.
+func (c *HelmDeployJobCtl) healthCheck(ctx context.Context, helmClient *helmtool.HelmClient, prevRevision int) bool {
+	target := &healthCheckTarget{
+		EnvName:     c.jobTaskSpec.Env,
+		Namespace:   c.namespace,
+		ServiceName: c.jobTaskSpec.ServiceName,
+		KubeClient:  c.kubeClient,
+	}
+	err := runHealthCheck(ctx, c.jobTaskSpec.HealthCheck, target, c.jobTaskSpec.Events, c.ack, c.logger)
+	if err == nil {
+		return false
+	}
+	if ctx.Err() != nil {
+		c.job.Status = config.StatusCancelled
+		return false
+	}
+	logError(c.job, err.Error(), c.logger)
+	if !c.jobTaskSpec.HealthCheck.Rollback {
+		return false
+	}
+	if prevRevision == 0 {
+		c.jobTaskSpec.Events.Error(fmt.Sprintf("release %s has no previous revision to roll back to", c.jobTaskSpec.ReleaseName))
+		c.ack()
+		return false
+	}
+	// the rollback waits for the restored resources in the same way as the upgrade, so the following jobs run
+	// against the previous revision.
+	if err := helmClient.RollbackToRevision(c.jobTaskSpec.ReleaseName, prevRevision, !c.jobTaskSpec.SkipCheckRunStatus, time.Duration(c.timeout())*time.Second); err != nil {
+		msg := fmt.Sprintf("failed to roll back release %s to revision %d: %v", c.jobTaskSpec.ReleaseName, prevRevision, err)
+		c.logger.Error(msg)
+		c.jobTaskSpec.Events.Error(msg)
+		c.ack()
+		return false
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("release %s rolled back to revision %d", c.jobTaskSpec.ReleaseName, prevRevision))
+	c.ack()
+	return true
 }
 
 func (c *HelmDeployJobCtl) timeout() int {
@@ -0,0 +1,479 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	istioclientv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	versionedclient "istio.io/client-go/pkg/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	crClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
+	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+	"github.com/koderover/zadig/pkg/tool/kube/updater"
+)
+
+const (
+	// IstioCanaryLabelKey tells the pods of the stable and canary deployments apart in the subsets.
+	IstioCanaryLabelKey = "zadig-canary-version"
+	istioStableSubset   = "stable"
+	istioCanarySubset   = "canary"
+)
+
+// IstioCanaryJobCtl runs the canary deployment next to the stable one, and shifts the traffic
+// step by step with the VirtualService and DestinationRule named after the K8s service.
+type IstioCanaryJobCtl struct {
+	job         *commonmodels.JobTask
+	workflowCtx *commonmodels.WorkflowTaskCtx
+	logger      *zap.SugaredLogger
+	kubeClient  crClient.Client
+	istioClient versionedclient.Interface
+	jobTaskSpec *commonmodels.JobTaskIstioCanarySpec
+	ack         func()
+}
+
+func NewIstioCanaryJobCtl(job *commonmodels.JobTask, workflowCtx *commonmodels.WorkflowTaskCtx, ack func(), logger *zap.SugaredLogger) *IstioCanaryJobCtl {
+	jobTaskSpec := &commonmodels.JobTaskIstioCanarySpec{}
+	if err := commonmodels.IToi(job.Spec, jobTaskSpec); err != nil {
+		logger.Error(err)
+	}
+	if jobTaskSpec.Events == nil {
+		jobTaskSpec.Events = &commonmodels.Events{}
+	}
+	job.Spec = jobTaskSpec
+	return &IstioCanaryJobCtl{
+		job:         job,
+		workflowCtx: workflowCtx,
+		logger:      logger,
+		ack:         ack,
+		jobTaskSpec: jobTaskSpec,
+	}
+}
+
+// Clean rolls back the canary which is not promoted when the workflow finished, it
+// is a no-op after the promotion since the canary deployment was deleted then.
+func (c *IstioCanaryJobCtl) Clean(ctx context.Context) {
+	// the workflow context is done when the task was cancelled.
+	ctx = context.TODO()
+	if err := c.initClients(); err != nil {
+		c.logger.Errorf("init clients error: %v", err)
+		return
+	}
+	if err := c.rollback(ctx); err != nil {
+		c.logger.Errorf("roll back canary of %s error: %v", c.jobTaskSpec.K8sServiceName, err)
+	}
+}
+
+// rollback routes all traffic back to stable and removes the canary, if the canary is not promoted.
+func (c *IstioCanaryJobCtl) rollback(ctx context.Context) error {
+	_, found, err := getter.GetDeployment(c.jobTaskSpec.Namespace, c.canaryWorkloadName(), c.kubeClient)
+	if err != nil || !found {
+		return err
+	}
+	if err := c.updateVirtualService(ctx, nil, 0); err != nil {
+		c.logger.Errorf("route traffic of %s back to stable error: %v", c.jobTaskSpec.K8sServiceName, err)
+	}
+	if err := c.removeCanary(ctx); err != nil {
+		return err
+	}
+	c.logger.Infof("canary of %s rolled back", c.jobTaskSpec.K8sServiceName)
+	return nil
+}
+
+func (c *IstioCanaryJobCtl) Run(ctx context.Context) {
+	if err := c.run(ctx); err != nil {
+		return
+	}
+	c.job.Status = config.StatusPassed
+}
+
+func (c *IstioCanaryJobCtl) run(ctx context.Context) error {
+	if err := c.initClients(); err != nil {
+		return c.fail(err.Error())
+	}
+	if c.jobTaskSpec.Continued {
+		if err := c.scaleCanary(ctx); err != nil {
+			return err
+		}
+	} else if err := c.startCanary(ctx); err != nil {
+		return err
+	}
+
+	for i, step := range c.jobTaskSpec.Steps {
+		if err := c.updateVirtualService(ctx, c.jobTaskSpec.Headers, step.Weight); err != nil {
+			return c.fail(fmt.Sprintf("route %d%% traffic to canary error: %v", step.Weight, err))
+		}
+		c.jobTaskSpec.CurrentWeight = step.Weight
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("%d%% traffic routed to canary", step.Weight))
+		c.ack()
+
+		if i == len(c.jobTaskSpec.Steps)-1 {
+			if step.Weight == 100 {
+				return c.promote(ctx)
+			}
+			break
+		}
+		if step.Pause <= 0 {
+			continue
+		}
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("pause %d minutes before the next step", step.Pause))
+		c.ack()
+		select {
+		case <-ctx.Done():
+			c.job.Status = config.StatusCancelled
+			return ctx.Err()
+		case <-time.After(time.Duration(step.Pause) * time.Minute):
+		}
+	}
+	return nil
+}
+
+func (c *IstioCanaryJobCtl) initClients() error {
+	var err error
+	c.kubeClient, err = kubeclient.GetKubeClient(config.HubServerAddress(), c.jobTaskSpec.ClusterID)
+	if err != nil {
+		return fmt.Errorf("can't init k8s client: %v", err)
+	}
+	restConfig, err := kubeclient.GetRESTConfig(config.HubServerAddress(), c.jobTaskSpec.ClusterID)
+	if err != nil {
+		return fmt.Errorf("can't get rest config: %v", err)
+	}
+	c.istioClient, err = versionedclient.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("can't init istio client: %v", err)
+	}
+	return nil
+}
+
+// startCanary creates the canary deployment and the subsets, no traffic is routed to the canary yet.
+func (c *IstioCanaryJobCtl) startCanary(ctx context.Context) error {
+	ns := c.jobTaskSpec.Namespace
+	if _, exist, err := getter.GetService(ns, c.jobTaskSpec.K8sServiceName, c.kubeClient); err != nil || !exist {
+		return c.fail(fmt.Sprintf("service: %s not found: %v", c.jobTaskSpec.K8sServiceName, err))
+	}
+	if err := c.checkVirtualServiceConflict(ctx); err != nil {
+		return c.fail(err.Error())
+	}
+	deployment, exist, err := getter.GetDeployment(ns, c.jobTaskSpec.WorkloadName, c.kubeClient)
+	if err != nil || !exist {
+		return c.fail(fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err))
+	}
+
+	// the pods of stable deployment need the label to be selected by the stable subset, which restarts them once.
+	if deployment.Spec.Template.Labels[IstioCanaryLabelKey] != istioStableSubset {
+		patchBytes := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"labels":{"%s":"%s"}}}}}`, IstioCanaryLabelKey, istioStableSubset))
+		if err := updater.PatchDeployment(ns, deployment.Name, patchBytes, c.kubeClient); err != nil {
+			return c.fail(fmt.Sprintf("label deployment: %s error: %v", deployment.Name, err))
+		}
+		c.jobTaskSpec.Events.Info(fmt.Sprintf("deployment: %s labeled as stable", deployment.Name))
+		c.ack()
+		if err := c.waitDeploymentReady(ctx, deployment.Name); err != nil {
+			return err
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	canary := deployment.DeepCopy()
+	canary.Name = c.canaryWorkloadName()
+	canary.ObjectMeta.ResourceVersion = ""
+	canary.Spec.Replicas = int32Ptr(istioCanaryReplicas(replicas, c.jobTaskSpec.Steps))
+	if canary.Spec.Template.Labels == nil {
+		canary.Spec.Template.Labels = map[string]string{}
+	}
+	canary.Spec.Template.Labels[IstioCanaryLabelKey] = istioCanarySubset
+	for i := range canary.Spec.Template.Spec.Containers {
+		if canary.Spec.Template.Spec.Containers[i].Name == c.jobTaskSpec.ContainerName {
+			c.jobTaskSpec.Events.Info(fmt.Sprintf("the original image is: %s", canary.Spec.Template.Spec.Containers[i].Image))
+			canary.Spec.Template.Spec.Containers[i].Image = c.jobTaskSpec.Image
+			break
+		}
+	}
+	if err := updater.CreateOrPatchDeployment(canary, c.kubeClient); err != nil {
+		return c.fail(fmt.Sprintf("create canary deployment: %s failed: %v", canary.Name, err))
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("canary deployment: %s created", canary.Name))
+	c.ack()
+	if err := c.waitDeploymentReady(ctx, canary.Name); err != nil {
+		return err
+	}
+
+	if err := c.ensureDestinationRule(ctx); err != nil {
+		return c.fail(fmt.Sprintf("create destination rule error: %v", err))
+	}
+	if err := c.updateVirtualService(ctx, c.jobTaskSpec.Headers, 0); err != nil {
+		return c.fail(fmt.Sprintf("create virtual service error: %v", err))
+	}
+	return nil
+}
+
+// scaleCanary scales the canary started by the previous job up for the largest weight of this job,
+// so it can take the traffic before the weights are shifted.
+func (c *IstioCanaryJobCtl) scaleCanary(ctx context.Context) error {
+	ns := c.jobTaskSpec.Namespace
+	canary, found, err := getter.GetDeployment(ns, c.canaryWorkloadName(), c.kubeClient)
+	if err != nil || !found {
+		return c.fail(fmt.Sprintf("canary deployment: %s not found, it may be rolled back: %v", c.canaryWorkloadName(), err))
+	}
+	deployment, found, err := getter.GetDeployment(ns, c.jobTaskSpec.WorkloadName, c.kubeClient)
+	if err != nil || !found {
+		return c.fail(fmt.Sprintf("deployment: %s not found: %v", c.jobTaskSpec.WorkloadName, err))
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	canaryReplicas := istioCanaryReplicas(replicas, c.jobTaskSpec.Steps)
+	if canary.Spec.Replicas != nil && *canary.Spec.Replicas >= canaryReplicas {
+		return nil
+	}
+	if err := updater.ScaleDeployment(ns, canary.Name, int(canaryReplicas), c.kubeClient); err != nil {
+		return c.fail(fmt.Sprintf("scale canary deployment: %s error: %v", canary.Name, err))
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("canary deployment: %s scaled to %d replicas", canary.Name, canaryReplicas))
+	c.ack()
+	return c.waitDeploymentReady(ctx, canary.Name)
+}
+
+// checkVirtualServiceConflict refuses to start the canary when the host is routed by another VirtualService,
+// such as the ones of the share environments, istio merges their routes in no specified order.
+func (c *IstioCanaryJobCtl) checkVirtualServiceConflict(ctx context.Context) error {
+	ns := c.jobTaskSpec.Namespace
+	vsList, err := c.istioClient.NetworkingV1alpha3().VirtualServices(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list virtual services error: %v", err)
+	}
+	for _, vs := range vsList.Items {
+		if vs.Name == c.istioResourceName() {
+			continue
+		}
+		for _, host := range vs.Spec.Hosts {
+			if istioHostMatches(host, c.jobTaskSpec.K8sServiceName, ns) {
+				return fmt.Errorf("service: %s is routed by virtual service: %s already, the istio canary can not run in share environments", c.jobTaskSpec.K8sServiceName, vs.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// promote updates the stable deployment to the canary image, then removes the canary after the traffic is back to stable.
+func (c *IstioCanaryJobCtl) promote(ctx context.Context) error {
+	if err := updater.UpdateDeploymentImage(c.jobTaskSpec.Namespace, c.jobTaskSpec.WorkloadName, c.jobTaskSpec.ContainerName, c.jobTaskSpec.Image, c.kubeClient); err != nil {
+		return c.fail(fmt.Sprintf("update deployment: %s image error: %v", c.jobTaskSpec.WorkloadName, err))
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("updating deployment: %s image", c.jobTaskSpec.WorkloadName))
+	c.ack()
+	if err := c.waitDeploymentReady(ctx, c.jobTaskSpec.WorkloadName); err != nil {
+		return err
+	}
+	if err := c.updateVirtualService(ctx, nil, 0); err != nil {
+		return c.fail(fmt.Sprintf("route traffic back to stable error: %v", err))
+	}
+	c.jobTaskSpec.CurrentWeight = 0
+	if err := c.removeCanary(ctx); err != nil {
+		return c.fail(err.Error())
+	}
+	c.jobTaskSpec.Events.Info(fmt.Sprintf("canary promoted, deployment: %s image updated successfully", c.jobTaskSpec.WorkloadName))
+	c.ack()
+	return nil
+}
+
+// removeCanary deletes the canary deployment before the routes, so no traffic goes to the canary pods through the service.
+func (c *IstioCanaryJobCtl) removeCanary(ctx context.Context) error {
+	ns := c.jobTaskSpec.Namespace
+	if err := updater.DeleteDeploymentAndWait(ns, c.canaryWorkloadName(), c.kubeClient); err != nil {
+		return fmt.Errorf("delete canary deployment %s error: %v", c.canaryWorkloadName(), err)
+	}
+	name := c.istioResourceName()
+	if err := c.istioClient.NetworkingV1alpha3().VirtualServices(ns).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete virtual service %s error: %v", name, err)
+	}
+	if err := c.istioClient.NetworkingV1alpha3().DestinationRules(ns).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete destination rule %s error: %v", name, err)
+	}
+	return nil
+}
+
+func (c *IstioCanaryJobCtl) ensureDestinationRule(ctx context.Context) error {
+	ns := c.jobTaskSpec.Namespace
+	spec := networkingv1alpha3.DestinationRule{
+		Host: c.jobTaskSpec.K8sServiceName,
+		Subsets: []*networkingv1alpha3.Subset{
+			{Name: istioStableSubset, Labels: map[string]string{IstioCanaryLabelKey: istioStableSubset}},
+			{Name: istioCanarySubset, Labels: map[string]string{IstioCanaryLabelKey: istioCanarySubset}},
+		},
+	}
+	dr, err := c.istioClient.NetworkingV1alpha3().DestinationRules(ns).Get(ctx, c.istioResourceName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		dr = &istioclientv1alpha3.DestinationRule{ObjectMeta: metav1.ObjectMeta{Name: c.istioResourceName(), Namespace: ns}, Spec: spec}
+		_, err = c.istioClient.NetworkingV1alpha3().DestinationRules(ns).Create(ctx, dr, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	dr.Spec = spec
+	_, err = c.istioClient.NetworkingV1alpha3().DestinationRules(ns).Update(ctx, dr, metav1.UpdateOptions{})
+	return err
+}
+
+// updateVirtualService routes the traffic by the weight, the requests matching the headers go to the canary
+// regardless of the weight, so the headers are nil when all traffic should go back to stable.
+func (c *IstioCanaryJobCtl) updateVirtualService(ctx context.Context, headers []*commonmodels.IstioHeaderMatch, weight int) error {
+	ns := c.jobTaskSpec.Namespace
+	spec := networkingv1alpha3.VirtualService{
+		Hosts: []string{c.jobTaskSpec.K8sServiceName},
+		Http:  istioCanaryRoutes(c.jobTaskSpec.K8sServiceName, headers, weight),
+	}
+	vs, err := c.istioClient.NetworkingV1alpha3().VirtualServices(ns).Get(ctx, c.istioResourceName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		vs = &istioclientv1alpha3.VirtualService{ObjectMeta: metav1.ObjectMeta{Name: c.istioResourceName(), Namespace: ns}, Spec: spec}
+		_, err = c.istioClient.NetworkingV1alpha3().VirtualServices(ns).Create(ctx, vs, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	vs.Spec = spec
+	_, err = c.istioClient.NetworkingV1alpha3().VirtualServices(ns).Update(ctx, vs, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *IstioCanaryJobCtl) waitDeploymentReady(ctx context.Context, name string) error {
+	timeout := time.After(time.Duration(c.timeout()) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			c.job.Status = config.StatusCancelled
+			return ctx.Err()
+		case <-timeout:
+			c.job.Status = config.StatusTimeout
+			msg := fmt.Sprintf("timeout waiting for the deployment: %s to run", name)
+			c.jobTaskSpec.Events.Info(msg)
+			return errors.New(msg)
+		case <-time.After(2 * time.Second):
+		}
+		d, found, err := getter.GetDeployment(c.jobTaskSpec.Namespace, name, c.kubeClient)
+		if err != nil || !found {
+			c.logger.Errorf("failed to check deployment ready status %s/%s - %v", c.jobTaskSpec.Namespace, name, err)
+			continue
+		}
+		if wrapper.Deployment(d).Ready() {
+			return nil
+		}
+	}
+}
+
+func (c *IstioCanaryJobCtl) fail(msg string) error {
+	logError(c.job, msg, c.logger)
+	c.jobTaskSpec.Events.Error(msg)
+	return errors.New(msg)
+}
+
+func (c *IstioCanaryJobCtl) timeout() int64 {
+	if c.jobTaskSpec.DeployTimeout == 0 {
+		return setting.DeployTimeout
+	}
+	return c.jobTaskSpec.DeployTimeout * 60
+}
+
+func (c *IstioCanaryJobCtl) canaryWorkloadName() string {
+	return c.jobTaskSpec.WorkloadName + CanaryDeploymentSuffix
+}
+
+func (c *IstioCanaryJobCtl) istioResourceName() string {
+	return c.jobTaskSpec.K8sServiceName + CanaryDeploymentSuffix
+}
+
+// istioCanaryReplicas scales the canary for the largest weight it takes before promotion.
+func istioCanaryReplicas(stableReplicas int32, steps []*commonmodels.IstioCanaryStep) int32 {
+	maxWeight := 0
+	for _, step := range steps {
+		if step.Weight > maxWeight {
+			maxWeight = step.Weight
+		}
+	}
+	replicas := int32(math.Ceil(float64(stableReplicas) * float64(maxWeight) / 100))
+	if replicas < 1 {
+		return 1
+	}
+	return replicas
+}
+
+// istioCanaryRoutes routes the requests matching the headers to the canary, and splits the others by the weight.
+func istioCanaryRoutes(host string, headers []*commonmodels.IstioHeaderMatch, weight int) []*networkingv1alpha3.HTTPRoute {
+	routes := []*networkingv1alpha3.HTTPRoute{}
+	if len(headers) > 0 {
+		match := &networkingv1alpha3.HTTPMatchRequest{Headers: map[string]*networkingv1alpha3.StringMatch{}}
+		for _, header := range headers {
+			match.Headers[header.Key] = istioStringMatch(header)
+		}
+		routes = append(routes, &networkingv1alpha3.HTTPRoute{
+			Match: []*networkingv1alpha3.HTTPMatchRequest{match},
+			Route: []*networkingv1alpha3.HTTPRouteDestination{
+				{Destination: &networkingv1alpha3.Destination{Host: host, Subset: istioCanarySubset}, Weight: 100},
+			},
+		})
+	}
+	routes = append(routes, &networkingv1alpha3.HTTPRoute{
+		Route: []*networkingv1alpha3.HTTPRouteDestination{
+			{Destination: &networkingv1alpha3.Destination{Host: host, Subset: istioStableSubset}, Weight: int32(100 - weight)},
+			{Destination: &networkingv1alpha3.Destination{Host: host, Subset: istioCanarySubset}, Weight: int32(weight)},
+		},
+	})
+	return routes
+}
+
+// istioHostMatches tells whether the host of a VirtualService refers to the service in the namespace.
+func istioHostMatches(host, service, namespace string) bool {
+	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace)
+	if strings.HasPrefix(host, "*") {
+		return strings.HasSuffix(fqdn, strings.TrimPrefix(host, "*"))
+	}
+	switch host {
+	case service, service + "." + namespace, service + "." + namespace + ".svc", fqdn:
+		return true
+	}
+	return false
+}
+
+func istioStringMatch(header *commonmodels.IstioHeaderMatch) *networkingv1alpha3.StringMatch {
+	switch header.MatchType {
+	case config.IstioMatchPrefix:
+		return &networkingv1alpha3.StringMatch{MatchType: &networkingv1alpha3.StringMatch_Prefix{Prefix: header.Value}}
+	case config.IstioMatchRegex:
+		return &networkingv1alpha3.StringMatch{MatchType: &networkingv1alpha3.StringMatch_Regex{Regex: header.Value}}
+	default:
+		return &networkingv1alpha3.StringMatch{MatchType: &networkingv1alpha3.StringMatch_Exact{Exact: header.Value}}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	istioclientv1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+)
+
+var _ = Describe("Testing istio canary job", func() {
+
+	Context("istioCanaryReplicas", func() {
+		steps := []*commonmodels.IstioCanaryStep{{Weight: 10}, {Weight: 50}, {Weight: 30}}
+
+		It("should scale the canary for the largest weight", func() {
+			Expect(istioCanaryReplicas(4, steps)).To(Equal(int32(2)))
+			Expect(istioCanaryReplicas(5, steps)).To(Equal(int32(3)))
+		})
+		It("should keep at least one replica", func() {
+			Expect(istioCanaryReplicas(0, steps)).To(Equal(int32(1)))
+			Expect(istioCanaryReplicas(3, []*commonmodels.IstioCanaryStep{{Weight: 1}})).To(Equal(int32(1)))
+		})
+	})
+
+	Context("istioCanaryRoutes", func() {
+		It("should split the traffic by the weight", func() {
+			routes := istioCanaryRoutes("app", nil, 20)
+			Expect(routes).To(HaveLen(1))
+			Expect(routes[0].Match).To(BeEmpty())
+			Expect(routes[0].Route).To(HaveLen(2))
+			Expect(routes[0].Route[0].Destination).To(Equal(&networkingv1alpha3.Destination{Host: "app", Subset: istioStableSubset}))
+			Expect(routes[0].Route[0].Weight).To(Equal(int32(80)))
+			Expect(routes[0].Route[1].Destination).To(Equal(&networkingv1alpha3.Destination{Host: "app", Subset: istioCanarySubset}))
+			Expect(routes[0].Route[1].Weight).To(Equal(int32(20)))
+		})
+		It("should route the requests matching the headers to the canary first", func() {
+			headers := []*commonmodels.IstioHeaderMatch{
+				{Key: "x-user", Value: "tester"},
+				{Key: "x-group", MatchType: config.IstioMatchPrefix, Value: "beta"},
+			}
+			routes := istioCanaryRoutes("app", headers, 0)
+			Expect(routes).To(HaveLen(2))
+			Expect(routes[0].Match).To(HaveLen(1))
+			Expect(routes[0].Match[0].Headers["x-user"].GetExact()).To(Equal("tester"))
+			Expect(routes[0].Match[0].Headers["x-group"].GetPrefix()).To(Equal("beta"))
+			Expect(routes[0].Route).To(HaveLen(1))
+			Expect(routes[0].Route[0].Destination.Subset).To(Equal(istioCanarySubset))
+			Expect(routes[1].Route[0].Weight).To(Equal(int32(100)))
+		})
+	})
+
+	Context("istioHostMatches", func() {
+		It("should match the short names and the fqdn of the service", func() {
+			Expect(istioHostMatches("app", "app", "dev")).To(BeTrue())
+			Expect(istioHostMatches("app.dev", "app", "dev")).To(BeTrue())
+			Expect(istioHostMatches("app.dev.svc.cluster.local", "app", "dev")).To(BeTrue())
+			Expect(istioHostMatches("*.dev.svc.cluster.local", "app", "dev")).To(BeTrue())
+		})
+		It("should not match other services", func() {
+			Expect(istioHostMatches("app2", "app", "dev")).To(BeFalse())
+			Expect(istioHostMatches("app.prod.svc.cluster.local", "app", "dev")).To(BeFalse())
+			Expect(istioHostMatches("*.prod.svc.cluster.local", "app", "dev")).To(BeFalse())
+		})
+	})
+
+	Context("IstioCanaryJobCtl", func() {
+		newJobCtl := func() *IstioCanaryJobCtl {
+			spec := &commonmodels.JobTaskIstioCanarySpec{
+				Namespace:      "dev",
+				K8sServiceName: "app",
+				WorkloadName:   "app",
+				Steps:          []*commonmodels.IstioCanaryStep{{Weight: 50}},
+				Events:         &commonmodels.Events{},
+			}
+			return &IstioCanaryJobCtl{
+				job:         &commonmodels.JobTask{Spec: spec},
+				logger:      zap.NewNop().Sugar(),
+				jobTaskSpec: spec,
+				ack:         func() {},
+			}
+		}
+
+		It("should refuse the host routed by a share environment", func() {
+			ctl := newJobCtl()
+			ctl.istioClient = istiofake.NewSimpleClientset(&istioclientv1alpha3.VirtualService{
+				ObjectMeta: metav1.ObjectMeta{Name: "zadig-app", Namespace: "dev"},
+				Spec:       networkingv1alpha3.VirtualService{Hosts: []string{"app"}},
+			})
+			Expect(ctl.checkVirtualServiceConflict(context.TODO())).To(HaveOccurred())
+		})
+		It("should ignore its own virtual service", func() {
+			ctl := newJobCtl()
+			ctl.istioClient = istiofake.NewSimpleClientset(&istioclientv1alpha3.VirtualService{
+				ObjectMeta: metav1.ObjectMeta{Name: ctl.istioResourceName(), Namespace: "dev"},
+				Spec:       networkingv1alpha3.VirtualService{Hosts: []string{"app"}},
+			})
+			Expect(ctl.checkVirtualServiceConflict(context.TODO())).NotTo(HaveOccurred())
+		})
+
+		It("should scale the continued canary for the largest weight", func() {
+			ctl := newJobCtl()
+			ctl.kubeClient = fake.NewClientBuilder().WithObjects(
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "dev"}, Spec: appsv1.DeploymentSpec{Replicas: int32Ptr(4)}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: ctl.canaryWorkloadName(), Namespace: "dev"}, Spec: appsv1.DeploymentSpec{Replicas: int32Ptr(1)}},
+			).Build()
+			Expect(ctl.scaleCanary(context.TODO())).NotTo(HaveOccurred())
+
+			canary, found, err := getter.GetDeployment("dev", ctl.canaryWorkloadName(), ctl.kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(*canary.Spec.Replicas).To(Equal(int32(2)))
+		})
+	})
+})
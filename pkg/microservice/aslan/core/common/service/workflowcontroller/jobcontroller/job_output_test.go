@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/types/job"
+)
+
+var _ = Describe("Testing job outputs", func() {
+
+	It("collects the outputs of a failed job from the termination message", func() {
+		jobLabel := &JobLabel{JobType: "plugin", JobName: "plugin-1-abc"}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "plugin-1-abc-x", Namespace: "zadig", Labels: getJobLabels(jobLabel)},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "plugin",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: 1,
+						Message:  `[{"name":"version","value":"v1.0.0"}]`,
+					}},
+				}},
+			},
+		}
+		kubeClient := fake.NewClientBuilder().WithObjects(pod).Build()
+
+		outputs, err := getJobOutput("zadig", "plugin", jobLabel, kubeClient)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outputs).To(HaveLen(1))
+		Expect(outputs[0].Name).To(Equal("version"))
+		Expect(outputs[0].Value).To(Equal("v1.0.0"))
+	})
+
+	It("collects the output files of a plugin into a json list", func() {
+		dir, err := os.MkdirTemp("", "outputs")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.WriteFile(filepath.Join(dir, "version"), []byte("v1.0.0\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "message"), []byte("say \"hi\"\nC:\\zadig"), 0644)).To(Succeed())
+		terminationFile := filepath.Join(dir, "termination")
+
+		script := pluginOutputScript([]*commonmodels.Output{{Name: "version"}, {Name: "message"}, {Name: "missing"}}, dir+"/", terminationFile)
+		Expect(exec.Command("/bin/sh", "-c", script).Run()).To(Succeed())
+
+		content, err := os.ReadFile(terminationFile)
+		Expect(err).NotTo(HaveOccurred())
+		outputs := []*job.JobOutput{}
+		Expect(json.Unmarshal(content, &outputs)).To(Succeed())
+		Expect(outputs).To(HaveLen(2))
+		Expect(outputs[0].Value).To(Equal("v1.0.0"))
+		Expect(outputs[1].Value).To(Equal("say \"hi\"\nC:\\zadig"))
+	})
+})
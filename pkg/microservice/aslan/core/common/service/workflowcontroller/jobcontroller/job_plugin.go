@@ -19,18 +19,15 @@ package jobcontroller
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"go.uber.org/zap"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	crClient "sigs.k8s.io/controller-runtime/pkg/client"
 
-	zadigconfig "github.com/koderover/zadig/pkg/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	"github.com/koderover/zadig/pkg/setting"
-	krkubeclient "github.com/koderover/zadig/pkg/tool/kube/client"
 	"github.com/koderover/zadig/pkg/tool/kube/updater"
 )
 
@@ -85,26 +82,39 @@ func (c *PluginJobCtl) Run(ctx context.Context) {
 	c.complete(ctx)
 }
 
-func (c *PluginJobCtl) run(ctx context.Context) error {
-	// get kube client
-	hubServerAddr := config.HubServerAddress()
-	switch c.jobTaskSpec.Properties.ClusterID {
-	case setting.LocalClusterID:
-		c.jobTaskSpec.Properties.Namespace = zadigconfig.Namespace()
-		c.kubeclient = krkubeclient.Client()
-		c.clientset = krkubeclient.Clientset()
-		c.restConfig = krkubeclient.RESTConfig()
-	default:
-		c.jobTaskSpec.Properties.Namespace = setting.AttachedClusterNamespace
-
-		crClient, clientset, restConfig, err := GetK8sClients(hubServerAddr, c.jobTaskSpec.Properties.ClusterID)
-		if err != nil {
-			logError(c.job, err.Error(), c.logger)
-			return err
+// Resume waits for the K8s job started before aslan restarted, the job will
+// be created again if it no longer exists.
+func (c *PluginJobCtl) Resume(ctx context.Context) {
+	c.prepare(ctx)
+	if err := c.initKubeClients(); err != nil {
+		return
+	}
+	if !k8sJobExists(c.jobTaskSpec.Properties.Namespace, c.job.K8sJobName, c.kubeclient) {
+		c.logger.Infof("k8s job %s not found, create it again", c.job.K8sJobName)
+		if err := c.run(ctx); err != nil {
+			return
 		}
-		c.kubeclient = crClient
-		c.clientset = clientset
-		c.restConfig = restConfig
+	}
+	c.wait(ctx)
+	c.complete(ctx)
+}
+
+func (c *PluginJobCtl) initKubeClients() error {
+	namespace, kubeclient, clientset, restConfig, err := getJobRuntimeClients(c.jobTaskSpec.Properties.ClusterID)
+	if err != nil {
+		logError(c.job, err.Error(), c.logger)
+		return err
+	}
+	c.jobTaskSpec.Properties.Namespace = namespace
+	c.kubeclient = kubeclient
+	c.clientset = clientset
+	c.restConfig = restConfig
+	return nil
+}
+
+func (c *PluginJobCtl) run(ctx context.Context) error {
+	if err := c.initKubeClients(); err != nil {
+		return err
 	}
 
 	jobLabel := &JobLabel{
@@ -155,19 +165,19 @@ func (c *PluginJobCtl) complete(ctx context.Context) {
 		}()
 	}()
 
-	// get job outputs info from pod terminate message.
+	// get job outputs info from pod terminate message, outputs of failed jobs are collected too.
 	outputs, err := getJobOutput(c.jobTaskSpec.Properties.Namespace, c.job.Name, jobLabel, c.kubeclient)
 	if err != nil {
 		c.logger.Error(err)
-		c.job.Error = err.Error()
+		if c.job.Status == config.StatusPassed {
+			c.job.Error = err.Error()
+		}
 	}
 
 	// write jobs output info to globalcontext so other job can use like this $(workflow.jobName.outputName)
-	for _, output := range outputs {
-		c.workflowCtx.GlobalContextSet(strings.Join([]string{"workflow", c.job.Name, output.Name}, "."), output.Value)
-	}
+	setJobOutputs(c.workflowCtx, c.job.Name, outputs)
 
-	if err := saveContainerLog(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient); err != nil {
+	if _, err := saveContainerLog(c.jobTaskSpec.Properties.Namespace, c.jobTaskSpec.Properties.ClusterID, c.workflowCtx.WorkflowName, c.job.Name, c.workflowCtx.TaskID, jobLabel, c.kubeclient); err != nil {
 		c.logger.Error(err)
 		c.job.Error = err.Error()
 		return
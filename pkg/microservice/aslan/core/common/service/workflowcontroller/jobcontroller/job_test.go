@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing run job", func() {
+
+	workflowCtx := &commonmodels.WorkflowTaskCtx{
+		WorkflowName:      "workflow",
+		TaskID:            1,
+		GlobalContextEach: func(f func(k, v string) bool) {},
+	}
+	logger := zap.NewNop().Sugar()
+
+	It("should skip the jobs finished before the task was resumed", func() {
+		job := &commonmodels.JobTask{Name: "deploy", JobType: string(config.JobZadigDeploy), Status: config.StatusPassed, Spec: &commonmodels.JobTaskDeploySpec{}}
+		runJob(context.Background(), job, workflowCtx, logger, func() {})
+		Expect(job.Status).To(Equal(config.StatusPassed))
+		Expect(job.EndTime).To(BeZero())
+	})
+
+	It("should fail the interrupted jobs which can not be resumed instead of running them again", func() {
+		job := &commonmodels.JobTask{
+			Name:       "deploy",
+			JobType:    string(config.JobZadigDeploy),
+			Status:     config.StatusRunning,
+			K8sJobName: "workflow-1-deploy",
+			StartTime:  100,
+			Retry:      2,
+			Spec:       &commonmodels.JobTaskDeploySpec{Env: "dev", ServiceName: "web"},
+		}
+		acked := 0
+		runJob(context.Background(), job, workflowCtx, logger, func() { acked++ })
+		Expect(job.Status).To(Equal(config.StatusFailed))
+		Expect(job.Error).To(Equal("job deploy was interrupted by the restart of aslan and can not be resumed"))
+		Expect(job.RetryCount).To(BeZero())
+		Expect(job.StartTime).To(Equal(int64(100)))
+		Expect(job.EndTime).NotTo(BeZero())
+		Expect(acked).To(Equal(2))
+	})
+})
@@ -40,6 +40,7 @@ import (
 	"k8s.io/client-go/rest"
 	crClient "sigs.k8s.io/controller-runtime/pkg/client"
 
+	zadigconfig "github.com/koderover/zadig/pkg/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
@@ -48,6 +49,7 @@ import (
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
 	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
+	krkubeclient "github.com/koderover/zadig/pkg/tool/kube/client"
 	"github.com/koderover/zadig/pkg/tool/kube/containerlog"
 	"github.com/koderover/zadig/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/pkg/tool/kube/podexec"
@@ -55,6 +57,7 @@ import (
 	"github.com/koderover/zadig/pkg/tool/log"
 	commontypes "github.com/koderover/zadig/pkg/types"
 	"github.com/koderover/zadig/pkg/types/job"
+	"github.com/koderover/zadig/pkg/types/step"
 	"github.com/koderover/zadig/pkg/util"
 )
 
@@ -86,6 +89,24 @@ func GetK8sClients(hubServerAddr, clusterID string) (crClient.Client, kubernetes
 	return controllerRuntimeClient, clientset, restConfig, nil
 }
 
+// getJobRuntimeClients returns the namespace where job pods run and the kube clients of the given cluster.
+func getJobRuntimeClients(clusterID string) (string, crClient.Client, kubernetes.Interface, *rest.Config, error) {
+	if clusterID == setting.LocalClusterID {
+		return zadigconfig.Namespace(), krkubeclient.Client(), krkubeclient.Clientset(), krkubeclient.RESTConfig(), nil
+	}
+	crClient, clientset, restConfig, err := GetK8sClients(config.HubServerAddress(), clusterID)
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	return setting.AttachedClusterNamespace, crClient, clientset, restConfig, nil
+}
+
+// k8sJobExists checks whether the K8s job created for a job task is still in the cluster.
+func k8sJobExists(namespace, jobName string, kubeClient crClient.Client) bool {
+	_, found, err := getter.GetJob(namespace, jobName, kubeClient)
+	return err == nil && found
+}
+
 type JobLabel struct {
 	JobName string
 	JobType string
@@ -143,32 +164,33 @@ func getBaseImage(buildOS, imageFrom string) string {
 	return jobImage
 }
 
-func buildPlainJob(jobName string, resReq setting.Request, resReqSpec setting.RequestSpec, jobTask *commonmodels.JobTask, jobTaskSpec *commonmodels.JobTaskPluginSpec, workflowCtx *commonmodels.WorkflowTaskCtx) (*batchv1.Job, error) {
-	collectJobOutput := `OLD_IFS=$IFS
-export IFS=","
-files='%s'
-outputs='%s'
-file_arr=($files)
-output_arr=($outputs)
-IFS="$OLD_IFS"
-result="{"
-for i in ${!file_arr[@]};
-do
-	file_value=$(cat ${file_arr[$i]})
-	output_value=${output_arr[$i]}
-	result="$result\"$output_value\":\"$file_value\","
+// pluginOutputScript collects the output files of a plugin into the termination message as a json list of job outputs.
+func pluginOutputScript(outputs []*commonmodels.Output, outputDir, terminationFile string) string {
+	names := []string{}
+	for _, output := range outputs {
+		names = append(names, output.Name)
+	}
+	return fmt.Sprintf(`result=""
+for output in %s; do
+	file="%s/$output"
+	[ -f "$file" ] || continue
+	value=$(sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' -e 's/\t/\\t/g' "$file" | awk '{printf "%%s%%s", sep, $0; sep="\\n"}')
+	result="$result{\"name\":\"$output\",\"value\":\"$value\"},"
 done
-result=$(sed 's/,$/}/' <<< $result)
-echo $result > %s
-`
-	files := []string{}
-	outputs := []string{}
-	for _, output := range jobTask.Outputs {
-		outputFile := path.Join(job.JobOutputDir, output.Name)
-		files = append(files, outputFile)
-		outputs = append(outputs, output.Name)
-	}
-	collectJobOutputCommand := fmt.Sprintf(collectJobOutput, strings.Join(files, ","), strings.Join(outputs, ","), job.JobTerminationFile)
+printf '%%s\n' "[${result%%,}]" > %s
+`, strings.Join(names, " "), strings.TrimSuffix(outputDir, "/"), terminationFile)
+}
+
+func buildPlainJob(jobName string, resReq setting.Request, resReqSpec setting.RequestSpec, jobTask *commonmodels.JobTask, jobTaskSpec *commonmodels.JobTaskPluginSpec, workflowCtx *commonmodels.WorkflowTaskCtx) (*batchv1.Job, error) {
+	collectJobOutputCommand := pluginOutputScript(jobTask.Outputs, job.JobOutputDir, job.JobTerminationFile)
+	cmds, args := jobTaskSpec.Plugin.Cmds, jobTaskSpec.Plugin.Args
+	// the pre stop hook only runs when the container is killed, so the plugin command is wrapped
+	// to collect the outputs after it exits, no matter it succeeded or not.
+	// plugins without cmds run the entrypoint of the image, whose outputs are only collected by the hook.
+	if len(jobTask.Outputs) > 0 && len(cmds) > 0 {
+		args = append([]string{"zadig-plugin"}, append(append([]string{}, cmds...), args...)...)
+		cmds = []string{"/bin/sh", "-c", "\"$@\"\ncode=$?\n" + collectJobOutputCommand + "exit $code"}
+	}
 
 	labels := getJobLabels(&JobLabel{
 		JobType: string(jobTask.JobType),
@@ -210,8 +232,8 @@ echo $result > %s
 							ImagePullPolicy: corev1.PullAlways,
 							Name:            jobTask.Name,
 							Image:           jobTaskSpec.Plugin.Image,
-							Args:            jobTaskSpec.Plugin.Args,
-							Command:         jobTaskSpec.Plugin.Cmds,
+							Args:            args,
+							Command:         cmds,
 							Lifecycle: &corev1.Lifecycle{
 								PostStart: &corev1.LifecycleHandler{
 									Exec: &corev1.ExecAction{
@@ -536,7 +558,8 @@ func waitPlainJobEnd(ctx context.Context, taskTimeout int, namespace, jobName st
 				xl.Errorf("get job failed, namespace:%s, jobName:%s, err:%v", namespace, jobName, err)
 			}
 			if job != nil {
-				started = job.Status.Active > 0
+				// a resumed job may have already finished.
+				started = job.Status.Active > 0 || job.Status.Succeeded > 0 || job.Status.Failed > 0
 			}
 		}
 		if started {
@@ -596,7 +619,8 @@ func waitJobEndWithFile(ctx context.Context, taskTimeout int, namespace, jobName
 				xl.Errorf("get job failed, namespace:%s, jobName:%s, err:%v", namespace, jobName, err)
 			}
 			if job != nil {
-				started = job.Status.Active > 0
+				// a resumed job may have already finished.
+				started = job.Status.Active > 0 || job.Status.Succeeded > 0 || job.Status.Failed > 0
 			}
 		}
 		if started {
@@ -682,6 +706,68 @@ func waitJobEndWithFile(ctx context.Context, taskTimeout int, namespace, jobName
 	}
 }
 
+// jobOutputStorage returns the default object storage for the outputs of the job,
+// the outputs fall back to the termination message if there is no default storage.
+// every attempt of the job runs as a new k8s job, so the outputs are kept apart by the k8s job name,
+// and a retried job never reads the outputs left by the previous attempt.
+func jobOutputStorage(workflowName string, taskID int64, jobName, k8sJobName string) (*job.OutputStorage, error) {
+	store, err := commonrepo.NewS3StorageColl().FindDefault()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find default object storage for the outputs of job %s: %v", jobName, err)
+	}
+	storage := &job.OutputStorage{
+		S3: &step.S3{
+			Ak:        store.Ak,
+			Sk:        store.Sk,
+			Endpoint:  store.Endpoint,
+			Bucket:    store.Bucket,
+			Subfolder: store.Subfolder,
+			Insecure:  store.Insecure,
+			Provider:  store.Provider,
+		},
+	}
+	if store.Insecure {
+		storage.S3.Protocol = "http"
+	}
+	subFolder := fmt.Sprintf("%s/%d/%s", strings.ToLower(workflowName), taskID, "outputs")
+	if store.Subfolder != "" {
+		subFolder = fmt.Sprintf("%s/%s", store.Subfolder, subFolder)
+	}
+	storage.ObjectDir = GetObjectPath(subFolder, path.Join(strings.ToLower(jobName), k8sJobName))
+	return storage, nil
+}
+
+func getJobOutputFromStorage(storage *job.OutputStorage) ([]*job.JobOutput, error) {
+	resp := []*job.JobOutput{}
+	forcedPathStyle := true
+	if storage.S3.Provider == setting.ProviderSourceAli {
+		forcedPathStyle = false
+	}
+	client, err := s3tool.NewClient(storage.S3.Endpoint, storage.S3.Ak, storage.S3.Sk, storage.S3.Insecure, forcedPathStyle)
+	if err != nil {
+		return resp, fmt.Errorf("create s3 client to get job outputs error: %v", err)
+	}
+	tempFileName, err := util.GenerateTmpFile()
+	if err != nil {
+		return resp, err
+	}
+	defer func() {
+		_ = os.Remove(tempFileName)
+	}()
+	objectKey := path.Join(storage.ObjectDir, job.JobOutputsFile)
+	if err := client.Download(storage.S3.Bucket, objectKey, tempFileName); err != nil {
+		return resp, fmt.Errorf("download job outputs %s error: %v", objectKey, err)
+	}
+	content, err := os.ReadFile(tempFileName)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(content, &resp); err != nil {
+		return resp, fmt.Errorf("unmarshal job outputs error: %v", err)
+	}
+	return resp, nil
+}
+
 func getJobOutput(namespace, containerName string, jobLabel *JobLabel, kubeClient crClient.Client) ([]*job.JobOutput, error) {
 	resp := []*job.JobOutput{}
 	ls := getJobLabels(jobLabel)
@@ -690,13 +776,9 @@ func getJobOutput(namespace, containerName string, jobLabel *JobLabel, kubeClien
 		return resp, err
 	}
 	for _, pod := range pods {
-		ipod := wrapper.Pod(pod)
-		// only collect succeeed job outputs.
-		if !ipod.Succeeded() {
-			return resp, nil
-		}
+		// outputs of failed jobs are collected too.
 		for _, containerStatus := range pod.Status.ContainerStatuses {
-			if containerStatus.Name != ls[containerName] {
+			if containerStatus.Name != containerName {
 				continue
 			}
 			if containerStatus.State.Terminated != nil && len(containerStatus.State.Terminated.Message) != 0 {
@@ -710,19 +792,20 @@ func getJobOutput(namespace, containerName string, jobLabel *JobLabel, kubeClien
 	return resp, nil
 }
 
-func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID int64, jobLabel *JobLabel, kubeClient crClient.Client) error {
+// saveContainerLog uploads the log of the job container to s3 and returns the log.
+func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID int64, jobLabel *JobLabel, kubeClient crClient.Client) (string, error) {
 	selector := labels.Set(getJobLabels(jobLabel)).AsSelector()
 	pods, err := getter.ListPods(namespace, selector, kubeClient)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(pods) < 1 {
-		return fmt.Errorf("no pod found with selector: %s", selector)
+		return "", fmt.Errorf("no pod found with selector: %s", selector)
 	}
 
 	if len(pods[0].Status.ContainerStatuses) < 1 {
-		return fmt.Errorf("no cotainer statuses : %s", selector)
+		return "", fmt.Errorf("no cotainer statuses : %s", selector)
 	}
 
 	buf := new(bytes.Buffer)
@@ -734,16 +817,17 @@ func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID
 	clientSet, err := kubeclient.GetClientset(config.HubServerAddress(), clusterID)
 	if err != nil {
 		log.Errorf("saveContainerLog, get client set error: %s", err)
-		return err
+		return "", err
 	}
 
 	if err := containerlog.GetContainerLogs(namespace, pods[0].Name, pods[0].Spec.Containers[0].Name, false, int64(0), buf, clientSet); err != nil {
-		return fmt.Errorf("failed to get container logs: %s", err)
+		return "", fmt.Errorf("failed to get container logs: %s", err)
 	}
+	content := buf.String()
 
 	store, err := commonrepo.NewS3StorageColl().FindDefault()
 	if err != nil {
-		return fmt.Errorf("failed to get default s3 storage: %s", err)
+		return "", fmt.Errorf("failed to get default s3 storage: %s", err)
 	}
 
 	if tempFileName, err := util.GenerateTmpFile(); err == nil {
@@ -763,7 +847,7 @@ func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID
 			}
 			s3client, err := s3tool.NewClient(store.Endpoint, store.Ak, store.Sk, store.Insecure, forcedPathStyle)
 			if err != nil {
-				return fmt.Errorf("saveContainerLog s3 create client error: %v", err)
+				return "", fmt.Errorf("saveContainerLog s3 create client error: %v", err)
 			}
 			fileName := strings.Replace(strings.ToLower(jobName), "_", "-", -1)
 			objectKey := GetObjectPath(store.Subfolder, fileName+".log")
@@ -772,15 +856,15 @@ func saveContainerLog(namespace, clusterID, workflowName, jobName string, taskID
 				tempFileName,
 				objectKey,
 			); err != nil {
-				return fmt.Errorf("saveContainerLog s3 Upload error: %v", err)
+				return "", fmt.Errorf("saveContainerLog s3 Upload error: %v", err)
 			}
 		} else {
-			return fmt.Errorf("saveContainerLog saveFile error: %v", err)
+			return "", fmt.Errorf("saveContainerLog saveFile error: %v", err)
 		}
 	} else {
-		return fmt.Errorf("saveContainerLog GenerateTmpFile error: %v", err)
+		return "", fmt.Errorf("saveContainerLog GenerateTmpFile error: %v", err)
 	}
-	return nil
+	return content, nil
 }
 
 func GetObjectPath(subFolder, name string) string {
@@ -802,3 +886,33 @@ func checkDogFoodExistsInContainer(clientset kubernetes.Interface, restConfig *r
 
 	return commontypes.JobStatus(stdout), success, err
 }
+
+// getStepResults reads the results of steps written by the job executor, the job container
+// stays alive for a while after the dog food is found, so it should be called right after the job ended.
+func getStepResults(namespace, jobName string, kubeClient crClient.Client, clientset kubernetes.Interface, restConfig *rest.Config) ([]*job.StepResult, error) {
+	resp := []*job.StepResult{}
+	pods, err := getter.ListPods(namespace, labels.Set{"job-name": jobName}.AsSelector(), kubeClient)
+	if err != nil {
+		return resp, err
+	}
+	for _, pod := range pods {
+		ipod := wrapper.Pod(pod)
+		if ipod.Pending() || ipod.Finished() {
+			continue
+		}
+		stdout, _, _, err := podexec.KubeExec(clientset, restConfig, podexec.ExecOptions{
+			Command:       []string{"/bin/sh", "-c", fmt.Sprintf("test -f %[1]s && cat %[1]s", job.JobStepResultFile)},
+			Namespace:     namespace,
+			PodName:       pod.Name,
+			ContainerName: ipod.ContainerNames()[0],
+		})
+		if err != nil {
+			return resp, fmt.Errorf("read step results of pod %s error: %v", pod.Name, err)
+		}
+		if err := json.Unmarshal([]byte(stdout), &resp); err != nil {
+			return resp, fmt.Errorf("unmarshal step results of pod %s error: %v", pod.Name, err)
+		}
+		return resp, nil
+	}
+	return resp, nil
+}
@@ -18,6 +18,7 @@ package jobcontroller
 
 import (
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/types/job"
 )
 
 type JobContext struct {
@@ -38,6 +39,11 @@ type JobContext struct {
 
 	Steps   []*commonmodels.StepTask `yaml:"steps"`
 	Outputs []string                 `yaml:"outputs"`
+	// OutputTypes is the type of outputs, outputs not in it are strings.
+	OutputTypes   map[string]job.OutputType `yaml:"output_types"`
+	OutputStorage *job.OutputStorage        `yaml:"output_storage"`
+	// StepMarkerNonce is the nonce the job executor prints in the step markers.
+	StepMarkerNonce string `yaml:"step_marker_nonce"`
 }
 
 type EnvVar []string
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobcontroller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	crClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/kube/wrapper"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+	"github.com/koderover/zadig/pkg/tool/kube/updater"
+)
+
+// workloadKind returns the kind used in messages, workloads without type are deployments.
+func workloadKind(workloadType string) string {
+	if workloadType == setting.StatefulSet {
+		return "statefulset"
+	}
+	return "deployment"
+}
+
+func workloadReady(ns, name, workloadType string, kubeClient crClient.Client) (bool, error) {
+	if workloadType == setting.StatefulSet {
+		sts, found, err := getter.GetStatefulSet(ns, name, kubeClient)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			return false, fmt.Errorf("statefulset %s/%s not found", ns, name)
+		}
+		return wrapper.StatefulSet(sts).Ready(), nil
+	}
+	d, found, err := getter.GetDeployment(ns, name, kubeClient)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, fmt.Errorf("deployment %s/%s not found", ns, name)
+	}
+	return wrapper.Deployment(d).Ready(), nil
+}
+
+func updateWorkloadImage(ns, name, workloadType, container, image string, kubeClient crClient.Client) error {
+	if workloadType == setting.StatefulSet {
+		return updater.UpdateStatefulSetImage(ns, name, container, image, kubeClient)
+	}
+	return updater.UpdateDeploymentImage(ns, name, container, image, kubeClient)
+}
+
+// workloadRolledOut returns whether the workload has observed its latest spec and all the replicas are ready.
+func workloadRolledOut(ns, name, workloadType string, kubeClient crClient.Client) (bool, error) {
+	if workloadType == setting.StatefulSet {
+		sts, found, err := getter.GetStatefulSet(ns, name, kubeClient)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			return false, fmt.Errorf("statefulset %s/%s not found", ns, name)
+		}
+		return sts.Status.ObservedGeneration >= sts.Generation && wrapper.StatefulSet(sts).Ready(), nil
+	}
+	d, found, err := getter.GetDeployment(ns, name, kubeClient)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, fmt.Errorf("deployment %s/%s not found", ns, name)
+	}
+	return d.Status.ObservedGeneration >= d.Generation && wrapper.Deployment(d).Ready(), nil
+}
+
+// waitWorkloadsRolledOut waits until all the workloads are rolled out, it returns an error if they are not within the timeout.
+func waitWorkloadsRolledOut(ctx context.Context, ns string, resources []commonmodels.Resource, timeout time.Duration, kubeClient crClient.Client) error {
+	deadline := time.After(timeout)
+	for {
+		var pending string
+		var checkErr error
+		for _, resource := range resources {
+			ready, err := workloadRolledOut(ns, resource.Name, resource.Kind, kubeClient)
+			if err != nil || !ready {
+				pending, checkErr = resource.Name, err
+				break
+			}
+		}
+		if pending == "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			if checkErr != nil {
+				return fmt.Errorf("%s/%s is not ready within %s: %v", ns, pending, timeout, checkErr)
+			}
+			return fmt.Errorf("%s/%s is not ready within %s", ns, pending, timeout)
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func deleteWorkloadAndWait(ns, name, workloadType string, kubeClient crClient.Client) error {
+	if workloadType == setting.StatefulSet {
+		return updater.DeleteStatefulSetAndWait(ns, name, kubeClient)
+	}
+	return updater.DeleteDeploymentAndWait(ns, name, kubeClient)
+}
@@ -21,8 +21,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
@@ -107,15 +112,38 @@ func Push(t *commonmodels.WorkflowTask) error {
 		log.Errorf("workflowTaskV4.Create error: %v", err)
 		return err
 	}
+	notifyScheduler()
 	return nil
 }
 
+const (
+	// taskLeaseDuration is how long a task is held by the aslan instance running it without renewing the lease,
+	// the task is resumed by another instance after that.
+	taskLeaseDuration      = 90 * time.Second
+	taskLeaseRenewInterval = 30 * time.Second
+)
+
+// instanceID identifies this aslan process as the owner of the tasks it runs.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%s", hostname, uuid.New().String())
+}
+
 func InitWorkflowController() {
 	InitQueue()
+	go renewTaskLeases()
 	go WorfklowTaskSender()
 }
 
 func InitQueue() error {
+	return recoverTasks()
+}
+
+// recoverTasks resumes the tasks left running by the aslan instances which are gone, it is also run periodically
+// since the leases of the tasks held by a crashed instance expire some time after another instance started.
+func recoverTasks() error {
 	log := log.SugaredLogger()
 
 	// 从数据库查找未完成的任务
@@ -126,64 +154,91 @@ func InitQueue() error {
 		return err
 	}
 
+	sysSetting, err := commonrepo.NewSystemSettingColl().Get()
+	if err != nil {
+		log.Errorf("get system stettings error: %v", err)
+		return err
+	}
+
+	runningTasks := make(map[string]bool)
 	for _, task := range tasks {
-		// 如果 Queue 重新初始化, 取消所有 running tasks
-		if err := CancelWorkflowTask(setting.DefaultTaskRevoker, task.WorkflowName, task.TaskID, log); err != nil {
-			log.Errorf("[CancelRunningTask] error: %v", err)
+		// created tasks have not been started yet, they are started by the scheduler from the queue.
+		if task.Status != config.StatusRunning {
 			continue
 		}
-	}
-	return nil
-}
-
-// WorfklowTaskSender 监控warpdrive空闲情况, 如果有空闲, 则发现下一个waiting task给warpdrive
-// 并将task状态设置为queued
-func WorfklowTaskSender() {
-	for {
-		time.Sleep(time.Second * 3)
-
-		sysSetting, err := commonrepo.NewSystemSettingColl().Get()
+		runningTasks[fmt.Sprintf("%s-%d", task.WorkflowName, task.TaskID)] = true
+		// claim the task first, so it is resumed by only one aslan instance, and never while its owner is alive.
+		claimed, err := commonrepo.NewWorkflowQueueColl().Claim(ConvertTaskToQueue(task), []config.Status{config.StatusQueued, config.StatusRunning}, instanceID, taskLeaseDuration)
 		if err != nil {
-			log.Errorf("get system stettings error: %v", err)
+			log.Errorf("claim workflow task %s:%d error: %v", task.WorkflowName, task.TaskID, err)
+			continue
 		}
-		//c.checkAgents()
-		if !hasAgentAvaiable(int(sysSetting.WorkflowConcurrency)) {
+		if !claimed {
 			continue
 		}
-		t, err := NextWaitingTask()
-		if err != nil {
-			// no waiting task found
-			blockTasks, err := BlockedTaskQueue()
-			if err != nil {
-				//no blocked task found
-				continue
-			}
-			for _, blockTask := range blockTasks {
-				if hasAgentAvaiable(int(sysSetting.WorkflowConcurrency)) {
-					//判断相同的工作流是否正在运行
-					if ParallelRunningAndQueuedTasks(blockTask) {
-						continue
-					}
-					// update agent and queue
-					if err := updateQueueAndRunTask(blockTask, int(sysSetting.BuildConcurrency)); err != nil {
-						continue
-					}
-				} else {
-					break
-				}
+		// resume the running tasks instead of cancelling them, jobs already passed will be skipped.
+		if err := resumeWorkflowTask(task, int(sysSetting.BuildConcurrency), log); err != nil {
+			log.Errorf("[ResumeWorkflowTask] %s:%d error: %v", task.WorkflowName, task.TaskID, err)
+			if err := CancelWorkflowTask(setting.DefaultTaskRevoker, task.WorkflowName, task.TaskID, log); err != nil {
+				log.Errorf("[CancelRunningTask] error: %v", err)
 			}
-			continue
 		}
-		// update agent and queue
-		if err := updateQueueAndRunTask(t, int(sysSetting.BuildConcurrency)); err != nil {
+	}
+
+	// tasks marked as queued were picked by an aslan instance but may never have been started,
+	// send them back to the queue once their owner is gone instead of holding the slot forever.
+	queuedTasks, err := commonrepo.NewWorkflowQueueColl().List(&commonrepo.ListWorfklowQueueOption{Status: config.StatusQueued})
+	if err != nil {
+		log.Errorf("list queued workflow task error: %v", err)
+		return err
+	}
+	for _, queuedTask := range queuedTasks {
+		if runningTasks[fmt.Sprintf("%s-%d", queuedTask.WorkflowName, queuedTask.TaskID)] {
 			continue
 		}
+		queuedTask.Status = config.StatusWaiting
+		if _, err := commonrepo.NewWorkflowQueueColl().Release(queuedTask, config.StatusQueued); err != nil {
+			log.Errorf("requeue workflow task %s:%d error: %v", queuedTask.WorkflowName, queuedTask.TaskID, err)
+		}
+	}
+	return nil
+}
+
+// resumeWorkflowTask re-attaches a workflow controller to a task left running by a previous aslan instance,
+// the task should have been claimed by this instance.
+func resumeWorkflowTask(t *commonmodels.WorkflowTask, jobConcurrency int, logger *zap.SugaredLogger) error {
+	if t.Status != config.StatusRunning {
+		return fmt.Errorf("task status %s is not resumable", t.Status)
+	}
+	logger.Infof("resume workflow task %s:%d", t.WorkflowName, t.TaskID)
+	go NewWorkflowController(t, logger).Run(context.Background(), jobConcurrency)
+	return nil
+}
 
+// renewTaskLeases keeps the tasks run by this instance from being resumed by the others.
+func renewTaskLeases() {
+	ticker := time.NewTicker(taskLeaseRenewInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := commonrepo.NewWorkflowQueueColl().RenewLease(instanceID, taskLeaseDuration); err != nil {
+			log.Errorf("renew leases of workflow tasks error: %v", err)
+		}
 	}
 }
 
-func hasAgentAvaiable(workflowConcurrency int) bool {
-	return len(RunningAndQueuedTasks()) < int(workflowConcurrency)
+// WorfklowTaskSender starts the waiting tasks when a task is enqueued or finished,
+// the queue is also checked periodically in case an event is missed.
+func WorfklowTaskSender() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-scheduleEvents:
+		case <-ticker.C:
+			recoverTasks()
+		}
+		scheduleTasks()
+	}
 }
 
 func RunningAndQueuedTasks() []*commonmodels.WorkflowQueue {
@@ -206,50 +261,6 @@ func ListTasks() []*commonmodels.WorkflowQueue {
 	return queues
 }
 
-// NextWaitingTask 查询下一个等待的task
-func NextWaitingTask() (*commonmodels.WorkflowQueue, error) {
-	opt := &commonrepo.ListWorfklowQueueOption{
-		Status: config.StatusWaiting,
-	}
-
-	tasks, err := commonrepo.NewWorkflowQueueColl().List(opt)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, t := range tasks {
-		return t, nil
-	}
-
-	return nil, errors.New("no waiting task found")
-}
-
-func BlockedTaskQueue() ([]*commonmodels.WorkflowQueue, error) {
-	opt := &commonrepo.ListWorfklowQueueOption{
-		Status: config.StatusBlocked,
-	}
-
-	queues, err := commonrepo.NewWorkflowQueueColl().List(opt)
-	if err != nil || len(queues) == 0 {
-		return nil, errors.New("no blocked task found")
-	}
-
-	return queues, nil
-}
-
-func ParallelRunningAndQueuedTasks(currentTask *commonmodels.WorkflowQueue) bool {
-	for _, t := range ListTasks() {
-		// task状态为TaskQueued说明task已经被send到nsq,wd已经开始处理但是没有返回ack
-		if t.Status != config.StatusRunning && t.Status != config.StatusQueued {
-			continue
-		}
-		if t.WorkflowName == currentTask.WorkflowName {
-			return true
-		}
-	}
-	return false
-}
-
 func updateQueueAndRunTask(t *commonmodels.WorkflowQueue, jobConcurrency int) error {
 	logger := log.SugaredLogger()
 	// 更新队列状态为TaskQueued
@@ -259,9 +270,14 @@ func updateQueueAndRunTask(t *commonmodels.WorkflowQueue, jobConcurrency int) er
 		return fmt.Errorf("%s:%d get workflow task error: %v", t.WorkflowName, t.TaskID, err)
 	}
 	workflowTask.Status = config.StatusQueued
-	if success := UpdateQueue(workflowTask); !success {
-		logger.Errorf("%s:%d update t status error", t.WorkflowName, t.TaskID)
-		return fmt.Errorf("%s:%d update t status error", t.WorkflowName, t.TaskID)
+	// other aslan instances may pick the same task, only the one claimed it runs the task.
+	claimed, err := commonrepo.NewWorkflowQueueColl().Claim(ConvertTaskToQueue(workflowTask), []config.Status{config.StatusWaiting, config.StatusBlocked}, instanceID, taskLeaseDuration)
+	if err != nil {
+		logger.Errorf("%s:%d update t status error: %v", t.WorkflowName, t.TaskID, err)
+		return fmt.Errorf("%s:%d update t status error: %v", t.WorkflowName, t.TaskID, err)
+	}
+	if !claimed {
+		return fmt.Errorf("%s:%d is claimed by another aslan instance", t.WorkflowName, t.TaskID)
 	}
 	ctx := context.Background()
 	go NewWorkflowController(workflowTask, logger).Run(ctx, jobConcurrency)
@@ -286,7 +302,43 @@ func ConvertTaskToQueue(task *commonmodels.WorkflowTask) *commonmodels.WorkflowQ
 		TaskRevoker:  task.TaskRevoker,
 		CreateTime:   task.CreateTime,
 		MultiRun:     task.MultiRun,
+		Priority:     task.Priority,
+		ClusterIDs:   taskClusterIDs(task.Stages),
+	}
+}
+
+// taskClusterIDs returns the clusters the jobs of the task run in, the jobs deploying to the envs in the local
+// cluster are counted in the local cluster since the cluster id of these envs is empty.
+func taskClusterIDs(stages []*commonmodels.StageTask) []string {
+	resp := []string{}
+	clusters := sets.NewString()
+	for _, stage := range stages {
+		for _, job := range stage.Jobs {
+			spec := &struct {
+				ClusterID  string `json:"cluster_id"`
+				Env        string `json:"env"`
+				Properties struct {
+					ClusterID string `json:"cluster_id"`
+				} `json:"properties"`
+			}{}
+			if err := commonmodels.IToi(job.Spec, spec); err != nil {
+				continue
+			}
+			clusterID := spec.ClusterID
+			if clusterID == "" {
+				clusterID = spec.Properties.ClusterID
+			}
+			if clusterID == "" && spec.Env != "" {
+				clusterID = setting.LocalClusterID
+			}
+			if clusterID == "" || clusters.Has(clusterID) {
+				continue
+			}
+			clusters.Insert(clusterID)
+			resp = append(resp, clusterID)
+		}
 	}
+	return resp
 }
 
 func cleanStages(stages []*commonmodels.StageTask) []*commonmodels.StageTask {
@@ -302,5 +354,9 @@ func cleanStages(stages []*commonmodels.StageTask) []*commonmodels.StageTask {
 }
 
 func Remove(taskQueue *commonmodels.WorkflowQueue) error {
-	return commonrepo.NewWorkflowQueueColl().Delete(taskQueue)
+	if err := commonrepo.NewWorkflowQueueColl().Delete(taskQueue); err != nil {
+		return err
+	}
+	notifyScheduler()
+	return nil
 }
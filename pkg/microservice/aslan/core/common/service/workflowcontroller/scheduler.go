@@ -0,0 +1,183 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflowcontroller
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// scheduleInterval is the fallback interval of the scheduler, in case an event is missed.
+const scheduleInterval = 30 * time.Second
+
+var scheduleEvents = make(chan struct{}, 1)
+
+// notifyScheduler wakes up the scheduler when a task is enqueued or finished, events are merged
+// while the scheduler is busy since every round looks at the whole queue.
+func notifyScheduler() {
+	select {
+	case scheduleEvents <- struct{}{}:
+	default:
+	}
+}
+
+// NotifyScheduler wakes up the scheduler when the quota of workflow tasks changed, so the waiting tasks are started at once.
+func NotifyScheduler() {
+	notifyScheduler()
+}
+
+// queueUsage counts the running and queued tasks of the workflow queue.
+type queueUsage struct {
+	total     int64
+	workflows map[string]int64
+	projects  map[string]int64
+	clusters  map[string]int64
+}
+
+func newQueueUsage(queues []*commonmodels.WorkflowQueue) *queueUsage {
+	usage := &queueUsage{
+		workflows: make(map[string]int64),
+		projects:  make(map[string]int64),
+		clusters:  make(map[string]int64),
+	}
+	for _, q := range queues {
+		if q.Status == config.StatusRunning || q.Status == config.StatusQueued {
+			usage.add(q)
+		}
+	}
+	return usage
+}
+
+func (u *queueUsage) add(q *commonmodels.WorkflowQueue) {
+	u.total++
+	u.workflows[q.WorkflowName]++
+	u.projects[q.ProjectName]++
+	for _, clusterID := range q.ClusterIDs {
+		u.clusters[clusterID]++
+	}
+}
+
+// runnable checks the task against the concurrency of its workflow, project and clusters.
+func (u *queueUsage) runnable(q *commonmodels.WorkflowQueue, quota *commonmodels.WorkflowQuota) bool {
+	if !q.MultiRun && u.workflows[q.WorkflowName] > 0 {
+		return false
+	}
+	if quota == nil {
+		return true
+	}
+	if limit := quotaLimit(quota.ProjectConcurrency, quota.DefaultProjectConcurrency, q.ProjectName); limit > 0 && u.projects[q.ProjectName] >= limit {
+		return false
+	}
+	for _, clusterID := range q.ClusterIDs {
+		if limit := quotaLimit(quota.ClusterConcurrency, quota.DefaultClusterConcurrency, clusterID); limit > 0 && u.clusters[clusterID] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+func quotaLimit(limits map[string]int64, defaultLimit int64, key string) int64 {
+	if limit, ok := limits[key]; ok {
+		return limit
+	}
+	return defaultLimit
+}
+
+// pickTasks returns the waiting tasks to run in order. The priority can be set by anyone editing the workflow, so it
+// only orders the tasks within the fair share of the projects: tasks of the projects running fewer tasks than their
+// share of the concurrency go first, then tasks with higher priority, then tasks of the project with fewer running
+// tasks, then the earlier created.
+func pickTasks(queues []*commonmodels.WorkflowQueue, concurrency int64, quota *commonmodels.WorkflowQuota) []*commonmodels.WorkflowQueue {
+	usage := newQueueUsage(queues)
+	pending := []*commonmodels.WorkflowQueue{}
+	projects := sets.NewString()
+	for _, q := range queues {
+		if q.Status == config.StatusWaiting || q.Status == config.StatusBlocked {
+			pending = append(pending, q)
+		}
+		if q.Status == config.StatusWaiting || q.Status == config.StatusBlocked || q.Status == config.StatusRunning || q.Status == config.StatusQueued {
+			projects.Insert(q.ProjectName)
+		}
+	}
+	share := int64(1)
+	if projects.Len() > 0 && concurrency > int64(projects.Len()) {
+		share = (concurrency + int64(projects.Len()) - 1) / int64(projects.Len())
+	}
+
+	resp := []*commonmodels.WorkflowQueue{}
+	for usage.total < concurrency {
+		candidates := []*commonmodels.WorkflowQueue{}
+		for _, q := range pending {
+			if usage.runnable(q, quota) {
+				candidates = append(candidates, q)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			aInShare, bInShare := usage.projects[a.ProjectName] < share, usage.projects[b.ProjectName] < share
+			if aInShare != bInShare {
+				return aInShare
+			}
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+			if usage.projects[a.ProjectName] != usage.projects[b.ProjectName] {
+				return usage.projects[a.ProjectName] < usage.projects[b.ProjectName]
+			}
+			return a.CreateTime < b.CreateTime
+		})
+		next := candidates[0]
+		resp = append(resp, next)
+		usage.add(next)
+		for i, q := range pending {
+			if q == next {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+	return resp
+}
+
+// scheduleTasks starts the waiting tasks as long as the concurrency and quotas allow.
+func scheduleTasks() {
+	sysSetting, err := commonrepo.NewSystemSettingColl().Get()
+	if err != nil {
+		log.Errorf("get system stettings error: %v", err)
+		return
+	}
+	queues, err := commonrepo.NewWorkflowQueueColl().List(&commonrepo.ListWorfklowQueueOption{})
+	if err != nil {
+		log.Errorf("list workflow queue error: %v", err)
+		return
+	}
+	for _, q := range pickTasks(queues, sysSetting.WorkflowConcurrency, sysSetting.WorkflowQuota) {
+		if err := updateQueueAndRunTask(q, int(sysSetting.BuildConcurrency)); err != nil {
+			continue
+		}
+	}
+}
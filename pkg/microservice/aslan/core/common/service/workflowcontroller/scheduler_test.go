@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflowcontroller
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+func queueTask(project, workflow string, taskID int64, status config.Status) *commonmodels.WorkflowQueue {
+	return &commonmodels.WorkflowQueue{
+		TaskID:       taskID,
+		ProjectName:  project,
+		WorkflowName: workflow,
+		Status:       status,
+		CreateTime:   taskID,
+		MultiRun:     true,
+	}
+}
+
+func taskNames(queues []*commonmodels.WorkflowQueue) []string {
+	resp := []string{}
+	for _, q := range queues {
+		resp = append(resp, q.WorkflowName)
+	}
+	return resp
+}
+
+var _ = Describe("Testing pick tasks", func() {
+	It("runs tasks in the order of creation", func() {
+		queues := []*commonmodels.WorkflowQueue{
+			queueTask("a", "w1", 1, config.StatusWaiting),
+			queueTask("a", "w2", 2, config.StatusWaiting),
+			queueTask("a", "w3", 3, config.StatusWaiting),
+		}
+		Expect(taskNames(pickTasks(queues, 2, nil))).To(Equal([]string{"w1", "w2"}))
+	})
+
+	It("does not exceed the global concurrency", func() {
+		queues := []*commonmodels.WorkflowQueue{
+			queueTask("a", "w1", 1, config.StatusRunning),
+			queueTask("a", "w2", 2, config.StatusQueued),
+			queueTask("a", "w3", 3, config.StatusWaiting),
+		}
+		Expect(pickTasks(queues, 2, nil)).To(BeEmpty())
+	})
+
+	It("runs tasks with higher priority first", func() {
+		hotfix := queueTask("a", "hotfix", 3, config.StatusWaiting)
+		hotfix.Priority = 10
+		queues := []*commonmodels.WorkflowQueue{
+			queueTask("a", "w1", 1, config.StatusWaiting),
+			queueTask("a", "w2", 2, config.StatusWaiting),
+			hotfix,
+		}
+		Expect(taskNames(pickTasks(queues, 1, nil))).To(Equal([]string{"hotfix"}))
+	})
+
+	It("shares the concurrency across projects", func() {
+		queues := []*commonmodels.WorkflowQueue{
+			queueTask("mono", "m0", 1, config.StatusRunning),
+			queueTask("mono", "m1", 2, config.StatusWaiting),
+			queueTask("mono", "m2", 3, config.StatusWaiting),
+			queueTask("mono", "m3", 4, config.StatusWaiting),
+			queueTask("other", "o1", 5, config.StatusWaiting),
+			queueTask("another", "a1", 6, config.StatusWaiting),
+		}
+		Expect(taskNames(pickTasks(queues, 4, nil))).To(Equal([]string{"o1", "a1", "m1"}))
+	})
+
+	It("runs tasks with higher priority only within the fair share of the project", func() {
+		queues := []*commonmodels.WorkflowQueue{}
+		for i, name := range []string{"n1", "n2", "n3", "n4"} {
+			q := queueTask("noisy", name, int64(i+1), config.StatusWaiting)
+			q.Priority = 10
+			queues = append(queues, q)
+		}
+		queues = append(queues, queueTask("quiet", "q1", 5, config.StatusWaiting), queueTask("quiet", "q2", 6, config.StatusWaiting))
+		Expect(taskNames(pickTasks(queues, 4, nil))).To(Equal([]string{"n1", "n2", "q1", "q2"}))
+	})
+
+	It("runs tasks over the fair share when the other projects have nothing to run", func() {
+		n1 := queueTask("noisy", "n1", 1, config.StatusWaiting)
+		n1.Priority = 10
+		queues := []*commonmodels.WorkflowQueue{
+			n1,
+			queueTask("noisy", "n2", 2, config.StatusWaiting),
+			queueTask("noisy", "n3", 3, config.StatusWaiting),
+			queueTask("quiet", "q1", 4, config.StatusRunning),
+		}
+		Expect(taskNames(pickTasks(queues, 4, nil))).To(Equal([]string{"n1", "n2", "n3"}))
+	})
+
+	It("respects the project and cluster quotas", func() {
+		c1 := queueTask("b", "c1", 3, config.StatusWaiting)
+		c1.ClusterIDs = []string{"cluster-1"}
+		c2 := queueTask("c", "c2", 4, config.StatusWaiting)
+		c2.ClusterIDs = []string{"cluster-1"}
+		queues := []*commonmodels.WorkflowQueue{
+			queueTask("a", "a1", 1, config.StatusRunning),
+			queueTask("a", "a2", 2, config.StatusWaiting),
+			c1,
+			c2,
+		}
+		quota := &commonmodels.WorkflowQuota{
+			DefaultProjectConcurrency: 1,
+			ClusterConcurrency:        map[string]int64{"cluster-1": 1},
+		}
+		Expect(taskNames(pickTasks(queues, 10, quota))).To(Equal([]string{"c1"}))
+	})
+
+	It("runs one task of a workflow at a time unless multi run is enabled", func() {
+		w1 := queueTask("a", "w1", 1, config.StatusRunning)
+		w1.MultiRun = false
+		blocked := queueTask("a", "w1", 2, config.StatusBlocked)
+		blocked.MultiRun = false
+		queues := []*commonmodels.WorkflowQueue{w1, blocked, queueTask("a", "w2", 3, config.StatusWaiting)}
+		Expect(taskNames(pickTasks(queues, 10, nil))).To(Equal([]string{"w2"}))
+	})
+})
+
+var _ = Describe("Testing task clusters", func() {
+	It("collects the clusters of the jobs once", func() {
+		stages := []*commonmodels.StageTask{{Jobs: []*commonmodels.JobTask{
+			{Spec: &commonmodels.JobTaskDeploySpec{Env: "dev", ClusterID: "cluster-1"}},
+			{Spec: &commonmodels.JobTaskHelmDeploySpec{Env: "test", ClusterID: "cluster-1"}},
+			{Spec: &commonmodels.JobTaskFreestyleSpec{Properties: commonmodels.JobProperties{ClusterID: "cluster-2"}}},
+		}}}
+		Expect(taskClusterIDs(stages)).To(Equal([]string{"cluster-1", "cluster-2"}))
+	})
+
+	It("counts the deploy jobs to the envs of the local cluster in the local cluster", func() {
+		stages := []*commonmodels.StageTask{{Jobs: []*commonmodels.JobTask{
+			{Spec: &commonmodels.JobTaskDeploySpec{Env: "dev"}},
+			{Spec: &commonmodels.JobTaskHelmDeploySpec{Env: "test"}},
+			{Spec: &commonmodels.JobTaskFreestyleSpec{}},
+		}}}
+		Expect(taskClusterIDs(stages)).To(Equal([]string{setting.LocalClusterID}))
+	})
+})
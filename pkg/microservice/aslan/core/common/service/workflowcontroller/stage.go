@@ -18,40 +18,33 @@ package workflowcontroller
 
 import (
 	"context"
-	"fmt"
-	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
-	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/instantmessage"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/workflowcontroller/jobcontroller"
 )
 
-type approveMap struct {
-	m map[string]*approveWithLock
-	sync.RWMutex
-}
-
-type approveWithLock struct {
-	approval *commonmodels.Approval
-	sync.RWMutex
-}
-
-var globalApproveMap approveMap
-
-func init() {
-	globalApproveMap.m = make(map[string]*approveWithLock, 0)
-}
-
 type StageCtl interface {
 	Run(ctx context.Context, concurrency int)
 }
 
 func runStage(ctx context.Context, stage *commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, concurrency int, logger *zap.SugaredLogger, ack func()) {
+	// stage already finished before the task was resumed.
+	if stage.Status == config.StatusPassed || stage.Status == config.StatusSkipped {
+		logger.Infof("skip finished stage: %s,status: %s", stage.Name, stage.Status)
+		return
+	}
+	if skip := skipStage(stage, workflowCtx, logger); skip {
+		ack()
+		return
+	}
 	stage.Status = config.StatusRunning
-	stage.StartTime = time.Now().Unix()
+	if stage.StartTime == 0 {
+		stage.StartTime = time.Now().Unix()
+	}
 	ack()
 	logger.Infof("start stage: %s,status: %s", stage.Name, stage.Status)
 	if err := waitiForApprove(ctx, stage, workflowCtx, logger, ack); err != nil {
@@ -73,6 +66,27 @@ func runStage(ctx context.Context, stage *commonmodels.StageTask, workflowCtx *c
 	stageCtl.Run(ctx, concurrency)
 }
 
+// skipStage marks the stage and its jobs skipped when the condition of the stage is false,
+// the stage fails when the condition is invalid.
+func skipStage(stage *commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger) bool {
+	run, err := jobcontroller.EvaluateCondition(stage.When, workflowCtx)
+	if err != nil {
+		logger.Errorf("evaluate condition of stage %s error: %v", stage.Name, err)
+		stage.Status = config.StatusFailed
+		stage.Error = err.Error()
+		return true
+	}
+	if run {
+		return false
+	}
+	logger.Infof("skip stage: %s,condition: %s", stage.Name, stage.When)
+	stage.Status = config.StatusSkipped
+	for _, job := range stage.Jobs {
+		job.Status = config.StatusSkipped
+	}
+	return true
+}
+
 func RunStages(ctx context.Context, stages []*commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, concurrency int, logger *zap.SugaredLogger, ack func()) {
 	for _, stage := range stages {
 		runStage(ctx, stage, workflowCtx, concurrency, logger, ack)
@@ -82,65 +96,6 @@ func RunStages(ctx context.Context, stages []*commonmodels.StageTask, workflowCt
 	}
 }
 
-func ApproveStage(workflowName, stageName, userName, userID, comment string, taskID int64, approve bool) error {
-	approveKey := fmt.Sprintf("%s-%d-%s", workflowName, taskID, stageName)
-	approveWithL, ok := globalApproveMap.getApproval(approveKey)
-	if !ok {
-		return fmt.Errorf("workflow %s ID %d stage %s do not need approve", workflowName, taskID, stageName)
-	}
-	return approveWithL.doApproval(userName, userID, comment, approve)
-}
-
-func waitiForApprove(ctx context.Context, stage *commonmodels.StageTask, workflowCtx *commonmodels.WorkflowTaskCtx, logger *zap.SugaredLogger, ack func()) error {
-	if stage.Approval == nil {
-		return nil
-	}
-	if !stage.Approval.Enabled {
-		return nil
-	}
-	if stage.Approval.Timeout == 0 {
-		stage.Approval.Timeout = 60
-	}
-	approveKey := fmt.Sprintf("%s-%d-%s", workflowCtx.WorkflowName, workflowCtx.TaskID, stage.Name)
-	approveWithL := &approveWithLock{approval: stage.Approval}
-	globalApproveMap.setApproval(approveKey, approveWithL)
-	defer func() {
-		globalApproveMap.deleteApproval(approveKey)
-		ack()
-	}()
-	if err := instantmessage.NewWeChatClient().SendWorkflowTaskAproveNotifications(workflowCtx.WorkflowName, workflowCtx.TaskID); err != nil {
-		logger.Errorf("send approve notification failed, error: %v", err)
-	}
-
-	timeout := time.After(time.Duration(stage.Approval.Timeout) * time.Minute)
-	latestApproveCount := 0
-	for {
-		time.Sleep(1 * time.Second)
-		select {
-		case <-ctx.Done():
-			stage.Status = config.StatusCancelled
-			return fmt.Errorf("workflow was canceled")
-
-		case <-timeout:
-			stage.Status = config.StatusCancelled
-			return fmt.Errorf("workflow timeout")
-		default:
-			approved, approveCount, err := approveWithL.isApproval()
-			if err != nil {
-				stage.Status = config.StatusReject
-				return err
-			}
-			if approved {
-				return nil
-			}
-			if approveCount > latestApproveCount {
-				ack()
-				latestApproveCount = approveCount
-			}
-		}
-	}
-}
-
 func statusFailed(status config.Status) bool {
 	if status == config.StatusCancelled || status == config.StatusFailed || status == config.StatusTimeout || status == config.StatusReject {
 		return true
@@ -184,64 +139,3 @@ func updateStageStatus(stage *commonmodels.StageTask) {
 	}
 	stage.Status = stageStatus
 }
-
-func (c *approveMap) setApproval(key string, value *approveWithLock) {
-	c.Lock()
-	defer c.Unlock()
-	c.m[key] = value
-}
-
-func (c *approveMap) getApproval(key string) (*approveWithLock, bool) {
-	c.RLock()
-	defer c.RUnlock()
-	v, existed := c.m[key]
-	return v, existed
-}
-func (c *approveMap) deleteApproval(key string) {
-	c.Lock()
-	defer c.Unlock()
-	delete(c.m, key)
-}
-
-func (c *approveWithLock) isApproval() (bool, int, error) {
-	c.Lock()
-	defer c.Unlock()
-	approveCount := 0
-	for _, user := range c.approval.ApproveUsers {
-		if user.RejectOrApprove == config.Reject {
-			c.approval.RejectOrApprove = config.Reject
-			return false, approveCount, fmt.Errorf("%s reject this task", user.UserName)
-		}
-		if user.RejectOrApprove == config.Approve {
-			approveCount++
-		}
-	}
-	if approveCount >= c.approval.NeededApprovers {
-		c.approval.RejectOrApprove = config.Approve
-		return true, approveCount, nil
-	}
-	return false, approveCount, nil
-}
-
-func (c *approveWithLock) doApproval(userName, userID, comment string, appvove bool) error {
-	c.Lock()
-	defer c.Unlock()
-	for _, user := range c.approval.ApproveUsers {
-		if user.UserID != userID {
-			continue
-		}
-		if user.RejectOrApprove != "" {
-			return fmt.Errorf("%s have %s already", userName, user.RejectOrApprove)
-		}
-		user.Comment = comment
-		user.OperationTime = time.Now().Unix()
-		if appvove {
-			user.RejectOrApprove = config.Approve
-			return nil
-		} else {
-			user.RejectOrApprove = config.Reject
-			return nil
-		}
-	}
-	return fmt.Errorf("user %s has no authority to approve", userName)
-}
@@ -36,6 +36,16 @@ import (
 
 var cancelChannelMap sync.Map
 
+// TaskFinishedHandler is called after the workflow task is done.
+type TaskFinishedHandler func(task *commonmodels.WorkflowTask, logger *zap.SugaredLogger)
+
+var taskFinishedHandlers []TaskFinishedHandler
+
+// RegisterTaskFinishedHandler registers the handler for the finished tasks, it should be called before the controller is started.
+func RegisterTaskFinishedHandler(handler TaskFinishedHandler) {
+	taskFinishedHandlers = append(taskFinishedHandlers, handler)
+}
+
 type workflowCtl struct {
 	workflowTask       *commonmodels.WorkflowTask
 	globalContextMutex sync.RWMutex
@@ -100,14 +110,74 @@ func CancelWorkflowTask(userName, workflowName string, taskID int64, logger *zap
 	return fmt.Errorf("cancel func type mismatched, id: %d, workflow name: %s", taskID, workflowName)
 }
 
+// RetryWorkflowTask puts a finished but not passed task back to the queue, the stages and jobs
+// already passed are kept along with their outputs, the rest will run again from the failed one.
+func RetryWorkflowTask(userName, workflowName string, taskID int64, logger *zap.SugaredLogger) error {
+	t, err := commonrepo.NewworkflowTaskv4Coll().Find(workflowName, taskID)
+	if err != nil {
+		logger.Errorf("[%s] task: %s:%d not found", userName, workflowName, taskID)
+		return err
+	}
+
+	if t.Status != config.StatusFailed && t.Status != config.StatusTimeout && t.Status != config.StatusCancelled && t.Status != config.StatusReject {
+		logger.Errorf("[%s] task: %s:%d is %s, cannot retry", userName, workflowName, taskID, t.Status)
+		return fmt.Errorf("task: %s:%d is %s, cannot retry", workflowName, taskID, t.Status)
+	}
+
+	for _, stage := range t.Stages {
+		if stage.Status == config.StatusPassed || stage.Status == config.StatusSkipped {
+			continue
+		}
+		stage.Status = ""
+		stage.StartTime = 0
+		stage.EndTime = 0
+		stage.Error = ""
+		if stage.Approval != nil && stage.Approval.RejectOrApprove == config.Reject {
+			stage.Approval.RejectOrApprove = ""
+			for _, user := range stage.Approval.ApproveUsers {
+				user.RejectOrApprove = ""
+				user.Comment = ""
+				user.OperationTime = 0
+			}
+		}
+		for _, job := range stage.Jobs {
+			if job.Status == config.StatusPassed || job.Status == config.StatusSkipped {
+				continue
+			}
+			job.Status = ""
+			job.StartTime = 0
+			job.EndTime = 0
+			job.Error = ""
+			job.K8sJobName = ""
+			job.RetryCount = 0
+		}
+	}
+	t.StartTime = 0
+	t.EndTime = 0
+	t.Error = ""
+	t.TaskRevoker = ""
+	t.IsRestart = true
+
+	logger.Infof("[%s] RetryTask %s:%d", userName, workflowName, taskID)
+	return UpdateTask(t)
+}
+
 func (c *workflowCtl) Run(ctx context.Context, concurrency int) {
 	if c.workflowTask.GlobalContext == nil {
 		c.workflowTask.GlobalContext = make(map[string]string)
 	}
 	c.workflowTask.Status = config.StatusRunning
-	c.workflowTask.StartTime = time.Now().Unix()
+	// resumed task keeps its original start time.
+	if c.workflowTask.StartTime == 0 {
+		c.workflowTask.StartTime = time.Now().Unix()
+	}
 	c.ack()
 	c.logger.Infof("start workflow: %s,status: %s", c.workflowTask.WorkflowName, c.workflowTask.Status)
+	if c.workflowTask.WorkflowArgs != nil {
+		if err := scmnotify.NewService().UpdateCommitStatusForWorkflowV4(c.workflowTask.WorkflowArgs, c.workflowTask.TaskID, config.StatusRunning); err != nil {
+			c.logger.Warnf("Failed to update commit status for custom workflow %s, taskID: %d the error is: %s", c.workflowTask.WorkflowName, c.workflowTask.TaskID, err)
+		}
+	}
 	defer func() {
 		c.workflowTask.EndTime = time.Now().Unix()
 		c.logger.Infof("finish workflow: %s,status: %s", c.workflowTask.WorkflowName, c.workflowTask.Status)
@@ -123,17 +193,31 @@ func (c *workflowCtl) Run(ctx context.Context, concurrency int) {
 		WorkflowName:      c.workflowTask.WorkflowName,
 		ProjectName:       c.workflowTask.ProjectName,
 		TaskID:            c.workflowTask.TaskID,
+		TaskCreator:       c.workflowTask.TaskCreator,
 		Workspace:         "/workspace",
 		DistDir:           fmt.Sprintf("%s/%s/dist/%d", config.S3StoragePath(), c.workflowTask.WorkflowName, c.workflowTask.TaskID),
 		DockerMountDir:    fmt.Sprintf("/tmp/%s/docker/%d", uuid.NewV4(), time.Now().Unix()),
 		ConfigMapMountDir: fmt.Sprintf("/tmp/%s/cm/%d", uuid.NewV4(), time.Now().Unix()),
 		WorkflowKeyVals:   c.workflowTask.KeyVals,
+		WorkflowParams:    c.workflowTask.Params,
 		GlobalContextGet:  c.getGlobalContext,
 		GlobalContextSet:  c.setGlobalContext,
 		GlobalContextEach: c.globalContextEach,
 	}
+	if c.workflowTask.WorkflowArgs != nil {
+		workflowCtx.HookPayload = c.workflowTask.WorkflowArgs.HookPayload
+	}
 	defer jobcontroller.CleanWorkflowJobs(ctx, c.workflowTask, workflowCtx, c.logger, c.ack)
-	RunStages(ctx, c.workflowTask.Stages, workflowCtx, concurrency, c.logger, c.ack)
+	if hasJobDependency(c.workflowTask.Stages) {
+		if err := RunJobDAG(ctx, c.workflowTask.Stages, workflowCtx, concurrency, c.logger, c.ack); err != nil {
+			c.logger.Errorf("run workflow %s:%d error: %v", c.workflowTask.WorkflowName, c.workflowTask.TaskID, err)
+			c.workflowTask.Error = err.Error()
+			c.workflowTask.Status = config.StatusFailed
+			return
+		}
+	} else {
+		RunStages(ctx, c.workflowTask.Stages, workflowCtx, concurrency, c.logger, c.ack)
+	}
 	updateworkflowStatus(c.workflowTask)
 }
 
@@ -195,11 +279,19 @@ func (c *workflowCtl) updateWorkflowTask() {
 			return
 		}
 	}
+	// approvals are written to database directly, keep them from being overwritten.
+	for _, stage := range c.workflowTask.Stages {
+		for _, stageInColl := range taskInColl.Stages {
+			if stage.Name == stageInColl.Name {
+				mergeApproval(stage.Approval, stageInColl.Approval)
+			}
+		}
+	}
 	if success := UpdateQueue(c.workflowTask); !success {
 		c.logger.Errorf("%s:%d update t status error", c.workflowTask.WorkflowName, c.workflowTask.TaskID)
 	}
-	// TODO update workflow task
-	if err := commonrepo.NewworkflowTaskv4Coll().Update(c.workflowTask.ID.Hex(), c.workflowTask); err != nil {
+	// approve users are left out of the update, ApproveStage writes their decisions atomically.
+	if err := commonrepo.NewworkflowTaskv4Coll().UpdateWithoutApproveUsers(c.workflowTask.ID.Hex(), c.workflowTask); err != nil {
 		c.logger.Errorf("update workflow task v4 failed,error: %v", err)
 	}
 
@@ -227,6 +319,9 @@ func (c *workflowCtl) updateWorkflowTask() {
 		if err := scmnotify.NewService().CompleteGitCheckForWorkflowV4(c.workflowTask.WorkflowArgs, c.workflowTask.TaskID, c.workflowTask.Status, c.logger); err != nil {
 			log.Warnf("Failed to update github check status for custom workflow %s, taskID: %d the error is: %s", c.workflowTask.WorkflowName, c.workflowTask.TaskID, err)
 		}
+		for _, handler := range taskFinishedHandlers {
+			handler(c.workflowTask, c.logger)
+		}
 	}
 
 }
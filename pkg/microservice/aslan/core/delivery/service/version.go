@@ -1424,8 +1424,9 @@ func downloadChart(deliveryVersion *commonmodels.DeliveryVersion, chartInfo *com
 		return "", err
 	}
 
-	chartRef := fmt.Sprintf("%s/%s", chartRepo.RepoName, chartInfo.ChartName)
-	return chartTGZFilePath, hClient.DownloadChart(commonservice.GeneHelmRepo(chartRepo), chartRef, chartInfo.ChartVersion, chartTGZFileParent, false)
+	repoEntry := commonservice.GeneHelmRepo(chartRepo)
+	chartRef := helmtool.ChartRef(repoEntry, chartInfo.ChartName)
+	return chartTGZFilePath, hClient.DownloadChart(repoEntry, chartRef, chartInfo.ChartVersion, chartTGZFileParent, false)
 }
 
 func getChartDistributeInfo(releaseID, chartName string, log *zap.SugaredLogger) (*commonmodels.DeliveryDistribute, error) {
@@ -1480,7 +1481,8 @@ func preDownloadChart(projectName, versionName, chartName string, log *zap.Sugar
 	return filePath, err
 }
 
-func getIndexInfoFromChartRepo(chartRepoName string) (*repo.IndexFile, error) {
+// getIndexInfoFromChartRepo fetches the index of the chart repo, charts in OCI registries are only listed by chartNames
+func getIndexInfoFromChartRepo(chartRepoName string, chartNames []string) (*repo.IndexFile, error) {
 	chartRepo, err := getChartRepoData(chartRepoName)
 	if err != nil {
 		return nil, err
@@ -1489,17 +1491,23 @@ func getIndexInfoFromChartRepo(chartRepoName string) (*repo.IndexFile, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create chart repo client")
 	}
-	return hClient.FetchIndexYaml(commonservice.GeneHelmRepo(chartRepo))
+	repoEntry := commonservice.GeneHelmRepo(chartRepo)
+	if helmtool.IsOCIRepo(repoEntry) {
+		return hClient.FetchOCIIndex(repoEntry, chartNames)
+	}
+	return hClient.FetchIndexYaml(repoEntry)
 }
 
 func fillChartUrl(charts []*DeliveryVersionPayloadChart, chartRepoName string) error {
-	index, err := getIndexInfoFromChartRepo(chartRepoName)
-	if err != nil {
-		return err
-	}
 	chartMap := make(map[string]*DeliveryVersionPayloadChart)
+	chartNames := make([]string, 0, len(charts))
 	for _, chart := range charts {
 		chartMap[chart.ChartName] = chart
+		chartNames = append(chartNames, chart.ChartName)
+	}
+	index, err := getIndexInfoFromChartRepo(chartRepoName, chartNames)
+	if err != nil {
+		return err
 	}
 
 	for name, entries := range index.Entries {
@@ -1524,13 +1532,12 @@ func fillChartUrl(charts []*DeliveryVersionPayloadChart, chartRepoName string) e
 }
 
 func GetChartVersion(chartName, chartRepoName string) ([]*ChartVersionResp, error) {
-
-	index, err := getIndexInfoFromChartRepo(chartRepoName)
+	chartNameList := strings.Split(chartName, ",")
+	index, err := getIndexInfoFromChartRepo(chartRepoName, chartNameList)
 	if err != nil {
 		return nil, err
 	}
 
-	chartNameList := strings.Split(chartName, ",")
 	chartNameSet := sets.NewString(chartNameList...)
 	existedChartSet := sets.NewString()
 
@@ -156,6 +156,8 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		environments.POST("/:name/services/:serviceName/restartNew", RestartNewService)
 		environments.POST("/:name/services/:serviceName/scale", ScaleService)
 		environments.POST("/:name/services/:serviceName/scaleNew", ScaleNewService)
+		environments.GET("/:name/services/:serviceName/versions", ListEnvServiceVersions)
+		environments.POST("/:name/services/:serviceName/rollback", RollbackEnvService)
 		environments.GET("/:name/services/:serviceName/containers/:container", GetServiceContainer)
 
 		environments.GET("/:name/estimated-renderchart", GetEstimatedRenderCharts)
@@ -55,6 +55,47 @@ func RestartService(c *gin.Context) {
 	ctx.Err = service.RestartService(args.EnvName, args, ctx.Logger)
 }
 
+type listEnvServiceVersionsArgs struct {
+	ProjectName string `json:"projectName" form:"projectName"`
+	PerPage     int    `json:"perPage"     form:"perPage,default=20"`
+	Page        int    `json:"page"        form:"page,default=1"`
+}
+
+func ListEnvServiceVersions(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	args := &listEnvServiceVersionsArgs{}
+	if err := c.ShouldBindQuery(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+
+	var count int64
+	ctx.Resp, count, ctx.Err = service.ListEnvServiceVersions(args.ProjectName, c.Param("name"), c.Param("serviceName"), args.Page, args.PerPage, ctx.Logger)
+	c.Writer.Header().Set("X-Total", strconv.FormatInt(count, 10))
+}
+
+func RollbackEnvService(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	envName := c.Param("name")
+	projectName := c.Query("projectName")
+	serviceName := c.Param("serviceName")
+
+	args := new(service.RollbackEnvServiceArgs)
+	if err := c.BindJSON(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+
+	internalhandler.InsertDetailedOperationLog(c, ctx.UserName, projectName, setting.OperationSceneEnv,
+		"回滚", "环境-服务", fmt.Sprintf("环境名称:%s,服务名称:%s,版本:%d", envName, serviceName, args.Revision),
+		"", ctx.Logger, envName)
+	ctx.Err = service.RollbackEnvService(projectName, envName, serviceName, args.Revision, ctx.UserName, ctx.Logger)
+}
+
 func UpdateService(c *gin.Context) {
 	ctx := internalhandler.NewContext(c)
 	defer func() { internalhandler.JSONResponse(c, ctx) }()
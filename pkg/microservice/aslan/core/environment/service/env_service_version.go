@@ -0,0 +1,322 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/release"
+	versionedclient "istio.io/client-go/pkg/clientset/versioned"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/setting"
+	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+	helmtool "github.com/koderover/zadig/pkg/tool/helmclient"
+	"github.com/koderover/zadig/pkg/tool/kube/informer"
+)
+
+type RollbackEnvServiceArgs struct {
+	Revision int64 `json:"revision"`
+}
+
+// createEnvServiceVersion records the deployed version of the service, failures are only logged
+// since the service has already been deployed.
+func createEnvServiceVersion(version *commonmodels.EnvServiceVersion, log *zap.SugaredLogger) {
+	if err := commonrepo.NewEnvServiceVersionColl().Create(version); err != nil {
+		log.Errorf("failed to create version of service %s in env %s/%s, err: %s", version.ServiceName, version.ProductName, version.EnvName, err)
+	}
+}
+
+func createHelmEnvServiceVersion(param *ReleaseInstallParam, releaseRevision int, log *zap.SugaredLogger) {
+	if param.EnvName == "" {
+		return
+	}
+	serviceObj := param.serviceObj
+	containers := make([]*commonmodels.Container, 0, len(serviceObj.Containers))
+	for _, c := range serviceObj.Containers {
+		container := &commonmodels.Container{
+			Name:      c.Name,
+			ImageName: c.ImageName,
+			Image:     c.Image,
+			ImagePath: c.ImagePath,
+		}
+		if c.ImagePath != nil {
+			if image, err := genImageFromYaml(c, param.MergedValues, "", "", ""); err == nil {
+				container.Image = image
+			}
+		}
+		containers = append(containers, container)
+	}
+
+	createEnvServiceVersion(&commonmodels.EnvServiceVersion{
+		ProductName: param.ProductName,
+		EnvName:     param.EnvName,
+		Namespace:   param.Namespace,
+		ServiceName: serviceObj.ServiceName,
+		Service: &commonmodels.ProductService{
+			ServiceName: serviceObj.ServiceName,
+			ProductName: serviceObj.ProductName,
+			Type:        setting.HelmDeployType,
+			Revision:    serviceObj.Revision,
+			Containers:  containers,
+		},
+		RenderChart:     param.RenderChart,
+		ReleaseName:     param.ReleaseName,
+		ReleaseRevision: releaseRevision,
+		ValuesYaml:      param.MergedValues,
+	}, log)
+}
+
+func ListEnvServiceVersions(projectName, envName, serviceName string, page, perPage int, log *zap.SugaredLogger) ([]*commonmodels.EnvServiceVersion, int64, error) {
+	versions, count, err := commonrepo.NewEnvServiceVersionColl().List(projectName, envName, serviceName, page, perPage)
+	if err != nil {
+		log.Errorf("failed to list versions of service %s in env %s/%s, err: %s", serviceName, projectName, envName, err)
+		return nil, 0, e.ErrGetService.AddErr(err)
+	}
+	return versions, count, nil
+}
+
+// RollbackEnvService deploys the service in the env with the images, manifests or values of a previous version.
+func RollbackEnvService(projectName, envName, serviceName string, revision int64, userName string, log *zap.SugaredLogger) error {
+	version, err := commonrepo.NewEnvServiceVersionColl().Find(projectName, envName, serviceName, revision)
+	if err != nil {
+		log.Errorf("failed to find version %d of service %s in env %s/%s, err: %s", revision, serviceName, projectName, envName, err)
+		return e.ErrRollbackEnvService.AddDesc(fmt.Sprintf("version %d of service %s not found", revision, serviceName))
+	}
+
+	prod, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: projectName, EnvName: envName})
+	if err != nil {
+		log.Errorf("failed to find env %s/%s, err: %s", projectName, envName, err)
+		return e.ErrRollbackEnvService.AddErr(err)
+	}
+	if err := checkEnvServiceRollback(prod, version); err != nil {
+		return e.ErrRollbackEnvService.AddDesc(err.Error())
+	}
+	prod.UpdateBy = userName
+
+	if version.Service.Type == setting.HelmDeployType {
+		err = rollbackHelmService(prod, version, userName, log)
+	} else {
+		err = rollbackK8sService(prod, version, log)
+	}
+	if err != nil {
+		log.Errorf("failed to rollback service %s in env %s/%s to version %d, err: %s", serviceName, projectName, envName, revision, err)
+		return e.ErrRollbackEnvService.AddErr(err)
+	}
+	return nil
+}
+
+// checkEnvServiceRollback returns the error if the service in the env can't be rolled back to the version.
+func checkEnvServiceRollback(prod *commonmodels.Product, version *commonmodels.EnvServiceVersion) error {
+	if version.Service == nil {
+		return fmt.Errorf("version %d of service %s is invalid", version.Revision, version.ServiceName)
+	}
+	switch prod.Status {
+	case setting.ProductStatusCreating, setting.ProductStatusUpdating, setting.ProductStatusDeleting:
+		return errors.New(e.EnvCantUpdatedMsg)
+	}
+	if _, ok := prod.GetServiceMap()[version.ServiceName]; !ok {
+		return fmt.Errorf("service %s not found in env %s", version.ServiceName, prod.EnvName)
+	}
+	switch version.Service.Type {
+	case setting.K8SDeployType:
+	case setting.HelmDeployType:
+		if version.RenderChart == nil || version.ReleaseName == "" {
+			return fmt.Errorf("chart of version %d is not recorded", version.Revision)
+		}
+	default:
+		return fmt.Errorf("service type %s is not supported", version.Service.Type)
+	}
+	return nil
+}
+
+func rollbackK8sService(prod *commonmodels.Product, version *commonmodels.EnvServiceVersion, log *zap.SugaredLogger) error {
+	svc := &commonmodels.ProductService{
+		ServiceName: version.ServiceName,
+		ProductName: version.Service.ProductName,
+		Type:        version.Service.Type,
+		Revision:    version.Service.Revision,
+		Containers:  version.Service.Containers,
+		Render:      version.Service.Render,
+	}
+	// compatibility: use the renderset of the env if the version does not record one
+	if svc.Render == nil {
+		svc.Render = prod.Render
+	}
+	renderSet, err := commonrepo.NewRenderSetColl().Find(&commonrepo.RenderSetFindOption{
+		Name:        svc.Render.Name,
+		Revision:    svc.Render.Revision,
+		ProductTmpl: svc.Render.ProductTmpl,
+		EnvName:     prod.EnvName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find renderset %s revision %d, err: %s", svc.Render.Name, svc.Render.Revision, err)
+	}
+
+	kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), prod.ClusterID)
+	if err != nil {
+		return err
+	}
+	restConfig, err := kubeclient.GetRESTConfig(config.HubServerAddress(), prod.ClusterID)
+	if err != nil {
+		return err
+	}
+	istioClient, err := versionedclient.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	cls, err := kubeclient.GetKubeClientSet(config.HubServerAddress(), prod.ClusterID)
+	if err != nil {
+		return err
+	}
+	inf, err := informer.NewInformer(prod.ClusterID, prod.Namespace, cls)
+	if err != nil {
+		return err
+	}
+
+	_, err = upsertService(true, prod, svc, prod.GetServiceMap()[svc.ServiceName], renderSet, inf, kubeClient, istioClient, log)
+	if err != nil {
+		return err
+	}
+
+	replaceEnvService(prod, svc)
+	return commonrepo.NewProductColl().Update(prod)
+}
+
+// replaceEnvService replaces the service with the same name in the env.
+func replaceEnvService(prod *commonmodels.Product, svc *commonmodels.ProductService) {
+	for _, group := range prod.Services {
+		for i, service := range group {
+			if service.ServiceName == svc.ServiceName {
+				group[i] = svc
+			}
+		}
+	}
+}
+
+func rollbackHelmService(prod *commonmodels.Product, version *commonmodels.EnvServiceVersion, userName string, log *zap.SugaredLogger) error {
+	if prod.Render == nil {
+		return fmt.Errorf("renderset of env %s not found", prod.EnvName)
+	}
+	renderSet, err := commonrepo.NewRenderSetColl().Find(&commonrepo.RenderSetFindOption{
+		ProductTmpl: prod.ProductName,
+		Name:        prod.Render.Name,
+		EnvName:     prod.EnvName,
+		Revision:    prod.Render.Revision,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find renderset %s revision %d, err: %s", prod.Render.Name, prod.Render.Revision, err)
+	}
+
+	helmClient, err := helmtool.NewClientFromNamespace(prod.ClusterID, prod.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// roll back the release if the revision is still kept in the release history, otherwise upgrade the release
+	// with the chart and values of the version.
+	var releases []*release.Release
+	if version.ReleaseRevision > 0 {
+		releases, err = helmClient.ListReleaseHistory(version.ReleaseName, 10)
+		if err != nil {
+			log.Warnf("failed to list history of release %s, err: %s", version.ReleaseName, err)
+		}
+	}
+
+	if releaseRevisionInHistory(releases, version.ReleaseRevision) {
+		if err := helmClient.RollbackToRevision(version.ReleaseName, version.ReleaseRevision, false, time.Duration(setting.DeployTimeout)*time.Second); err != nil {
+			return fmt.Errorf("failed to rollback release %s to revision %d, err: %s", version.ReleaseName, version.ReleaseRevision, err)
+		}
+		releaseRevision := 0
+		if rel, err := helmClient.GetRelease(version.ReleaseName); err == nil {
+			releaseRevision = rel.Version
+		}
+		createEnvServiceVersion(&commonmodels.EnvServiceVersion{
+			ProductName:     prod.ProductName,
+			EnvName:         prod.EnvName,
+			Namespace:       prod.Namespace,
+			ServiceName:     version.ServiceName,
+			Service:         version.Service,
+			RenderChart:     version.RenderChart,
+			ReleaseName:     version.ReleaseName,
+			ReleaseRevision: releaseRevision,
+			ValuesYaml:      version.ValuesYaml,
+			CreateBy:        userName,
+		}, log)
+	} else {
+		serviceObj, err := commonrepo.NewServiceColl().Find(&commonrepo.ServiceFindOption{
+			ServiceName: version.ServiceName,
+			ProductName: version.Service.ProductName,
+			Type:        setting.HelmDeployType,
+			Revision:    version.Service.Revision,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find service %s revision %d, err: %s", version.ServiceName, version.Service.Revision, err)
+		}
+		param := &ReleaseInstallParam{
+			ProductName:  serviceObj.ProductName,
+			Namespace:    prod.Namespace,
+			ReleaseName:  version.ReleaseName,
+			MergedValues: version.ValuesYaml,
+			RenderChart:  version.RenderChart,
+			serviceObj:   serviceObj,
+			EnvName:      prod.EnvName,
+		}
+		if err := installOrUpgradeHelmChartWithValues(param, false, helmClient); err != nil {
+			return err
+		}
+	}
+
+	applyHelmServiceVersion(prod, renderSet, version)
+	if err := commonrepo.NewRenderSetColl().Update(renderSet); err != nil {
+		return fmt.Errorf("failed to update renderset %s, err: %s", renderSet.Name, err)
+	}
+	return commonrepo.NewProductColl().Update(prod)
+}
+
+// releaseRevisionInHistory reports whether the revision is still kept in the history of the release,
+// so the release can be rolled back to it instead of being upgraded again.
+func releaseRevisionInHistory(releases []*release.Release, revision int) bool {
+	if revision <= 0 {
+		return false
+	}
+	for _, rel := range releases {
+		if rel.Version == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHelmServiceVersion sets the chart of the version to the renderset, and the revision and images of the version
+// to the service in the env.
+func applyHelmServiceVersion(prod *commonmodels.Product, renderSet *commonmodels.RenderSet, version *commonmodels.EnvServiceVersion) {
+	for i, chart := range renderSet.ChartInfos {
+		if chart.ServiceName == version.ServiceName {
+			renderSet.ChartInfos[i] = version.RenderChart
+		}
+	}
+	prodSvc := prod.GetServiceMap()[version.ServiceName]
+	prodSvc.Revision = version.Service.Revision
+	prodSvc.Containers = version.Service.Containers
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/release"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	templatemodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models/template"
+	"github.com/koderover/zadig/pkg/setting"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+)
+
+var _ = Describe("Testing env service version", func() {
+
+	newEnv := func() *commonmodels.Product {
+		return &commonmodels.Product{
+			ProductName: "project",
+			EnvName:     "dev",
+			Services: [][]*commonmodels.ProductService{{
+				{ServiceName: "web", Type: setting.HelmDeployType, Revision: 3, Containers: []*commonmodels.Container{{Name: "web", Image: "koderover/web:v3"}}},
+				{ServiceName: "api", Type: setting.HelmDeployType, Revision: 5},
+			}},
+		}
+	}
+	newVersion := func() *commonmodels.EnvServiceVersion {
+		return &commonmodels.EnvServiceVersion{
+			ProductName: "project",
+			EnvName:     "dev",
+			ServiceName: "web",
+			Revision:    2,
+			Service: &commonmodels.ProductService{
+				ServiceName: "web",
+				Type:        setting.HelmDeployType,
+				Revision:    2,
+				Containers:  []*commonmodels.Container{{Name: "web", Image: "koderover/web:v2"}},
+			},
+			RenderChart:     &templatemodels.RenderChart{ServiceName: "web", ChartVersion: "0.2.0", ValuesYaml: "image: koderover/web:v2"},
+			ReleaseName:     "web-dev",
+			ReleaseRevision: 7,
+		}
+	}
+
+	Context("checkEnvServiceRollback", func() {
+		It("should be passed for the recorded version", func() {
+			Expect(checkEnvServiceRollback(newEnv(), newVersion())).NotTo(HaveOccurred())
+		})
+		It("should reject the rollback while the env is updating", func() {
+			for _, status := range []string{setting.ProductStatusCreating, setting.ProductStatusUpdating, setting.ProductStatusDeleting} {
+				env := newEnv()
+				env.Status = status
+				err := checkEnvServiceRollback(env, newVersion())
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal(e.EnvCantUpdatedMsg))
+			}
+		})
+		It("should reject the version without service", func() {
+			version := newVersion()
+			version.Service = nil
+			Expect(checkEnvServiceRollback(newEnv(), version)).To(HaveOccurred())
+		})
+		It("should reject the service not in the env", func() {
+			version := newVersion()
+			version.ServiceName = "db"
+			Expect(checkEnvServiceRollback(newEnv(), version)).To(HaveOccurred())
+		})
+		It("should reject the helm version without chart or release", func() {
+			version := newVersion()
+			version.RenderChart = nil
+			Expect(checkEnvServiceRollback(newEnv(), version)).To(HaveOccurred())
+			version = newVersion()
+			version.ReleaseName = ""
+			Expect(checkEnvServiceRollback(newEnv(), version)).To(HaveOccurred())
+		})
+		It("should reject the unsupported service types", func() {
+			version := newVersion()
+			version.Service.Type = setting.PMDeployType
+			Expect(checkEnvServiceRollback(newEnv(), version)).To(HaveOccurred())
+		})
+	})
+
+	Context("releaseRevisionInHistory", func() {
+		releases := []*release.Release{{Name: "web-dev", Version: 6}, {Name: "web-dev", Version: 7}, {Name: "web-dev", Version: 8}}
+
+		It("should roll back the release to the revision in the history", func() {
+			Expect(releaseRevisionInHistory(releases, 7)).To(BeTrue())
+		})
+		It("should upgrade the release for the revisions no longer in the history", func() {
+			Expect(releaseRevisionInHistory(releases, 2)).To(BeFalse())
+			Expect(releaseRevisionInHistory(nil, 7)).To(BeFalse())
+		})
+		It("should upgrade the release for the unknown revisions", func() {
+			Expect(releaseRevisionInHistory(releases, 0)).To(BeFalse())
+			Expect(releaseRevisionInHistory([]*release.Release{{Name: "web-dev", Version: 0}}, 0)).To(BeFalse())
+		})
+	})
+
+	Context("applyHelmServiceVersion", func() {
+		It("should update the chart in the renderset and the service in the env", func() {
+			env := newEnv()
+			version := newVersion()
+			renderSet := &commonmodels.RenderSet{ChartInfos: []*templatemodels.RenderChart{
+				{ServiceName: "web", ChartVersion: "0.3.0", ValuesYaml: "image: koderover/web:v3"},
+				{ServiceName: "api", ChartVersion: "0.5.0"},
+			}}
+			applyHelmServiceVersion(env, renderSet, version)
+
+			Expect(renderSet.ChartInfos[0]).To(Equal(version.RenderChart))
+			Expect(renderSet.ChartInfos[1].ChartVersion).To(Equal("0.5.0"))
+			web := env.GetServiceMap()["web"]
+			Expect(web.Revision).To(Equal(int64(2)))
+			Expect(web.Containers[0].Image).To(Equal("koderover/web:v2"))
+			Expect(env.GetServiceMap()["api"].Revision).To(Equal(int64(5)))
+		})
+	})
+
+	Context("replaceEnvService", func() {
+		It("should replace the service with the same name only", func() {
+			env := newEnv()
+			svc := &commonmodels.ProductService{ServiceName: "web", Type: setting.K8SDeployType, Revision: 2}
+			replaceEnvService(env, svc)
+			Expect(env.Services[0][0]).To(BeIdenticalTo(svc))
+			Expect(env.Services[0][1].ServiceName).To(Equal("api"))
+		})
+	})
+})
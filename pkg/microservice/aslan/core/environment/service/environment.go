@@ -205,6 +205,8 @@ type ReleaseInstallParam struct {
 	RenderChart  *templatemodels.RenderChart
 	serviceObj   *commonmodels.Service
 	DryRun       bool
+	// EnvName is used to record the deployed version of the service.
+	EnvName string
 }
 
 type intervalExecutorHandler func(data *commonmodels.Service, isRetry bool, log *zap.SugaredLogger) error
@@ -2206,6 +2208,10 @@ func DeleteProduct(username, envName, productName, requestID string, isDelete bo
 	log.Infof("[%s] delete product %s", username, productInfo.Namespace)
 	commonservice.LogProductStats(username, setting.DeleteProductEvent, productName, requestID, eventStart, log)
 
+	if err := commonrepo.NewEnvServiceVersionColl().DeleteByEnv(productName, envName); err != nil {
+		log.Errorf("[%s][%s] delete env service versions error: %v", username, productInfo.Namespace, err)
+	}
+
 	ctx := context.TODO()
 	switch productInfo.Source {
 	case setting.SourceFromHelm:
@@ -3002,7 +3008,27 @@ func upsertService(isUpdate bool, env *commonmodels.Product,
 		res = append(res, u)
 	}
 
-	return res, errList.ErrorOrNil()
+	if err := errList.ErrorOrNil(); err != nil {
+		return res, err
+	}
+
+	version := &commonmodels.EnvServiceVersion{
+		ProductName: productName,
+		EnvName:     envName,
+		Namespace:   namespace,
+		ServiceName: service.ServiceName,
+		Service:     service,
+		Yaml:        *parsedYaml,
+		CreateBy:    env.UpdateBy,
+	}
+	if renderSet != nil {
+		svc := *service
+		svc.Render = &commonmodels.RenderInfo{Name: renderSet.Name, Revision: renderSet.Revision, ProductTmpl: renderSet.ProductTmpl}
+		version.Service = &svc
+	}
+	createEnvServiceVersion(version, log)
+
+	return res, nil
 }
 
 func removeOldResources(
@@ -3340,6 +3366,7 @@ func buildInstallParam(namespace, envName, defaultValues string, renderChart *te
 		MergedValues: mergedValues,
 		RenderChart:  renderChart,
 		serviceObj:   serviceObj,
+		EnvName:      envName,
 	}
 	return ret, nil
 }
@@ -3406,6 +3433,8 @@ func installOrUpgradeHelmChartWithValues(param *ReleaseInstallParam, isRetry boo
 			err = EnsureZadigServiceByManifest(ctx, param.ProductName, param.Namespace, release.Manifest)
 			if err != nil {
 				err = errors.WithMessagef(err, "failed to ensure Zadig Service %s", err)
+			} else {
+				createHelmEnvServiceVersion(param, release.Version, log.SugaredLogger())
 			}
 		}
 	}
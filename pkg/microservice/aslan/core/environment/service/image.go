@@ -187,6 +187,7 @@ func updateContainerForHelmChart(serviceName, resType, image, containerName stri
 		MergedValues: replacedMergedValuesYaml,
 		RenderChart:  targetChart,
 		serviceObj:   serviceObj,
+		EnvName:      product.EnvName,
 	}
 
 	// when replace image, should not wait
@@ -70,7 +70,7 @@ func GetWorkflowV4JobContainerLogs(c *gin.Context) {
 		return
 	}
 	// Use all lowercase job names to avoid subdomain errors
-	ctx.Resp, ctx.Err = logservice.GetWorkflowV4JobContainerLogs(strings.ToLower(c.Param("workflowName")), c.Param("jobName"), taskID, ctx.Logger)
+	ctx.Resp, ctx.Err = logservice.GetWorkflowV4JobContainerLogs(strings.ToLower(c.Param("workflowName")), c.Param("jobName"), c.Query("step"), taskID, ctx.Logger)
 }
 
 func GetTestJobContainerLogs(c *gin.Context) {
@@ -26,12 +26,14 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/kube"
 	s3service "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/s3"
 	"github.com/koderover/zadig/pkg/setting"
 	"github.com/koderover/zadig/pkg/tool/kube/containerlog"
 	s3tool "github.com/koderover/zadig/pkg/tool/s3"
+	jobtypes "github.com/koderover/zadig/pkg/types/job"
 	"github.com/koderover/zadig/pkg/util"
 )
 
@@ -55,13 +57,46 @@ func GetWorkflowBuildJobContainerLogs(pipelineName, serviceName, buildType strin
 	return buildLog, nil
 }
 
-func GetWorkflowV4JobContainerLogs(workflowName, jobName string, taskID int64, log *zap.SugaredLogger) (string, error) {
+// GetWorkflowV4JobContainerLogs returns the log of the job, or the log of the step only if stepName is specified.
+func GetWorkflowV4JobContainerLogs(workflowName, jobName, stepName string, taskID int64, log *zap.SugaredLogger) (string, error) {
 	buildJobNamePrefix := jobName
 	buildLog, err := getContainerLogFromS3(workflowName, buildJobNamePrefix, taskID, log)
 	if err != nil {
 		return "", err
 	}
-	return buildLog, nil
+	if stepName == "" {
+		return buildLog, nil
+	}
+	nonce, err := getStepMarkerNonce(workflowName, jobName, taskID)
+	if err != nil {
+		return "", err
+	}
+	for _, stepLog := range jobtypes.SplitStepLogs(buildLog, nonce) {
+		if stepLog.Name == stepName {
+			return stepLog.Log, nil
+		}
+	}
+	return "", fmt.Errorf("log of step %s not found in job %s", stepName, jobName)
+}
+
+func getStepMarkerNonce(workflowName, jobName string, taskID int64) (string, error) {
+	task, err := commonrepo.NewworkflowTaskv4Coll().Find(workflowName, taskID)
+	if err != nil {
+		return "", fmt.Errorf("failed to find workflow task %s-%d: %v", workflowName, taskID, err)
+	}
+	for _, stage := range task.Stages {
+		for _, job := range stage.Jobs {
+			if job.Name != jobName {
+				continue
+			}
+			jobSpec := &commonmodels.JobTaskFreestyleSpec{}
+			if err := commonmodels.IToi(job.Spec, jobSpec); err != nil {
+				return "", err
+			}
+			return jobSpec.StepMarkerNonce, nil
+		}
+	}
+	return "", fmt.Errorf("job %s not found in workflow task %s-%d", jobName, workflowName, taskID)
 }
 
 func GetTestJobContainerLogs(pipelineName, serviceName string, taskID int64, log *zap.SugaredLogger) (string, error) {
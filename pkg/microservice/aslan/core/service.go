@@ -62,6 +62,7 @@ import (
 const (
 	webhookController = iota
 	bundleController
+	registryHookController
 )
 
 type policyGetter interface {
@@ -74,12 +75,14 @@ type Controller interface {
 
 func StartControllers(stopCh <-chan struct{}) {
 	controllerWorkers := map[int]int{
-		webhookController: 1,
-		bundleController:  1,
+		webhookController:      1,
+		bundleController:       1,
+		registryHookController: 1,
 	}
 	controllers := map[int]Controller{
-		webhookController: webhook.NewWebhookController(),
-		bundleController:  policybundle.NewBundleController(),
+		webhookController:      webhook.NewWebhookController(),
+		bundleController:       policybundle.NewBundleController(),
+		registryHookController: workflowservice.NewRegistryHookPoller(),
 	}
 
 	var wg sync.WaitGroup
@@ -146,6 +149,7 @@ func Start(ctx context.Context) {
 	workflowservice.InitPipelineController()
 	// update offical plugins
 	workflowservice.UpdateOfficalPluginRepository(log.SugaredLogger())
+	workflowcontroller.RegisterTaskFinishedHandler(workflowservice.TriggerWorkflowV4ByUpstream)
 	workflowcontroller.InitWorkflowController()
 	// 如果集群环境所属的项目不存在，则删除此集群环境
 	environmentservice.CleanProducts()
@@ -289,8 +293,11 @@ func initDatabase() {
 		commonrepo.NewWorkflowV4Coll(),
 		commonrepo.NewworkflowTaskv4Coll(),
 		commonrepo.NewWorkflowQueueColl(),
+		commonrepo.NewEnvServiceVersionColl(),
 		commonrepo.NewPluginRepoColl(),
 		commonrepo.NewWorkflowViewColl(),
+		commonrepo.NewIMAppColl(),
+		commonrepo.NewIMUserBindingColl(),
 
 		systemrepo.NewAnnouncementColl(),
 		systemrepo.NewOperationLogColl(),
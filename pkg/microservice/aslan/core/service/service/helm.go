@@ -568,11 +568,12 @@ func CreateOrUpdateHelmServiceFromChartRepo(projectName string, args *HelmServic
 		return nil, e.ErrCreateTemplate.AddErr(errors.Wrapf(err, "failed to init chart client for repo: %s", chartRepo.RepoName))
 	}
 
-	chartRef := fmt.Sprintf("%s/%s", chartRepo.RepoName, chartRepoArgs.ChartName)
+	repoEntry := commonservice.GeneHelmRepo(chartRepo)
+	chartRef := helmclient.ChartRef(repoEntry, chartRepoArgs.ChartName)
 	localPath := config.LocalServicePath(projectName, chartRepoArgs.ChartName)
 	// remove local file to untar
 	_ = os.RemoveAll(localPath)
-	err = hClient.DownloadChart(commonservice.GeneHelmRepo(chartRepo), chartRef, chartRepoArgs.ChartVersion, localPath, true)
+	err = hClient.DownloadChart(repoEntry, chartRef, chartRepoArgs.ChartVersion, localPath, true)
 	if err != nil {
 		return nil, e.ErrCreateTemplate.AddErr(errors.Wrapf(err, "failed to download chart %s/%s-%s", chartRepo.RepoName, chartRepoArgs.ChartName, chartRepoArgs.ChartVersion))
 	}
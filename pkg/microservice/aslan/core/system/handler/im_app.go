@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/system/service"
+	internalhandler "github.com/koderover/zadig/pkg/shared/handler"
+	"github.com/koderover/zadig/pkg/tool/crypto"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+)
+
+func CreateIMApp(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	args := new(commonmodels.IMApp)
+	if err := c.ShouldBindJSON(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	internalhandler.InsertOperationLog(c, ctx.UserName, "", "新增", "系统配置-IM应用", fmt.Sprintf("name: %s, type: %s", args.Name, args.Type), "", ctx.Logger)
+
+	ctx.Err = service.CreateIMApp(args, ctx.Logger)
+}
+
+func UpdateIMApp(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	args := new(commonmodels.IMApp)
+	if err := c.ShouldBindJSON(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	internalhandler.InsertOperationLog(c, ctx.UserName, "", "更新", "系统配置-IM应用", fmt.Sprintf("name: %s, type: %s", args.Name, args.Type), "", ctx.Logger)
+
+	ctx.Err = service.UpdateIMApp(c.Param("id"), args, ctx.Logger)
+}
+
+func ListIMApp(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	encryptedKey := c.Query("encryptedKey")
+	if len(encryptedKey) == 0 {
+		ctx.Err = e.ErrInvalidParam
+		return
+	}
+
+	aesKey, err := commonservice.GetAesKeyFromEncryptedKey(encryptedKey, ctx.Logger)
+	if err != nil {
+		ctx.Err = err
+		return
+	}
+
+	apps, err := service.ListIMApp(ctx.Logger)
+	if err != nil {
+		ctx.Err = err
+		return
+	}
+	for _, app := range apps {
+		for _, secret := range []*string{&app.AppSecret, &app.VerificationToken, &app.EncryptKey, &app.SigningSecret} {
+			if *secret == "" {
+				continue
+			}
+			if *secret, err = crypto.AesEncryptByKey(*secret, aesKey.PlainText); err != nil {
+				ctx.Err = fmt.Errorf("failed to encrypt im app secret, err: %s", err)
+				return
+			}
+		}
+	}
+	ctx.Resp = apps
+}
+
+func DeleteIMApp(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	internalhandler.InsertOperationLog(c, ctx.UserName, "", "删除", "系统配置-IM应用", fmt.Sprintf("id:%s", c.Param("id")), "", ctx.Logger)
+	ctx.Err = service.DeleteIMApp(c.Param("id"), ctx.Logger)
+}
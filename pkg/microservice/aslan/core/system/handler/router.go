@@ -128,6 +128,8 @@ func (*Router) Inject(router *gin.RouterGroup) {
 	{
 		concurrency.GET("/workflow", GetWorkflowConcurrency)
 		concurrency.POST("/workflow", UpdateWorkflowConcurrency)
+		concurrency.GET("/workflow/quota", GetWorkflowQuota)
+		concurrency.PUT("/workflow/quota", UpdateWorkflowQuota)
 	}
 
 	// default login default login home page settings
@@ -245,6 +247,17 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		sonar.DELETE("/integration/:id", DeleteSonarIntegration)
 		sonar.POST("/validate", ValidateSonarInformation)
 	}
+
+	// ---------------------------------------------------------------------------------------
+	// im app API, the apps receive the callbacks of the approval cards
+	// ---------------------------------------------------------------------------------------
+	imApp := router.Group("im_app")
+	{
+		imApp.POST("", CreateIMApp)
+		imApp.PUT("/:id", UpdateIMApp)
+		imApp.GET("", ListIMApp)
+		imApp.DELETE("/:id", DeleteIMApp)
+	}
 }
 
 type OpenAPIRouter struct{}
@@ -18,12 +18,15 @@ package service
 
 import (
 	"errors"
+	"fmt"
 
 	"go.uber.org/zap"
 
 	configbase "github.com/koderover/zadig/pkg/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/workflowcontroller"
 	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
@@ -61,3 +64,38 @@ func UpdateWorkflowConcurrency(workflowConcurrency, buildConcurrency int64, log
 	}
 	return updater.ScaleDeployment(config.Namespace(), configbase.WarpDriveServiceName(), int(workflowConcurrency), kubeClient)
 }
+
+func GetWorkflowQuota() (*commonmodels.WorkflowQuota, error) {
+	configuration, err := commonrepo.NewSystemSettingColl().Get()
+	if err != nil {
+		return nil, err
+	}
+	if configuration.WorkflowQuota == nil {
+		return &commonmodels.WorkflowQuota{}, nil
+	}
+	return configuration.WorkflowQuota, nil
+}
+
+// UpdateWorkflowQuota only affects the waiting tasks, running tasks are not stopped.
+func UpdateWorkflowQuota(quota *commonmodels.WorkflowQuota, log *zap.SugaredLogger) error {
+	if quota.DefaultProjectConcurrency < 0 || quota.DefaultClusterConcurrency < 0 {
+		return e.ErrInvalidParam.AddDesc("concurrency cannot be negative")
+	}
+	for project, limit := range quota.ProjectConcurrency {
+		if limit < 0 {
+			return e.ErrInvalidParam.AddDesc(fmt.Sprintf("concurrency of project %s cannot be negative", project))
+		}
+	}
+	for clusterID, limit := range quota.ClusterConcurrency {
+		if limit < 0 {
+			return e.ErrInvalidParam.AddDesc(fmt.Sprintf("concurrency of cluster %s cannot be negative", clusterID))
+		}
+	}
+	if err := commonrepo.NewSystemSettingColl().UpdateWorkflowQuota(quota); err != nil {
+		log.Errorf("Failed to update workflow quota, the error is: %s", err)
+		return err
+	}
+	// a raised quota may start the waiting tasks.
+	workflowcontroller.NotifyScheduler()
+	return nil
+}
@@ -17,11 +17,14 @@ limitations under the License.
 package service
 
 import (
+	"fmt"
+
 	"go.uber.org/zap"
 
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
+	e "github.com/koderover/zadig/pkg/tool/errors"
 	"github.com/koderover/zadig/pkg/tool/helmclient"
 )
 
@@ -79,7 +82,11 @@ func ListCharts(name string, log *zap.SugaredLogger) (*IndexFileResp, error) {
 		return nil, err
 	}
 
-	indexInfo, err := client.FetchIndexYaml(service.GeneHelmRepo(chartRepo))
+	repoEntry := service.GeneHelmRepo(chartRepo)
+	if helmclient.IsOCIRepo(repoEntry) {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("charts in OCI registry %s can not be listed, please specify the chart name", chartRepo.RepoName))
+	}
+	indexInfo, err := client.FetchIndexYaml(repoEntry)
 	if err != nil {
 		return nil, err
 	}
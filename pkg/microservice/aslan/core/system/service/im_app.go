@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+)
+
+func CreateIMApp(args *commonmodels.IMApp, log *zap.SugaredLogger) error {
+	if err := validateIMApp(args); err != nil {
+		return err
+	}
+	if err := commonrepo.NewIMAppColl().Create(context.TODO(), args); err != nil {
+		log.Errorf("Create im app error: %s", err)
+		return err
+	}
+	return nil
+}
+
+func UpdateIMApp(id string, args *commonmodels.IMApp, log *zap.SugaredLogger) error {
+	if err := validateIMApp(args); err != nil {
+		return err
+	}
+	if err := commonrepo.NewIMAppColl().Update(context.TODO(), id, args); err != nil {
+		log.Errorf("Update im app error: %s", err)
+		return err
+	}
+	return nil
+}
+
+func ListIMApp(log *zap.SugaredLogger) ([]*commonmodels.IMApp, error) {
+	resp, err := commonrepo.NewIMAppColl().List(context.TODO())
+	if err != nil {
+		log.Errorf("Failed to list im apps from db, the error is: %s", err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func DeleteIMApp(id string, log *zap.SugaredLogger) error {
+	if err := commonrepo.NewIMAppColl().DeleteByID(context.TODO(), id); err != nil {
+		log.Errorf("Failed to delete im app of id: %s, the error is: %s", id, err)
+		return err
+	}
+	return nil
+}
+
+func validateIMApp(args *commonmodels.IMApp) error {
+	switch args.Type {
+	case commonmodels.IMAppTypeLark, commonmodels.IMAppTypeDingTalk:
+		if args.AppID == "" || args.AppSecret == "" {
+			return e.ErrInvalidParam.AddDesc("app id and app secret must be provided")
+		}
+		if args.Type == commonmodels.IMAppTypeLark && args.VerificationToken == "" {
+			return e.ErrInvalidParam.AddDesc("verification token must be provided")
+		}
+	case commonmodels.IMAppTypeSlack:
+		if args.SigningSecret == "" {
+			return e.ErrInvalidParam.AddDesc("signing secret must be provided")
+		}
+	default:
+		return e.ErrInvalidParam.AddDesc("type should be one of feishu, dingding and slack")
+	}
+	return nil
+}
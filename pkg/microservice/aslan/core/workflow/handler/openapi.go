@@ -64,3 +64,15 @@ func OpenAPICancelWorkflowTaskV4(c *gin.Context) {
 	}
 	ctx.Err = workflowservice.CancelWorkflowTaskV4(ctx.UserName, args.WorkflowName, args.TaskID, ctx.Logger)
 }
+
+func OpenAPIRetryWorkflowTaskV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	args := new(getworkflowTaskReq)
+	if err := c.BindJSON(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflowservice.RetryWorkflowTaskV4(ctx.UserName, args.WorkflowName, args.TaskID, ctx.Logger)
+}
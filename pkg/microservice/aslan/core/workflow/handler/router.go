@@ -185,6 +185,20 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		workflowV4.POST("/cron/:workflowName", CreateCronForWorkflowV4)
 		workflowV4.PUT("/cron", UpdateCronForWorkflowV4)
 		workflowV4.DELETE("/cron/:workflowName/trigger/:cronID", DeleteCronForWorkflowV4)
+		workflowV4.GET("/generalhook", ListGeneralHookForWorkflowV4)
+		workflowV4.POST("/generalhook/:workflowName", CreateGeneralHookForWorkflowV4)
+		workflowV4.PUT("/generalhook/:workflowName", UpdateGeneralHookForWorkflowV4)
+		workflowV4.DELETE("/generalhook/:workflowName/trigger/:hookName", DeleteGeneralHookForWorkflowV4)
+		workflowV4.POST("/generalhook/:workflowName/:hookName/webhook", ProcessGeneralHook)
+		workflowV4.GET("/upstreamhook", ListUpstreamHookForWorkflowV4)
+		workflowV4.POST("/upstreamhook/:workflowName", CreateUpstreamHookForWorkflowV4)
+		workflowV4.PUT("/upstreamhook/:workflowName", UpdateUpstreamHookForWorkflowV4)
+		workflowV4.DELETE("/upstreamhook/:workflowName/trigger/:hookName", DeleteUpstreamHookForWorkflowV4)
+		workflowV4.GET("/registryhook", ListRegistryHookForWorkflowV4)
+		workflowV4.POST("/registryhook/:workflowName", CreateRegistryHookForWorkflowV4)
+		workflowV4.PUT("/registryhook/:workflowName", UpdateRegistryHookForWorkflowV4)
+		workflowV4.DELETE("/registryhook/:workflowName/trigger/:hookName", DeleteRegistryHookForWorkflowV4)
+		workflowV4.POST("/registryhook/:workflowName/:hookName/webhook", ProcessRegistryHook)
 	}
 
 	// ---------------------------------------------------------------------------------------
@@ -196,8 +210,13 @@ func (*Router) Inject(router *gin.RouterGroup) {
 		taskV4.GET("", ListWorkflowTaskV4)
 		taskV4.GET("/workflow/:workflowName/task/:taskID", GetWorkflowTaskV4)
 		taskV4.DELETE("/workflow/:workflowName/task/:taskID", CancelWorkflowTaskV4)
+		taskV4.POST("/workflow/:workflowName/task/:taskID/retry", RetryWorkflowTaskV4)
 		taskV4.GET("/clone/workflow/:workflowName/task/:taskID", CloneWorkflowTaskV4)
 		taskV4.POST("/approve", ApproveStage)
+		taskV4.POST("/approve/callback/:appID", IMApproveCallback)
+		taskV4.GET("/approve/callback/:appID", IMApproveDingTalkCallback)
+		taskV4.GET("/approve/im/bind", GetIMUserBinding)
+		taskV4.POST("/approve/im/bind", BindIMUser)
 		taskV4.GET("/workflow/:workflowName/taskId/:taskId/job/:jobName", GetWorkflowV4ArtifactFileContent)
 	}
 
@@ -239,6 +258,7 @@ func (*OpenAPIRouter) Inject(router *gin.RouterGroup) {
 		custom.POST("/task", CreateCustomWorkflowTask)
 		custom.GET("/task", OpenAPIGetWorkflowTaskV4)
 		custom.DELETE("/task", OpenAPICancelWorkflowTaskV4)
+		custom.POST("/task/retry", OpenAPIRetryWorkflowTaskV4)
 		custom.POST("/task/approve", ApproveStage)
 	}
 }
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -69,6 +70,8 @@ func CreateWorkflowTaskV4(c *gin.Context) {
 		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
 		return
 	}
+	// the trigger chain is only set by the upstream hooks, a chain from the client may break the loop detection.
+	args.TriggerChain = nil
 	ctx.Resp, ctx.Err = workflow.CreateWorkflowTaskV4(ctx.UserName, args, ctx.Logger)
 }
 
@@ -114,6 +117,18 @@ func CancelWorkflowTaskV4(c *gin.Context) {
 	ctx.Err = workflow.CancelWorkflowTaskV4(ctx.UserName, c.Param("workflowName"), taskID, ctx.Logger)
 }
 
+func RetryWorkflowTaskV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	taskID, err := strconv.ParseInt(c.Param("taskID"), 10, 64)
+	if err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc("invalid task id")
+		return
+	}
+	ctx.Err = workflow.RetryWorkflowTaskV4(ctx.UserName, c.Param("workflowName"), taskID, ctx.Logger)
+}
+
 func CloneWorkflowTaskV4(c *gin.Context) {
 	ctx := internalhandler.NewContext(c)
 	defer func() { internalhandler.JSONResponse(c, ctx) }()
@@ -168,3 +183,57 @@ func GetWorkflowV4ArtifactFileContent(c *gin.Context) {
 
 	c.Data(200, "application/octet-stream", resp)
 }
+
+// IMApproveCallback receives the approval card callbacks of lark and slack.
+func IMApproveCallback(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	body, err := c.GetRawData()
+	if err != nil {
+		ctx.Err = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	ctx.Resp, ctx.Err = workflow.HandleIMApproveCallback(c.Param("appID"), c.Request.Header, body, ctx.Logger)
+}
+
+// IMApproveDingTalkCallback handles the approval links of dingtalk action cards.
+func IMApproveDingTalkCallback(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+
+	redirect, message, err := workflow.HandleDingTalkApproveCallback(c.Param("appID"), c.Request.URL.Query(), ctx.Logger)
+	if err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+	if redirect != "" {
+		c.Redirect(http.StatusFound, redirect)
+		return
+	}
+	c.String(http.StatusOK, message)
+}
+
+type bindIMUserReq struct {
+	Token   string `json:"token"`
+	Confirm bool   `json:"confirm"`
+}
+
+// GetIMUserBinding shows the IM user of the bind link before the user confirms the binding.
+func GetIMUserBinding(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Resp, ctx.Err = workflow.GetIMUserBindingPreview(c.Query("token"), ctx.Logger)
+}
+
+func BindIMUser(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	args := &bindIMUserReq{}
+	if err := c.ShouldBindJSON(args); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflow.BindIMUser(args.Token, args.Confirm, ctx.UserID, ctx.UserName, ctx.Logger)
+}
@@ -253,3 +253,143 @@ func DeleteCronForWorkflowV4(c *gin.Context) {
 
 	ctx.Err = workflow.DeleteCronForWorkflowV4(c.Param("workflowName"), c.Param("cronID"), ctx.Logger)
 }
+
+func ListGeneralHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Resp, ctx.Err = workflow.ListGeneralHookForWorkflowV4(c.Query("workflowName"), ctx.Logger)
+}
+
+func CreateGeneralHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.GeneralHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Resp, ctx.Err = workflow.CreateGeneralHookForWorkflowV4(c.Param("workflowName"), req, ctx.Logger)
+}
+
+func UpdateGeneralHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.GeneralHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflow.UpdateGeneralHookForWorkflowV4(c.Param("workflowName"), req, ctx.Logger)
+}
+
+func DeleteGeneralHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Err = workflow.DeleteGeneralHookForWorkflowV4(c.Param("workflowName"), c.Param("hookName"), ctx.Logger)
+}
+
+// ProcessGeneralHook receives the payloads of the general hooks and triggers the workflow.
+func ProcessGeneralHook(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	payload, err := c.GetRawData()
+	if err != nil {
+		ctx.Err = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	ctx.Resp, ctx.Err = workflow.TriggerWorkflowV4ByGeneralHook(c.Param("workflowName"), c.Param("hookName"), c.Request.Header, payload, ctx.Logger)
+}
+
+func ListUpstreamHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Resp, ctx.Err = workflow.ListUpstreamHookForWorkflowV4(c.Query("workflowName"), ctx.Logger)
+}
+
+func CreateUpstreamHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.UpstreamHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflow.CreateUpstreamHookForWorkflowV4(c.Param("workflowName"), ctx.UserID, req, ctx.Logger)
+}
+
+func UpdateUpstreamHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.UpstreamHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflow.UpdateUpstreamHookForWorkflowV4(c.Param("workflowName"), ctx.UserID, req, ctx.Logger)
+}
+
+func DeleteUpstreamHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Err = workflow.DeleteUpstreamHookForWorkflowV4(c.Param("workflowName"), c.Param("hookName"), ctx.Logger)
+}
+
+func ListRegistryHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Resp, ctx.Err = workflow.ListRegistryHookForWorkflowV4(c.Query("workflowName"), ctx.Logger)
+}
+
+func CreateRegistryHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.RegistryHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Resp, ctx.Err = workflow.CreateRegistryHookForWorkflowV4(c.Param("workflowName"), req, ctx.Logger)
+}
+
+func UpdateRegistryHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	req := new(commonmodels.RegistryHook)
+	if err := c.ShouldBindJSON(req); err != nil {
+		ctx.Err = e.ErrInvalidParam.AddDesc(err.Error())
+		return
+	}
+	ctx.Err = workflow.UpdateRegistryHookForWorkflowV4(c.Param("workflowName"), req, ctx.Logger)
+}
+
+func DeleteRegistryHookForWorkflowV4(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	ctx.Err = workflow.DeleteRegistryHookForWorkflowV4(c.Param("workflowName"), c.Param("hookName"), ctx.Logger)
+}
+
+// ProcessRegistryHook receives the push notifications of harbor and docker distribution and triggers the workflow.
+func ProcessRegistryHook(c *gin.Context) {
+	ctx := internalhandler.NewContext(c)
+	defer func() { internalhandler.JSONResponse(c, ctx) }()
+
+	payload, err := c.GetRawData()
+	if err != nil {
+		ctx.Err = e.ErrInvalidParam.AddErr(err)
+		return
+	}
+	ctx.Resp, ctx.Err = workflow.TriggerWorkflowV4ByRegistryHook(c.Param("workflowName"), c.Param("hookName"), c.Request.Header, payload, ctx.Logger)
+}
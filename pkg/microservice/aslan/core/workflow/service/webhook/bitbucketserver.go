@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/bitbucketserver"
+)
+
+func ProcessBitbucketServerHook(payload []byte, req *http.Request, requestID string, log *zap.SugaredLogger) error {
+	eventType := bitbucketserver.HookEventType(req)
+	// bitbucket server sends a ping when the webhook is tested
+	if eventType == bitbucketserver.EventTypePing {
+		return nil
+	}
+	if !validHookSignature(payload, req.Header.Get(bitbucketserver.SignatureHeader), "sha256=") {
+		return errors.New("signature is illegal")
+	}
+
+	event, err := bitbucketserver.ParseHook(eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	if ev, ok := event.(*bitbucketserver.RefsChangedEvent); ok && ev.Actor != nil {
+		webhookUser := &commonmodels.WebHookUser{
+			Domain:    req.Header.Get("X-Forwarded-Host"),
+			UserName:  ev.Actor.Name,
+			Email:     ev.Actor.EmailAddress,
+			Source:    setting.SourceFromBitbucketServer,
+			CreatedAt: time.Now().Unix(),
+		}
+		commonrepo.NewWebHookUserColl().Upsert(webhookUser)
+	}
+	return TriggerWorkflowV4ByBitbucketServerEvent(event, config.SystemAddress(), requestID, log)
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+	"github.com/koderover/zadig/pkg/tool/bitbucketserver"
+	"github.com/koderover/zadig/pkg/types"
+)
+
+type bitbucketServerDiffFunc func(projectKey, repo string, codehostID int, diff func(*bitbucketserver.Client) ([]*bitbucketserver.Change, error)) ([]string, error)
+
+type bitbucketServerEventMatcherForWorkflowV4 interface {
+	Match(*commonmodels.MainHookRepo) (bool, error)
+	GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository
+}
+
+func bitbucketServerRepoPath(repo *bitbucketserver.Repository) string {
+	if repo == nil || repo.Project == nil {
+		return ""
+	}
+	return repo.Project.Key + "/" + repo.Slug
+}
+
+type bitbucketServerPushEventMatcherForWorkflowV4 struct {
+	diffFunc     bitbucketServerDiffFunc
+	log          *zap.SugaredLogger
+	event        *bitbucketserver.RefsChangedEvent
+	change       *bitbucketserver.RefChange
+	changedFiles []string
+}
+
+func (bpem *bitbucketServerPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := bpem.event
+	if hookRepo.Source != setting.SourceFromBitbucketServer || !checkRepoNamespaceMatch(hookRepo, bitbucketServerRepoPath(ev.Repository)) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPush) {
+		return false, nil
+	}
+
+	branch := getBranchFromRef(bpem.change.RefID)
+	if !matchHookBranch(hookRepo, branch) {
+		return false, nil
+	}
+	hookRepo.Branch = branch
+	if ev.Actor != nil {
+		hookRepo.Committer = ev.Actor.Name
+	}
+
+	since := bpem.change.FromHash
+	// the branch is newly created, only the changes of the head commit are taken
+	if bpem.change.Type == bitbucketserver.RefChangeTypeAdd {
+		since = ""
+	}
+	changedFiles, err := bpem.diffFunc(ev.Repository.Project.Key, ev.Repository.Slug, hookRepo.CodehostID, func(cli *bitbucketserver.Client) ([]*bitbucketserver.Change, error) {
+		return cli.ListChanges(ev.Repository.Project.Key, ev.Repository.Slug, bpem.change.ToHash, since)
+	})
+	if err != nil {
+		bpem.log.Warnf("failed to get changes of event %v", ev)
+		return false, err
+	}
+	bpem.changedFiles = changedFiles
+	return MatchChanges(hookRepo, changedFiles), nil
+}
+
+func (bpem *bitbucketServerPushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		RepoOwner:     hookRepo.RepoOwner,
+		Branch:        hookRepo.Branch,
+		CommitID:      bpem.change.ToHash,
+		Source:        hookRepo.Source,
+	}
+}
+
+func (bpem *bitbucketServerPushEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return bpem.changedFiles
+}
+
+type bitbucketServerMergeEventMatcherForWorkflowV4 struct {
+	diffFunc     bitbucketServerDiffFunc
+	log          *zap.SugaredLogger
+	event        *bitbucketserver.PullRequestEvent
+	changedFiles []string
+}
+
+func (bmem *bitbucketServerMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	pr := bmem.event.PullRequest
+	if hookRepo.Source != setting.SourceFromBitbucketServer || pr.ToRef == nil || !checkRepoNamespaceMatch(hookRepo, bitbucketServerRepoPath(pr.ToRef.Repository)) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPr) {
+		return false, nil
+	}
+	if !matchHookBranch(hookRepo, pr.ToRef.DisplayID) {
+		return false, nil
+	}
+	hookRepo.Branch = pr.ToRef.DisplayID
+	if pr.Author.User != nil {
+		hookRepo.Committer = pr.Author.User.Name
+	}
+
+	repo := pr.ToRef.Repository
+	changedFiles, err := bmem.diffFunc(repo.Project.Key, repo.Slug, hookRepo.CodehostID, func(cli *bitbucketserver.Client) ([]*bitbucketserver.Change, error) {
+		return cli.ListPullRequestChanges(repo.Project.Key, repo.Slug, pr.ID)
+	})
+	if err != nil {
+		bmem.log.Warnf("failed to get changes of event %v", bmem.event)
+		return false, err
+	}
+	bmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
+	bmem.changedFiles = changedFiles
+	return MatchChanges(hookRepo, changedFiles), nil
+}
+
+func (bmem *bitbucketServerMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoOwner:     hookRepo.RepoOwner,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		Branch:        hookRepo.Branch,
+		PR:            bmem.event.PullRequest.ID,
+		CommitID:      bmem.event.PullRequest.FromRef.LatestCommit,
+		Source:        hookRepo.Source,
+	}
+}
+
+func (bmem *bitbucketServerMergeEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return bmem.changedFiles
+}
+
+type bitbucketServerTagEventMatcherForWorkflowV4 struct {
+	log    *zap.SugaredLogger
+	event  *bitbucketserver.RefsChangedEvent
+	change *bitbucketserver.RefChange
+}
+
+// Match matches the tag event, bitbucket server does not tell the default branch in the event,
+// so the branch of the hook is not checked.
+func (btem *bitbucketServerTagEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := btem.event
+	if hookRepo.Source != setting.SourceFromBitbucketServer || !checkRepoNamespaceMatch(hookRepo, bitbucketServerRepoPath(ev.Repository)) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventTag) {
+		return false, nil
+	}
+	hookRepo.Tag = getTagFromRef(btem.change.RefID)
+	if ev.Actor != nil {
+		hookRepo.Committer = ev.Actor.Name
+	}
+	return true, nil
+}
+
+func (btem *bitbucketServerTagEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoOwner:     hookRepo.RepoOwner,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		Branch:        hookRepo.Branch,
+		Tag:           hookRepo.Tag,
+		Source:        hookRepo.Source,
+	}
+}
+
+// createBitbucketServerEventMatchersForWorkflowV4 creates one matcher for each ref change of the event,
+// since a single push of bitbucket server may update several branches and tags.
+func createBitbucketServerEventMatchersForWorkflowV4(event interface{}, diffSrv bitbucketServerDiffFunc, log *zap.SugaredLogger) []bitbucketServerEventMatcherForWorkflowV4 {
+	resp := []bitbucketServerEventMatcherForWorkflowV4{}
+	switch evt := event.(type) {
+	case *bitbucketserver.RefsChangedEvent:
+		for _, change := range evt.Changes {
+			if change.Type == bitbucketserver.RefChangeTypeDelete {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(change.RefID, "refs/tags/"):
+				resp = append(resp, &bitbucketServerTagEventMatcherForWorkflowV4{log: log, event: evt, change: change})
+			case strings.HasPrefix(change.RefID, "refs/heads/"):
+				resp = append(resp, &bitbucketServerPushEventMatcherForWorkflowV4{diffFunc: diffSrv, log: log, event: evt, change: change})
+			}
+		}
+	case *bitbucketserver.PullRequestEvent:
+		if evt.PullRequest != nil {
+			resp = append(resp, &bitbucketServerMergeEventMatcherForWorkflowV4{diffFunc: diffSrv, log: log, event: evt})
+		}
+	}
+	return resp
+}
+
+func TriggerWorkflowV4ByBitbucketServerEvent(event interface{}, baseURI, requestID string, log *zap.SugaredLogger) error {
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{}, 0, 0)
+	if err != nil {
+		errMsg := fmt.Sprintf("list workflow v4 error: %v", err)
+		log.Error(errMsg)
+		return fmt.Errorf(errMsg)
+	}
+
+	mErr := &multierror.Error{}
+	for _, matcher := range createBitbucketServerEventMatchersForWorkflowV4(event, findChangedFilesOfBitbucketServer, log) {
+		for _, workflow := range workflows {
+			for _, item := range workflow.HookCtls {
+				if !item.Enabled {
+					continue
+				}
+				matches, err := matcher.Match(item.MainRepo)
+				if err != nil {
+					mErr = multierror.Append(mErr, err)
+				}
+				if !matches {
+					continue
+				}
+
+				log.Infof("event match hook %v of %s", item.MainRepo, workflow.Name)
+				eventRepo := matcher.GetHookRepo(item.MainRepo)
+				var hookPayload *commonmodels.HookPayload
+				if ev, isPr := event.(*bitbucketserver.PullRequestEvent); isPr {
+					mergeRequestID := strconv.Itoa(ev.PullRequest.ID)
+					autoCancelOpt := &AutoCancelOpt{
+						MergeRequestID: mergeRequestID,
+						CommitID:       eventRepo.CommitID,
+						TaskType:       config.WorkflowType,
+						MainRepo:       item.MainRepo,
+						AutoCancel:     item.AutoCancel,
+						WorkflowName:   workflow.Name,
+					}
+					if err := AutoCancelWorkflowV4Task(autoCancelOpt, log); err != nil {
+						log.Errorf("failed to auto cancel workflowV4 task when receive event %v due to %v ", event, err)
+						mErr = multierror.Append(mErr, err)
+					}
+
+					hookPayload = &commonmodels.HookPayload{
+						Owner:          eventRepo.RepoOwner,
+						Repo:           eventRepo.RepoName,
+						Branch:         eventRepo.Branch,
+						IsPr:           true,
+						CodehostID:     item.MainRepo.CodehostID,
+						MergeRequestID: mergeRequestID,
+						CommitID:       eventRepo.CommitID,
+					}
+				}
+				if err := job.MergeArgs(workflow, item.WorkflowArg); err != nil {
+					errMsg := fmt.Sprintf("merge workflow args error: %v", err)
+					log.Error(errMsg)
+					mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+					continue
+				}
+				if err := job.MergeWebhookRepo(workflow, eventRepo); err != nil {
+					errMsg := fmt.Sprintf("merge webhook repo info to workflowargs error: %v", err)
+					log.Error(errMsg)
+					mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+					continue
+				}
+				workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
+				if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
+					errMsg := fmt.Sprintf("failed to create workflow task when receive bitbucket server event due to %v ", err)
+					log.Error(errMsg)
+					mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+				} else {
+					log.Infof("succeed to create task %v", resp)
+				}
+			}
+		}
+	}
+	return mErr.ErrorOrNil()
+}
+
+func findChangedFilesOfBitbucketServer(projectKey, repo string, codehostID int, diff func(*bitbucketserver.Client) ([]*bitbucketserver.Change, error)) ([]string, error) {
+	detail, err := systemconfig.New().GetCodeHost(codehostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find codehost %d: %v", codehostID, err)
+	}
+
+	changes, err := diff(bitbucketserver.NewClient(detail.Address, detail.AccessToken, config.ProxyHTTPSAddr(), detail.EnableProxy))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes of %s/%s from bitbucket server, err: %v", projectKey, repo, err)
+	}
+
+	changedFiles := make([]string, 0, len(changes))
+	for _, change := range changes {
+		changedFiles = append(changedFiles, change.Path.ToString)
+	}
+	return changedFiles, nil
+}
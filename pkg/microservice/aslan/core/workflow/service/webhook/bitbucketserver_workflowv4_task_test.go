@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/bitbucketserver"
+)
+
+var _ = Describe("Testing bitbucket server event matchers", func() {
+	repo := &bitbucketserver.Repository{Slug: "demo", Project: &bitbucketserver.Project{Key: "PRJ"}}
+	event := &bitbucketserver.RefsChangedEvent{
+		Repository: repo,
+		Changes: []*bitbucketserver.RefChange{
+			{RefID: "refs/heads/main", FromHash: "a", ToHash: "b", Type: bitbucketserver.RefChangeTypeUpdate},
+			{RefID: "refs/heads/feature", ToHash: "c", Type: bitbucketserver.RefChangeTypeDelete},
+			{RefID: "refs/tags/v1.0.0", ToHash: "d", Type: bitbucketserver.RefChangeTypeAdd},
+		},
+	}
+	diff := func(projectKey, repo string, codehostID int, diff func(*bitbucketserver.Client) ([]*bitbucketserver.Change, error)) ([]string, error) {
+		return []string{"src/main.go"}, nil
+	}
+	newHookRepo := func(events ...config.HookEventType) *commonmodels.MainHookRepo {
+		return &commonmodels.MainHookRepo{
+			Source:       setting.SourceFromBitbucketServer,
+			RepoOwner:    "PRJ",
+			RepoName:     "demo",
+			Branch:       "main",
+			MatchFolders: []string{"src"},
+			Events:       events,
+		}
+	}
+
+	It("creates a matcher for each branch and tag which is not deleted", func() {
+		matchers := createBitbucketServerEventMatchersForWorkflowV4(event, diff, zap.NewNop().Sugar())
+		Expect(matchers).To(HaveLen(2))
+		Expect(matchers[0]).To(BeAssignableToTypeOf(&bitbucketServerPushEventMatcherForWorkflowV4{}))
+		Expect(matchers[1]).To(BeAssignableToTypeOf(&bitbucketServerTagEventMatcherForWorkflowV4{}))
+	})
+
+	It("matches the push to the configured branch", func() {
+		matchers := createBitbucketServerEventMatchersForWorkflowV4(event, diff, zap.NewNop().Sugar())
+		hookRepo := newHookRepo(config.HookEventPush)
+		matched, err := matchers[0].Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeTrue())
+		Expect(matchers[0].GetHookRepo(hookRepo).CommitID).To(Equal("b"))
+
+		matched, err = matchers[1].Match(newHookRepo(config.HookEventPush))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeFalse())
+	})
+
+	It("does not match the repository of another project", func() {
+		matchers := createBitbucketServerEventMatchersForWorkflowV4(event, diff, zap.NewNop().Sugar())
+		hookRepo := newHookRepo(config.HookEventPush, config.HookEventTag)
+		hookRepo.RepoOwner = "OTHER"
+		for _, matcher := range matchers {
+			matched, err := matcher.Match(hookRepo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matched).To(BeFalse())
+		}
+	})
+})
@@ -78,6 +78,11 @@ func ProcessCodehubHook(payload []byte, req *http.Request, requestID string, log
 		errorList = multierror.Append(errorList, err)
 	}
 
+	//自定义工作流webhook
+	if err = TriggerWorkflowV4ByCodehubEvent(event, baseURI, requestID, log); err != nil {
+		errorList = multierror.Append(errorList, err)
+	}
+
 	return errorList.ErrorOrNil()
 }
 
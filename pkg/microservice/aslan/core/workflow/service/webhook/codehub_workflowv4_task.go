@@ -0,0 +1,218 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/codehub"
+	"github.com/koderover/zadig/pkg/types"
+)
+
+type codehubEventMatcherForWorkflowV4 interface {
+	Match(*commonmodels.MainHookRepo) (bool, error)
+	GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository
+}
+
+type codehubPushEventMatcherForWorkflowV4 struct {
+	log          *zap.SugaredLogger
+	event        *codehub.PushEvent
+	changedFiles []string
+}
+
+func (cpem *codehubPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := cpem.event
+	if hookRepo.Source != setting.SourceFromCodeHub || !checkRepoNamespaceMatch(hookRepo, ev.Project.PathWithNamespace) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPush) {
+		return false, nil
+	}
+
+	branch := getBranchFromRef(ev.Ref)
+	if !matchHookBranch(hookRepo, branch) {
+		return false, nil
+	}
+	hookRepo.Branch = branch
+	hookRepo.Committer = ev.UserUsername
+	var changedFiles []string
+	for _, commit := range ev.Commits {
+		changedFiles = append(changedFiles, commit.Added...)
+		changedFiles = append(changedFiles, commit.Removed...)
+		changedFiles = append(changedFiles, commit.Modified...)
+	}
+	cpem.changedFiles = changedFiles
+	return MatchChanges(hookRepo, changedFiles), nil
+}
+
+func (cpem *codehubPushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		RepoOwner:     hookRepo.RepoOwner,
+		Branch:        hookRepo.Branch,
+		CommitID:      cpem.event.After,
+		Source:        hookRepo.Source,
+	}
+}
+
+func (cpem *codehubPushEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return cpem.changedFiles
+}
+
+// codehubMergeEventMatcherForWorkflowV4 matches the opened merge requests, codehub doesn't provide the changed files
+// of the merge request, so the file filters of the hook are not applied.
+type codehubMergeEventMatcherForWorkflowV4 struct {
+	log   *zap.SugaredLogger
+	event *codehub.MergeEvent
+}
+
+func (cmem *codehubMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := cmem.event
+	if hookRepo.Source != setting.SourceFromCodeHub || !checkRepoNamespaceMatch(hookRepo, ev.ObjectAttributes.Target.PathWithNamespace) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPr) || ev.ObjectAttributes.State != "opened" {
+		return false, nil
+	}
+	if !matchHookBranch(hookRepo, ev.ObjectAttributes.TargetBranch) {
+		return false, nil
+	}
+	hookRepo.Branch = ev.ObjectAttributes.TargetBranch
+	hookRepo.Committer = ev.User.Username
+	return true, nil
+}
+
+func (cmem *codehubMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoOwner:     hookRepo.RepoOwner,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		Branch:        hookRepo.Branch,
+		PR:            cmem.event.ObjectAttributes.IID,
+		CommitID:      cmem.event.ObjectAttributes.LastCommit.ID,
+		Source:        hookRepo.Source,
+	}
+}
+
+func createCodehubEventMatcherForWorkflowV4(event interface{}, log *zap.SugaredLogger) codehubEventMatcherForWorkflowV4 {
+	switch evt := event.(type) {
+	case *codehub.PushEvent:
+		return &codehubPushEventMatcherForWorkflowV4{
+			log:   log,
+			event: evt,
+		}
+	case *codehub.MergeEvent:
+		return &codehubMergeEventMatcherForWorkflowV4{
+			log:   log,
+			event: evt,
+		}
+	}
+	return nil
+}
+
+func TriggerWorkflowV4ByCodehubEvent(event interface{}, baseURI, requestID string, log *zap.SugaredLogger) error {
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{}, 0, 0)
+	if err != nil {
+		errMsg := fmt.Sprintf("list workflow v4 error: %v", err)
+		log.Error(errMsg)
+		return fmt.Errorf(errMsg)
+	}
+
+	mErr := &multierror.Error{}
+	matcher := createCodehubEventMatcherForWorkflowV4(event, log)
+	if matcher == nil {
+		return fmt.Errorf("unsupported codehub event %T", event)
+	}
+
+	for _, workflow := range workflows {
+		for _, item := range workflow.HookCtls {
+			if !item.Enabled {
+				continue
+			}
+			matches, err := matcher.Match(item.MainRepo)
+			if err != nil {
+				mErr = multierror.Append(mErr, err)
+			}
+			if !matches {
+				continue
+			}
+
+			log.Infof("event match hook %v of %s", item.MainRepo, workflow.Name)
+			eventRepo := matcher.GetHookRepo(item.MainRepo)
+			var hookPayload *commonmodels.HookPayload
+			if ev, isPr := event.(*codehub.MergeEvent); isPr {
+				mergeRequestID := strconv.Itoa(ev.ObjectAttributes.IID)
+				autoCancelOpt := &AutoCancelOpt{
+					MergeRequestID: mergeRequestID,
+					CommitID:       ev.ObjectAttributes.LastCommit.ID,
+					TaskType:       config.WorkflowType,
+					MainRepo:       item.MainRepo,
+					AutoCancel:     item.AutoCancel,
+					WorkflowName:   workflow.Name,
+				}
+				if err := AutoCancelWorkflowV4Task(autoCancelOpt, log); err != nil {
+					log.Errorf("failed to auto cancel workflowV4 task when receive event %v due to %v ", event, err)
+					mErr = multierror.Append(mErr, err)
+				}
+
+				hookPayload = &commonmodels.HookPayload{
+					Owner:          eventRepo.RepoOwner,
+					Repo:           eventRepo.RepoName,
+					Branch:         eventRepo.Branch,
+					IsPr:           true,
+					CodehostID:     item.MainRepo.CodehostID,
+					MergeRequestID: mergeRequestID,
+					CommitID:       ev.ObjectAttributes.LastCommit.ID,
+				}
+			}
+			if err := job.MergeArgs(workflow, item.WorkflowArg); err != nil {
+				errMsg := fmt.Sprintf("merge workflow args error: %v", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+				continue
+			}
+			if err := job.MergeWebhookRepo(workflow, eventRepo); err != nil {
+				errMsg := fmt.Sprintf("merge webhook repo info to workflowargs error: %v", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+				continue
+			}
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
+			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
+				errMsg := fmt.Sprintf("failed to create workflow task when receive codehub event due to %v ", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+			} else {
+				log.Infof("succeed to create task %v", resp)
+			}
+		}
+	}
+	return mErr.ErrorOrNil()
+}
@@ -0,0 +1,427 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/hashicorp/go-multierror"
+	"github.com/xanzy/go-gitlab"
+	"go.uber.org/zap"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	git "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/github"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/scmnotify"
+	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/policy"
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+	"github.com/koderover/zadig/pkg/shared/client/user"
+	"github.com/koderover/zadig/pkg/types"
+)
+
+const (
+	commentCommandPrefix = "/zadig"
+
+	commentCommandRun    = "run"
+	commentCommandRetry  = "retry"
+	commentCommandCancel = "cancel"
+
+	// recentPullRequestTasks is the number of latest tasks of a workflow looked up for the tasks of the pull request
+	recentPullRequestTasks = 50
+)
+
+// commentCommand is a command commented on a pull request, e.g. `/zadig run <workflow>`,
+// the workflow is optional for retry and cancel, which apply to every workflow of the pull request then.
+type commentCommand struct {
+	Action   string
+	Workflow string
+}
+
+// pullRequestComment is a comment on a pull request, which is parsed from the comment events of code hosts.
+type pullRequestComment struct {
+	Source    string
+	RepoPath  string
+	PRID      int
+	Commenter string
+	Body      string
+	// PRRefs returns the target branch and the head commit of the pull request.
+	PRRefs func(mainRepo *commonmodels.MainHookRepo) (string, string, error)
+}
+
+// parseCommentCommand returns the first command in the comment, or nil if there is none.
+func parseCommentCommand(body string) *commentCommand {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != commentCommandPrefix {
+			continue
+		}
+		cmd := &commentCommand{Action: strings.ToLower(fields[1])}
+		if len(fields) > 2 {
+			cmd.Workflow = fields[2]
+		}
+		switch cmd.Action {
+		case commentCommandRun:
+			if cmd.Workflow == "" {
+				continue
+			}
+		case commentCommandRetry, commentCommandCancel:
+		default:
+			continue
+		}
+		return cmd
+	}
+	return nil
+}
+
+func workflowV4TaskURL(projectName, workflowName string, taskID int64) string {
+	return fmt.Sprintf("%s/v1/projects/detail/%s/pipelines/custom/%s/%d", configbase.SystemAddress(), projectName, workflowName, taskID)
+}
+
+// ProcessPullRequestComment runs the command in the comment against the workflows whose webhook watches the
+// repository of the pull request, and replies the results to the pull request.
+func ProcessPullRequestComment(comment *pullRequestComment, log *zap.SugaredLogger) error {
+	cmd := parseCommentCommand(comment.Body)
+	if cmd == nil {
+		return nil
+	}
+
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{}, 0, 0)
+	if err != nil {
+		log.Errorf("list workflow v4 error: %v", err)
+		return err
+	}
+
+	type commandTarget struct {
+		workflow *commonmodels.WorkflowV4
+		mainRepo *commonmodels.MainHookRepo
+	}
+	var replyRepo *commonmodels.MainHookRepo
+	targets := []*commandTarget{}
+	for _, workflow := range workflows {
+		for _, item := range workflow.HookCtls {
+			if !item.Enabled || item.MainRepo == nil || item.MainRepo.Source != comment.Source || !checkRepoNamespaceMatch(item.MainRepo, comment.RepoPath) {
+				continue
+			}
+			replyRepo = item.MainRepo
+			if cmd.Workflow == "" || cmd.Workflow == workflow.Name || cmd.Workflow == workflow.DisplayName {
+				targets = append(targets, &commandTarget{workflow: workflow, mainRepo: item.MainRepo})
+				break
+			}
+		}
+	}
+	// the repository is not watched by any workflow, there is nowhere to reply
+	if replyRepo == nil {
+		return nil
+	}
+
+	reply := func(lines []string) error {
+		body := fmt.Sprintf("@%s\n%s", comment.Commenter, strings.Join(lines, "\n"))
+		if err := scmnotify.NewService().ReplyPullRequestComment(replyRepo, comment.PRID, body); err != nil {
+			log.Errorf("failed to reply the comment of pr %d of %s: %v", comment.PRID, comment.RepoPath, err)
+			return err
+		}
+		return nil
+	}
+	if len(targets) == 0 {
+		return reply([]string{fmt.Sprintf("- no workflow named %s is triggered by this repository", cmd.Workflow)})
+	}
+
+	zadigUser, err := findBoundUser(replyRepo.CodehostID, comment.Commenter)
+	if err != nil {
+		log.Errorf("failed to find user %s: %v", comment.Commenter, err)
+		return reply([]string{fmt.Sprintf("- %s is not a user of zadig logged in with this code host, the command is ignored", comment.Commenter)})
+	}
+
+	mErr := &multierror.Error{}
+	lines := []string{}
+	for _, target := range targets {
+		workflow, mainRepo := target.workflow, target.mainRepo
+		if !canRunWorkflow(zadigUser.UID, workflow, log) {
+			lines = append(lines, fmt.Sprintf("- %s: permission denied", workflow.Name))
+			continue
+		}
+		var line string
+		switch cmd.Action {
+		case commentCommandRun:
+			line, err = runWorkflowByComment(workflow, mainRepo, comment, zadigUser.Name, log)
+		case commentCommandRetry:
+			line, err = retryWorkflowByComment(workflow, mainRepo, comment, zadigUser.Name, log)
+		case commentCommandCancel:
+			line, err = cancelWorkflowByComment(workflow, mainRepo, comment, zadigUser.Name, log)
+		}
+		if err != nil {
+			mErr = multierror.Append(mErr, err)
+			line = fmt.Sprintf("- %s: failed to %s, error: %v", workflow.Name, cmd.Action, err)
+		}
+		lines = append(lines, line)
+	}
+	if err := reply(lines); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	return mErr.ErrorOrNil()
+}
+
+// findBoundUser returns the zadig user who logs in with the account through a connector of the code host. Only the
+// accounts of these users are verified by the code host, accounts of other users can be taken by anyone on it.
+func findBoundUser(codehostID int, account string) (*user.User, error) {
+	ch, err := systemconfig.New().GetCodeHost(codehostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find codehost %d: %v", codehostID, err)
+	}
+	connectors, err := systemconfig.New().ListConnectorsInternal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connectors: %v", err)
+	}
+	for _, connector := range connectors {
+		if !connectorOfCodeHost(connector, ch) {
+			continue
+		}
+		resp, err := user.New().SearchUser(&user.SearchUserArgs{Account: account, IdentityType: connector.ID})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range resp.Users {
+			if u.Account == account && u.IdentityType == connector.ID {
+				return u, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("user with account %s of codehost %d not found", account, codehostID)
+}
+
+// connectorOfCodeHost tells whether the users of the connector log in through the code host.
+func connectorOfCodeHost(connector *systemconfig.Connector, ch *systemconfig.CodeHost) bool {
+	if !strings.EqualFold(connector.Type, ch.Type) {
+		return false
+	}
+	var hostKey, defaultHost string
+	switch strings.ToLower(ch.Type) {
+	case setting.SourceFromGithub:
+		hostKey, defaultHost = "hostName", "github.com"
+	case setting.SourceFromGitlab:
+		hostKey, defaultHost = "baseURL", "gitlab.com"
+	default:
+		return false
+	}
+	connectorHost := defaultHost
+	if cfg, ok := connector.Config.(map[string]interface{}); ok {
+		if host, ok := cfg[hostKey].(string); ok && host != "" {
+			connectorHost = host
+		}
+	}
+	return urlHost(connectorHost, defaultHost) == urlHost(ch.Address, defaultHost)
+}
+
+// urlHost returns the host of the address, which may be a bare host name.
+func urlHost(address, defaultHost string) string {
+	if address == "" {
+		return defaultHost
+	}
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return address
+	}
+	return strings.ToLower(u.Host)
+}
+
+func canRunWorkflow(uid string, workflow *commonmodels.WorkflowV4, log *zap.SugaredLogger) bool {
+	permissions, err := policy.NewDefault().GetResourcePermission(&policy.ResourcePermissionReq{
+		ProjectName:  workflow.Project,
+		Uid:          uid,
+		Resources:    []string{workflow.Name},
+		ResourceType: "Workflow",
+	})
+	if err != nil {
+		log.Errorf("failed to get the permission of user %s on workflow %s: %v", uid, workflow.Name, err)
+		return false
+	}
+	for _, verb := range permissions[workflow.Name] {
+		if verb == "*" || verb == "run_workflow" {
+			return true
+		}
+	}
+	return false
+}
+
+func runWorkflowByComment(workflow *commonmodels.WorkflowV4, mainRepo *commonmodels.MainHookRepo, comment *pullRequestComment, userName string, log *zap.SugaredLogger) (string, error) {
+	branch, commitID, err := comment.PRRefs(mainRepo)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the pull request: %v", err)
+	}
+	eventRepo := &types.Repository{
+		CodehostID:    mainRepo.CodehostID,
+		RepoName:      mainRepo.RepoName,
+		RepoOwner:     mainRepo.RepoOwner,
+		RepoNamespace: mainRepo.GetRepoNamespace(),
+		Branch:        branch,
+		PR:            comment.PRID,
+		CommitID:      commitID,
+		Source:        mainRepo.Source,
+	}
+	for _, item := range workflow.HookCtls {
+		if item.MainRepo == mainRepo {
+			if err := job.MergeArgs(workflow, item.WorkflowArg); err != nil {
+				return "", fmt.Errorf("merge workflow args error: %v", err)
+			}
+			break
+		}
+	}
+	if err := job.MergeWebhookRepo(workflow, eventRepo); err != nil {
+		return "", fmt.Errorf("merge webhook repo info to workflowargs error: %v", err)
+	}
+	workflow.HookPayload = workflowV4HookPayload(&commonmodels.HookPayload{
+		Owner:          eventRepo.RepoOwner,
+		Repo:           eventRepo.RepoName,
+		Branch:         eventRepo.Branch,
+		IsPr:           true,
+		CodehostID:     mainRepo.CodehostID,
+		MergeRequestID: strconv.Itoa(comment.PRID),
+		CommitID:       commitID,
+	}, eventRepo, nil)
+	resp, err := workflowservice.CreateWorkflowTaskV4(userName, workflow, log)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("- %s: task [#%d](%s) created", workflow.Name, resp.TaskID, workflowV4TaskURL(workflow.Project, workflow.Name, resp.TaskID)), nil
+}
+
+// pullRequestTasks returns the recent tasks of the workflow created for the pull request, the latest goes first.
+func pullRequestTasks(workflow *commonmodels.WorkflowV4, mainRepo *commonmodels.MainHookRepo, prID int) ([]*commonmodels.WorkflowTask, error) {
+	tasks, _, err := commonrepo.NewworkflowTaskv4Coll().List(&commonrepo.ListWorkflowTaskV4Option{WorkflowName: workflow.Name, Limit: recentPullRequestTasks})
+	if err != nil {
+		return nil, err
+	}
+	resp := []*commonmodels.WorkflowTask{}
+	for _, task := range tasks {
+		if task.WorkflowArgs == nil || task.WorkflowArgs.HookPayload == nil {
+			continue
+		}
+		payload := task.WorkflowArgs.HookPayload
+		if payload.CodehostID != mainRepo.CodehostID || payload.Owner != mainRepo.RepoOwner ||
+			payload.Repo != mainRepo.RepoName || payload.MergeRequestID != strconv.Itoa(prID) {
+			continue
+		}
+		resp = append(resp, task)
+	}
+	return resp, nil
+}
+
+func retryWorkflowByComment(workflow *commonmodels.WorkflowV4, mainRepo *commonmodels.MainHookRepo, comment *pullRequestComment, userName string, log *zap.SugaredLogger) (string, error) {
+	tasks, err := pullRequestTasks(workflow, mainRepo, comment.PRID)
+	if err != nil {
+		return "", err
+	}
+	if len(tasks) == 0 {
+		return fmt.Sprintf("- %s: no task of this pull request to retry", workflow.Name), nil
+	}
+	task := tasks[0]
+	switch task.Status {
+	case config.StatusFailed, config.StatusTimeout, config.StatusCancelled:
+	default:
+		return fmt.Sprintf("- %s: the latest task [#%d](%s) is %s, only failed tasks can be retried", workflow.Name, task.TaskID, workflowV4TaskURL(task.ProjectName, task.WorkflowName, task.TaskID), task.Status), nil
+	}
+	if err := workflowservice.RetryWorkflowTaskV4(userName, task.WorkflowName, task.TaskID, log); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("- %s: task [#%d](%s) retried", workflow.Name, task.TaskID, workflowV4TaskURL(task.ProjectName, task.WorkflowName, task.TaskID)), nil
+}
+
+func cancelWorkflowByComment(workflow *commonmodels.WorkflowV4, mainRepo *commonmodels.MainHookRepo, comment *pullRequestComment, userName string, log *zap.SugaredLogger) (string, error) {
+	tasks, err := pullRequestTasks(workflow, mainRepo, comment.PRID)
+	if err != nil {
+		return "", err
+	}
+	cancelled := []string{}
+	for _, task := range tasks {
+		switch task.Status {
+		case config.StatusWaiting, config.StatusQueued, config.StatusCreated, config.StatusRunning, config.StatusBlocked, config.StatusWaitingApprove:
+		default:
+			continue
+		}
+		if err := workflowservice.CancelWorkflowTaskV4(userName, task.WorkflowName, task.TaskID, log); err != nil {
+			return "", err
+		}
+		cancelled = append(cancelled, fmt.Sprintf("[#%d](%s)", task.TaskID, workflowV4TaskURL(task.ProjectName, task.WorkflowName, task.TaskID)))
+	}
+	if len(cancelled) == 0 {
+		return fmt.Sprintf("- %s: no running task of this pull request to cancel", workflow.Name), nil
+	}
+	return fmt.Sprintf("- %s: task %s cancelled", workflow.Name, strings.Join(cancelled, ", ")), nil
+}
+
+func githubPullRequestComment(event *github.IssueCommentEvent) *pullRequestComment {
+	owner, repo, number := event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.GetIssue().GetNumber()
+	return &pullRequestComment{
+		Source:    setting.SourceFromGithub,
+		RepoPath:  event.GetRepo().GetFullName(),
+		PRID:      number,
+		Commenter: event.GetComment().GetUser().GetLogin(),
+		Body:      event.GetComment().GetBody(),
+		PRRefs: func(mainRepo *commonmodels.MainHookRepo) (string, string, error) {
+			detail, err := systemconfig.New().GetCodeHost(mainRepo.CodehostID)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to find codehost %d: %v", mainRepo.CodehostID, err)
+			}
+			pr, err := git.NewClient(detail.AccessToken, config.ProxyHTTPSAddr(), detail.EnableProxy).GetPullRequest(context.Background(), owner, repo, number)
+			if err != nil {
+				return "", "", err
+			}
+			return pr.GetBase().GetRef(), pr.GetHead().GetSHA(), nil
+		},
+	}
+}
+
+// gitlabNoteCreated tells whether the note event is sent for a new note, edited notes are sent with the update action
+// by gitlab, and gitlab sending no action marks the edited notes by the updated time only.
+func gitlabNoteCreated(payload []byte, event *gitlab.MergeCommentEvent) bool {
+	note := &struct {
+		ObjectAttributes struct {
+			Action string `json:"action"`
+		} `json:"object_attributes"`
+	}{}
+	if err := json.Unmarshal(payload, note); err == nil && note.ObjectAttributes.Action != "" {
+		return note.ObjectAttributes.Action == "create"
+	}
+	return event.ObjectAttributes.UpdatedAt == "" || event.ObjectAttributes.UpdatedAt == event.ObjectAttributes.CreatedAt
+}
+
+func gitlabPullRequestComment(event *gitlab.MergeCommentEvent) *pullRequestComment {
+	return &pullRequestComment{
+		Source:    setting.SourceFromGitlab,
+		RepoPath:  event.Project.PathWithNamespace,
+		PRID:      event.MergeRequest.IID,
+		Commenter: event.User.Username,
+		Body:      event.ObjectAttributes.Note,
+		PRRefs: func(mainRepo *commonmodels.MainHookRepo) (string, string, error) {
+			return event.MergeRequest.TargetBranch, event.MergeRequest.LastCommit.ID, nil
+		},
+	}
+}
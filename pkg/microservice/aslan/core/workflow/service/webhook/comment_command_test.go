@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+)
+
+var _ = Describe("Testing comment commands", func() {
+	DescribeTable("parsing the command in a comment",
+		func(body string, expected *commentCommand) {
+			Expect(parseCommentCommand(body)).To(Equal(expected))
+		},
+		Entry("run with workflow", "/zadig run build-dev", &commentCommand{Action: "run", Workflow: "build-dev"}),
+		Entry("run without workflow", "/zadig run", nil),
+		Entry("retry without workflow", "LGTM\n/zadig retry", &commentCommand{Action: "retry"}),
+		Entry("cancel with workflow", "  /zadig Cancel build-dev  ", &commentCommand{Action: "cancel", Workflow: "build-dev"}),
+		Entry("unknown action", "/zadig deploy build-dev", nil),
+		Entry("command quoted in text", "please type `/zadig run build-dev`", nil),
+		Entry("no command", "looks good to me", nil),
+	)
+
+	DescribeTable("matching the connector of the code host",
+		func(connector *systemconfig.Connector, ch *systemconfig.CodeHost, expected bool) {
+			Expect(connectorOfCodeHost(connector, ch)).To(Equal(expected))
+		},
+		Entry("github connector of github.com", &systemconfig.Connector{Type: "github", ID: "github"}, &systemconfig.CodeHost{Type: "github", Address: "https://github.com"}, true),
+		Entry("github enterprise connector of github.com",
+			&systemconfig.Connector{Type: "github", Config: map[string]interface{}{"hostName": "git.example.com"}},
+			&systemconfig.CodeHost{Type: "github", Address: "https://github.com"}, false),
+		Entry("gitlab connector of the same host",
+			&systemconfig.Connector{Type: "gitlab", Config: map[string]interface{}{"baseURL": "https://gitlab.example.com/"}},
+			&systemconfig.CodeHost{Type: "gitlab", Address: "https://gitlab.example.com"}, true),
+		Entry("gitlab.com connector of a self-hosted gitlab",
+			&systemconfig.Connector{Type: "gitlab"}, &systemconfig.CodeHost{Type: "gitlab", Address: "https://gitlab.example.com"}, false),
+		Entry("ldap connector", &systemconfig.Connector{Type: "ldap"}, &systemconfig.CodeHost{Type: "gitlab", Address: "https://gitlab.com"}, false),
+	)
+
+	DescribeTable("telling gitlab notes created from the edited ones",
+		func(payload string, createdAt, updatedAt string, expected bool) {
+			event := &gitlab.MergeCommentEvent{}
+			event.ObjectAttributes.CreatedAt = createdAt
+			event.ObjectAttributes.UpdatedAt = updatedAt
+			Expect(gitlabNoteCreated([]byte(payload), event)).To(Equal(expected))
+		},
+		Entry("created note", `{"object_attributes":{"action":"create"}}`, "t1", "t2", true),
+		Entry("edited note", `{"object_attributes":{"action":"update"}}`, "t1", "t1", false),
+		Entry("note without action", `{"object_attributes":{}}`, "t1", "t1", true),
+		Entry("edited note without action", `{"object_attributes":{}}`, "t1", "t2", false),
+	)
+})
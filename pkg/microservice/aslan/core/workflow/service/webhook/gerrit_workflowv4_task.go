@@ -263,7 +263,7 @@ func TriggerWorkflowV4ByGerritEvent(event *gerritTypeEvent, body []byte, uri, ba
 			if notification != nil {
 				workflow.NotificationID = notification.ID.Hex()
 			}
-			workflow.HookPayload = hookPayload
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
 			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
 				errMsg := fmt.Sprintf("failed to create workflow task when receive push event due to %v ", err)
 				log.Error(errMsg)
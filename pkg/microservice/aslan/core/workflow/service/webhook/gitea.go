@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	gitservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/git"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/gitea"
+)
+
+func ProcessGiteaHook(payload []byte, req *http.Request, requestID string, log *zap.SugaredLogger) error {
+	if !validHookSignature(payload, req.Header.Get(gitea.SignatureHeader), "") {
+		return errors.New("signature is illegal")
+	}
+
+	event, err := gitea.ParseHook(gitea.HookEventType(req), payload)
+	if err != nil {
+		return err
+	}
+
+	switch event := event.(type) {
+	case *gitea.PushEvent:
+		if len(event.Commits) > 0 {
+			webhookUser := &commonmodels.WebHookUser{
+				Domain:    req.Header.Get("X-Forwarded-Host"),
+				UserName:  event.Commits[0].Author.Name,
+				Email:     event.Commits[0].Author.Email,
+				Source:    setting.SourceFromGitea,
+				CreatedAt: time.Now().Unix(),
+			}
+			commonrepo.NewWebHookUserColl().Upsert(webhookUser)
+		}
+	case *gitea.PullRequestEvent:
+		if event.Action != "opened" && event.Action != "reopened" && event.Action != "synchronized" {
+			return fmt.Errorf("action %s is skipped", event.Action)
+		}
+	}
+	return TriggerWorkflowV4ByGiteaEvent(event, config.SystemAddress(), requestID, log)
+}
+
+// validHookSignature checks the hex encoded hmac-sha256 signature of the payload signed by the hook secret.
+func validHookSignature(payload []byte, signature, prefix string) bool {
+	secret := gitservice.GetHookSecret()
+	if secret == "" {
+		return true
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal([]byte(prefix+hex.EncodeToString(mac.Sum(nil))), []byte(signature))
+}
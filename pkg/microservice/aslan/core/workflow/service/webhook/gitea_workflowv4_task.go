@@ -0,0 +1,305 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/systemconfig"
+	"github.com/koderover/zadig/pkg/tool/gitea"
+	"github.com/koderover/zadig/pkg/types"
+)
+
+type giteaPullRequestDiffFunc func(event *gitea.PullRequestEvent, codehostID int) ([]string, error)
+
+type giteaEventMatcherForWorkflowV4 interface {
+	Match(*commonmodels.MainHookRepo) (bool, error)
+	GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository
+}
+
+type giteaPushEventMatcherForWorkflowV4 struct {
+	log          *zap.SugaredLogger
+	event        *gitea.PushEvent
+	changedFiles []string
+}
+
+func (gpem *giteaPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := gpem.event
+	if hookRepo.Source != setting.SourceFromGitea || !checkRepoNamespaceMatch(hookRepo, ev.Repository.FullName) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPush) {
+		return false, nil
+	}
+
+	branch := getBranchFromRef(ev.Ref)
+	if !matchHookBranch(hookRepo, branch) {
+		return false, nil
+	}
+	hookRepo.Branch = branch
+	hookRepo.Committer = ev.Pusher.Login
+	var changedFiles []string
+	for _, commit := range ev.Commits {
+		changedFiles = append(changedFiles, commit.Added...)
+		changedFiles = append(changedFiles, commit.Removed...)
+		changedFiles = append(changedFiles, commit.Modified...)
+	}
+	gpem.changedFiles = changedFiles
+	return MatchChanges(hookRepo, changedFiles), nil
+}
+
+func (gpem *giteaPushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		RepoOwner:     hookRepo.RepoOwner,
+		Branch:        hookRepo.Branch,
+		CommitID:      gpem.event.After,
+		Source:        hookRepo.Source,
+	}
+}
+
+func (gpem *giteaPushEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gpem.changedFiles
+}
+
+type giteaMergeEventMatcherForWorkflowV4 struct {
+	diffFunc     giteaPullRequestDiffFunc
+	log          *zap.SugaredLogger
+	event        *gitea.PullRequestEvent
+	changedFiles []string
+}
+
+func (gmem *giteaMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := gmem.event
+	if hookRepo.Source != setting.SourceFromGitea || !checkRepoNamespaceMatch(hookRepo, ev.PullRequest.Base.Repo.FullName) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventPr) {
+		return false, nil
+	}
+	if !matchHookBranch(hookRepo, ev.PullRequest.Base.Ref) {
+		return false, nil
+	}
+	hookRepo.Branch = ev.PullRequest.Base.Ref
+	hookRepo.Committer = ev.PullRequest.User.Login
+
+	changedFiles, err := gmem.diffFunc(ev, hookRepo.CodehostID)
+	if err != nil {
+		gmem.log.Warnf("failed to get changes of event %v", ev)
+		return false, err
+	}
+	gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
+	gmem.changedFiles = changedFiles
+	return MatchChanges(hookRepo, changedFiles), nil
+}
+
+func (gmem *giteaMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoOwner:     hookRepo.RepoOwner,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		Branch:        hookRepo.Branch,
+		PR:            gmem.event.PullRequest.Number,
+		CommitID:      gmem.event.PullRequest.Head.Sha,
+		Source:        hookRepo.Source,
+	}
+}
+
+func (gmem *giteaMergeEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gmem.changedFiles
+}
+
+type giteaTagEventMatcherForWorkflowV4 struct {
+	log   *zap.SugaredLogger
+	event *gitea.PushEvent
+}
+
+func (gtem *giteaTagEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
+	ev := gtem.event
+	if hookRepo.Source != setting.SourceFromGitea || !checkRepoNamespaceMatch(hookRepo, ev.Repository.FullName) {
+		return false, nil
+	}
+	if !EventConfigured(hookRepo, config.HookEventTag) {
+		return false, nil
+	}
+	if !matchHookBranch(hookRepo, ev.Repository.DefaultBranch) {
+		return false, nil
+	}
+	hookRepo.Tag = getTagFromRef(ev.Ref)
+	hookRepo.Committer = ev.Pusher.Login
+	return true, nil
+}
+
+func (gtem *giteaTagEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmodels.MainHookRepo) *types.Repository {
+	return &types.Repository{
+		CodehostID:    hookRepo.CodehostID,
+		RepoName:      hookRepo.RepoName,
+		RepoOwner:     hookRepo.RepoOwner,
+		RepoNamespace: hookRepo.GetRepoNamespace(),
+		Branch:        hookRepo.Branch,
+		Tag:           hookRepo.Tag,
+		Source:        hookRepo.Source,
+	}
+}
+
+// matchHookBranch matches the branch with the branch of the hook, which is a regular expression if IsRegular is set.
+func matchHookBranch(hookRepo *commonmodels.MainHookRepo, branch string) bool {
+	if !hookRepo.IsRegular {
+		return hookRepo.Branch == branch
+	}
+	// Do not use regexp.MustCompile to avoid panic
+	matched, err := regexp.MatchString(hookRepo.Branch, branch)
+	return err == nil && matched
+}
+
+func createGiteaEventMatcherForWorkflowV4(event interface{}, diffSrv giteaPullRequestDiffFunc, log *zap.SugaredLogger) giteaEventMatcherForWorkflowV4 {
+	switch evt := event.(type) {
+	case *gitea.PushEvent:
+		if strings.HasPrefix(evt.Ref, "refs/tags/") {
+			return &giteaTagEventMatcherForWorkflowV4{
+				log:   log,
+				event: evt,
+			}
+		}
+		return &giteaPushEventMatcherForWorkflowV4{
+			log:   log,
+			event: evt,
+		}
+	case *gitea.PullRequestEvent:
+		return &giteaMergeEventMatcherForWorkflowV4{
+			diffFunc: diffSrv,
+			log:      log,
+			event:    evt,
+		}
+	}
+	return nil
+}
+
+func TriggerWorkflowV4ByGiteaEvent(event interface{}, baseURI, requestID string, log *zap.SugaredLogger) error {
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{}, 0, 0)
+	if err != nil {
+		errMsg := fmt.Sprintf("list workflow v4 error: %v", err)
+		log.Error(errMsg)
+		return fmt.Errorf(errMsg)
+	}
+
+	mErr := &multierror.Error{}
+	matcher := createGiteaEventMatcherForWorkflowV4(event, findChangedFilesOfGiteaPullRequest, log)
+	if matcher == nil {
+		return fmt.Errorf("unsupported gitea event %T", event)
+	}
+
+	for _, workflow := range workflows {
+		for _, item := range workflow.HookCtls {
+			if !item.Enabled {
+				continue
+			}
+			matches, err := matcher.Match(item.MainRepo)
+			if err != nil {
+				mErr = multierror.Append(mErr, err)
+			}
+			if !matches {
+				continue
+			}
+
+			log.Infof("event match hook %v of %s", item.MainRepo, workflow.Name)
+			eventRepo := matcher.GetHookRepo(item.MainRepo)
+			var hookPayload *commonmodels.HookPayload
+			if ev, isPr := event.(*gitea.PullRequestEvent); isPr {
+				mergeRequestID := strconv.Itoa(ev.PullRequest.Number)
+				autoCancelOpt := &AutoCancelOpt{
+					MergeRequestID: mergeRequestID,
+					CommitID:       ev.PullRequest.Head.Sha,
+					TaskType:       config.WorkflowType,
+					MainRepo:       item.MainRepo,
+					AutoCancel:     item.AutoCancel,
+					WorkflowName:   workflow.Name,
+				}
+				if err := AutoCancelWorkflowV4Task(autoCancelOpt, log); err != nil {
+					log.Errorf("failed to auto cancel workflowV4 task when receive event %v due to %v ", event, err)
+					mErr = multierror.Append(mErr, err)
+				}
+
+				hookPayload = &commonmodels.HookPayload{
+					Owner:          eventRepo.RepoOwner,
+					Repo:           eventRepo.RepoName,
+					Branch:         eventRepo.Branch,
+					IsPr:           true,
+					CodehostID:     item.MainRepo.CodehostID,
+					MergeRequestID: mergeRequestID,
+					CommitID:       ev.PullRequest.Head.Sha,
+				}
+			}
+			if err := job.MergeArgs(workflow, item.WorkflowArg); err != nil {
+				errMsg := fmt.Sprintf("merge workflow args error: %v", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+				continue
+			}
+			if err := job.MergeWebhookRepo(workflow, eventRepo); err != nil {
+				errMsg := fmt.Sprintf("merge webhook repo info to workflowargs error: %v", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+				continue
+			}
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
+			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
+				errMsg := fmt.Sprintf("failed to create workflow task when receive gitea event due to %v ", err)
+				log.Error(errMsg)
+				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
+			} else {
+				log.Infof("succeed to create task %v", resp)
+			}
+		}
+	}
+	return mErr.ErrorOrNil()
+}
+
+func findChangedFilesOfGiteaPullRequest(event *gitea.PullRequestEvent, codehostID int) ([]string, error) {
+	detail, err := systemconfig.New().GetCodeHost(codehostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find codehost %d: %v", codehostID, err)
+	}
+
+	cli := gitea.NewClient(detail.Address, detail.AccessToken, config.ProxyHTTPSAddr(), detail.EnableProxy)
+	repo := event.PullRequest.Base.Repo
+	files, err := cli.ListPullRequestFiles(repo.Owner.Login, repo.Name, event.PullRequest.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes from gitea, err: %v", err)
+	}
+
+	changedFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		changedFiles = append(changedFiles, file.Filename)
+	}
+	return changedFiles, nil
+}
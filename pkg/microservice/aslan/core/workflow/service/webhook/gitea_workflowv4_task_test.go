@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/gitea"
+)
+
+var _ = Describe("Testing gitea event matchers", func() {
+	repo := &gitea.Repository{Name: "demo", FullName: "owner/demo", DefaultBranch: "main"}
+	pusher := &gitea.User{Login: "pusher"}
+	pushEvent := &gitea.PushEvent{
+		Ref:        "refs/heads/main",
+		After:      "b",
+		Commits:    []*gitea.PushCommit{{ID: "b", Modified: []string{"src/main.go"}}},
+		Repository: repo,
+		Pusher:     pusher,
+	}
+	tagEvent := &gitea.PushEvent{Ref: "refs/tags/v1.0.0", After: "c", Repository: repo, Pusher: pusher}
+	prEvent := &gitea.PullRequestEvent{
+		Action: "opened",
+		Number: 1,
+		PullRequest: &gitea.PullRequest{
+			Number: 1,
+			User:   &gitea.User{Login: "author"},
+			Head:   &gitea.PRBranchInfo{Ref: "feature", Sha: "d", Repo: repo},
+			Base:   &gitea.PRBranchInfo{Ref: "main", Sha: "a", Repo: repo},
+		},
+		Repository: repo,
+	}
+	diff := func(event *gitea.PullRequestEvent, codehostID int) ([]string, error) {
+		return []string{"src/main.go"}, nil
+	}
+	newHookRepo := func(events ...config.HookEventType) *commonmodels.MainHookRepo {
+		return &commonmodels.MainHookRepo{
+			Source:       setting.SourceFromGitea,
+			RepoOwner:    "owner",
+			RepoName:     "demo",
+			Branch:       "main",
+			MatchFolders: []string{"src"},
+			Events:       events,
+		}
+	}
+
+	It("creates the matcher by the type of the event", func() {
+		Expect(createGiteaEventMatcherForWorkflowV4(pushEvent, diff, zap.NewNop().Sugar())).To(BeAssignableToTypeOf(&giteaPushEventMatcherForWorkflowV4{}))
+		Expect(createGiteaEventMatcherForWorkflowV4(tagEvent, diff, zap.NewNop().Sugar())).To(BeAssignableToTypeOf(&giteaTagEventMatcherForWorkflowV4{}))
+		Expect(createGiteaEventMatcherForWorkflowV4(prEvent, diff, zap.NewNop().Sugar())).To(BeAssignableToTypeOf(&giteaMergeEventMatcherForWorkflowV4{}))
+		Expect(createGiteaEventMatcherForWorkflowV4(&gitea.User{}, diff, zap.NewNop().Sugar())).To(BeNil())
+	})
+
+	It("matches the push to the configured branch", func() {
+		matcher := createGiteaEventMatcherForWorkflowV4(pushEvent, diff, zap.NewNop().Sugar())
+		hookRepo := newHookRepo(config.HookEventPush)
+		matched, err := matcher.Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeTrue())
+		Expect(hookRepo.Committer).To(Equal("pusher"))
+		Expect(matcher.GetHookRepo(hookRepo).CommitID).To(Equal("b"))
+
+		hookRepo = newHookRepo(config.HookEventPush)
+		hookRepo.MatchFolders = []string{"docs"}
+		matched, err = matcher.Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeFalse())
+	})
+
+	It("matches the branch by regular expression", func() {
+		matcher := createGiteaEventMatcherForWorkflowV4(pushEvent, diff, zap.NewNop().Sugar())
+		hookRepo := newHookRepo(config.HookEventPush)
+		hookRepo.Branch = "ma.*"
+		hookRepo.IsRegular = true
+		matched, err := matcher.Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeTrue())
+		Expect(hookRepo.Branch).To(Equal("main"))
+	})
+
+	It("matches the tag only if tag events are configured", func() {
+		matcher := createGiteaEventMatcherForWorkflowV4(tagEvent, diff, zap.NewNop().Sugar())
+		matched, err := matcher.Match(newHookRepo(config.HookEventPush))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeFalse())
+
+		hookRepo := newHookRepo(config.HookEventTag)
+		matched, err = matcher.Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeTrue())
+		Expect(matcher.GetHookRepo(hookRepo).Tag).To(Equal("v1.0.0"))
+	})
+
+	It("matches the pull request to the configured base branch", func() {
+		matcher := createGiteaEventMatcherForWorkflowV4(prEvent, diff, zap.NewNop().Sugar())
+		hookRepo := newHookRepo(config.HookEventPr)
+		matched, err := matcher.Match(hookRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matched).To(BeTrue())
+		Expect(hookRepo.Committer).To(Equal("author"))
+		repository := matcher.GetHookRepo(hookRepo)
+		Expect(repository.PR).To(Equal(1))
+		Expect(repository.CommitID).To(Equal("d"))
+	})
+
+	It("returns the error of the diff of the pull request", func() {
+		failedDiff := func(event *gitea.PullRequestEvent, codehostID int) ([]string, error) {
+			return nil, errors.New("diff failed")
+		}
+		matcher := createGiteaEventMatcherForWorkflowV4(prEvent, failedDiff, zap.NewNop().Sugar())
+		_, err := matcher.Match(newHookRepo(config.HookEventPr))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("does not match the repository of another owner", func() {
+		hookRepo := newHookRepo(config.HookEventPush, config.HookEventTag, config.HookEventPr)
+		hookRepo.RepoOwner = "other"
+		for _, event := range []interface{}{pushEvent, tagEvent, prEvent} {
+			matched, err := createGiteaEventMatcherForWorkflowV4(event, diff, zap.NewNop().Sugar()).Match(hookRepo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matched).To(BeFalse())
+		}
+	})
+})
@@ -41,9 +41,10 @@ type giteeEventMatcherForWorkflowV4 interface {
 }
 
 type giteePushEventMatcherForWorkflowV4 struct {
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *gitee.PushEvent
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *gitee.PushEvent
+	changedFiles []string
 }
 
 func (gpem *giteePushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -72,6 +73,7 @@ func (gpem *giteePushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Mai
 			changedFiles = append(changedFiles, commit.Removed...)
 			changedFiles = append(changedFiles, commit.Modified...)
 		}
+		gpem.changedFiles = changedFiles
 		return MatchChanges(hookRepo, changedFiles), nil
 	}
 
@@ -89,11 +91,16 @@ func (gpem *giteePushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmode
 	}
 }
 
+func (gpem *giteePushEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 type giteeMergeEventMatcherForWorkflowV4 struct {
-	diffFunc giteePullRequestDiffFunc
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *gitee.PullRequestEvent
+	diffFunc     giteePullRequestDiffFunc
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *gitee.PullRequestEvent
+	changedFiles []string
 }
 
 func (gmem *giteeMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -124,6 +131,7 @@ func (gmem *giteeMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Ma
 			}
 			gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
 
+			gmem.changedFiles = changedFiles
 			return MatchChanges(hookRepo, changedFiles), nil
 		}
 	}
@@ -142,6 +150,10 @@ func (gmem *giteeMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmod
 	}
 }
 
+func (gmem *giteeMergeEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 type giteeTagEventMatcherForWorkflowV4 struct {
 	log      *zap.SugaredLogger
 	workflow *commonmodels.WorkflowV4
@@ -308,7 +320,7 @@ func TriggerWorkflowV4ByGiteeEvent(event interface{}, baseURI, requestID string,
 			if notification != nil {
 				workflow.NotificationID = notification.ID.Hex()
 			}
-			workflow.HookPayload = hookPayload
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
 			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
 				errMsg := fmt.Sprintf("failed to create workflow task when receive push event due to %v ", err)
 				log.Error(errMsg)
@@ -557,6 +557,15 @@ func ProcessGithubWebHookForWorkflowV4(payload []byte, req *http.Request, reques
 			log.Errorf("tagEventToPipelineTasks error: %s", err)
 			return e.ErrGithubWebHook.AddErr(err)
 		}
+	case *github.IssueCommentEvent:
+		// comments of issues are not handled, only the ones of pull requests
+		if et.GetAction() != "created" || !et.GetIssue().IsPullRequest() {
+			return nil
+		}
+		if err = ProcessPullRequestComment(githubPullRequestComment(et), log); err != nil {
+			log.Errorf("process pull request comment error: %s", err)
+			return e.ErrGithubWebHook.AddErr(err)
+		}
 	}
 	return nil
 }
@@ -41,9 +41,10 @@ type gitEventMatcherForWorkflowV4 interface {
 }
 
 type githubPushEventMatcheForWorkflowV4 struct {
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *github.PushEvent
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *github.PushEvent
+	changedFiles []string
 }
 
 func (gpem *githubPushEventMatcheForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -75,6 +76,7 @@ func (gpem *githubPushEventMatcheForWorkflowV4) Match(hookRepo *commonmodels.Mai
 		changedFiles = append(changedFiles, commit.Removed...)
 		changedFiles = append(changedFiles, commit.Modified...)
 	}
+	gpem.changedFiles = changedFiles
 	return MatchChanges(hookRepo, changedFiles), nil
 }
 
@@ -91,11 +93,16 @@ func (gpem *githubPushEventMatcheForWorkflowV4) GetHookRepo(hookRepo *commonmode
 	}
 }
 
+func (gpem *githubPushEventMatcheForWorkflowV4) ChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 type githubMergeEventMatcherForWorkflowV4 struct {
-	diffFunc githubPullRequestDiffFunc
-	log      *zap.SugaredLogger
-	workflow *commonmodels.WorkflowV4
-	event    *github.PullRequestEvent
+	diffFunc     githubPullRequestDiffFunc
+	log          *zap.SugaredLogger
+	workflow     *commonmodels.WorkflowV4
+	event        *github.PullRequestEvent
+	changedFiles []string
 }
 
 func (gmem *githubMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -129,6 +136,7 @@ func (gmem *githubMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.M
 		}
 		gmem.log.Debugf("succeed to get %d changes in merge event", len(changedFiles))
 
+		gmem.changedFiles = changedFiles
 		return MatchChanges(hookRepo, changedFiles), nil
 	}
 
@@ -149,6 +157,10 @@ func (gmem *githubMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmo
 	}
 }
 
+func (gmem *githubMergeEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 type githubTagEventMatcherForWorkflowV4 struct {
 	log      *zap.SugaredLogger
 	workflow *commonmodels.WorkflowV4
@@ -305,7 +317,7 @@ func TriggerWorkflowV4ByGithubEvent(event interface{}, baseURI, deliveryID, requ
 				mErr = multierror.Append(mErr, fmt.Errorf(errMsg))
 				continue
 			}
-			workflow.HookPayload = hookPayload
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
 			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
 				errMsg := fmt.Sprintf("failed to create workflow task when receive push event due to %v ", err)
 				log.Error(errMsg)
@@ -97,6 +97,14 @@ func ProcessGitlabHook(payload []byte, req *http.Request, requestID string, log
 		mergeEvent = event
 	case *gitlab.TagEvent:
 		tagEvent = event
+	case *gitlab.MergeCommentEvent:
+		// edited notes are not handled, otherwise the commands in them run again
+		if !gitlabNoteCreated(payload, event) {
+			break
+		}
+		if err = ProcessPullRequestComment(gitlabPullRequestComment(event), log); err != nil {
+			errorList = multierror.Append(errorList, err)
+		}
 	}
 
 	//触发工作流webhook和测试管理webhook
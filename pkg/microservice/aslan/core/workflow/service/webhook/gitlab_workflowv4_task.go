@@ -45,6 +45,7 @@ type gitlabMergeEventMatcherForWorkflowV4 struct {
 	trigger            *TriggerYaml
 	isYaml             bool
 	yamlServiceChanged []BuildServices
+	changedFiles       []string
 }
 
 func (gmem *gitlabMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -93,6 +94,7 @@ func (gmem *gitlabMergeEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.M
 			gmem.yamlServiceChanged = serviceChangeds
 			return len(serviceChangeds) != 0, nil
 		}
+		gmem.changedFiles = changedFiles
 		return MatchChanges(hookRepo, changedFiles), nil
 	}
 	return false, nil
@@ -110,6 +112,10 @@ func (gmem *gitlabMergeEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmo
 	}
 }
 
+func (gmem *gitlabMergeEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gmem.changedFiles
+}
+
 func createGitlabEventMatcherForWorkflowV4(
 	event interface{}, diffSrv gitlabMergeRequestDiffFunc, workflow *commonmodels.WorkflowV4, log *zap.SugaredLogger,
 ) gitEventMatcherForWorkflowV4 {
@@ -145,6 +151,7 @@ type gitlabPushEventMatcherForWorkflowV4 struct {
 	trigger            *TriggerYaml
 	isYaml             bool
 	yamlServiceChanged []BuildServices
+	changedFiles       []string
 }
 
 func (gpem *gitlabPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.MainHookRepo) (bool, error) {
@@ -208,6 +215,7 @@ func (gpem *gitlabPushEventMatcherForWorkflowV4) Match(hookRepo *commonmodels.Ma
 		gpem.yamlServiceChanged = serviceChangeds
 		return len(serviceChangeds) != 0, nil
 	}
+	gpem.changedFiles = changedFiles
 	return MatchChanges(hookRepo, changedFiles), nil
 }
 
@@ -222,6 +230,10 @@ func (gpem *gitlabPushEventMatcherForWorkflowV4) GetHookRepo(hookRepo *commonmod
 	}
 }
 
+func (gpem *gitlabPushEventMatcherForWorkflowV4) ChangedFiles() []string {
+	return gpem.changedFiles
+}
+
 type gitlabTagEventMatcherForWorkflowV4 struct {
 	log                *zap.SugaredLogger
 	workflow           *commonmodels.WorkflowV4
@@ -396,7 +408,7 @@ func TriggerWorkflowV4ByGitlabEvent(event interface{}, baseURI, requestID string
 			if notification != nil {
 				workflow.NotificationID = notification.ID.Hex()
 			}
-			workflow.HookPayload = hookPayload
+			workflow.HookPayload = workflowV4HookPayload(hookPayload, eventRepo, matcher)
 			if resp, err := workflowservice.CreateWorkflowTaskV4(setting.WebhookTaskCreator, workflow, log); err != nil {
 				errMsg := fmt.Sprintf("failed to create workflow task when receive push event due to %v ", err)
 				log.Error(errMsg)
@@ -769,3 +769,34 @@ func subElem(parent, sub string) bool {
 	}
 	return false
 }
+
+// changedFilesMatcher is implemented by the workflow v4 event matchers which know the files changed in the event.
+type changedFilesMatcher interface {
+	ChangedFiles() []string
+}
+
+// workflowV4HookPayload records the event which triggered the workflow v4, the conditions of its stages and jobs may refer to it.
+func workflowV4HookPayload(hookPayload *commonmodels.HookPayload, eventRepo *types.Repository, matcher interface{}) *commonmodels.HookPayload {
+	payload := &commonmodels.HookPayload{}
+	if hookPayload != nil {
+		*payload = *hookPayload
+	}
+	if payload.Branch == "" {
+		payload.Branch = eventRepo.Branch
+	}
+	if payload.CommitID == "" {
+		payload.CommitID = eventRepo.CommitID
+	}
+	switch {
+	case eventRepo.Tag != "":
+		payload.EventType = string(config.HookEventTag)
+	case payload.IsPr || eventRepo.PR > 0:
+		payload.EventType = string(config.HookEventPr)
+	default:
+		payload.EventType = string(config.HookEventPush)
+	}
+	if m, ok := matcher.(changedFilesMatcher); ok {
+		payload.ChangedFiles = m.ChangedFiles()
+	}
+	return payload
+}
@@ -59,6 +59,10 @@ func InitJobCtl(job *commonmodels.Job, workflow *commonmodels.WorkflowV4) (JobCt
 		resp = &CanaryDeployJob{job: job, workflow: workflow}
 	case config.JobK8sCanaryRelease:
 		resp = &CanaryReleaseJob{job: job, workflow: workflow}
+	case config.JobIstioCanary:
+		resp = &IstioCanaryJob{job: job, workflow: workflow}
+	case config.JobCanaryAnalysis:
+		resp = &CanaryAnalysisJob{job: job, workflow: workflow}
 	case config.JobZadigTesting:
 		resp = &TestingJob{job: job, workflow: workflow}
 	default:
@@ -88,7 +92,15 @@ func ToJobs(job *commonmodels.Job, workflow *commonmodels.WorkflowV4, taskID int
 	if err != nil {
 		return []*commonmodels.JobTask{}, err
 	}
-	return jobCtl.ToJobs(taskID)
+	jobTasks, err := jobCtl.ToJobs(taskID)
+	if err != nil {
+		return jobTasks, err
+	}
+	for _, jobTask := range jobTasks {
+		jobTask.OriginName = job.Name
+		jobTask.DependsOn = job.DependsOn
+	}
+	return jobTasks, nil
 }
 
 func LintJob(job *commonmodels.Job, workflow *commonmodels.WorkflowV4) error {
@@ -17,15 +17,12 @@ limitations under the License.
 package job
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
-	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
-	"github.com/koderover/zadig/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/pkg/tool/log"
 	"helm.sh/helm/v3/pkg/time"
 	"k8s.io/apimachinery/pkg/labels"
@@ -66,6 +63,7 @@ func (j *BlueGreenDeployJob) MergeArgs(args *commonmodels.Job) error {
 		if err := commonmodels.IToi(args.Spec, argsSpec); err != nil {
 			return err
 		}
+		j.spec.Env = argsSpec.Env
 		j.spec.Targets = argsSpec.Targets
 		j.job.Spec = j.spec
 	}
@@ -80,6 +78,15 @@ func (j *BlueGreenDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, erro
 		return resp, err
 	}
 
+	if j.spec.Env != "" {
+		env, err := getDeployEnv(j.workflow.Project, j.spec.Env, blueGreenDeployJobType)
+		if err != nil {
+			logger.Error(err)
+			return resp, err
+		}
+		j.spec.ClusterID, j.spec.Namespace = env.ClusterID, env.Namespace
+	}
+
 	kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), j.spec.ClusterID)
 	if err != nil {
 		logger.Errorf("Failed to get kube client, err: %v", err)
@@ -87,38 +94,30 @@ func (j *BlueGreenDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, erro
 	}
 
 	for _, target := range j.spec.Targets {
-		service, exist, err := getter.GetService(j.spec.Namespace, target.K8sServiceName, kubeClient)
-		if err != nil || !exist {
-			msg := fmt.Sprintf("Failed to get service, err: %v", err)
-			logger.Error(msg)
-			return resp, errors.New(msg)
+		service, err := getTargetService(j.spec.Namespace, target.K8sServiceName, kubeClient)
+		if err != nil {
+			logger.Error(err)
+			return resp, err
 		}
+		target.K8sServiceName = service.Name
 		delete(service.Spec.Selector, config.BlueGreenVerionLabelName)
 		selector := labels.Set(service.Spec.Selector).AsSelector()
-		deployments, err := getter.ListDeployments(j.spec.Namespace, selector, kubeClient)
+		workload, err := findServiceWorkload(j.spec.Namespace, selector, kubeClient)
 		if err != nil {
-			msg := fmt.Sprintf("list deployments error: %v", err)
-			logger.Error(msg)
-			return resp, errors.New(msg)
+			logger.Error(err)
+			return resp, err
 		}
-		if len(deployments) == 0 {
-			msg := "no deployment found"
-			logger.Error(msg)
-			return resp, errors.New(msg)
+		if err := lintHelmWorkload(workload, blueGreenDeployJobType); err != nil {
+			logger.Error(err)
+			return resp, err
 		}
-		if len(deployments) > 1 {
-			msg := "more than one deployment found"
-			logger.Error(msg)
-			return resp, errors.New(msg)
-		}
-		deployment := deployments[0]
 
 		version := fmt.Sprintf("v%d", time.Now().Unix())
 		target.Version = version
-		target.WorkloadName = deployment.Name
-		target.WorkloadType = setting.Deployment
+		target.WorkloadName = workload.Name
+		target.WorkloadType = workload.Type
 		target.BlueK8sServiceName = target.K8sServiceName + config.BlueServiceNameSuffix
-		target.BlueWorkloadName = getBlueWorkloadName(deployment.Name, version)
+		target.BlueWorkloadName = getBlueWorkloadName(workload.Name, version)
 		task := &commonmodels.JobTask{
 			Name:    jobNameFormat(j.job.Name + "-" + target.K8sServiceName),
 			JobType: string(config.JobK8sBlueGreenDeploy),
@@ -129,8 +128,8 @@ func (j *BlueGreenDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, erro
 				DeployTimeout:      target.DeployTimeout,
 				K8sServiceName:     target.K8sServiceName,
 				BlueK8sServiceName: target.BlueK8sServiceName,
-				WorkloadType:       setting.Deployment,
-				WorkloadName:       deployment.Name,
+				WorkloadType:       workload.Type,
+				WorkloadName:       workload.Name,
 				BlueWorkloadName:   target.BlueWorkloadName,
 				ContainerName:      target.ContainerName,
 				Image:              target.Image,
@@ -149,6 +148,11 @@ func (j *BlueGreenDeployJob) LintJob() error {
 	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
 		return err
 	}
+	for _, target := range j.spec.Targets {
+		if target.K8sServiceName == "" {
+			return fmt.Errorf("k8s service name should not be empty")
+		}
+	}
 	quoteJobs := []*commonmodels.Job{}
 	for _, stage := range j.workflow.Stages {
 		for _, job := range stage.Jobs {
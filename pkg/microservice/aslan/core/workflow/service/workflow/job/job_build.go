@@ -179,181 +179,97 @@ func (j *BuildJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 
 		build.Package = fmt.Sprintf("%s.tar.gz", commonservice.ReleaseCandidate(build.Repos, taskID, j.workflow.Project, build.ServiceModule, "", build.ServiceModule, "tar"))
 
-		buildInfo, err := commonrepo.NewBuildColl().Find(&commonrepo.BuildFindOption{Name: build.BuildName})
-		if err != nil {
-			return resp, err
-		}
-		if err := fillBuildDetail(buildInfo, build.ServiceName, build.ServiceModule); err != nil {
-			return resp, err
-		}
-		basicImage, err := commonrepo.NewBasicImageColl().Find(buildInfo.PreBuild.ImageID)
-		if err != nil {
-			return resp, err
-		}
-		registries, err := commonservice.ListRegistryNamespaces("", true, logger)
-		if err != nil {
-			return resp, err
-		}
-		jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{}
-		jobTask := &commonmodels.JobTask{
-			Name:    jobNameFormat(build.ServiceName + "-" + build.ServiceModule + "-" + j.job.Name),
-			JobType: string(config.JobZadigBuild),
-			Spec:    jobTaskSpec,
-			Timeout: int64(buildInfo.Timeout),
-		}
-		jobTaskSpec.Properties = commonmodels.JobProperties{
-			Timeout:         int64(buildInfo.Timeout),
-			ResourceRequest: buildInfo.PreBuild.ResReq,
-			ResReqSpec:      buildInfo.PreBuild.ResReqSpec,
-			CustomEnvs:      renderKeyVals(build.KeyVals, buildInfo.PreBuild.Envs),
-			ClusterID:       buildInfo.PreBuild.ClusterID,
-			BuildOS:         basicImage.Value,
-			ImageFrom:       buildInfo.PreBuild.ImageFrom,
-			Registries:      registries,
-		}
-		clusterInfo, err := commonrepo.NewK8SClusterColl().Get(buildInfo.PreBuild.ClusterID)
-		if err != nil {
-			return resp, err
-		}
-
-		if clusterInfo.Cache.MediumType == "" {
-			jobTaskSpec.Properties.CacheEnable = false
-		} else {
-			jobTaskSpec.Properties.Cache = clusterInfo.Cache
-			jobTaskSpec.Properties.CacheEnable = buildInfo.CacheEnable
-			jobTaskSpec.Properties.CacheDirType = buildInfo.CacheDirType
-			jobTaskSpec.Properties.CacheUserDir = buildInfo.CacheUserDir
-		}
-		jobTaskSpec.Properties.Envs = append(jobTaskSpec.Properties.CustomEnvs, getBuildJobVariables(build, taskID, j.workflow.Project, j.workflow.Name, registry, logger)...)
-
-		if jobTaskSpec.Properties.CacheEnable && jobTaskSpec.Properties.Cache.MediumType == types.NFSMedium {
-			jobTaskSpec.Properties.CacheUserDir = renderEnv(jobTaskSpec.Properties.CacheUserDir, jobTaskSpec.Properties.Envs)
-			jobTaskSpec.Properties.Cache.NFSProperties.Subpath = renderEnv(jobTaskSpec.Properties.Cache.NFSProperties.Subpath, jobTaskSpec.Properties.Envs)
-		}
-
-		// init tools install step
-		tools := []*step.Tool{}
-		for _, tool := range buildInfo.PreBuild.Installs {
-			tools = append(tools, &step.Tool{
-				Name:    tool.Name,
-				Version: tool.Version,
-			})
-		}
-		toolInstallStep := &commonmodels.StepTask{
-			Name:     fmt.Sprintf("%s-%s", build.ServiceName, "tool-install"),
-			JobName:  jobTask.Name,
-			StepType: config.StepTools,
-			Spec:     step.StepToolInstallSpec{Installs: tools},
-		}
-		jobTaskSpec.Steps = append(jobTaskSpec.Steps, toolInstallStep)
-		// init git clone step
-		gitStep := &commonmodels.StepTask{
-			Name:     build.ServiceName + "-git",
-			JobName:  jobTask.Name,
-			StepType: config.StepGit,
-			Spec:     step.StepGitSpec{Repos: renderRepos(build.Repos, buildInfo.Repos)},
-		}
-		jobTaskSpec.Steps = append(jobTaskSpec.Steps, gitStep)
-
-		// init shell step
-		dockerLoginCmd := `docker login -u "$DOCKER_REGISTRY_AK" -p "$DOCKER_REGISTRY_SK" "$DOCKER_REGISTRY_HOST" &> /dev/null`
-		scripts := append([]string{dockerLoginCmd}, strings.Split(replaceWrapLine(buildInfo.Scripts), "\n")...)
-		shellStep := &commonmodels.StepTask{
-			Name:     build.ServiceName + "-shell",
-			JobName:  jobTask.Name,
-			StepType: config.StepShell,
-			Spec: &step.StepShellSpec{
-				Scripts: scripts,
-			},
-		}
-		jobTaskSpec.Steps = append(jobTaskSpec.Steps, shellStep)
-
-		// init docker build step
-		if buildInfo.PostBuild.DockerBuild != nil {
-			dockefileContent := ""
-			if buildInfo.PostBuild.DockerBuild.TemplateID != "" {
-				if dockerfileDetail, err := templ.GetDockerfileTemplateDetail(buildInfo.PostBuild.DockerBuild.TemplateID, logger); err == nil {
-					dockefileContent = dockerfileDetail.Content
-				}
+		// fan out into one job task for each cell of the matrix.
+		for _, cell := range expandMatrix(j.spec.Matrix) {
+			cellBuild := matrixServiceAndBuild(build, j.spec.Matrix, cell)
+			buildInfo, err := commonrepo.NewBuildColl().Find(&commonrepo.BuildFindOption{Name: build.BuildName})
+			if err != nil {
+				return resp, err
 			}
-
-			dockerBuildStep := &commonmodels.StepTask{
-				Name:     build.ServiceName + "-docker-build",
-				JobName:  jobTask.Name,
-				StepType: config.StepDockerBuild,
-				Spec: step.StepDockerBuildSpec{
-					Source:                buildInfo.PostBuild.DockerBuild.Source,
-					WorkDir:               buildInfo.PostBuild.DockerBuild.WorkDir,
-					DockerFile:            buildInfo.PostBuild.DockerBuild.DockerFile,
-					ImageName:             build.Image,
-					ImageReleaseTag:       imageTag,
-					BuildArgs:             buildInfo.PostBuild.DockerBuild.BuildArgs,
-					DockerTemplateContent: dockefileContent,
-					DockerRegistry: &step.DockerRegistry{
-						DockerRegistryID: j.spec.DockerRegistryID,
-						Host:             registry.RegAddr,
-						UserName:         registry.AccessKey,
-						Password:         registry.SecretKey,
-						Namespace:        registry.Namespace,
-					},
-				},
+			if err := fillBuildDetail(buildInfo, build.ServiceName, build.ServiceModule); err != nil {
+				return resp, err
 			}
-			jobTaskSpec.Steps = append(jobTaskSpec.Steps, dockerBuildStep)
-		}
-
-		// init archive step
-		if buildInfo.PostBuild.FileArchive != nil && buildInfo.PostBuild.FileArchive.FileLocation != "" {
-			uploads := []*step.Upload{
-				{
-					FilePath:        path.Join(buildInfo.PostBuild.FileArchive.FileLocation, build.Package),
-					DestinationPath: path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "archive"),
-				},
+			basicImage, err := commonrepo.NewBasicImageColl().Find(buildInfo.PreBuild.ImageID)
+			if err != nil {
+				return resp, err
 			}
-			archiveStep := &commonmodels.StepTask{
-				Name:     build.ServiceName + "-archive",
-				JobName:  jobTask.Name,
-				StepType: config.StepArchive,
-				Spec: step.StepArchiveSpec{
-					UploadDetail: uploads,
-					S3:           modelS3toS3(defaultS3),
-				},
+			registries, err := commonservice.ListRegistryNamespaces("", true, logger)
+			if err != nil {
+				return resp, err
 			}
-			jobTaskSpec.Steps = append(jobTaskSpec.Steps, archiveStep)
-		}
-
-		// init object storage step
-		if buildInfo.PostBuild.ObjectStorageUpload != nil && buildInfo.PostBuild.ObjectStorageUpload.Enabled {
-			modelS3, err := commonrepo.NewS3StorageColl().Find(buildInfo.PostBuild.ObjectStorageUpload.ObjectStorageID)
+			jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{}
+			jobTask := &commonmodels.JobTask{
+				Name:    matrixJobName(jobNameFormat(build.ServiceName+"-"+build.ServiceModule+"-"+j.job.Name), j.spec.Matrix, cell),
+				JobType: string(config.JobZadigBuild),
+				Spec:    jobTaskSpec,
+				Timeout: int64(buildInfo.Timeout),
+				Retry:   j.spec.Retry,
+			}
+			if len(j.spec.Matrix) > 0 {
+				jobTask.Matrix = cell
+			}
+			jobTaskSpec.Properties = commonmodels.JobProperties{
+				Timeout:         int64(buildInfo.Timeout),
+				Retry:           j.spec.Retry,
+				ResourceRequest: buildInfo.PreBuild.ResReq,
+				ResReqSpec:      buildInfo.PreBuild.ResReqSpec,
+				CustomEnvs:      renderKeyVals(build.KeyVals, buildInfo.PreBuild.Envs),
+				ClusterID:       buildInfo.PreBuild.ClusterID,
+				BuildOS:         basicImage.Value,
+				ImageFrom:       buildInfo.PreBuild.ImageFrom,
+				Registries:      registries,
+			}
+			clusterInfo, err := commonrepo.NewK8SClusterColl().Get(buildInfo.PreBuild.ClusterID)
 			if err != nil {
 				return resp, err
 			}
-			s3 := modelS3toS3(modelS3)
-			s3.Subfolder = ""
-			uploads := []*step.Upload{}
-			archiveStep := &commonmodels.StepTask{
-				Name:     build.ServiceName + "-object-storage",
-				JobName:  jobTask.Name,
-				StepType: config.StepArchive,
-				Spec: step.StepArchiveSpec{
-					UploadDetail:    uploads,
-					ObjectStorageID: buildInfo.PostBuild.ObjectStorageUpload.ObjectStorageID,
-					S3:              s3,
-				},
+
+			if clusterInfo.Cache.MediumType == "" {
+				jobTaskSpec.Properties.CacheEnable = false
+			} else {
+				jobTaskSpec.Properties.Cache = clusterInfo.Cache
+				jobTaskSpec.Properties.CacheEnable = buildInfo.CacheEnable
+				jobTaskSpec.Properties.CacheDirType = buildInfo.CacheDirType
+				jobTaskSpec.Properties.CacheUserDir = buildInfo.CacheUserDir
+			}
+			envs := append([]*commonmodels.KeyVal{}, jobTaskSpec.Properties.CustomEnvs...)
+			envs = append(envs, matrixEnvs(j.spec.Matrix, cell)...)
+			jobTaskSpec.Properties.Envs = append(envs, getBuildJobVariables(cellBuild, taskID, j.workflow.Project, j.workflow.Name, registry, logger)...)
+
+			if jobTaskSpec.Properties.CacheEnable && jobTaskSpec.Properties.Cache.MediumType == types.NFSMedium {
+				jobTaskSpec.Properties.CacheUserDir = renderEnv(jobTaskSpec.Properties.CacheUserDir, jobTaskSpec.Properties.Envs)
+				jobTaskSpec.Properties.Cache.NFSProperties.Subpath = renderEnv(jobTaskSpec.Properties.Cache.NFSProperties.Subpath, jobTaskSpec.Properties.Envs)
 			}
-			for _, detail := range buildInfo.PostBuild.ObjectStorageUpload.UploadDetail {
-				uploads = append(uploads, &step.Upload{
-					FilePath:        detail.FilePath,
-					DestinationPath: detail.DestinationPath,
+
+			// init tools install step
+			tools := []*step.Tool{}
+			for _, tool := range buildInfo.PreBuild.Installs {
+				tools = append(tools, &step.Tool{
+					Name:    tool.Name,
+					Version: tool.Version,
 				})
 			}
-			jobTaskSpec.Steps = append(jobTaskSpec.Steps, archiveStep)
-		}
+			toolInstallStep := &commonmodels.StepTask{
+				Name:     fmt.Sprintf("%s-%s", build.ServiceName, "tool-install"),
+				JobName:  jobTask.Name,
+				StepType: config.StepTools,
+				Spec:     step.StepToolInstallSpec{Installs: tools},
+			}
+			jobTaskSpec.Steps = append(jobTaskSpec.Steps, toolInstallStep)
+			// init git clone step
+			gitStep := &commonmodels.StepTask{
+				Name:     build.ServiceName + "-git",
+				JobName:  jobTask.Name,
+				StepType: config.StepGit,
+				Spec:     step.StepGitSpec{Repos: renderRepos(build.Repos, buildInfo.Repos)},
+			}
+			jobTaskSpec.Steps = append(jobTaskSpec.Steps, gitStep)
 
-		// init psot build shell step
-		if buildInfo.PostBuild.Scripts != "" {
-			scripts := append([]string{dockerLoginCmd}, strings.Split(replaceWrapLine(buildInfo.PostBuild.Scripts), "\n")...)
+			// init shell step
+			dockerLoginCmd := `docker login -u "$DOCKER_REGISTRY_AK" -p "$DOCKER_REGISTRY_SK" "$DOCKER_REGISTRY_HOST" &> /dev/null`
+			scripts := append([]string{dockerLoginCmd}, strings.Split(replaceWrapLine(buildInfo.Scripts), "\n")...)
 			shellStep := &commonmodels.StepTask{
-				Name:     build.ServiceName + "-post-shell",
+				Name:     build.ServiceName + "-shell",
 				JobName:  jobTask.Name,
 				StepType: config.StepShell,
 				Spec: &step.StepShellSpec{
@@ -361,8 +277,103 @@ func (j *BuildJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 				},
 			}
 			jobTaskSpec.Steps = append(jobTaskSpec.Steps, shellStep)
+
+			// init docker build step
+			if buildInfo.PostBuild.DockerBuild != nil {
+				dockefileContent := ""
+				if buildInfo.PostBuild.DockerBuild.TemplateID != "" {
+					if dockerfileDetail, err := templ.GetDockerfileTemplateDetail(buildInfo.PostBuild.DockerBuild.TemplateID, logger); err == nil {
+						dockefileContent = dockerfileDetail.Content
+					}
+				}
+
+				dockerBuildStep := &commonmodels.StepTask{
+					Name:     build.ServiceName + "-docker-build",
+					JobName:  jobTask.Name,
+					StepType: config.StepDockerBuild,
+					Spec: step.StepDockerBuildSpec{
+						Source:                buildInfo.PostBuild.DockerBuild.Source,
+						WorkDir:               buildInfo.PostBuild.DockerBuild.WorkDir,
+						DockerFile:            buildInfo.PostBuild.DockerBuild.DockerFile,
+						ImageName:             cellBuild.Image,
+						ImageReleaseTag:       imageTag,
+						BuildArgs:             buildInfo.PostBuild.DockerBuild.BuildArgs,
+						DockerTemplateContent: dockefileContent,
+						DockerRegistry: &step.DockerRegistry{
+							DockerRegistryID: j.spec.DockerRegistryID,
+							Host:             registry.RegAddr,
+							UserName:         registry.AccessKey,
+							Password:         registry.SecretKey,
+							Namespace:        registry.Namespace,
+						},
+					},
+				}
+				jobTaskSpec.Steps = append(jobTaskSpec.Steps, dockerBuildStep)
+			}
+
+			// init archive step
+			if buildInfo.PostBuild.FileArchive != nil && buildInfo.PostBuild.FileArchive.FileLocation != "" {
+				uploads := []*step.Upload{
+					{
+						FilePath:        path.Join(buildInfo.PostBuild.FileArchive.FileLocation, cellBuild.Package),
+						DestinationPath: path.Join(j.workflow.Name, fmt.Sprint(taskID), jobTask.Name, "archive"),
+					},
+				}
+				archiveStep := &commonmodels.StepTask{
+					Name:     build.ServiceName + "-archive",
+					JobName:  jobTask.Name,
+					StepType: config.StepArchive,
+					Spec: step.StepArchiveSpec{
+						UploadDetail: uploads,
+						S3:           modelS3toS3(defaultS3),
+					},
+				}
+				jobTaskSpec.Steps = append(jobTaskSpec.Steps, archiveStep)
+			}
+
+			// init object storage step
+			if buildInfo.PostBuild.ObjectStorageUpload != nil && buildInfo.PostBuild.ObjectStorageUpload.Enabled {
+				modelS3, err := commonrepo.NewS3StorageColl().Find(buildInfo.PostBuild.ObjectStorageUpload.ObjectStorageID)
+				if err != nil {
+					return resp, err
+				}
+				s3 := modelS3toS3(modelS3)
+				s3.Subfolder = ""
+				uploads := []*step.Upload{}
+				archiveStep := &commonmodels.StepTask{
+					Name:     build.ServiceName + "-object-storage",
+					JobName:  jobTask.Name,
+					StepType: config.StepArchive,
+					Spec: step.StepArchiveSpec{
+						UploadDetail:    uploads,
+						ObjectStorageID: buildInfo.PostBuild.ObjectStorageUpload.ObjectStorageID,
+						S3:              s3,
+					},
+				}
+				for _, detail := range buildInfo.PostBuild.ObjectStorageUpload.UploadDetail {
+					uploads = append(uploads, &step.Upload{
+						FilePath:        detail.FilePath,
+						DestinationPath: detail.DestinationPath,
+					})
+				}
+				jobTaskSpec.Steps = append(jobTaskSpec.Steps, archiveStep)
+			}
+
+			// init psot build shell step
+			if buildInfo.PostBuild.Scripts != "" {
+				scripts := append([]string{dockerLoginCmd}, strings.Split(replaceWrapLine(buildInfo.PostBuild.Scripts), "\n")...)
+				shellStep := &commonmodels.StepTask{
+					Name:     build.ServiceName + "-post-shell",
+					JobName:  jobTask.Name,
+					StepType: config.StepShell,
+					Spec: &step.StepShellSpec{
+						Scripts: scripts,
+					},
+				}
+				jobTaskSpec.Steps = append(jobTaskSpec.Steps, shellStep)
+			}
+			resp = append(resp, jobTask)
 		}
-		resp = append(resp, jobTask)
 	}
 	j.job.Spec = j.spec
 	return resp, nil
@@ -516,5 +527,18 @@ func mergeRepos(templateRepos []*types.Repository, customRepos []*types.Reposito
 }
 
 func (j *BuildJob) LintJob() error {
+	j.spec = &commonmodels.ZadigBuildJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	if err := lintMatrix(j.spec.Matrix); err != nil {
+		return err
+	}
+	for _, build := range j.spec.ServiceAndBuilds {
+		jobName := jobNameFormat(build.ServiceName + "-" + build.ServiceModule + "-" + j.job.Name)
+		if err := lintMatrixJobNames(j.workflow, j.job.Name, jobName, j.spec.Matrix); err != nil {
+			return err
+		}
+	}
 	return nil
 }
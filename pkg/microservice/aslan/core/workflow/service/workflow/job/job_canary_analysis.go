@@ -0,0 +1,265 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+// defaultAnalysisInterval is used when the interval of canary analysis is not set, unit is second.
+const defaultAnalysisInterval = 60
+
+type CanaryAnalysisJob struct {
+	job      *commonmodels.Job
+	workflow *commonmodels.WorkflowV4
+	spec     *commonmodels.CanaryAnalysisJobSpec
+}
+
+func (j *CanaryAnalysisJob) Instantiate() error {
+	j.spec = &commonmodels.CanaryAnalysisJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	j.job.Spec = j.spec
+	return nil
+}
+
+func (j *CanaryAnalysisJob) SetPreset() error {
+	j.spec = &commonmodels.CanaryAnalysisJobSpec{}
+	if err := commonmodels.IToi(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	j.job.Spec = j.spec
+	return nil
+}
+
+func (j *CanaryAnalysisJob) MergeArgs(args *commonmodels.Job) error {
+	return nil
+}
+
+func (j *CanaryAnalysisJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
+	resp := []*commonmodels.JobTask{}
+	j.spec = &commonmodels.CanaryAnalysisJobSpec{}
+	if err := commonmodels.IToi(j.job.Spec, j.spec); err != nil {
+		return resp, err
+	}
+	j.job.Spec = j.spec
+
+	rollbackTargets := []*commonmodels.AnalysisRollbackTarget{}
+	if j.spec.FromJob != "" {
+		var err error
+		if rollbackTargets, err = j.getRollbackTargets(); err != nil {
+			return resp, err
+		}
+	}
+	prometheusToken := j.spec.PrometheusToken
+	// the token is masked in the workflow args from the users, use the saved one instead.
+	if prometheusToken == setting.MaskValue {
+		var err error
+		if prometheusToken, err = savedPrometheusToken(j.workflow.Name, j.job.Name); err != nil {
+			return resp, err
+		}
+	}
+	interval := j.spec.Interval
+	if interval == 0 {
+		interval = defaultAnalysisInterval
+	}
+	resp = append(resp, &commonmodels.JobTask{
+		Name:    jobNameFormat(j.job.Name),
+		JobType: string(config.JobCanaryAnalysis),
+		Spec: &commonmodels.JobTaskCanaryAnalysisSpec{
+			PrometheusAddress: j.spec.PrometheusAddress,
+			PrometheusToken:   prometheusToken,
+			Metrics:           j.spec.Metrics,
+			Interval:          interval,
+			Count:             j.spec.Count,
+			FailureLimit:      j.spec.FailureLimit,
+			Rollback:          j.spec.Rollback,
+			RollbackTargets:   rollbackTargets,
+		},
+	})
+	return resp, nil
+}
+
+// getRollbackTargets collects the deployments created by the quoted job, whose workloads
+// were resolved when the quoted job was converted into job tasks.
+func (j *CanaryAnalysisJob) getRollbackTargets() ([]*commonmodels.AnalysisRollbackTarget, error) {
+	resp := []*commonmodels.AnalysisRollbackTarget{}
+	fromJob := findJob(j.workflow, j.spec.FromJob)
+	if fromJob == nil {
+		return resp, fmt.Errorf("no job: %s found, please check workflow configuration", j.spec.FromJob)
+	}
+	switch fromJob.JobType {
+	case config.JobK8sCanaryDeploy:
+		spec := &commonmodels.CanaryDeployJobSpec{}
+		if err := commonmodels.IToi(fromJob.Spec, spec); err != nil {
+			return resp, err
+		}
+		for _, target := range spec.Targets {
+			resp = append(resp, &commonmodels.AnalysisRollbackTarget{
+				JobType:        string(fromJob.JobType),
+				ClusterID:      spec.ClusterID,
+				Namespace:      spec.Namespace,
+				K8sServiceName: target.K8sServiceName,
+				WorkloadType:   target.WorkloadType,
+				WorkloadName:   target.WorkloadName,
+			})
+		}
+	case config.JobK8sBlueGreenDeploy:
+		spec := &commonmodels.BlueGreenDeployJobSpec{}
+		if err := commonmodels.IToi(fromJob.Spec, spec); err != nil {
+			return resp, err
+		}
+		for _, target := range spec.Targets {
+			resp = append(resp, &commonmodels.AnalysisRollbackTarget{
+				JobType:            string(fromJob.JobType),
+				ClusterID:          spec.ClusterID,
+				Namespace:          spec.Namespace,
+				K8sServiceName:     target.K8sServiceName,
+				WorkloadType:       target.WorkloadType,
+				WorkloadName:       target.WorkloadName,
+				BlueK8sServiceName: target.BlueK8sServiceName,
+				BlueWorkloadName:   target.BlueWorkloadName,
+			})
+		}
+	case config.JobIstioCanary:
+		spec, err := findIstioCanaryJobSpec(j.workflow, fromJob.Name)
+		if err != nil {
+			return resp, err
+		}
+		// the continued canary rolls back the one started by the first job.
+		for spec.FromJob != "" {
+			if spec, err = findIstioCanaryJobSpec(j.workflow, spec.FromJob); err != nil {
+				return resp, err
+			}
+		}
+		for _, target := range spec.Targets {
+			resp = append(resp, &commonmodels.AnalysisRollbackTarget{
+				JobType:        string(fromJob.JobType),
+				ClusterID:      spec.ClusterID,
+				Namespace:      spec.Namespace,
+				K8sServiceName: target.K8sServiceName,
+				WorkloadName:   target.WorkloadName,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// savedPrometheusToken returns the prometheus token of the canary analysis job, or of the health check of the deploy job
+// in the saved workflow.
+func savedPrometheusToken(workflowName, jobName string) (string, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		return "", fmt.Errorf("find workflow %s error: %v", workflowName, err)
+	}
+	job := findJob(workflow, jobName)
+	if job == nil {
+		return "", fmt.Errorf("job %s not found in workflow %s", jobName, workflowName)
+	}
+	switch job.JobType {
+	case config.JobCanaryAnalysis:
+		spec := &commonmodels.CanaryAnalysisJobSpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil {
+			return "", err
+		}
+		return spec.PrometheusToken, nil
+	case config.JobZadigDeploy:
+		spec := &commonmodels.ZadigDeployJobSpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil {
+			return "", err
+		}
+		if spec.HealthCheck == nil {
+			return "", nil
+		}
+		return spec.HealthCheck.PrometheusToken, nil
+	default:
+		return "", fmt.Errorf("job %s in workflow %s has no prometheus token", jobName, workflowName)
+	}
+}
+
+func findJob(workflow *commonmodels.WorkflowV4, jobName string) *commonmodels.Job {
+	for _, stage := range workflow.Stages {
+		for _, job := range stage.Jobs {
+			if job.Name == jobName {
+				return job
+			}
+		}
+	}
+	return nil
+}
+
+func (j *CanaryAnalysisJob) LintJob() error {
+	j.spec = &commonmodels.CanaryAnalysisJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	if len(j.spec.Metrics) == 0 {
+		return fmt.Errorf("at least one metric is required")
+	}
+	if err := lintAnalysisMetrics(j.spec.PrometheusAddress, j.spec.Metrics); err != nil {
+		return err
+	}
+	if j.spec.Count <= 0 {
+		return fmt.Errorf("count of measurements should be positive")
+	}
+	if j.spec.Interval < 0 || j.spec.FailureLimit < 0 {
+		return fmt.Errorf("interval and failure limit should not be negative")
+	}
+
+	if j.spec.FromJob == "" {
+		if j.spec.Rollback {
+			return fmt.Errorf("the job to roll back is required")
+		}
+		return nil
+	}
+	jobRankMap := getJobRankMap(j.workflow.Stages)
+	fromJobRank, ok := jobRankMap[j.spec.FromJob]
+	if !ok || fromJobRank >= jobRankMap[j.job.Name] {
+		return fmt.Errorf("can not quote job %s in job %s", j.spec.FromJob, j.job.Name)
+	}
+	switch findJob(j.workflow, j.spec.FromJob).JobType {
+	case config.JobK8sCanaryDeploy, config.JobK8sBlueGreenDeploy, config.JobIstioCanary:
+	default:
+		return fmt.Errorf("job %s should be one of canary deploy, blue-green deploy and istio canary job", j.spec.FromJob)
+	}
+	return nil
+}
+
+// lintAnalysisMetrics checks the prometheus address and the metrics measured by it.
+func lintAnalysisMetrics(prometheusAddress string, metrics []*commonmodels.AnalysisMetric) error {
+	if u, err := url.Parse(prometheusAddress); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid prometheus address: %s", prometheusAddress)
+	}
+	for _, metric := range metrics {
+		if metric.Name == "" || metric.Query == "" {
+			return fmt.Errorf("metric name and query should not be empty")
+		}
+		switch metric.Condition {
+		case config.AnalysisConditionLT, config.AnalysisConditionLTE, config.AnalysisConditionGT, config.AnalysisConditionGTE:
+		default:
+			return fmt.Errorf("metric %s: condition should be one of lt, lte, gt and gte", metric.Name)
+		}
+	}
+	return nil
+}
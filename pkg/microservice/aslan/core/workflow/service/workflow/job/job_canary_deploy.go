@@ -23,9 +23,7 @@ import (
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
-	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
-	"github.com/koderover/zadig/pkg/tool/kube/getter"
 	"github.com/koderover/zadig/pkg/tool/log"
 	"k8s.io/apimachinery/pkg/labels"
 )
@@ -65,6 +63,7 @@ func (j *CanaryDeployJob) MergeArgs(args *commonmodels.Job) error {
 		if err := commonmodels.IToi(args.Spec, argsSpec); err != nil {
 			return err
 		}
+		j.spec.Env = argsSpec.Env
 		j.spec.Targets = argsSpec.Targets
 		j.job.Spec = j.spec
 	}
@@ -80,6 +79,15 @@ func (j *CanaryDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error)
 		return resp, err
 	}
 
+	if j.spec.Env != "" {
+		env, err := getDeployEnv(j.workflow.Project, j.spec.Env, canaryDeployJobType)
+		if err != nil {
+			logger.Error(err)
+			return resp, err
+		}
+		j.spec.ClusterID, j.spec.Namespace = env.ClusterID, env.Namespace
+	}
+
 	kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), j.spec.ClusterID)
 	if err != nil {
 		logger.Errorf("Failed to get kube client, err: %v", err)
@@ -87,38 +95,30 @@ func (j *CanaryDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error)
 	}
 
 	for _, target := range j.spec.Targets {
-		service, exist, err := getter.GetService(j.spec.Namespace, target.K8sServiceName, kubeClient)
-		if err != nil || !exist {
-			msg := fmt.Sprintf("Failed to get service, err: %v", err)
-			logger.Error(msg)
-			return resp, errors.New(msg)
+		service, err := getTargetService(j.spec.Namespace, target.K8sServiceName, kubeClient)
+		if err != nil {
+			logger.Error(err)
+			return resp, err
 		}
+		target.K8sServiceName = service.Name
 		if service.Spec.ClusterIP == "None" {
-			msg := fmt.Sprintf("service :%s was a headless service, which canry deployment do not suppoort", err)
+			msg := fmt.Sprintf("service :%s was a headless service, which canry deployment do not suppoort", service.Name)
 			logger.Error(msg)
 			return resp, errors.New(msg)
 		}
 		selector := labels.Set(service.Spec.Selector).AsSelector()
-		deployments, err := getter.ListDeployments(j.spec.Namespace, selector, kubeClient)
+		workload, err := findServiceWorkload(j.spec.Namespace, selector, kubeClient)
 		if err != nil {
-			msg := fmt.Sprintf("list deployments error: %v", err)
-			logger.Error(msg)
-			return resp, errors.New(msg)
+			logger.Error(err)
+			return resp, err
 		}
-		if len(deployments) == 0 {
-			msg := "no deployment found"
-			logger.Error(msg)
-			return resp, errors.New(msg)
-		}
-		if len(deployments) > 1 {
-			msg := "more than one deployment found"
-			logger.Error(msg)
-			return resp, errors.New(msg)
+		if err := lintHelmWorkload(workload, canaryDeployJobType); err != nil {
+			logger.Error(err)
+			return resp, err
 		}
-		deployment := deployments[0]
-		target.WorkloadName = deployment.Name
-		target.WorkloadType = setting.Deployment
-		canaryReplica := math.Ceil(float64(*deployment.Spec.Replicas) * (float64(target.CanaryPercentage) / 100))
+		target.WorkloadName = workload.Name
+		target.WorkloadType = workload.Type
+		canaryReplica := math.Ceil(float64(workload.Replicas) * (float64(target.CanaryPercentage) / 100))
 		task := &commonmodels.JobTask{
 			Name:    jobNameFormat(j.job.Name + "-" + target.K8sServiceName),
 			JobType: string(config.JobK8sCanaryDeploy),
@@ -128,8 +128,8 @@ func (j *CanaryDeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error)
 				DockerRegistryID: j.spec.DockerRegistryID,
 				DeployTimeout:    target.DeployTimeout,
 				K8sServiceName:   target.K8sServiceName,
-				WorkloadType:     setting.Deployment,
-				WorkloadName:     deployment.Name,
+				WorkloadType:     workload.Type,
+				WorkloadName:     workload.Name,
 				ContainerName:    target.ContainerName,
 				CanaryPercentage: target.CanaryPercentage,
 				CanaryReplica:    int(canaryReplica),
@@ -148,6 +148,11 @@ func (j *CanaryDeployJob) LintJob() error {
 	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
 		return err
 	}
+	for _, target := range j.spec.Targets {
+		if target.K8sServiceName == "" {
+			return fmt.Errorf("k8s service name should not be empty")
+		}
+	}
 	quoteJobs := []*commonmodels.Job{}
 	for _, stage := range j.workflow.Stages {
 		for _, job := range stage.Jobs {
@@ -18,11 +18,15 @@ package job
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
 	templaterepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb/template"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/kube"
 	"github.com/koderover/zadig/pkg/setting"
 	"github.com/koderover/zadig/pkg/util"
 )
@@ -103,6 +107,17 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 
 	productServiceMap := product.GetServiceMap()
 
+	prometheusToken := ""
+	if j.spec.HealthCheck != nil {
+		prometheusToken = j.spec.HealthCheck.PrometheusToken
+		// the token is masked in the workflow args from the users, use the saved one instead.
+		if prometheusToken == setting.MaskValue {
+			if prometheusToken, err = savedPrometheusToken(j.workflow.Name, j.job.Name); err != nil {
+				return resp, err
+			}
+		}
+	}
+
 	if project.ProductFeature != nil && project.ProductFeature.CreateEnvType == setting.SourceFromExternal {
 		productServices, err := commonrepo.NewServiceColl().ListExternalWorkloadsBy(j.workflow.Project, j.spec.Env)
 		if err != nil {
@@ -153,6 +168,10 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 			if err := checkServiceExsistsInEnv(productServiceMap, deploy.ServiceName, j.spec.Env); err != nil {
 				return resp, err
 			}
+			healthCheck, err := renderHealthCheck(j.spec.HealthCheck, prometheusToken, product, deploy.ServiceName)
+			if err != nil {
+				return resp, err
+			}
 			jobTaskSpec := &commonmodels.JobTaskDeploySpec{
 				Env:                j.spec.Env,
 				SkipCheckRunStatus: j.spec.SkipCheckRunStatus,
@@ -161,6 +180,7 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 				ServiceModule:      deploy.ServiceModule,
 				ClusterID:          product.ClusterID,
 				Image:              deploy.Image,
+				HealthCheck:        healthCheck,
 			}
 			jobTask := &commonmodels.JobTask{
 				Name:    jobNameFormat(deploy.ServiceName + "-" + deploy.ServiceModule + "-" + j.job.Name),
@@ -190,6 +210,10 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 				return nil, fmt.Errorf("failed to find service: %s with revision: %d, err: %s", serviceName, serviceRevision, err)
 			}
 			releaseName := util.GeneReleaseName(revisionSvc.GetReleaseNaming(), product.ProductName, product.Namespace, product.EnvName, serviceName)
+			healthCheck, err := renderHealthCheck(j.spec.HealthCheck, prometheusToken, product, serviceName)
+			if err != nil {
+				return resp, err
+			}
 
 			jobTaskSpec := &commonmodels.JobTaskHelmDeploySpec{
 				Env:                j.spec.Env,
@@ -198,6 +222,7 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 				ServiceType:        setting.HelmDeployType,
 				ClusterID:          product.ClusterID,
 				ReleaseName:        releaseName,
+				HealthCheck:        healthCheck,
 			}
 			for _, deploy := range deploys {
 				if err := checkServiceExsistsInEnv(productServiceMap, serviceName, j.spec.Env); err != nil {
@@ -221,6 +246,41 @@ func (j *DeployJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 	return resp, nil
 }
 
+// renderHealthCheck returns the health check of the service deployed in the env, $Namespace$, $EnvName$, $Product$
+// and $Service$ in the urls of the http probes are replaced, so every service is probed by its own urls.
+// The probes are sent by aslan, so the urls only resolved in the cluster are rejected for the envs in the other clusters.
+func renderHealthCheck(check *commonmodels.DeployHealthCheck, prometheusToken string, product *commonmodels.Product, serviceName string) (*commonmodels.DeployHealthCheck, error) {
+	if check == nil {
+		return nil, nil
+	}
+	localCluster := product.ClusterID == "" || product.ClusterID == setting.LocalClusterID
+	resp := *check
+	resp.PrometheusToken = prometheusToken
+	resp.HTTPProbes = make([]*commonmodels.HTTPProbe, 0, len(check.HTTPProbes))
+	for _, probe := range check.HTTPProbes {
+		newProbe := *probe
+		newProbe.URL = kube.ParseSysKeys(product.Namespace, product.EnvName, product.ProductName, serviceName, probe.URL)
+		if !localCluster && clusterLocalURL(newProbe.URL) {
+			return nil, fmt.Errorf("http probe %s: %s can only be reached in the cluster of env %s, please use an address exposed out of the cluster", probe.Name, newProbe.URL, product.EnvName)
+		}
+		resp.HTTPProbes = append(resp.HTTPProbes, &newProbe)
+	}
+	return &resp, nil
+}
+
+// clusterLocalURL reports whether the host of the url is only resolved in the cluster, such as the names of the k8s services.
+func clusterLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	return !strings.Contains(host, ".") || strings.HasSuffix(host, ".svc") || strings.HasSuffix(host, ".cluster.local")
+}
+
 func checkServiceExsistsInEnv(serviceMap map[string]*commonmodels.ProductService, serviceName, env string) error {
 	if _, ok := serviceMap[serviceName]; !ok {
 		return fmt.Errorf("service %s not exists in env %s", serviceName, env)
@@ -233,6 +293,9 @@ func (j *DeployJob) LintJob() error {
 	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
 		return err
 	}
+	if err := lintHealthCheck(j.spec.HealthCheck); err != nil {
+		return err
+	}
 	if j.spec.Source != config.SourceFromJob {
 		return nil
 	}
@@ -241,5 +304,49 @@ func (j *DeployJob) LintJob() error {
 	if !ok || buildJobRank >= jobRankMap[j.job.Name] {
 		return fmt.Errorf("can not quote job %s in job %s", j.spec.JobName, j.job.Name)
 	}
+	// every cell of a matrix build pushes its own image, there is no single image to deploy.
+	for _, stage := range j.workflow.Stages {
+		for _, job := range stage.Jobs {
+			if job.JobType != config.JobZadigBuild || job.Name != j.spec.JobName {
+				continue
+			}
+			buildSpec := &commonmodels.ZadigBuildJobSpec{}
+			if err := commonmodels.IToiYaml(job.Spec, buildSpec); err != nil {
+				return err
+			}
+			if len(buildSpec.Matrix) > 0 {
+				return fmt.Errorf("can not quote matrix build job %s in deploy job %s", j.spec.JobName, j.job.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func lintHealthCheck(check *commonmodels.DeployHealthCheck) error {
+	if check == nil {
+		return nil
+	}
+	if check.Window < 0 || check.Interval < 0 {
+		return fmt.Errorf("window and interval of health check should not be negative")
+	}
+	if len(check.HTTPProbes)+len(check.Scripts)+len(check.Metrics) == 0 {
+		return fmt.Errorf("at least one http probe, script or metric is required in health check")
+	}
+	for _, probe := range check.HTTPProbes {
+		if probe.Name == "" {
+			return fmt.Errorf("http probe name should not be empty")
+		}
+		if u, err := url.Parse(probe.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("http probe %s: invalid url: %s", probe.Name, probe.URL)
+		}
+	}
+	for _, script := range check.Scripts {
+		if script.Name == "" || script.Image == "" || script.Script == "" {
+			return fmt.Errorf("script name, image and content should not be empty")
+		}
+	}
+	if len(check.Metrics) > 0 {
+		return lintAnalysisMetrics(check.PrometheusAddress, check.Metrics)
+	}
 	return nil
 }
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing deploy job", func() {
+
+	Context("lintHealthCheck", func() {
+		newCheck := func() *commonmodels.DeployHealthCheck {
+			return &commonmodels.DeployHealthCheck{
+				Window:   60,
+				Interval: 5,
+				HTTPProbes: []*commonmodels.HTTPProbe{
+					{Name: "healthz", URL: "http://$Service$.$Namespace$.svc:8080/healthz"},
+				},
+				Scripts: []*commonmodels.HealthCheckScript{
+					{Name: "smoke", Image: "curlimages/curl", Script: "curl -f http://$SERVICE_NAME/"},
+				},
+				PrometheusAddress: "http://prometheus:9090",
+				Metrics: []*commonmodels.AnalysisMetric{
+					{Name: "error rate", Query: "sum(rate(errors[1m]))", Condition: config.AnalysisConditionLT, Threshold: 1},
+				},
+			}
+		}
+
+		It("should pass without health check", func() {
+			Expect(lintHealthCheck(nil)).To(Succeed())
+		})
+		It("should pass with the urls of the placeholders", func() {
+			Expect(lintHealthCheck(newCheck())).To(Succeed())
+		})
+		It("should reject negative window and interval", func() {
+			check := newCheck()
+			check.Interval = -1
+			Expect(lintHealthCheck(check)).To(MatchError("window and interval of health check should not be negative"))
+		})
+		It("should require at least one check", func() {
+			Expect(lintHealthCheck(&commonmodels.DeployHealthCheck{})).To(MatchError("at least one http probe, script or metric is required in health check"))
+		})
+		It("should reject the probes without name or with invalid urls", func() {
+			check := newCheck()
+			check.HTTPProbes[0].Name = ""
+			Expect(lintHealthCheck(check)).To(MatchError("http probe name should not be empty"))
+
+			check = newCheck()
+			check.HTTPProbes[0].URL = "tcp://web:8080"
+			Expect(lintHealthCheck(check)).To(MatchError("http probe healthz: invalid url: tcp://web:8080"))
+		})
+		It("should reject incomplete scripts", func() {
+			check := newCheck()
+			check.Scripts[0].Image = ""
+			Expect(lintHealthCheck(check)).To(MatchError("script name, image and content should not be empty"))
+		})
+		It("should check the metrics with the prometheus address", func() {
+			check := newCheck()
+			check.PrometheusAddress = "prometheus"
+			Expect(lintHealthCheck(check)).To(MatchError("invalid prometheus address: prometheus"))
+
+			check = newCheck()
+			check.Metrics[0].Condition = "eq"
+			Expect(lintHealthCheck(check)).To(MatchError("metric error rate: condition should be one of lt, lte, gt and gte"))
+		})
+	})
+
+	Context("renderHealthCheck", func() {
+		product := &commonmodels.Product{ProductName: "project", EnvName: "dev", Namespace: "project-env-dev"}
+
+		It("should return nil without health check", func() {
+			check, err := renderHealthCheck(nil, "", product, "web")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check).To(BeNil())
+		})
+		It("should render the urls for every service with the token", func() {
+			check := &commonmodels.DeployHealthCheck{
+				Window:          60,
+				PrometheusToken: "***",
+				HTTPProbes: []*commonmodels.HTTPProbe{
+					{Name: "healthz", URL: "http://$Service$.$Namespace$.svc:8080/healthz?env=$EnvName$&project=$Product$"},
+				},
+			}
+			web, err := renderHealthCheck(check, "secret", product, "web")
+			Expect(err).NotTo(HaveOccurred())
+			api, err := renderHealthCheck(check, "secret", product, "api")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(web.HTTPProbes[0].URL).To(Equal("http://web.project-env-dev.svc:8080/healthz?env=dev&project=project"))
+			Expect(api.HTTPProbes[0].URL).To(Equal("http://api.project-env-dev.svc:8080/healthz?env=dev&project=project"))
+			Expect(web.PrometheusToken).To(Equal("secret"))
+			Expect(web.Window).To(Equal(int64(60)))
+			Expect(check.HTTPProbes[0].URL).To(Equal("http://$Service$.$Namespace$.svc:8080/healthz?env=$EnvName$&project=$Product$"))
+			Expect(check.PrometheusToken).To(Equal("***"))
+		})
+		It("should reject the urls in the cluster for the envs in the other clusters", func() {
+			check := &commonmodels.DeployHealthCheck{HTTPProbes: []*commonmodels.HTTPProbe{
+				{Name: "healthz", URL: "http://$Service$.$Namespace$.svc:8080/healthz"},
+			}}
+			remote := &commonmodels.Product{ProductName: "project", EnvName: "prod", Namespace: "project-env-prod", ClusterID: "remote"}
+			_, err := renderHealthCheck(check, "", remote, "web")
+			Expect(err).To(HaveOccurred())
+
+			local := *remote
+			local.ClusterID = setting.LocalClusterID
+			_, err = renderHealthCheck(check, "", &local, "web")
+			Expect(err).NotTo(HaveOccurred())
+
+			check.HTTPProbes[0].URL = "https://web.example.com/healthz"
+			_, err = renderHealthCheck(check, "", remote, "web")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("clusterLocalURL", func() {
+		It("should take the k8s service names as in the cluster", func() {
+			Expect(clusterLocalURL("http://web:8080/healthz")).To(BeTrue())
+			Expect(clusterLocalURL("http://web.dev.svc:8080/healthz")).To(BeTrue())
+			Expect(clusterLocalURL("http://web.dev.svc.cluster.local/healthz")).To(BeTrue())
+		})
+		It("should take the domains and ips as out of the cluster", func() {
+			Expect(clusterLocalURL("https://web.example.com/healthz")).To(BeFalse())
+			Expect(clusterLocalURL("http://10.0.0.1:8080/healthz")).To(BeFalse())
+			Expect(clusterLocalURL("http://[::1]:8080/healthz")).To(BeFalse())
+		})
+	})
+})
@@ -26,6 +26,7 @@ import (
 	commonservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
 	"github.com/koderover/zadig/pkg/tool/log"
 	"github.com/koderover/zadig/pkg/types"
+	jobtypes "github.com/koderover/zadig/pkg/types/job"
 	steptypes "github.com/koderover/zadig/pkg/types/step"
 )
 
@@ -172,30 +173,41 @@ func (j *FreeStyleJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 		return resp, err
 	}
 	j.job.Spec = j.spec
-	jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{
-		Properties: *j.spec.Properties,
-		Steps:      stepsToStepTasks(j.spec.Steps),
-	}
-	jobTask := &commonmodels.JobTask{
-		Name:    j.job.Name,
-		JobType: string(config.JobFreestyle),
-		Spec:    jobTaskSpec,
-		Timeout: j.spec.Properties.Timeout,
-	}
 	registries, err := commonservice.ListRegistryNamespaces("", true, logger)
 	if err != nil {
 		return resp, err
 	}
-	jobTaskSpec.Properties.Registries = registries
-	basicImage, err := commonrepo.NewBasicImageColl().Find(jobTaskSpec.Properties.ImageID)
+	basicImage, err := commonrepo.NewBasicImageColl().Find(j.spec.Properties.ImageID)
 	if err != nil {
 		return resp, err
 	}
-	jobTaskSpec.Properties.BuildOS = basicImage.Value
-	// save user defined variables.
-	jobTaskSpec.Properties.CustomEnvs = jobTaskSpec.Properties.Envs
-	jobTaskSpec.Properties.Envs = append(jobTaskSpec.Properties.Envs, getfreestyleJobVariables(jobTaskSpec.Steps, taskID, j.workflow.Project, j.workflow.Name)...)
-	return []*commonmodels.JobTask{jobTask}, nil
+	// fan out into one job task for each cell of the matrix.
+	for _, cell := range expandMatrix(j.spec.Matrix) {
+		jobTaskSpec := &commonmodels.JobTaskFreestyleSpec{
+			Properties: *j.spec.Properties,
+			Steps:      stepsToStepTasks(j.spec.Steps),
+		}
+		jobTask := &commonmodels.JobTask{
+			Name:    matrixJobName(j.job.Name, j.spec.Matrix, cell),
+			JobType: string(config.JobFreestyle),
+			Spec:    jobTaskSpec,
+			Timeout: j.spec.Properties.Timeout,
+			Retry:   j.spec.Properties.Retry,
+			Outputs: j.spec.Outputs,
+		}
+		if len(j.spec.Matrix) > 0 {
+			jobTask.Matrix = cell
+		}
+		jobTaskSpec.Properties.Registries = registries
+		jobTaskSpec.Properties.BuildOS = basicImage.Value
+		// save user defined variables.
+		jobTaskSpec.Properties.CustomEnvs = jobTaskSpec.Properties.Envs
+		envs := append([]*commonmodels.KeyVal{}, jobTaskSpec.Properties.Envs...)
+		envs = append(envs, matrixEnvs(j.spec.Matrix, cell)...)
+		jobTaskSpec.Properties.Envs = append(envs, getfreestyleJobVariables(jobTaskSpec.Steps, taskID, j.workflow.Project, j.workflow.Name)...)
+		resp = append(resp, jobTask)
+	}
+	return resp, nil
 }
 
 func stepsToStepTasks(step []*commonmodels.Step) []*commonmodels.StepTask {
@@ -205,6 +217,8 @@ func stepsToStepTasks(step []*commonmodels.Step) []*commonmodels.StepTask {
 		stepTask := &commonmodels.StepTask{
 			Name:     step.Name,
 			StepType: step.StepType,
+			RunIf:    step.RunIf,
+			Timeout:  step.Timeout,
 			Spec:     step.Spec,
 		}
 		if stepTask.StepType == config.StepDockerBuild {
@@ -257,5 +271,29 @@ func getfreestyleJobVariables(steps []*commonmodels.StepTask, taskID int64, proj
 }
 
 func (j *FreeStyleJob) LintJob() error {
-	return nil
+	j.spec = &commonmodels.FreestyleJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	for _, step := range j.spec.Steps {
+		switch jobtypes.StepRunIf(step.RunIf) {
+		case "", jobtypes.StepRunIfSuccess, jobtypes.StepRunIfFailure, jobtypes.StepRunIfAlways:
+		default:
+			return fmt.Errorf("step %s: run_if should be one of success, failure and always", step.Name)
+		}
+		if step.Timeout < 0 {
+			return fmt.Errorf("step %s: timeout should not be negative", step.Name)
+		}
+	}
+	for _, output := range j.spec.Outputs {
+		switch jobtypes.OutputType(output.Type) {
+		case "", jobtypes.OutputTypeString, jobtypes.OutputTypeJSON, jobtypes.OutputTypeFile:
+		default:
+			return fmt.Errorf("output %s: type should be one of string, json and file", output.Name)
+		}
+	}
+	if err := lintMatrix(j.spec.Matrix); err != nil {
+		return err
+	}
+	return lintMatrixJobNames(j.workflow, j.job.Name, j.job.Name, j.spec.Matrix)
 }
@@ -0,0 +1,262 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+type IstioCanaryJob struct {
+	job      *commonmodels.Job
+	workflow *commonmodels.WorkflowV4
+	spec     *commonmodels.IstioCanaryJobSpec
+}
+
+func (j *IstioCanaryJob) Instantiate() error {
+	j.spec = &commonmodels.IstioCanaryJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	j.job.Spec = j.spec
+	return nil
+}
+
+func (j *IstioCanaryJob) SetPreset() error {
+	j.spec = &commonmodels.IstioCanaryJobSpec{}
+	if err := commonmodels.IToi(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	j.job.Spec = j.spec
+	return nil
+}
+
+func (j *IstioCanaryJob) MergeArgs(args *commonmodels.Job) error {
+	if j.job.Name == args.Name && j.job.JobType == args.JobType {
+		j.spec = &commonmodels.IstioCanaryJobSpec{}
+		if err := commonmodels.IToi(j.job.Spec, j.spec); err != nil {
+			return err
+		}
+		j.job.Spec = j.spec
+		argsSpec := &commonmodels.IstioCanaryJobSpec{}
+		if err := commonmodels.IToi(args.Spec, argsSpec); err != nil {
+			return err
+		}
+		// targets of the continued canary come from the quoted job.
+		if j.spec.FromJob == "" {
+			j.spec.Targets = argsSpec.Targets
+		}
+		j.job.Spec = j.spec
+	}
+	return nil
+}
+
+func (j *IstioCanaryJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
+	resp := []*commonmodels.JobTask{}
+	j.spec = &commonmodels.IstioCanaryJobSpec{}
+	if err := commonmodels.IToi(j.job.Spec, j.spec); err != nil {
+		return resp, err
+	}
+	j.job.Spec = j.spec
+
+	if j.spec.FromJob != "" {
+		return j.continuedJobs()
+	}
+
+	logger := log.SugaredLogger()
+	kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), j.spec.ClusterID)
+	if err != nil {
+		logger.Errorf("Failed to get kube client, err: %v", err)
+		return resp, err
+	}
+	for _, target := range j.spec.Targets {
+		service, exist, err := getter.GetService(j.spec.Namespace, target.K8sServiceName, kubeClient)
+		if err != nil || !exist {
+			msg := fmt.Sprintf("Failed to get service: %s, err: %v", target.K8sServiceName, err)
+			logger.Error(msg)
+			return resp, errors.New(msg)
+		}
+		selector := labels.Set(service.Spec.Selector).AsSelector()
+		deployments, err := getter.ListDeployments(j.spec.Namespace, selector, kubeClient)
+		if err != nil {
+			msg := fmt.Sprintf("list deployments error: %v", err)
+			logger.Error(msg)
+			return resp, errors.New(msg)
+		}
+		if len(deployments) != 1 {
+			msg := fmt.Sprintf("service %s should select exactly one deployment, found %d", target.K8sServiceName, len(deployments))
+			logger.Error(msg)
+			return resp, errors.New(msg)
+		}
+		target.WorkloadName = deployments[0].Name
+		target.WorkloadType = setting.Deployment
+		resp = append(resp, &commonmodels.JobTask{
+			Name:    jobNameFormat(j.job.Name + "-" + target.K8sServiceName),
+			JobType: string(config.JobIstioCanary),
+			Spec: &commonmodels.JobTaskIstioCanarySpec{
+				ClusterID:      j.spec.ClusterID,
+				Namespace:      j.spec.Namespace,
+				K8sServiceName: target.K8sServiceName,
+				WorkloadType:   target.WorkloadType,
+				WorkloadName:   target.WorkloadName,
+				ContainerName:  target.ContainerName,
+				Image:          target.Image,
+				Steps:          j.spec.Steps,
+				Headers:        j.spec.Headers,
+				DeployTimeout:  j.spec.DeployTimeout,
+			},
+		})
+	}
+	return resp, nil
+}
+
+// continuedJobs shifts the traffic of the canaries started by the quoted job, the jobs
+// are in the same order as the workflow stages so the quoted job was converted already.
+func (j *IstioCanaryJob) continuedJobs() ([]*commonmodels.JobTask, error) {
+	resp := []*commonmodels.JobTask{}
+	fromJobSpec, err := findIstioCanaryJobSpec(j.workflow, j.spec.FromJob)
+	if err != nil {
+		return resp, err
+	}
+	for _, target := range fromJobSpec.Targets {
+		if target.WorkloadName == "" {
+			continue
+		}
+		resp = append(resp, &commonmodels.JobTask{
+			Name:    jobNameFormat(j.job.Name + "-" + target.K8sServiceName),
+			JobType: string(config.JobIstioCanary),
+			Spec: &commonmodels.JobTaskIstioCanarySpec{
+				ClusterID:      fromJobSpec.ClusterID,
+				Namespace:      fromJobSpec.Namespace,
+				K8sServiceName: target.K8sServiceName,
+				WorkloadType:   target.WorkloadType,
+				WorkloadName:   target.WorkloadName,
+				ContainerName:  target.ContainerName,
+				Image:          target.Image,
+				Continued:      true,
+				Steps:          j.spec.Steps,
+				Headers:        fromJobSpec.Headers,
+				DeployTimeout:  fromJobSpec.DeployTimeout,
+			},
+		})
+	}
+	return resp, nil
+}
+
+func findIstioCanaryJobSpec(workflow *commonmodels.WorkflowV4, jobName string) (*commonmodels.IstioCanaryJobSpec, error) {
+	for _, stage := range workflow.Stages {
+		for _, job := range stage.Jobs {
+			if job.JobType != config.JobIstioCanary || job.Name != jobName {
+				continue
+			}
+			spec := &commonmodels.IstioCanaryJobSpec{}
+			if err := commonmodels.IToi(job.Spec, spec); err != nil {
+				return nil, err
+			}
+			return spec, nil
+		}
+	}
+	return nil, fmt.Errorf("no istio canary job: %s found, please check workflow configuration", jobName)
+}
+
+func (j *IstioCanaryJob) LintJob() error {
+	j.spec = &commonmodels.IstioCanaryJobSpec{}
+	if err := commonmodels.IToiYaml(j.job.Spec, j.spec); err != nil {
+		return err
+	}
+	if err := lintIstioCanarySteps(j.spec.Steps); err != nil {
+		return err
+	}
+	for _, header := range j.spec.Headers {
+		if header.Key == "" {
+			return fmt.Errorf("header key should not be empty")
+		}
+		switch header.MatchType {
+		case "", config.IstioMatchExact, config.IstioMatchPrefix, config.IstioMatchRegex:
+		default:
+			return fmt.Errorf("header %s: match type should be one of exact, prefix and regex", header.Key)
+		}
+	}
+
+	jobRankMap := getJobRankMap(j.workflow.Stages)
+	if j.spec.FromJob != "" {
+		fromJobRank, ok := jobRankMap[j.spec.FromJob]
+		if !ok || fromJobRank >= jobRankMap[j.job.Name] {
+			return fmt.Errorf("can not quote job %s in job %s", j.spec.FromJob, j.job.Name)
+		}
+		fromJobSpec, err := findIstioCanaryJobSpec(j.workflow, j.spec.FromJob)
+		if err != nil {
+			return err
+		}
+		if len(fromJobSpec.Steps) > 0 && fromJobSpec.Steps[len(fromJobSpec.Steps)-1].Weight >= 100 {
+			return fmt.Errorf("canary of job %s is promoted already, can not be continued by job %s", j.spec.FromJob, j.job.Name)
+		}
+	}
+
+	quoteJobs := []string{}
+	for _, stage := range j.workflow.Stages {
+		for _, job := range stage.Jobs {
+			if job.JobType != config.JobIstioCanary || job.Name == j.job.Name {
+				continue
+			}
+			spec := &commonmodels.IstioCanaryJobSpec{}
+			if err := commonmodels.IToiYaml(job.Spec, spec); err != nil {
+				return err
+			}
+			if spec.FromJob == j.job.Name {
+				quoteJobs = append(quoteJobs, job.Name)
+			}
+		}
+	}
+	if len(quoteJobs) > 1 {
+		return fmt.Errorf("more than one istio canary job quote job %s", j.job.Name)
+	}
+	// the canary left behind would be rolled back when the workflow finished.
+	if len(quoteJobs) == 0 && j.spec.Steps[len(j.spec.Steps)-1].Weight != 100 {
+		return fmt.Errorf("the last step of job %s should route all traffic to the canary, or continue it in another job", j.job.Name)
+	}
+	return nil
+}
+
+func lintIstioCanarySteps(steps []*commonmodels.IstioCanaryStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	lastWeight := 0
+	for _, step := range steps {
+		if step.Weight <= 0 || step.Weight > 100 {
+			return fmt.Errorf("step weight %d should be in (0, 100]", step.Weight)
+		}
+		if step.Weight < lastWeight {
+			return fmt.Errorf("step weight should not decrease, got %d after %d", step.Weight, lastWeight)
+		}
+		if step.Pause < 0 {
+			return fmt.Errorf("step pause should not be negative")
+		}
+		lastWeight = step.Weight
+	}
+	return nil
+}
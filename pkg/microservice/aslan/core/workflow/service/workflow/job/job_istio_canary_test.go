@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing istio canary job", func() {
+
+	Context("lintIstioCanarySteps", func() {
+		It("should accept the increasing weights", func() {
+			steps := []*commonmodels.IstioCanaryStep{{Weight: 10, Pause: 5}, {Weight: 10}, {Weight: 100}}
+			Expect(lintIstioCanarySteps(steps)).NotTo(HaveOccurred())
+		})
+		It("should require at least one step", func() {
+			Expect(lintIstioCanarySteps(nil)).To(HaveOccurred())
+		})
+		It("should reject the weights out of range", func() {
+			Expect(lintIstioCanarySteps([]*commonmodels.IstioCanaryStep{{Weight: 0}})).To(HaveOccurred())
+			Expect(lintIstioCanarySteps([]*commonmodels.IstioCanaryStep{{Weight: 101}})).To(HaveOccurred())
+		})
+		It("should reject the decreasing weights", func() {
+			Expect(lintIstioCanarySteps([]*commonmodels.IstioCanaryStep{{Weight: 50}, {Weight: 20}})).To(HaveOccurred())
+		})
+		It("should reject the negative pause", func() {
+			Expect(lintIstioCanarySteps([]*commonmodels.IstioCanaryStep{{Weight: 50, Pause: -1}})).To(HaveOccurred())
+		})
+	})
+})
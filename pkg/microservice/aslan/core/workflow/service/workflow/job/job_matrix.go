@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+// maxMatrixCells limits the number of job tasks one job fans out into.
+const maxMatrixCells = 32
+
+var (
+	matrixNameRegx  = regexp.MustCompile("[^a-z0-9-]+")
+	matrixEnvKeyReg = regexp.MustCompile("[^A-Z0-9_]+")
+)
+
+// expandMatrix returns every combination of the matrix values, a job without matrix has a single empty cell.
+func expandMatrix(matrix []*commonmodels.MatrixAxis) []map[string]string {
+	cells := []map[string]string{{}}
+	for _, axis := range matrix {
+		next := make([]map[string]string, 0, len(cells)*len(axis.Values))
+		for _, cell := range cells {
+			for _, value := range axis.Values {
+				nextCell := make(map[string]string, len(cell)+1)
+				for k, v := range cell {
+					nextCell[k] = v
+				}
+				nextCell[axis.Name] = value
+				next = append(next, nextCell)
+			}
+		}
+		cells = next
+	}
+	return cells
+}
+
+// matrixJobName appends the values of the cell to the job name, so the outputs of every cell are named apart.
+func matrixJobName(jobName string, matrix []*commonmodels.MatrixAxis, cell map[string]string) string {
+	if len(matrix) == 0 {
+		return jobName
+	}
+	suffix := matrixSuffix(matrix, cell)
+	if len(jobName)+len(suffix)+1 > 63 && len(suffix) < 62 {
+		jobName = jobName[:62-len(suffix)]
+	}
+	return jobNameFormat(jobName + "-" + suffix)
+}
+
+// matrixSuffix joins the values of the cell, the result is safe to be used in job names and image tags.
+func matrixSuffix(matrix []*commonmodels.MatrixAxis, cell map[string]string) string {
+	values := []string{}
+	for _, axis := range matrix {
+		values = append(values, strings.Trim(matrixNameRegx.ReplaceAllString(strings.ToLower(cell[axis.Name]), "-"), "-"))
+	}
+	return strings.Join(values, "-")
+}
+
+// matrixServiceAndBuild appends the values of the cell to the image tag and package name of the build,
+// so the cells of a build job do not overwrite the artifacts of each other.
+func matrixServiceAndBuild(build *commonmodels.ServiceAndBuild, matrix []*commonmodels.MatrixAxis, cell map[string]string) *commonmodels.ServiceAndBuild {
+	if len(matrix) == 0 {
+		return build
+	}
+	suffix := matrixSuffix(matrix, cell)
+	cellBuild := *build
+	cellBuild.Image = fmt.Sprintf("%s-%s", build.Image, suffix)
+	cellBuild.Package = fmt.Sprintf("%s-%s.tar.gz", strings.TrimSuffix(build.Package, ".tar.gz"), suffix)
+	return &cellBuild
+}
+
+// matrixEnvs injects the values of the cell as env vars named MATRIX_<AXIS>.
+func matrixEnvs(matrix []*commonmodels.MatrixAxis, cell map[string]string) []*commonmodels.KeyVal {
+	resp := []*commonmodels.KeyVal{}
+	for _, axis := range matrix {
+		key := "MATRIX_" + matrixEnvKeyReg.ReplaceAllString(strings.ToUpper(axis.Name), "_")
+		resp = append(resp, &commonmodels.KeyVal{Key: key, Value: cell[axis.Name], IsCredential: false})
+	}
+	return resp
+}
+
+func lintMatrix(matrix []*commonmodels.MatrixAxis) error {
+	cellCount := 1
+	names := map[string]bool{}
+	for _, axis := range matrix {
+		if axis.Name == "" {
+			return fmt.Errorf("matrix name should not be empty")
+		}
+		if names[axis.Name] {
+			return fmt.Errorf("duplicated matrix name: %s", axis.Name)
+		}
+		names[axis.Name] = true
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("matrix %s should have at least one value", axis.Name)
+		}
+		cellCount *= len(axis.Values)
+		if cellCount > maxMatrixCells {
+			return fmt.Errorf("matrix should not expand into more than %d jobs", maxMatrixCells)
+		}
+	}
+
+	jobNames := map[string]bool{}
+	for _, cell := range expandMatrix(matrix) {
+		name := matrixJobName("", matrix, cell)
+		if jobNames[name] {
+			return fmt.Errorf("matrix values %v are duplicated after converted to job name", cell)
+		}
+		jobNames[name] = true
+	}
+	return nil
+}
+
+// lintMatrixJobNames makes sure the job names expanded from the matrix do not collide with the other jobs in the workflow.
+func lintMatrixJobNames(workflow *commonmodels.WorkflowV4, currentJobName, jobName string, matrix []*commonmodels.MatrixAxis) error {
+	if workflow == nil || len(matrix) == 0 {
+		return nil
+	}
+	jobNames := map[string]bool{}
+	for _, stage := range workflow.Stages {
+		for _, job := range stage.Jobs {
+			if job.Name != currentJobName {
+				jobNames[job.Name] = true
+			}
+		}
+	}
+	for _, cell := range expandMatrix(matrix) {
+		name := matrixJobName(jobName, matrix, cell)
+		if jobNames[name] {
+			return fmt.Errorf("job name %s expanded from matrix collides with an existing job", name)
+		}
+	}
+	return nil
+}
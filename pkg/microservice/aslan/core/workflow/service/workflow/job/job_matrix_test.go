@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing job matrix", func() {
+
+	matrix := []*commonmodels.MatrixAxis{
+		{Name: "os", Values: []string{"linux", "windows"}},
+		{Name: "arch", Values: []string{"amd64", "arm64", "386"}},
+	}
+
+	Context("expandMatrix", func() {
+		It("should return a single empty cell for no matrix", func() {
+			Expect(expandMatrix(nil)).To(Equal([]map[string]string{{}}))
+		})
+		It("should return every combination of the values", func() {
+			cells := expandMatrix(matrix)
+			Expect(cells).To(HaveLen(6))
+			Expect(cells[0]).To(Equal(map[string]string{"os": "linux", "arch": "amd64"}))
+			Expect(cells[5]).To(Equal(map[string]string{"os": "windows", "arch": "386"}))
+		})
+	})
+
+	Context("matrixJobName", func() {
+		It("should keep the job name for no matrix", func() {
+			Expect(matrixJobName("build", nil, map[string]string{})).To(Equal("build"))
+		})
+		It("should append the values of the cell", func() {
+			cell := map[string]string{"os": "Linux", "arch": "amd_64"}
+			Expect(matrixJobName("build", matrix, cell)).To(Equal("build-linux-amd-64"))
+		})
+		It("should truncate long job names", func() {
+			cell := map[string]string{"os": "linux", "arch": "amd64"}
+			name := matrixJobName(strings.Repeat("a", 63), matrix, cell)
+			Expect(len(name)).To(BeNumerically("<=", 63))
+			Expect(name).To(HaveSuffix("-linux-amd64"))
+		})
+	})
+
+	Context("lintMatrix", func() {
+		It("should be passed for valid matrix", func() {
+			Expect(lintMatrix(matrix)).ShouldNot(HaveOccurred())
+		})
+		It("should raise error for empty name", func() {
+			Expect(lintMatrix([]*commonmodels.MatrixAxis{{Values: []string{"a"}}})).Should(HaveOccurred())
+		})
+		It("should raise error for duplicated names", func() {
+			Expect(lintMatrix([]*commonmodels.MatrixAxis{
+				{Name: "os", Values: []string{"linux"}},
+				{Name: "os", Values: []string{"windows"}},
+			})).Should(HaveOccurred())
+		})
+		It("should raise error for empty values", func() {
+			Expect(lintMatrix([]*commonmodels.MatrixAxis{{Name: "os"}})).Should(HaveOccurred())
+		})
+		It("should raise error for too many cells", func() {
+			Expect(lintMatrix([]*commonmodels.MatrixAxis{
+				{Name: "a", Values: []string{"1", "2", "3", "4", "5", "6"}},
+				{Name: "b", Values: []string{"1", "2", "3", "4", "5", "6"}},
+			})).Should(HaveOccurred())
+		})
+		It("should raise error for values duplicated after converted to job name", func() {
+			Expect(lintMatrix([]*commonmodels.MatrixAxis{{Name: "os", Values: []string{"Linux", "linux"}}})).Should(HaveOccurred())
+		})
+	})
+
+	Context("lintMatrixJobNames", func() {
+		It("should raise error for names collided with other jobs", func() {
+			workflow := &commonmodels.WorkflowV4{Stages: []*commonmodels.WorkflowStage{
+				{Name: "build", Jobs: []*commonmodels.Job{{Name: "build"}, {Name: "build-linux"}}},
+			}}
+			osMatrix := []*commonmodels.MatrixAxis{{Name: "os", Values: []string{"linux"}}}
+			Expect(lintMatrixJobNames(workflow, "build", "build", osMatrix)).Should(HaveOccurred())
+			Expect(lintMatrixJobNames(workflow, "build", "deploy", osMatrix)).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("matrixServiceAndBuild", func() {
+		It("should append the values of the cell to the image and package", func() {
+			build := &commonmodels.ServiceAndBuild{Image: "koderover/app:v1", Package: "app-v1.tar.gz"}
+			cellBuild := matrixServiceAndBuild(build, matrix, map[string]string{"os": "linux", "arch": "arm64"})
+			Expect(cellBuild.Image).To(Equal("koderover/app:v1-linux-arm64"))
+			Expect(cellBuild.Package).To(Equal("app-v1-linux-arm64.tar.gz"))
+			Expect(build.Image).To(Equal("koderover/app:v1"))
+		})
+	})
+
+	Context("deploy job quoting a matrix build job", func() {
+		It("should raise error", func() {
+			workflow := &commonmodels.WorkflowV4{Stages: []*commonmodels.WorkflowStage{
+				{Name: "build", Jobs: []*commonmodels.Job{{
+					Name:    "build",
+					JobType: config.JobZadigBuild,
+					Spec:    &commonmodels.ZadigBuildJobSpec{Matrix: matrix},
+				}}},
+				{Name: "deploy", Jobs: []*commonmodels.Job{{
+					Name:    "deploy",
+					JobType: config.JobZadigDeploy,
+					Spec:    &commonmodels.ZadigDeployJobSpec{Source: config.SourceFromJob, JobName: "build"},
+				}}},
+			}}
+			deployJob := &DeployJob{job: workflow.Stages[1].Jobs[0], workflow: workflow}
+			Expect(deployJob.LintJob()).Should(HaveOccurred())
+
+			workflow.Stages[0].Jobs[0].Spec = &commonmodels.ZadigBuildJobSpec{}
+			Expect(deployJob.LintJob()).ShouldNot(HaveOccurred())
+		})
+	})
+})
@@ -84,6 +84,7 @@ func (j *PluginJob) ToJobs(taskID int64) ([]*commonmodels.JobTask, error) {
 		JobType: string(config.JobPlugin),
 		Spec:    jobTaskSpec,
 		Outputs: j.spec.Plugin.Outputs,
+		Retry:   j.spec.Properties.Retry,
 	}
 	registries, err := commonservice.ListRegistryNamespaces("", true, logger)
 	if err != nil {
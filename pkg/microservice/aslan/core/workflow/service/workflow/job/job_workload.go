@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	crClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+)
+
+// the names of the jobs in the errors of the shared lints.
+const (
+	blueGreenDeployJobType = "blue-green deploy"
+	canaryDeployJobType    = "canary deploy"
+)
+
+// serviceWorkload is the deployment or statefulset selected by a k8s service.
+type serviceWorkload struct {
+	Name     string
+	Type     string
+	Replicas int32
+	// ReleaseName is the helm release managing the workload, empty if it is not managed by helm.
+	ReleaseName string
+}
+
+// getDeployEnv returns the environment the blue-green and canary jobs deploy to. Helm envs are rejected, since the
+// jobs change the workloads out of the release and the next upgrade of the release would revert the changes.
+func getDeployEnv(projectName, envName, jobType string) (*commonmodels.Product, error) {
+	env, err := commonrepo.NewProductColl().Find(&commonrepo.ProductFindOptions{Name: projectName, EnvName: envName})
+	if err != nil {
+		return nil, fmt.Errorf("env %s not found: %v", envName, err)
+	}
+	if env.Source == setting.SourceFromHelm {
+		return nil, fmt.Errorf("env %s: %s does not support helm envs", envName, jobType)
+	}
+	return env, nil
+}
+
+func getTargetService(namespace, k8sServiceName string, kubeClient crClient.Client) (*corev1.Service, error) {
+	if k8sServiceName == "" {
+		return nil, fmt.Errorf("k8s service name should not be empty")
+	}
+	service, exist, err := getter.GetService(namespace, k8sServiceName, kubeClient)
+	if err != nil || !exist {
+		return nil, fmt.Errorf("Failed to get service, err: %v", err)
+	}
+	return service, nil
+}
+
+// findServiceWorkload finds the only deployment or statefulset matching the selector. Statefulsets with volume claim
+// templates are rejected, since the copies made by the jobs would start with empty volumes and leave the claims behind
+// when removed.
+func findServiceWorkload(namespace string, selector labels.Selector, kubeClient crClient.Client) (*serviceWorkload, error) {
+	resp := []*serviceWorkload{}
+	deployments, err := getter.ListDeployments(namespace, selector, kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("list deployments error: %v", err)
+	}
+	for _, deployment := range deployments {
+		resp = append(resp, &serviceWorkload{
+			Name:        deployment.Name,
+			Type:        setting.Deployment,
+			Replicas:    *deployment.Spec.Replicas,
+			ReleaseName: deployment.Annotations[setting.HelmReleaseNameAnnotation],
+		})
+	}
+	statefulSets, err := getter.ListStatefulSets(namespace, selector, kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("list statefulsets error: %v", err)
+	}
+	for _, statefulSet := range statefulSets {
+		if len(statefulSet.Spec.VolumeClaimTemplates) > 0 {
+			return nil, fmt.Errorf("statefulset %s has volume claim templates, which is not supported", statefulSet.Name)
+		}
+		resp = append(resp, &serviceWorkload{
+			Name:        statefulSet.Name,
+			Type:        setting.StatefulSet,
+			Replicas:    *statefulSet.Spec.Replicas,
+			ReleaseName: statefulSet.Annotations[setting.HelmReleaseNameAnnotation],
+		})
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("no deployment or statefulset found")
+	}
+	if len(resp) > 1 {
+		return nil, fmt.Errorf("more than one deployment or statefulset found")
+	}
+	return resp[0], nil
+}
+
+// lintHelmWorkload rejects the workloads managed by helm, the workloads changed by the job are out of the release,
+// so the next upgrade of the release would revert the changes.
+func lintHelmWorkload(workload *serviceWorkload, jobType string) error {
+	if workload.ReleaseName != "" {
+		return fmt.Errorf("%s %s is managed by helm release %s, %s does not support helm releases", workload.Type, workload.Name, workload.ReleaseName, jobType)
+	}
+	return nil
+}
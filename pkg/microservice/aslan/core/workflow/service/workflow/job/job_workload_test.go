@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing workloads of blue-green and canary jobs", func() {
+
+	appLabels := map[string]string{"app": "web"}
+	replicas := int32(2)
+	releaseAnnotations := map[string]string{setting.HelmReleaseNameAnnotation: "dev-web"}
+
+	newDeployment := func(name string, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev", Labels: appLabels, Annotations: annotations},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		}
+	}
+	newStatefulSet := func(name string, claims []corev1.PersistentVolumeClaim) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev", Labels: appLabels},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, VolumeClaimTemplates: claims},
+		}
+	}
+	newService := func(name, clusterIP string, annotations map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "dev", Annotations: annotations},
+			Spec:       corev1.ServiceSpec{Selector: appLabels, ClusterIP: clusterIP},
+		}
+	}
+	selector := labels.Set(appLabels).AsSelector()
+
+	Context("findServiceWorkload", func() {
+		It("should find the deployment with its release", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(newDeployment("web", releaseAnnotations)).Build()
+			workload, err := findServiceWorkload("dev", selector, kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workload).To(Equal(&serviceWorkload{Name: "web", Type: setting.Deployment, Replicas: 2, ReleaseName: "dev-web"}))
+		})
+		It("should find the statefulset without volume claim templates", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(newStatefulSet("web", nil)).Build()
+			workload, err := findServiceWorkload("dev", selector, kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workload.Type).To(Equal(setting.StatefulSet))
+		})
+		It("should reject the statefulset with volume claim templates", func() {
+			claims := []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}}
+			kubeClient := fake.NewClientBuilder().WithObjects(newStatefulSet("web", claims)).Build()
+			_, err := findServiceWorkload("dev", selector, kubeClient)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject more than one workload", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(newDeployment("web", releaseAnnotations), newDeployment("web-debug", nil)).Build()
+			_, err := findServiceWorkload("dev", selector, kubeClient)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("getTargetService", func() {
+		It("should find the service by name", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(newService("web", "", nil), newService("api", "", nil)).Build()
+			service, err := getTargetService("dev", "web", kubeClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Name).To(Equal("web"))
+		})
+		It("should require the k8s service name", func() {
+			kubeClient := fake.NewClientBuilder().WithObjects(newService("web", "", releaseAnnotations)).Build()
+			_, err := getTargetService("dev", "", kubeClient)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should raise error for missing service", func() {
+			kubeClient := fake.NewClientBuilder().Build()
+			_, err := getTargetService("dev", "web", kubeClient)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("lintHelmWorkload", func() {
+		It("should reject the workloads managed by helm", func() {
+			err := lintHelmWorkload(&serviceWorkload{Name: "web", Type: setting.Deployment, ReleaseName: "dev-web"}, canaryDeployJobType)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("canary deploy does not support helm releases"))
+			Expect(lintHelmWorkload(&serviceWorkload{Name: "web", Type: setting.StatefulSet}, blueGreenDeployJobType)).NotTo(HaveOccurred())
+		})
+	})
+})
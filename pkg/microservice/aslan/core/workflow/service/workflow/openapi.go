@@ -150,11 +150,15 @@ func getInputUpdater(job *commonmodels.Job, input interface{}) (CustomJobInput,
 		updater := new(CanaryDeployJobInput)
 		err := commonmodels.IToi(input, updater)
 		return updater, err
+	case config.JobIstioCanary:
+		updater := new(IstioCanaryJobInput)
+		err := commonmodels.IToi(input, updater)
+		return updater, err
 	case config.JobCustomDeploy:
 		updater := new(CustomDeployJobInput)
 		err := commonmodels.IToi(input, updater)
 		return updater, err
-	case config.JobK8sBlueGreenRelease, config.JobK8sCanaryRelease:
+	case config.JobK8sBlueGreenRelease, config.JobK8sCanaryRelease, config.JobCanaryAnalysis:
 		updater := new(EmptyInput)
 		err := commonmodels.IToi(input, updater)
 		return updater, err
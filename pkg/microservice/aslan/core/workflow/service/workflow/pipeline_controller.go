@@ -31,6 +31,7 @@ import (
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
 	commonservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
 	nsqservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/nsq"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/workflowcontroller"
 	"github.com/koderover/zadig/pkg/setting"
 	krkubeclient "github.com/koderover/zadig/pkg/tool/kube/client"
 	"github.com/koderover/zadig/pkg/tool/kube/getter"
@@ -73,6 +74,16 @@ func SubScribeNSQ() error {
 		return err
 	}
 
+	// init approve consumer, every aslan replica needs its own channel to receive all approve messages.
+	approveHandler := &workflowcontroller.ApproveHandler{
+		Logger: logger,
+	}
+	err = nsqservice.SubScribeSimple(setting.TopicApprove, fmt.Sprintf("approve-%s#ephemeral", config.PodName()), approveHandler)
+	if err != nil {
+		logger.Errorf("approve subscription failed, the error is: %v", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	commonservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/registry"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// registryHookPollInterval is the interval of polling the registries which are not able to send notifications.
+const registryHookPollInterval = time.Minute
+
+type registryHookPoller struct {
+	logger *zap.SugaredLogger
+}
+
+// NewRegistryHookPoller returns the controller polling the tags of the image repos for the registry hooks.
+func NewRegistryHookPoller() *registryHookPoller {
+	return &registryHookPoller{logger: log.SugaredLogger()}
+}
+
+// Run polls the registries until receiving signal from stopCh, the workers parameter is not used.
+func (p *registryHookPoller) Run(workers int, stopCh <-chan struct{}) {
+	p.logger.Info("Starting registry hook poller")
+	defer p.logger.Info("Shutting down registry hook poller")
+
+	go wait.Until(p.poll, registryHookPollInterval, stopCh)
+
+	<-stopCh
+}
+
+func (p *registryHookPoller) poll() {
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{RegistryPolling: true}, 0, 0)
+	if err != nil {
+		p.logger.Errorf("failed to list workflows polling registries, the error is: %v", err)
+		return
+	}
+	for _, workflow := range workflows {
+		for _, hook := range workflow.RegistryHooks {
+			if !hook.Enabled || !hook.Polling {
+				continue
+			}
+			if err := pollRegistryHook(workflow.Name, hook, p.logger); err != nil {
+				p.logger.Errorf("failed to poll registry hook %s of workflow %s, the error is: %v", hook.Name, workflow.Name, err)
+			}
+		}
+	}
+}
+
+func pollRegistryHook(workflowName string, hook *commonmodels.RegistryHook, logger *zap.SugaredLogger) error {
+	registryInfo, _, err := commonservice.FindRegistryById(hook.RegistryID, true, logger)
+	if err != nil {
+		return err
+	}
+	var regService registry.Service
+	if registryInfo.AdvancedSetting != nil {
+		regService = registry.NewV2Service(registryInfo.RegProvider, registryInfo.AdvancedSetting.TLSEnabled, registryInfo.AdvancedSetting.TLSCert)
+	} else {
+		regService = registry.NewV2Service(registryInfo.RegProvider, true, "")
+	}
+	repos, err := regService.ListRepoImages(registry.ListRepoImagesOption{
+		Endpoint: registry.Endpoint{
+			Addr:      registryInfo.RegAddr,
+			Ak:        registryInfo.AccessKey,
+			Sk:        registryInfo.SecretKey,
+			Namespace: registryInfo.Namespace,
+			Region:    registryInfo.Region,
+		},
+		Repos: []string{hook.Repo},
+	}, logger)
+	if err != nil {
+		return err
+	}
+	// the tags failed to be listed are logged by the registry service, keep the polled tags as they are.
+	if len(repos.Repos) == 0 {
+		return fmt.Errorf("failed to list tags of %s", hook.Repo)
+	}
+
+	tags := []string{}
+	for _, repo := range repos.Repos {
+		for _, tag := range repo.Tags {
+			if registryTagMatched(hook, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	// the first polling only records the tags, the new tags are claimed one by one, since the tags may be polled
+	// by the other instances or deployed by the notifications at the same time.
+	if hook.PolledTags == nil {
+		return commonrepo.NewWorkflowV4Coll().InitRegistryHookPolledTags(workflowName, hook.Name, tags)
+	}
+	for _, tag := range newRegistryTags(hook.PolledTags, tags) {
+		claimed, err := commonrepo.NewWorkflowV4Coll().ClaimRegistryHookPolledTag(workflowName, hook.Name, tag)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if _, err := triggerWorkflowV4ByRegistryTag(workflowName, hook, GetImage(registryInfo, hook.Repo+":"+tag), logger); err != nil {
+			logger.Errorf("failed to trigger workflow %s by tag %s of %s, the error is: %v", workflowName, tag, hook.Repo, err)
+		}
+	}
+	if staleTags := staleRegistryTags(hook.PolledTags, tags); len(staleTags) > 0 {
+		return commonrepo.NewWorkflowV4Coll().RemoveRegistryHookPolledTags(workflowName, hook.Name, staleTags)
+	}
+	return nil
+}
+
+// newRegistryTags returns the tags not polled before, nothing is new for the first polling.
+func newRegistryTags(polledTags, tags []string) []string {
+	resp := []string{}
+	if polledTags == nil {
+		return resp
+	}
+	polled := sets.NewString(polledTags...)
+	for _, tag := range tags {
+		if !polled.Has(tag) {
+			resp = append(resp, tag)
+		}
+	}
+	return resp
+}
+
+// staleRegistryTags returns the polled tags which are no longer in the registry.
+func staleRegistryTags(polledTags, tags []string) []string {
+	resp := []string{}
+	current := sets.NewString(tags...)
+	for _, tag := range polledTags {
+		if !current.Has(tag) {
+			resp = append(resp, tag)
+		}
+	}
+	return resp
+}
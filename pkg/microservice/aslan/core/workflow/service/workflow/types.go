@@ -361,6 +361,29 @@ func (p *CanaryDeployJobInput) UpdateJobSpec(job *commonmodels.Job) (*commonmode
 	return job, nil
 }
 
+type IstioCanaryJobInput struct {
+	ServiceList []*BlueGreenDeployArgs `json:"service_list"`
+}
+
+func (p *IstioCanaryJobInput) UpdateJobSpec(job *commonmodels.Job) (*commonmodels.Job, error) {
+	newSpec := new(commonmodels.IstioCanaryJobSpec)
+	if err := commonmodels.IToi(job.Spec, newSpec); err != nil {
+		return nil, errors.New("unable to cast job.Spec into commonmodels.IstioCanaryJobSpec")
+	}
+
+	for _, target := range newSpec.Targets {
+		for _, inputSvc := range p.ServiceList {
+			if inputSvc.ServiceName == target.K8sServiceName {
+				target.Image = inputSvc.ImageName
+			}
+		}
+	}
+
+	job.Spec = newSpec
+
+	return job, nil
+}
+
 type CustomDeployJobInput struct {
 	TargetList []*CustomDeployTarget `json:"target_list"`
 }
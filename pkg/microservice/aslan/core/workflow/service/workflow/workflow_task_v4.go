@@ -71,16 +71,36 @@ type StageTaskPreview struct {
 	Parallel  bool                   `bson:"parallel"      json:"parallel"`
 	Approval  *commonmodels.Approval `bson:"approval"      json:"approval"`
 	Jobs      []*JobTaskPreview      `bson:"jobs"          json:"jobs"`
+	// MatrixJobs groups the jobs fanned out from the same matrix job.
+	MatrixJobs []*MatrixJobPreview `bson:"matrix_jobs" json:"matrix_jobs,omitempty"`
+}
+
+type MatrixJobPreview struct {
+	Name   string        `json:"name"`
+	Status config.Status `json:"status"`
+	Jobs   []string      `json:"jobs"`
 }
 
 type JobTaskPreview struct {
-	Name      string        `bson:"name"           json:"name"`
-	JobType   string        `bson:"type"           json:"type"`
-	Status    config.Status `bson:"status"         json:"status"`
-	StartTime int64         `bson:"start_time"     json:"start_time,omitempty"`
-	EndTime   int64         `bson:"end_time"       json:"end_time,omitempty"`
-	Error     string        `bson:"error"          json:"error"`
-	Spec      interface{}   `bson:"spec"           json:"spec"`
+	Name      string             `bson:"name"           json:"name"`
+	JobType   string             `bson:"type"           json:"type"`
+	Status    config.Status      `bson:"status"         json:"status"`
+	StartTime int64              `bson:"start_time"     json:"start_time,omitempty"`
+	EndTime   int64              `bson:"end_time"       json:"end_time,omitempty"`
+	Error     string             `bson:"error"          json:"error"`
+	Matrix    map[string]string  `bson:"matrix"         json:"matrix,omitempty"`
+	Steps     []*StepTaskPreview `bson:"steps"          json:"steps,omitempty"`
+	Spec      interface{}        `bson:"spec"           json:"spec"`
+}
+
+type StepTaskPreview struct {
+	Name      string          `json:"name"`
+	StepType  config.StepType `json:"type"`
+	Status    config.Status   `json:"status"`
+	Error     string          `json:"error"`
+	ExitCode  int             `json:"exit_code"`
+	StartTime int64           `json:"start_time,omitempty"`
+	EndTime   int64           `json:"end_time,omitempty"`
 }
 
 type ZadigBuildJobSpec struct {
@@ -131,6 +151,17 @@ type K8sCanaryDeployJobSpec struct {
 	Events         *commonmodels.Events `bson:"events"                       json:"events"`
 }
 
+type IstioCanaryJobSpec struct {
+	Image          string                          `bson:"image"                        json:"image"`
+	K8sServiceName string                          `bson:"k8s_service_name"             json:"k8s_service_name"`
+	ClusterName    string                          `bson:"cluster_name"                 json:"cluster_name"`
+	Namespace      string                          `bson:"namespace"                    json:"namespace"`
+	ContainerName  string                          `bson:"container_name"               json:"container_name"`
+	Steps          []*commonmodels.IstioCanaryStep `bson:"steps"                        json:"steps"`
+	CurrentWeight  int                             `bson:"current_weight"               json:"current_weight"`
+	Events         *commonmodels.Events            `bson:"events"                       json:"events"`
+}
+
 type K8sCanaryReleaseJobSpec struct {
 	Image          string               `bson:"image"                        json:"image"`
 	K8sServiceName string               `bson:"k8s_service_name"             json:"k8s_service_name"`
@@ -175,6 +206,8 @@ func GetWorkflowv4Preset(encryptedKey, workflowName string, log *zap.SugaredLogg
 	if err := ensureWorkflowV4Resp(encryptedKey, workflow, log); err != nil {
 		return workflow, err
 	}
+	maskPrometheusTokens(workflow)
+	maskNotifySecrets(workflow)
 	return workflow, nil
 }
 
@@ -194,6 +227,14 @@ func CreateWorkflowTaskV4(user string, workflow *commonmodels.WorkflowV4, log *z
 		return resp, e.ErrCreateTask.AddDesc(err.Error())
 	}
 	workflowTask.OriginWorkflowArgs = originTaskArgs
+	// conditions are evaluated with the variables at run time, keep them from being rendered when creating task.
+	stageConditions, jobConditions := make(map[string]string), make(map[string]string)
+	for _, stage := range originTaskArgs.Stages {
+		stageConditions[stage.Name] = stage.When
+		for _, job := range stage.Jobs {
+			jobConditions[job.Name] = job.When
+		}
+	}
 	nextTaskID, err := commonrepo.NewCounterColl().GetNextSeq(fmt.Sprintf(setting.WorkflowTaskV4Fmt, workflow.Name))
 	if err != nil {
 		log.Errorf("Counter.GetNextSeq error: %v", err)
@@ -220,12 +261,14 @@ func CreateWorkflowTaskV4(user string, workflow *commonmodels.WorkflowV4, log *z
 	workflowTask.Params = workflow.Params
 	workflowTask.KeyVals = workflow.KeyVals
 	workflowTask.MultiRun = workflow.MultiRun
+	workflowTask.Priority = workflow.Priority
 
 	for _, stage := range workflow.Stages {
 		stageTask := &commonmodels.StageTask{
 			Name:     stage.Name,
 			Parallel: stage.Parallel,
 			Approval: stage.Approval,
+			When:     stageConditions[stage.Name],
 		}
 		for _, job := range stage.Jobs {
 			if job.Skipped {
@@ -256,6 +299,9 @@ func CreateWorkflowTaskV4(user string, workflow *commonmodels.WorkflowV4, log *z
 				log.Errorf("cannot create workflow %s, the error is: %v", workflow.Name, err)
 				return resp, e.ErrCreateTask.AddDesc(err.Error())
 			}
+			for _, jobTask := range jobs {
+				jobTask.When = jobConditions[job.Name]
+			}
 			stageTask.Jobs = append(stageTask.Jobs, jobs...)
 		}
 		if len(stageTask.Jobs) > 0 {
@@ -270,17 +316,22 @@ func CreateWorkflowTaskV4(user string, workflow *commonmodels.WorkflowV4, log *z
 	workflowTask.WorkflowArgs = workflow
 	workflowTask.Status = config.StatusCreated
 
+	// The queued status must be reported before the task is enqueued, otherwise it may overwrite the running status
+	// reported by the scheduler.
+	if err := scmnotify.NewService().UpdateGitCheckForWorkflowV4(workflowTask.WorkflowArgs, workflowTask.TaskID, log); err != nil {
+		log.Warnf("Failed to update github check status for custom workflow %s, taskID: %d the error is: %s", workflowTask.WorkflowName, workflowTask.TaskID, err)
+	}
 	if err := workflowcontroller.CreateTask(workflowTask); err != nil {
 		log.Errorf("create workflow task error: %v", err)
+		if err := scmnotify.NewService().CompleteGitCheckForWorkflowV4(workflowTask.WorkflowArgs, workflowTask.TaskID, config.StatusFailed, log); err != nil {
+			log.Warnf("Failed to complete github check status for custom workflow %s, taskID: %d the error is: %s", workflowTask.WorkflowName, workflowTask.TaskID, err)
+		}
 		return resp, e.ErrCreateTask.AddDesc(err.Error())
 	}
 	// Updating the comment in the git repository, this will not cause the function to return error if this function call fails
 	if err := scmnotify.NewService().UpdateWebhookCommentForWorkflowV4(workflowTask, log); err != nil {
 		log.Warnf("Failed to update comment for custom workflow %s, taskID: %d the error is: %s", workflowTask.WorkflowName, workflowTask.TaskID, err)
 	}
-	if err := scmnotify.NewService().UpdateGitCheckForWorkflowV4(workflowTask.WorkflowArgs, workflowTask.TaskID, log); err != nil {
-		log.Warnf("Failed to update github check status for custom workflow %s, taskID: %d the error is: %s", workflowTask.WorkflowName, workflowTask.TaskID, err)
-	}
 
 	return resp, nil
 }
@@ -291,6 +342,8 @@ func CloneWorkflowTaskV4(workflowName string, taskID int64, logger *zap.SugaredL
 		logger.Errorf("find workflowTaskV4 error: %s", err)
 		return nil, e.ErrGetTask.AddErr(err)
 	}
+	maskPrometheusTokens(task.OriginWorkflowArgs)
+	maskNotifySecrets(task.OriginWorkflowArgs)
 	return task.OriginWorkflowArgs, nil
 }
 
@@ -312,6 +365,9 @@ func ListWorkflowTaskV4(workflowName string, pageNum, pageSize int64, logger *za
 		logger.Errorf("list workflowTaskV4 error: %s", err)
 		return resp, total, err
 	}
+	for _, task := range resp {
+		maskWorkflowTaskPrometheusTokens(task)
+	}
 	return resp, total, nil
 }
 
@@ -323,6 +379,14 @@ func CancelWorkflowTaskV4(userName, workflowName string, taskID int64, logger *z
 	return nil
 }
 
+func RetryWorkflowTaskV4(userName, workflowName string, taskID int64, logger *zap.SugaredLogger) error {
+	if err := workflowcontroller.RetryWorkflowTask(userName, workflowName, taskID, logger); err != nil {
+		logger.Errorf("retry workflowTaskV4 error: %s", err)
+		return e.ErrRestartTask.AddErr(err)
+	}
+	return nil
+}
+
 func GetWorkflowTaskV4(workflowName string, taskID int64, logger *zap.SugaredLogger) (*WorkflowTaskPreview, error) {
 	task, err := commonrepo.NewworkflowTaskv4Coll().Find(workflowName, taskID)
 	if err != nil {
@@ -346,13 +410,14 @@ func GetWorkflowTaskV4(workflowName string, taskID int64, logger *zap.SugaredLog
 	}
 	for _, stage := range task.Stages {
 		resp.Stages = append(resp.Stages, &StageTaskPreview{
-			Name:      stage.Name,
-			Status:    stage.Status,
-			StartTime: stage.StartTime,
-			EndTime:   stage.EndTime,
-			Parallel:  stage.Parallel,
-			Approval:  stage.Approval,
-			Jobs:      jobsToJobPreviews(stage.Jobs),
+			Name:       stage.Name,
+			Status:     stage.Status,
+			StartTime:  stage.StartTime,
+			EndTime:    stage.EndTime,
+			Parallel:   stage.Parallel,
+			Approval:   stage.Approval,
+			Jobs:       jobsToJobPreviews(stage.Jobs),
+			MatrixJobs: matrixJobPreviews(stage.Jobs),
 		})
 	}
 	return resp, nil
@@ -371,6 +436,75 @@ func ApproveStage(workflowName, stageName, userName, userID, comment string, tas
 	return nil
 }
 
+// matrixJobPreviews aggregates the status of the jobs fanned out from one matrix job,
+// the matrix job is running until all of its jobs finished, then takes the worst status of them.
+func matrixJobPreviews(jobs []*commonmodels.JobTask) []*MatrixJobPreview {
+	statusMap := map[config.Status]int{
+		config.StatusCancelled: 4,
+		config.StatusTimeout:   3,
+		config.StatusFailed:    2,
+		config.StatusPassed:    1,
+		config.StatusSkipped:   0,
+	}
+	resp := []*MatrixJobPreview{}
+	previewMap := map[string]*MatrixJobPreview{}
+	jobsMap := map[string][]*commonmodels.JobTask{}
+	for _, job := range jobs {
+		if len(job.Matrix) == 0 {
+			continue
+		}
+		preview, ok := previewMap[job.OriginName]
+		if !ok {
+			preview = &MatrixJobPreview{Name: job.OriginName}
+			previewMap[job.OriginName] = preview
+			resp = append(resp, preview)
+		}
+		preview.Jobs = append(preview.Jobs, job.Name)
+		jobsMap[job.OriginName] = append(jobsMap[job.OriginName], job)
+	}
+	for _, preview := range resp {
+		started, finished := false, true
+		statusCode := -1
+		for _, job := range jobsMap[preview.Name] {
+			if job.StartTime > 0 {
+				started = true
+			}
+			code, ok := statusMap[job.Status]
+			if !ok {
+				finished = false
+				continue
+			}
+			if code > statusCode {
+				statusCode = code
+				preview.Status = job.Status
+			}
+		}
+		switch {
+		case !finished && started:
+			preview.Status = config.StatusRunning
+		case !finished:
+			preview.Status = jobsMap[preview.Name][0].Status
+		}
+	}
+	return resp
+}
+
+func stepsToStepPreviews(steps []*commonmodels.StepTask) []*StepTaskPreview {
+	resp := []*StepTaskPreview{}
+	for _, step := range steps {
+		resp = append(resp, &StepTaskPreview{
+			Name:      step.Name,
+			StepType:  step.StepType,
+			Status:    step.Status,
+			Error:     step.Error,
+			ExitCode:  step.ExitCode,
+			StartTime: step.StartTime,
+			EndTime:   step.EndTime,
+		})
+	}
+	return resp
+}
+
 func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 	resp := []*JobTaskPreview{}
 	for _, job := range jobs {
@@ -381,6 +515,7 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 			EndTime:   job.EndTime,
 			Error:     job.Error,
 			JobType:   job.JobType,
+			Matrix:    job.Matrix,
 		}
 		switch job.JobType {
 		case string(config.FreestyleType):
@@ -406,6 +541,7 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 				}
 			}
 			spec.Envs = taskJobSpec.Properties.CustomEnvs
+			jobPreview.Steps = stepsToStepPreviews(taskJobSpec.Steps)
 			for _, step := range taskJobSpec.Steps {
 				if step.StepType == config.StepGit {
 					stepSpec := &stepspec.StepGitSpec{}
@@ -423,6 +559,7 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 				continue
 			}
 			spec.Envs = taskJobSpec.Properties.CustomEnvs
+			jobPreview.Steps = stepsToStepPreviews(taskJobSpec.Steps)
 			for _, step := range taskJobSpec.Steps {
 				if step.StepType == config.StepGit {
 					stepSpec := &stepspec.StepGitSpec{}
@@ -586,6 +723,30 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 				sepc.ClusterName = cluster.Name
 			}
 			jobPreview.Spec = sepc
+		case string(config.JobIstioCanary):
+			taskJobSpec := &commonmodels.JobTaskIstioCanarySpec{}
+			if err := commonmodels.IToi(job.Spec, taskJobSpec); err != nil {
+				continue
+			}
+			spec := IstioCanaryJobSpec{
+				Image:          taskJobSpec.Image,
+				K8sServiceName: taskJobSpec.K8sServiceName,
+				Namespace:      taskJobSpec.Namespace,
+				ContainerName:  taskJobSpec.ContainerName,
+				Steps:          taskJobSpec.Steps,
+				CurrentWeight:  taskJobSpec.CurrentWeight,
+				Events:         taskJobSpec.Events,
+			}
+			cluster, err := commonrepo.NewK8SClusterColl().Get(taskJobSpec.ClusterID)
+			if err != nil {
+				log.Errorf("cluster id: %s not found", taskJobSpec.ClusterID)
+			} else {
+				spec.ClusterName = cluster.Name
+			}
+			jobPreview.Spec = spec
+		case string(config.JobCanaryAnalysis):
+			maskJobTaskPrometheusToken(job)
+			jobPreview.Spec = job.Spec
 		default:
 			jobPreview.Spec = job.Spec
 		}
@@ -594,6 +755,55 @@ func jobsToJobPreviews(jobs []*commonmodels.JobTask) []*JobTaskPreview {
 	return resp
 }
 
+// maskWorkflowTaskPrometheusTokens hides the prometheus tokens in the jobs and the args of the task,
+// and the secrets of the webhook notifications in the args.
+func maskWorkflowTaskPrometheusTokens(task *commonmodels.WorkflowTask) {
+	for _, stage := range task.Stages {
+		for _, job := range stage.Jobs {
+			maskJobTaskPrometheusToken(job)
+		}
+	}
+	maskPrometheusTokens(task.WorkflowArgs)
+	maskPrometheusTokens(task.OriginWorkflowArgs)
+	maskNotifySecrets(task.WorkflowArgs)
+	maskNotifySecrets(task.OriginWorkflowArgs)
+}
+
+// maskJobTaskPrometheusToken hides the prometheus token of the canary analysis job or the health check of the deploy job.
+func maskJobTaskPrometheusToken(job *commonmodels.JobTask) {
+	switch job.JobType {
+	case string(config.JobCanaryAnalysis):
+		spec := &commonmodels.JobTaskCanaryAnalysisSpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil {
+			return
+		}
+		if spec.PrometheusToken != "" {
+			spec.PrometheusToken = setting.MaskValue
+		}
+		job.Spec = spec
+	case string(config.JobZadigDeploy):
+		spec := &commonmodels.JobTaskDeploySpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil || spec.HealthCheck == nil {
+			return
+		}
+		maskHealthCheckPrometheusToken(spec.HealthCheck)
+		job.Spec = spec
+	case string(config.JobZadigHelmDeploy):
+		spec := &commonmodels.JobTaskHelmDeploySpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil || spec.HealthCheck == nil {
+			return
+		}
+		maskHealthCheckPrometheusToken(spec.HealthCheck)
+		job.Spec = spec
+	}
+}
+
+func maskHealthCheckPrometheusToken(check *commonmodels.DeployHealthCheck) {
+	if check.PrometheusToken != "" {
+		check.PrometheusToken = setting.MaskValue
+	}
+}
+
 func setZadigBuildRepos(job *commonmodels.Job, logger *zap.SugaredLogger) error {
 	spec := &commonmodels.ZadigBuildJobSpec{}
 	if err := commonmodels.IToi(job.Spec, spec); err != nil {
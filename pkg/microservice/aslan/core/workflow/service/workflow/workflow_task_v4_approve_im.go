@@ -0,0 +1,369 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	configbase "github.com/koderover/zadig/pkg/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/instantmessage"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+const (
+	// imCallbackMaxDelay rejects the replayed callbacks of slack.
+	imCallbackMaxDelay = 5 * time.Minute
+
+	dingTalkAuthURL        = "https://login.dingtalk.com/oauth2/auth"
+	dingTalkUserTokenURL   = "https://api.dingtalk.com/v1.0/oauth2/userAccessToken"
+	dingTalkCurrentUserURL = "https://api.dingtalk.com/v1.0/contact/users/me"
+)
+
+// larkCardCallback covers both the legacy card callback and the card.action.trigger event of lark.
+type larkCardCallback struct {
+	Schema    string          `json:"schema"`
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	Token     string          `json:"token"`
+	OpenID    string          `json:"open_id"`
+	Action    *larkCardAction `json:"action"`
+	Header    *struct {
+		Token string `json:"token"`
+	} `json:"header"`
+	Event *struct {
+		Operator struct {
+			OpenID string `json:"open_id"`
+		} `json:"operator"`
+		Action *larkCardAction `json:"action"`
+	} `json:"event"`
+}
+
+type larkCardAction struct {
+	Value map[string]string `json:"value"`
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// HandleIMApproveCallback verifies the callback of the approval card buttons clicked in lark or slack,
+// then records the decision for the zadig user bound to the IM user.
+func HandleIMApproveCallback(imAppID string, header http.Header, body []byte, logger *zap.SugaredLogger) (interface{}, error) {
+	app, err := commonrepo.NewIMAppColl().GetByID(context.TODO(), imAppID)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("im app %s not found", imAppID))
+	}
+	switch app.Type {
+	case commonmodels.IMAppTypeLark:
+		return handleLarkApproveCallback(app, header, body, logger)
+	case commonmodels.IMAppTypeSlack:
+		return nil, handleSlackApproveCallback(app, header, body, logger)
+	}
+	return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("im app type %s does not support callback", app.Type))
+}
+
+func handleLarkApproveCallback(app *commonmodels.IMApp, header http.Header, body []byte, logger *zap.SugaredLogger) (interface{}, error) {
+	plaintext, err := decryptLarkBody(app.EncryptKey, body)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddErr(err)
+	}
+	callback := &larkCardCallback{}
+	if err := json.Unmarshal(plaintext, callback); err != nil {
+		return nil, e.ErrInvalidParam.AddErr(err)
+	}
+	if callback.Type == "url_verification" {
+		if !hmac.Equal([]byte(callback.Token), []byte(app.VerificationToken)) {
+			return nil, e.ErrForbidden.AddDesc("invalid verification token")
+		}
+		return map[string]string{"challenge": callback.Challenge}, nil
+	}
+
+	if err := verifyLarkCallback(app, header, body, callback); err != nil {
+		return nil, e.ErrForbidden.AddErr(err)
+	}
+
+	openID, action := callback.OpenID, callback.Action
+	if callback.Event != nil {
+		openID, action = callback.Event.Operator.OpenID, callback.Event.Action
+	}
+	if openID == "" || action == nil {
+		return nil, e.ErrInvalidParam.AddDesc("invalid lark card callback")
+	}
+	message, err := approveFromIM(app, openID, action.Value[instantmessage.ApproveActionKey], logger)
+	toastType := "success"
+	if err != nil {
+		toastType, message = "error", err.Error()
+	}
+	return map[string]interface{}{
+		"toast": map[string]string{"type": toastType, "content": message},
+	}, nil
+}
+
+// verifyLarkCallback checks the signature of the callback with the raw body. The legacy card callbacks are signed by
+// sha1 with the verification token, while the card.action.trigger events are signed by sha256 with the encrypt key,
+// or carry the verification token in the header if the app has no encrypt key.
+func verifyLarkCallback(app *commonmodels.IMApp, header http.Header, body []byte, callback *larkCardCallback) error {
+	content := header.Get("X-Lark-Request-Timestamp") + header.Get("X-Lark-Request-Nonce")
+	if callback.Schema != "2.0" {
+		signature := sha1.Sum([]byte(content + app.VerificationToken + string(body)))
+		if !hmac.Equal([]byte(hex.EncodeToString(signature[:])), []byte(header.Get("X-Lark-Signature"))) {
+			return errors.New("invalid lark signature")
+		}
+		return nil
+	}
+	if app.EncryptKey == "" {
+		if callback.Header == nil || !hmac.Equal([]byte(callback.Header.Token), []byte(app.VerificationToken)) {
+			return errors.New("invalid verification token")
+		}
+		return nil
+	}
+	signature := sha256.Sum256([]byte(content + app.EncryptKey + string(body)))
+	if !hmac.Equal([]byte(hex.EncodeToString(signature[:])), []byte(header.Get("X-Lark-Signature"))) {
+		return errors.New("invalid lark signature")
+	}
+	return nil
+}
+
+// decryptLarkBody returns the plaintext of the events encrypted by lark with the encrypt key of the app,
+// the body is returned as it is if it is not encrypted.
+func decryptLarkBody(encryptKey string, body []byte) ([]byte, error) {
+	encrypted := &struct {
+		Encrypt string `json:"encrypt"`
+	}{}
+	if err := json.Unmarshal(body, encrypted); err != nil || encrypted.Encrypt == "" {
+		return body, nil
+	}
+	if encryptKey == "" {
+		return nil, errors.New("encrypt key of the lark app is not configured")
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted lark event")
+	}
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plaintext, data[aes.BlockSize:])
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("invalid padding of encrypted lark event")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func handleSlackApproveCallback(app *commonmodels.IMApp, header http.Header, body []byte, logger *zap.SugaredLogger) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	requestTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(requestTime, 0)).Abs() > imCallbackMaxDelay {
+		return e.ErrForbidden.AddDesc("invalid slack request timestamp")
+	}
+	mac := hmac.New(sha256.New, []byte(app.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	if !hmac.Equal([]byte("v0="+hex.EncodeToString(mac.Sum(nil))), []byte(header.Get("X-Slack-Signature"))) {
+		return e.ErrForbidden.AddDesc("invalid slack signature")
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return e.ErrInvalidParam.AddErr(err)
+	}
+	interaction := &slackInteraction{}
+	if err := json.Unmarshal([]byte(values.Get("payload")), interaction); err != nil {
+		return e.ErrInvalidParam.AddErr(err)
+	}
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		return nil
+	}
+	message, err := approveFromIM(app, interaction.User.ID, interaction.Actions[0].Value, logger)
+	if err != nil {
+		message = err.Error()
+	}
+	// reply to the user only, the card in the channel is kept for the other approvers.
+	if interaction.ResponseURL != "" {
+		_, err = httpclient.Post(interaction.ResponseURL, httpclient.SetBody(map[string]interface{}{
+			"response_type":    "ephemeral",
+			"replace_original": false,
+			"text":             message,
+		}))
+		if err != nil {
+			logger.Errorf("failed to reply slack interaction, err: %s", err)
+		}
+	}
+	return nil
+}
+
+// HandleDingTalkApproveCallback handles the approval buttons of dingtalk action cards, which are links rather
+// than callbacks, so the user is redirected to the oauth of dingtalk first to find out who clicked the button.
+// It returns the url to redirect to, or the message to show to the user.
+func HandleDingTalkApproveCallback(imAppID string, query url.Values, logger *zap.SugaredLogger) (string, string, error) {
+	app, err := commonrepo.NewIMAppColl().GetByID(context.TODO(), imAppID)
+	if err != nil || app.Type != commonmodels.IMAppTypeDingTalk {
+		return "", "", e.ErrInvalidParam.AddDesc(fmt.Sprintf("dingtalk app %s not found", imAppID))
+	}
+
+	authCode := query.Get("authCode")
+	if authCode == "" {
+		params := url.Values{}
+		params.Add("redirect_uri", instantmessage.GetIMApproveCallbackURL(imAppID))
+		params.Add("response_type", "code")
+		params.Add("client_id", app.AppID)
+		params.Add("scope", "openid")
+		params.Add("state", query.Get(instantmessage.ApproveActionKey))
+		params.Add("prompt", "consent")
+		return dingTalkAuthURL + "?" + params.Encode(), "", nil
+	}
+
+	userToken := &struct {
+		AccessToken string `json:"accessToken"`
+	}{}
+	_, err = httpclient.Post(dingTalkUserTokenURL, httpclient.SetBody(map[string]string{
+		"clientId":     app.AppID,
+		"clientSecret": app.AppSecret,
+		"code":         authCode,
+		"grantType":    "authorization_code",
+	}), httpclient.SetResult(userToken))
+	if err != nil {
+		logger.Errorf("failed to get dingtalk user access token, err: %s", err)
+		return "", "", e.ErrForbidden.AddDesc("failed to verify dingtalk user")
+	}
+	user := &struct {
+		UnionID string `json:"unionId"`
+	}{}
+	_, err = httpclient.Get(dingTalkCurrentUserURL, httpclient.SetHeader("x-acs-dingtalk-access-token", userToken.AccessToken), httpclient.SetResult(user))
+	if err != nil || user.UnionID == "" {
+		logger.Errorf("failed to get dingtalk user, err: %v", err)
+		return "", "", e.ErrForbidden.AddDesc("failed to verify dingtalk user")
+	}
+
+	message, err := approveFromIM(app, user.UnionID, query.Get("state"), logger)
+	return "", message, err
+}
+
+// approveFromIM records the decision carried by the signed action token for the zadig user bound to the IM user,
+// users not bound yet get a link to bind their zadig account.
+func approveFromIM(app *commonmodels.IMApp, imUserID, actionToken string, logger *zap.SugaredLogger) (string, error) {
+	action, err := instantmessage.ParseApproveActionToken(actionToken)
+	if err != nil {
+		return "", fmt.Errorf("审批操作无效或已过期: %s", err)
+	}
+	binding, err := commonrepo.NewIMUserBindingColl().Find(app.ID.Hex(), imUserID)
+	if err != nil {
+		userToken, err := instantmessage.NewIMUserToken(app.ID.Hex(), imUserID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("请先绑定 Zadig 账号后重新审批, 链接仅限本人使用, 请勿转发: %s/v1/im/bind?token=%s", configbase.SystemAddress(), url.QueryEscape(userToken)), nil
+	}
+
+	comment := fmt.Sprintf("通过 %s 审批", app.Name)
+	if err := ApproveStage(action.WorkflowName, action.StageName, binding.UserName, binding.UserID, comment, action.TaskID, action.Approve, logger); err != nil {
+		return "", err
+	}
+	if action.Approve {
+		return fmt.Sprintf("已通过工作流 %s #%d 阶段 %s 的审批", action.WorkflowName, action.TaskID, action.StageName), nil
+	}
+	return fmt.Sprintf("已拒绝工作流 %s #%d 阶段 %s 的审批", action.WorkflowName, action.TaskID, action.StageName), nil
+}
+
+type IMUserBindingPreview struct {
+	IMAppName string `json:"im_app_name"`
+	IMAppType string `json:"im_app_type"`
+	IMUserID  string `json:"im_user_id"`
+	// UserName is the zadig user the IM user is bound to currently.
+	UserName string `json:"user_name"`
+}
+
+// GetIMUserBindingPreview shows the IM user carried by the bind link, so the zadig user can tell whether the link
+// was sent by themselves before confirming the binding.
+func GetIMUserBindingPreview(token string, logger *zap.SugaredLogger) (*IMUserBindingPreview, error) {
+	imUser, err := instantmessage.ParseIMUserToken(token)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddErr(err)
+	}
+	app, err := commonrepo.NewIMAppColl().GetByID(context.TODO(), imUser.IMAppID)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("im app %s not found", imUser.IMAppID))
+	}
+	resp := &IMUserBindingPreview{
+		IMAppName: app.Name,
+		IMAppType: app.Type,
+		IMUserID:  imUser.IMUserID,
+	}
+	if binding, err := commonrepo.NewIMUserBindingColl().Find(imUser.IMAppID, imUser.IMUserID); err == nil {
+		resp.UserName = binding.UserName
+	}
+	return resp, nil
+}
+
+// BindIMUser binds the IM user verified by a previous callback to the current zadig user. The binding must be confirmed
+// explicitly after the IM user is shown, otherwise anyone opening a forwarded link binds the sender to their account.
+func BindIMUser(token string, confirm bool, userID, userName string, logger *zap.SugaredLogger) error {
+	imUser, err := instantmessage.ParseIMUserToken(token)
+	if err != nil {
+		return e.ErrInvalidParam.AddErr(err)
+	}
+	if userID == "" {
+		return e.ErrInvalidParam.AddErr(errors.New("user is empty"))
+	}
+	if !confirm {
+		return e.ErrInvalidParam.AddDesc("binding of the im user must be confirmed")
+	}
+	err = commonrepo.NewIMUserBindingColl().Upsert(&commonmodels.IMUserBinding{
+		IMAppID:  imUser.IMAppID,
+		IMUserID: imUser.IMUserID,
+		UserID:   userID,
+		UserName: userName,
+	})
+	if err != nil {
+		logger.Errorf("bind im user %s of app %s to %s error: %s", imUser.IMUserID, imUser.IMAppID, userName, err)
+		return err
+	}
+	return nil
+}
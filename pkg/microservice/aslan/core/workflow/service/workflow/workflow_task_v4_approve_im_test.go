@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing workflow task v4 approve im", func() {
+
+	larkHeader := func(signature string) http.Header {
+		header := http.Header{}
+		header.Set("X-Lark-Request-Timestamp", "1600000000")
+		header.Set("X-Lark-Request-Nonce", "nonce")
+		header.Set("X-Lark-Signature", signature)
+		return header
+	}
+	parseCallback := func(body []byte) *larkCardCallback {
+		callback := &larkCardCallback{}
+		Expect(json.Unmarshal(body, callback)).To(Succeed())
+		return callback
+	}
+
+	Context("verifyLarkCallback of legacy card callbacks", func() {
+		app := &commonmodels.IMApp{VerificationToken: "token"}
+		body := []byte(`{"open_id":"user","action":{"value":{}}}`)
+		sha1Signature := func(token string) string {
+			signature := sha1.Sum([]byte("1600000000nonce" + token + string(body)))
+			return hex.EncodeToString(signature[:])
+		}
+
+		It("should accept the callback signed with the verification token", func() {
+			Expect(verifyLarkCallback(app, larkHeader(sha1Signature("token")), body, parseCallback(body))).To(Succeed())
+		})
+		It("should reject the callback signed with another token", func() {
+			Expect(verifyLarkCallback(app, larkHeader(sha1Signature("another")), body, parseCallback(body))).NotTo(Succeed())
+		})
+	})
+
+	Context("verifyLarkCallback of card.action.trigger events", func() {
+		body := []byte(`{"schema":"2.0","header":{"token":"token"},"event":{"operator":{"open_id":"user"}}}`)
+		sha256Signature := func(key string) string {
+			signature := sha256.Sum256([]byte("1600000000nonce" + key + string(body)))
+			return hex.EncodeToString(signature[:])
+		}
+
+		It("should accept the event signed with the encrypt key", func() {
+			app := &commonmodels.IMApp{VerificationToken: "token", EncryptKey: "key"}
+			Expect(verifyLarkCallback(app, larkHeader(sha256Signature("key")), body, parseCallback(body))).To(Succeed())
+		})
+		It("should reject the event without signature when the app has an encrypt key", func() {
+			app := &commonmodels.IMApp{VerificationToken: "token", EncryptKey: "key"}
+			Expect(verifyLarkCallback(app, larkHeader(""), body, parseCallback(body))).NotTo(Succeed())
+		})
+		It("should reject the event signed with another key", func() {
+			app := &commonmodels.IMApp{VerificationToken: "token", EncryptKey: "key"}
+			Expect(verifyLarkCallback(app, larkHeader(sha256Signature("another")), body, parseCallback(body))).NotTo(Succeed())
+		})
+		It("should check the verification token when the app has no encrypt key", func() {
+			Expect(verifyLarkCallback(&commonmodels.IMApp{VerificationToken: "token"}, larkHeader(""), body, parseCallback(body))).To(Succeed())
+			Expect(verifyLarkCallback(&commonmodels.IMApp{VerificationToken: "another"}, larkHeader(""), body, parseCallback(body))).NotTo(Succeed())
+		})
+	})
+
+	Context("decryptLarkBody", func() {
+		encrypt := func(key string, plaintext []byte) []byte {
+			padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+			plaintext = append(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)...)
+			sum := sha256.Sum256([]byte(key))
+			block, err := aes.NewCipher(sum[:])
+			Expect(err).NotTo(HaveOccurred())
+			data := make([]byte, aes.BlockSize+len(plaintext))
+			copy(data, "0123456789abcdef")
+			cipher.NewCBCEncrypter(block, data[:aes.BlockSize]).CryptBlocks(data[aes.BlockSize:], plaintext)
+			body, _ := json.Marshal(map[string]string{"encrypt": base64.StdEncoding.EncodeToString(data)})
+			return body
+		}
+
+		It("should return the body which is not encrypted", func() {
+			body := []byte(`{"type":"url_verification"}`)
+			Expect(decryptLarkBody("key", body)).To(Equal(body))
+		})
+		It("should decrypt the body with the encrypt key", func() {
+			plaintext := []byte(`{"type":"url_verification","challenge":"challenge"}`)
+			Expect(decryptLarkBody("key", encrypt("key", plaintext))).To(Equal(plaintext))
+		})
+		It("should fail when the encrypt key is not configured", func() {
+			_, err := decryptLarkBody("", encrypt("key", []byte(`{}`)))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing workflow task v4", func() {
+
+	Context("matrixJobPreviews", func() {
+		matrixJob := func(name string, status config.Status, startTime int64) *commonmodels.JobTask {
+			return &commonmodels.JobTask{
+				Name:       "build-" + name,
+				OriginName: "build",
+				Matrix:     map[string]string{"os": name},
+				Status:     status,
+				StartTime:  startTime,
+			}
+		}
+
+		It("should ignore jobs without matrix", func() {
+			Expect(matrixJobPreviews([]*commonmodels.JobTask{{Name: "deploy", Status: config.StatusPassed}})).To(BeEmpty())
+		})
+		It("should group the jobs by the origin job", func() {
+			previews := matrixJobPreviews([]*commonmodels.JobTask{
+				matrixJob("linux", config.StatusPassed, 1),
+				{Name: "deploy", Status: config.StatusPassed},
+				matrixJob("windows", config.StatusPassed, 1),
+			})
+			Expect(previews).To(HaveLen(1))
+			Expect(previews[0].Name).To(Equal("build"))
+			Expect(previews[0].Jobs).To(Equal([]string{"build-linux", "build-windows"}))
+			Expect(previews[0].Status).To(Equal(config.StatusPassed))
+		})
+		It("should take the worst status of finished jobs", func() {
+			previews := matrixJobPreviews([]*commonmodels.JobTask{
+				matrixJob("linux", config.StatusFailed, 1),
+				matrixJob("windows", config.StatusPassed, 1),
+				matrixJob("darwin", config.StatusSkipped, 0),
+			})
+			Expect(previews[0].Status).To(Equal(config.StatusFailed))
+		})
+		It("should be running until all jobs finished", func() {
+			previews := matrixJobPreviews([]*commonmodels.JobTask{
+				matrixJob("linux", config.StatusFailed, 1),
+				matrixJob("windows", config.StatusRunning, 1),
+			})
+			Expect(previews[0].Status).To(Equal(config.StatusRunning))
+		})
+		It("should keep the status of jobs not started", func() {
+			previews := matrixJobPreviews([]*commonmodels.JobTask{
+				matrixJob("linux", config.StatusPrepare, 0),
+				matrixJob("windows", config.StatusPrepare, 0),
+			})
+			Expect(previews[0].Status).To(Equal(config.StatusPrepare))
+		})
+	})
+})
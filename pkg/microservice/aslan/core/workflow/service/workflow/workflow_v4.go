@@ -25,6 +25,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
@@ -41,6 +42,7 @@ import (
 	"github.com/koderover/zadig/pkg/setting"
 	e "github.com/koderover/zadig/pkg/tool/errors"
 	"github.com/koderover/zadig/pkg/tool/log"
+	"github.com/koderover/zadig/pkg/util/condition"
 )
 
 const (
@@ -62,6 +64,8 @@ func CreateWorkflowV4(user string, workflow *commonmodels.WorkflowV4, logger *za
 	if err := LintWorkflowV4(workflow, logger); err != nil {
 		return err
 	}
+	// the trigger chain is only set on the tasks triggered by the upstream hooks.
+	workflow.TriggerChain = nil
 
 	workflow.CreatedBy = user
 	workflow.UpdatedBy = user
@@ -105,6 +109,17 @@ func UpdateWorkflowV4(name, user string, inputWorkflow *commonmodels.WorkflowV4,
 	inputWorkflow.UpdateTime = time.Now().Unix()
 	inputWorkflow.ID = workflow.ID
 	inputWorkflow.HookCtls = workflow.HookCtls
+	inputWorkflow.GeneralHooks = workflow.GeneralHooks
+	inputWorkflow.UpstreamHooks = workflow.UpstreamHooks
+	inputWorkflow.RegistryHooks = workflow.RegistryHooks
+	inputWorkflow.TriggerChain = nil
+	if err := restorePrometheusTokens(inputWorkflow, workflow); err != nil {
+		logger.Errorf("Failed to restore prometheus tokens of workflow v4: %s, the error is: %v", name, err)
+		return e.ErrUpsertWorkflow.AddErr(err)
+	}
+	if err := restoreNotifySecrets(inputWorkflow, workflow); err != nil {
+		return e.ErrUpsertWorkflow.AddErr(err)
+	}
 
 	for _, stage := range inputWorkflow.Stages {
 		for _, job := range stage.Jobs {
@@ -134,9 +149,119 @@ func FindWorkflowV4(encryptedKey, name string, logger *zap.SugaredLogger) (*comm
 	if err := ensureWorkflowV4Resp(encryptedKey, workflow, logger); err != nil {
 		return workflow, err
 	}
+	maskGeneralHookSecrets(workflow.GeneralHooks)
+	maskRegistryHookSecrets(workflow.RegistryHooks)
+	maskPrometheusTokens(workflow)
+	maskNotifySecrets(workflow)
 	return workflow, err
 }
 
+// maskPrometheusTokens hides the prometheus tokens of the canary analysis jobs and the health checks of the deploy jobs in the responses.
+func maskPrometheusTokens(workflow *commonmodels.WorkflowV4) {
+	if workflow == nil {
+		return
+	}
+	for _, stage := range workflow.Stages {
+		for _, job := range stage.Jobs {
+			token, err := jobPrometheusToken(job)
+			if err != nil || token == nil {
+				continue
+			}
+			if *token != "" {
+				*token = setting.MaskValue
+			}
+		}
+	}
+}
+
+// restorePrometheusTokens keeps the saved prometheus tokens of the jobs which are masked in the input.
+func restorePrometheusTokens(input, saved *commonmodels.WorkflowV4) error {
+	savedTokens := make(map[string]string)
+	for _, stage := range saved.Stages {
+		for _, job := range stage.Jobs {
+			token, err := jobPrometheusToken(job)
+			if err != nil {
+				return err
+			}
+			if token != nil {
+				savedTokens[job.Name] = *token
+			}
+		}
+	}
+	for _, stage := range input.Stages {
+		for _, job := range stage.Jobs {
+			token, err := jobPrometheusToken(job)
+			if err != nil {
+				return err
+			}
+			if token == nil || *token != setting.MaskValue {
+				continue
+			}
+			*token = savedTokens[job.Name]
+		}
+	}
+	return nil
+}
+
+// jobPrometheusToken returns the prometheus token in the spec of the job, which is set back to the job,
+// it returns nil if the job has no prometheus token.
+func jobPrometheusToken(job *commonmodels.Job) (*string, error) {
+	switch job.JobType {
+	case config.JobCanaryAnalysis:
+		spec := &commonmodels.CanaryAnalysisJobSpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil {
+			return nil, err
+		}
+		job.Spec = spec
+		return &spec.PrometheusToken, nil
+	case config.JobZadigDeploy:
+		spec := &commonmodels.ZadigDeployJobSpec{}
+		if err := commonmodels.IToi(job.Spec, spec); err != nil {
+			return nil, err
+		}
+		if spec.HealthCheck == nil {
+			return nil, nil
+		}
+		job.Spec = spec
+		return &spec.HealthCheck.PrometheusToken, nil
+	}
+	return nil, nil
+}
+
+// maskNotifySecrets hides the secrets signing the webhook notifications in the responses.
+func maskNotifySecrets(workflow *commonmodels.WorkflowV4) {
+	if workflow == nil {
+		return
+	}
+	for _, notify := range workflow.NotifyCtls {
+		if notify.WebHookNotify != nil && notify.WebHookNotify.Secret != "" {
+			notify.WebHookNotify.Secret = setting.MaskValue
+		}
+	}
+}
+
+// restoreNotifySecrets keeps the saved secrets of the webhook notifications which are masked in the input,
+// the saved secret is kept only if the notification is still sent to the same address.
+func restoreNotifySecrets(input, saved *commonmodels.WorkflowV4) error {
+	savedSecrets := make(map[string]string)
+	for _, notify := range saved.NotifyCtls {
+		if notify.WebHookNotify != nil {
+			savedSecrets[notify.WebHookNotify.Address] = notify.WebHookNotify.Secret
+		}
+	}
+	for _, notify := range input.NotifyCtls {
+		if notify.WebHookNotify == nil || notify.WebHookNotify.Secret != setting.MaskValue {
+			continue
+		}
+		secret, ok := savedSecrets[notify.WebHookNotify.Address]
+		if !ok {
+			return fmt.Errorf("the secret of the webhook notification to %s should be set again", notify.WebHookNotify.Address)
+		}
+		notify.WebHookNotify.Secret = secret
+	}
+	return nil
+}
+
 func DeleteWorkflowV4(name string, logger *zap.SugaredLogger) error {
 	workflow, err := commonrepo.NewWorkflowV4Coll().Find(name)
 	if err != nil {
@@ -451,6 +576,10 @@ func LintWorkflowV4(workflow *commonmodels.WorkflowV4, logger *zap.SugaredLogger
 			logger.Errorf("duplicated stage name: %s", stage.Name)
 			return e.ErrUpsertWorkflow.AddDesc(fmt.Sprintf("duplicated stage name: %s", stage.Name))
 		}
+		if _, err := condition.Evaluate(stage.When, nil); err != nil {
+			logger.Errorf("invalid condition of stage %s: %v", stage.Name, err)
+			return e.ErrUpsertWorkflow.AddDesc(fmt.Sprintf("invalid condition of stage %s: %v", stage.Name, err))
+		}
 		for _, job := range stage.Jobs {
 			if match := reg.MatchString(job.Name); !match {
 				logger.Errorf("job name [%s] did not match %s", job.Name, JobNameRegx)
@@ -462,12 +591,80 @@ func LintWorkflowV4(workflow *commonmodels.WorkflowV4, logger *zap.SugaredLogger
 				logger.Errorf("duplicated job name: %s", job.Name)
 				return e.ErrUpsertWorkflow.AddDesc(fmt.Sprintf("duplicated job name: %s", job.Name))
 			}
+			if _, err := condition.Evaluate(job.When, nil); err != nil {
+				logger.Errorf("invalid condition of job %s: %v", job.Name, err)
+				return e.ErrUpsertWorkflow.AddDesc(fmt.Sprintf("invalid condition of job %s: %v", job.Name, err))
+			}
 			if err := jobctl.LintJob(job, workflow); err != nil {
 				logger.Errorf("lint job %s failed: %v", job.Name, err)
 				return e.ErrUpsertWorkflow.AddErr(err)
 			}
 		}
 	}
+	if err := lintJobDependency(workflow.Stages); err != nil {
+		logger.Errorf("lint job dependency failed: %v", err)
+		return e.ErrUpsertWorkflow.AddErr(err)
+	}
+	return nil
+}
+
+// lintJobDependency checks that every job in depends_on exists and the jobs have no circular dependency,
+// jobs without depends_on wait for the previous stage, and for the previous job when the stage is not parallel.
+func lintJobDependency(stages []*commonmodels.WorkflowStage) error {
+	jobNames := sets.NewString()
+	for _, stage := range stages {
+		for _, job := range stage.Jobs {
+			jobNames.Insert(job.Name)
+		}
+	}
+
+	upstreams := make(map[string][]string)
+	for i, stage := range stages {
+		for j, job := range stage.Jobs {
+			if len(job.DependsOn) > 0 {
+				for _, name := range job.DependsOn {
+					if !jobNames.Has(name) {
+						return fmt.Errorf("job %s depends on job %s which does not exist", job.Name, name)
+					}
+				}
+				upstreams[job.Name] = job.DependsOn
+				continue
+			}
+			if i > 0 {
+				for _, upstream := range stages[i-1].Jobs {
+					upstreams[job.Name] = append(upstreams[job.Name], upstream.Name)
+				}
+			}
+			if !stage.Parallel && j > 0 {
+				upstreams[job.Name] = append(upstreams[job.Name], stage.Jobs[j-1].Name)
+			}
+		}
+	}
+
+	// 0: not visited, 1: visiting, 2: visited
+	states := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch states[name] {
+		case 1:
+			return fmt.Errorf("job %s has circular dependency", name)
+		case 2:
+			return nil
+		}
+		states[name] = 1
+		for _, upstream := range upstreams[name] {
+			if err := visit(upstream); err != nil {
+				return err
+			}
+		}
+		states[name] = 2
+		return nil
+	}
+	for _, name := range jobNames.List() {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -663,6 +860,9 @@ func BulkCopyWorkflowV4(args BulkCopyWorkflowArgs, username string, log *zap.Sug
 			newItem.ID = primitive.NewObjectID()
 			// do not copy webhook triggers.
 			newItem.HookCtls = []*commonmodels.WorkflowV4Hook{}
+			newItem.GeneralHooks = []*commonmodels.GeneralHook{}
+			newItem.UpstreamHooks = []*commonmodels.UpstreamHook{}
+			newItem.RegistryHooks = []*commonmodels.RegistryHook{}
 
 			newWorkflows = append(newWorkflows, &newItem)
 		} else {
@@ -0,0 +1,388 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+	"github.com/koderover/zadig/pkg/util/condition"
+)
+
+const (
+	// GeneralHookTokenHeader carries the secret of the general hook as it is.
+	GeneralHookTokenHeader = "X-Zadig-Token"
+	// GeneralHookSignatureHeader carries the hex encoded hmac-sha256 of the payload signed by the secret, prefixed by "sha256=".
+	GeneralHookSignatureHeader = "X-Zadig-Signature"
+
+	generalHookSecretLength = 32
+)
+
+// CreateGeneralHookForWorkflowV4 returns the created hook, which is the only response carrying the secret of the hook.
+func CreateGeneralHookForWorkflowV4(workflowName string, input *commonmodels.GeneralHook, logger *zap.SugaredLogger) (*commonmodels.GeneralHook, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return nil, e.ErrCreateWebhook.AddErr(err)
+	}
+	for _, hook := range workflow.GeneralHooks {
+		if hook.Name == input.Name {
+			errMsg := fmt.Sprintf("general hook %s already exists", input.Name)
+			logger.Error(errMsg)
+			return nil, e.ErrCreateWebhook.AddDesc(errMsg)
+		}
+	}
+	if err := lintGeneralHook(input); err != nil {
+		logger.Errorf(err.Error())
+		return nil, e.ErrCreateWebhook.AddErr(err)
+	}
+	if input.Secret == "" || input.Secret == setting.MaskValue {
+		if input.Secret, err = newHookSecret(); err != nil {
+			logger.Errorf("failed to generate the secret of general hook %s: %v", input.Name, err)
+			return nil, e.ErrCreateWebhook.AddErr(err)
+		}
+	}
+	workflow.GeneralHooks = append(workflow.GeneralHooks, input)
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to create general hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return nil, e.ErrCreateWebhook.AddDesc(errMsg)
+	}
+	return input, nil
+}
+
+func UpdateGeneralHookForWorkflowV4(workflowName string, input *commonmodels.GeneralHook, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	if err := lintGeneralHook(input); err != nil {
+		logger.Errorf(err.Error())
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	var existHook *commonmodels.GeneralHook
+	for i, hook := range workflow.GeneralHooks {
+		if hook.Name == input.Name {
+			existHook = hook
+			workflow.GeneralHooks[i] = input
+			break
+		}
+	}
+	if existHook == nil {
+		errMsg := fmt.Sprintf("general hook %s does not exist", input.Name)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	// keep the secret if it is not changed, so the outside systems need not to be updated
+	if input.Secret == "" || input.Secret == setting.MaskValue {
+		input.Secret = existHook.Secret
+	}
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to update general hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func ListGeneralHookForWorkflowV4(workflowName string, logger *zap.SugaredLogger) ([]*commonmodels.GeneralHook, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return []*commonmodels.GeneralHook{}, e.ErrListWebhook.AddErr(err)
+	}
+	maskGeneralHookSecrets(workflow.GeneralHooks)
+	return workflow.GeneralHooks, nil
+}
+
+// newHookSecret generates the secret of the hooks triggering workflows, the secret must not be predictable.
+func newHookSecret() (string, error) {
+	secret := make([]byte, generalHookSecretLength/2)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// maskGeneralHookSecrets hides the secrets from the users who can only view the workflow.
+func maskGeneralHookSecrets(hooks []*commonmodels.GeneralHook) {
+	for _, hook := range hooks {
+		if hook.Secret != "" {
+			hook.Secret = setting.MaskValue
+		}
+	}
+}
+
+func DeleteGeneralHookForWorkflowV4(workflowName, hookName string, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrDeleteWebhook.AddErr(err)
+	}
+	updatedHooks := []*commonmodels.GeneralHook{}
+	for _, hook := range workflow.GeneralHooks {
+		if hook.Name != hookName {
+			updatedHooks = append(updatedHooks, hook)
+		}
+	}
+	if len(updatedHooks) == len(workflow.GeneralHooks) {
+		errMsg := fmt.Sprintf("general hook %s does not exist", hookName)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	workflow.GeneralHooks = updatedHooks
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to delete general hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func lintGeneralHook(hook *commonmodels.GeneralHook) error {
+	if err := validateHookNames([]string{hook.Name}); err != nil {
+		return err
+	}
+	for _, mapping := range hook.Mappings {
+		if mapping.Key == "" {
+			return fmt.Errorf("the key of the mapping should not be empty")
+		}
+		if (mapping.Path == "") == (mapping.Template == "") {
+			return fmt.Errorf("mapping %s: either path or template should be set", mapping.Key)
+		}
+		if mapping.Path != "" {
+			if err := jsonpath.New(mapping.Key).Parse(jsonPathTemplate(mapping.Path)); err != nil {
+				return fmt.Errorf("mapping %s: invalid path: %v", mapping.Key, err)
+			}
+		}
+		if mapping.Template != "" {
+			if _, err := template.New(mapping.Key).Parse(mapping.Template); err != nil {
+				return fmt.Errorf("mapping %s: invalid template: %v", mapping.Key, err)
+			}
+		}
+	}
+	if _, err := condition.Evaluate(hook.Filter, nil); err != nil {
+		return fmt.Errorf("invalid filter: %v", err)
+	}
+	return nil
+}
+
+// jsonPathTemplate accepts both $.a.b and {.a.b} as the json path.
+func jsonPathTemplate(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+	return "{" + path + "}"
+}
+
+func validGeneralHookSecret(secret string, header http.Header, payload []byte) bool {
+	if token := header.Get(GeneralHookTokenHeader); token != "" {
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal([]byte("sha256="+hex.EncodeToString(mac.Sum(nil))), []byte(header.Get(GeneralHookSignatureHeader)))
+}
+
+// generalHookValue returns the value picked by the mapping, objects and arrays are returned as json.
+func generalHookValue(mapping *commonmodels.GeneralHookMapping, payload interface{}) (string, error) {
+	var value string
+	if mapping.Template != "" {
+		tmpl, err := template.New(mapping.Key).Option("missingkey=zero").Parse(mapping.Template)
+		if err != nil {
+			return "", err
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, payload); err != nil {
+			return "", err
+		}
+		value = strings.ReplaceAll(buf.String(), "<no value>", "")
+	} else {
+		jp := jsonpath.New(mapping.Key)
+		jp.AllowMissingKeys(true)
+		if err := jp.Parse(jsonPathTemplate(mapping.Path)); err != nil {
+			return "", err
+		}
+		results, err := jp.FindResults(payload)
+		if err != nil {
+			return "", err
+		}
+		if len(results) > 0 && len(results[0]) > 0 && results[0][0].IsValid() && results[0][0].CanInterface() {
+			switch v := results[0][0].Interface().(type) {
+			case nil:
+			case string:
+				value = v
+			default:
+				bs, err := json.Marshal(v)
+				if err != nil {
+					return "", err
+				}
+				value = string(bs)
+			}
+		}
+	}
+	if value == "" {
+		value = mapping.Default
+	}
+	return value, nil
+}
+
+// renderGeneralHookMappings returns the values of the mappings, keyed by the param name, or <job name>.<key> for job variables.
+func renderGeneralHookMappings(mappings []*commonmodels.GeneralHookMapping, payload interface{}) (map[string]string, error) {
+	resp := make(map[string]string)
+	for _, mapping := range mappings {
+		value, err := generalHookValue(mapping, payload)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %v", mapping.Key, err)
+		}
+		key := mapping.Key
+		if mapping.JobName != "" {
+			key = mapping.JobName + "." + mapping.Key
+		}
+		resp[key] = value
+	}
+	return resp, nil
+}
+
+// TriggerWorkflowV4ByGeneralHook creates a task of the workflow for the payload sent to the general hook,
+// nil is returned without an error when the payload is filtered out.
+func TriggerWorkflowV4ByGeneralHook(workflowName, hookName string, header http.Header, payload []byte, logger *zap.SugaredLogger) (*CreateTaskV4Resp, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return nil, e.ErrFindWorkflow.AddErr(err)
+	}
+	var hook *commonmodels.GeneralHook
+	for _, h := range workflow.GeneralHooks {
+		if h.Name == hookName {
+			hook = h
+			break
+		}
+	}
+	if hook == nil || !hook.Enabled {
+		return nil, e.ErrNotFound.AddDesc(fmt.Sprintf("general hook %s of workflow %s is not found or disabled", hookName, workflowName))
+	}
+	if !validGeneralHookSecret(hook.Secret, header, payload) {
+		return nil, e.ErrForbidden.AddDesc("invalid secret")
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("payload is not a valid json: %v", err))
+	}
+	values, err := renderGeneralHookMappings(hook.Mappings, data)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddErr(err)
+	}
+	matched, err := condition.Evaluate(hook.Filter, values)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("failed to evaluate the filter: %v", err))
+	}
+	if !matched {
+		logger.Infof("payload of general hook %s of workflow %s is filtered out", hookName, workflowName)
+		return nil, nil
+	}
+
+	if err := job.MergeArgs(workflow, hook.WorkflowArg); err != nil {
+		errMsg := fmt.Sprintf("merge workflow args error: %v", err)
+		logger.Error(errMsg)
+		return nil, e.ErrCreateTask.AddDesc(errMsg)
+	}
+	for _, param := range workflow.Params {
+		if value, ok := values[param.Name]; ok {
+			param.Value = value
+		}
+	}
+	for _, stage := range workflow.Stages {
+		for _, j := range stage.Jobs {
+			if err := setJobKeyVals(j, j.Name+".", values); err != nil {
+				return nil, e.ErrCreateTask.AddErr(err)
+			}
+		}
+	}
+	return CreateWorkflowTaskV4(setting.GeneralHookTaskCreator, workflow, logger)
+}
+
+// setJobKeyVals sets the variables of the job whose keys are in the values with the prefix.
+func setJobKeyVals(j *commonmodels.Job, prefix string, values map[string]string) error {
+	value := func(key string) (string, bool) {
+		v, ok := values[prefix+key]
+		return v, ok
+	}
+	switch j.JobType {
+	case config.JobFreestyle:
+		spec := &commonmodels.FreestyleJobSpec{}
+		if err := commonmodels.IToi(j.Spec, spec); err != nil {
+			return err
+		}
+		if spec.Properties == nil {
+			return nil
+		}
+		for _, kv := range spec.Properties.Envs {
+			if v, ok := value(kv.Key); ok {
+				kv.Value = v
+			}
+		}
+		j.Spec = spec
+	case config.JobZadigBuild:
+		spec := &commonmodels.ZadigBuildJobSpec{}
+		if err := commonmodels.IToi(j.Spec, spec); err != nil {
+			return err
+		}
+		for _, build := range spec.ServiceAndBuilds {
+			for _, kv := range build.KeyVals {
+				if v, ok := value(kv.Key); ok {
+					kv.Value = v
+				}
+			}
+		}
+		j.Spec = spec
+	case config.JobPlugin:
+		spec := &commonmodels.PluginJobSpec{}
+		if err := commonmodels.IToi(j.Spec, spec); err != nil {
+			return err
+		}
+		if spec.Plugin == nil {
+			return nil
+		}
+		for _, input := range spec.Plugin.Inputs {
+			if v, ok := value(input.Name); ok {
+				input.Value = v
+			}
+		}
+		j.Spec = spec
+	}
+	return nil
+}
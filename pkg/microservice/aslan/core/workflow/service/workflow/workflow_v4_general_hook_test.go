@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing general hook", func() {
+
+	payload := []byte(`{"ref":"refs/heads/main","commits":[{"id":"abc"}],"release":{"tag":"v1.0.0","draft":false}}`)
+
+	Context("renderGeneralHookMappings", func() {
+		var data interface{}
+		BeforeEach(func() {
+			Expect(json.Unmarshal(payload, &data)).ShouldNot(HaveOccurred())
+		})
+
+		It("should pick values by json path and template", func() {
+			values, err := renderGeneralHookMappings([]*commonmodels.GeneralHookMapping{
+				{Key: "ref", Path: "$.ref"},
+				{Key: "COMMIT", JobName: "build", Path: "{.commits[0].id}"},
+				{Key: "tag", Template: "release-{{.release.tag}}"},
+				{Key: "draft", Path: "$.release.draft"},
+			}, data)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal(map[string]string{
+				"ref":          "refs/heads/main",
+				"build.COMMIT": "abc",
+				"tag":          "release-v1.0.0",
+				"draft":        "false",
+			}))
+		})
+
+		It("should fall back to the default value for missing keys", func() {
+			values, err := renderGeneralHookMappings([]*commonmodels.GeneralHookMapping{
+				{Key: "env", Path: "$.env", Default: "dev"},
+				{Key: "owner", Template: "{{.owner}}", Default: "zadig"},
+			}, data)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal(map[string]string{"env": "dev", "owner": "zadig"}))
+		})
+	})
+
+	Context("validGeneralHookSecret", func() {
+		It("should accept the token", func() {
+			header := http.Header{}
+			header.Set(GeneralHookTokenHeader, "secret")
+			Expect(validGeneralHookSecret("secret", header, payload)).To(BeTrue())
+			header.Set(GeneralHookTokenHeader, "other")
+			Expect(validGeneralHookSecret("secret", header, payload)).To(BeFalse())
+		})
+
+		It("should accept the signature", func() {
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write(payload)
+			header := http.Header{}
+			header.Set(GeneralHookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+			Expect(validGeneralHookSecret("secret", header, payload)).To(BeTrue())
+			Expect(validGeneralHookSecret("other", header, payload)).To(BeFalse())
+			Expect(validGeneralHookSecret("secret", http.Header{}, payload)).To(BeFalse())
+		})
+	})
+
+	Context("newHookSecret", func() {
+		It("should generate different secrets of the same length", func() {
+			first, err := newHookSecret()
+			Expect(err).ShouldNot(HaveOccurred())
+			second, err := newHookSecret()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(first).To(HaveLen(generalHookSecretLength))
+			Expect(first).NotTo(Equal(second))
+		})
+	})
+
+	Context("maskGeneralHookSecrets", func() {
+		It("should mask the secrets which are set", func() {
+			hooks := []*commonmodels.GeneralHook{{Name: "a", Secret: "secret"}, {Name: "b"}}
+			maskGeneralHookSecrets(hooks)
+			Expect(hooks[0].Secret).To(Equal(setting.MaskValue))
+			Expect(hooks[1].Secret).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,359 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	commonservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+)
+
+// registryPushEvent is a tag pushed to the image repo, repo is the full name of the repo, e.g. library/nginx.
+type registryPushEvent struct {
+	Repo string
+	Tag  string
+}
+
+// harborEvent is the payload of harbor webhooks, see https://goharbor.io/docs/main/working-with-projects/project-configuration/configure-webhooks/.
+type harborEvent struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Tag string `json:"tag"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// distributionEnvelope is the payload of docker distribution notifications, see https://docs.docker.com/registry/notifications/.
+type distributionEnvelope struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+	} `json:"events"`
+}
+
+// parseRegistryPushEvents returns the tags pushed in the notification of harbor or docker distribution.
+func parseRegistryPushEvents(payload []byte) ([]*registryPushEvent, error) {
+	resp := []*registryPushEvent{}
+
+	envelope := &distributionEnvelope{}
+	if err := json.Unmarshal(payload, envelope); err != nil {
+		return nil, err
+	}
+	if len(envelope.Events) > 0 {
+		for _, event := range envelope.Events {
+			// pulls and pushes of blobs are notified too, only pushes of manifests have tags.
+			if event.Action != "push" || event.Target.Tag == "" {
+				continue
+			}
+			resp = append(resp, &registryPushEvent{Repo: event.Target.Repository, Tag: event.Target.Tag})
+		}
+		return resp, nil
+	}
+
+	event := &harborEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	if event.Type != "PUSH_ARTIFACT" && event.Type != "pushImage" {
+		return resp, nil
+	}
+	for _, resource := range event.EventData.Resources {
+		if resource.Tag == "" {
+			continue
+		}
+		resp = append(resp, &registryPushEvent{Repo: event.EventData.Repository.RepoFullName, Tag: resource.Tag})
+	}
+	return resp, nil
+}
+
+// CreateRegistryHookForWorkflowV4 returns the created hook, which is the only response carrying the secret of the hook.
+func CreateRegistryHookForWorkflowV4(workflowName string, input *commonmodels.RegistryHook, logger *zap.SugaredLogger) (*commonmodels.RegistryHook, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return nil, e.ErrCreateWebhook.AddErr(err)
+	}
+	for _, hook := range workflow.RegistryHooks {
+		if hook.Name == input.Name {
+			errMsg := fmt.Sprintf("registry hook %s already exists", input.Name)
+			logger.Error(errMsg)
+			return nil, e.ErrCreateWebhook.AddDesc(errMsg)
+		}
+	}
+	if err := lintRegistryHook(workflow, input, logger); err != nil {
+		logger.Errorf(err.Error())
+		return nil, e.ErrCreateWebhook.AddErr(err)
+	}
+	if input.Secret == "" || input.Secret == setting.MaskValue {
+		if input.Secret, err = newHookSecret(); err != nil {
+			logger.Errorf("failed to generate the secret of registry hook %s: %v", input.Name, err)
+			return nil, e.ErrCreateWebhook.AddErr(err)
+		}
+	}
+	input.PolledTags = nil
+	workflow.RegistryHooks = append(workflow.RegistryHooks, input)
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to create registry hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return nil, e.ErrCreateWebhook.AddDesc(errMsg)
+	}
+	return input, nil
+}
+
+func UpdateRegistryHookForWorkflowV4(workflowName string, input *commonmodels.RegistryHook, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	if err := lintRegistryHook(workflow, input, logger); err != nil {
+		logger.Errorf(err.Error())
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	var existHook *commonmodels.RegistryHook
+	for i, hook := range workflow.RegistryHooks {
+		if hook.Name == input.Name {
+			existHook = hook
+			workflow.RegistryHooks[i] = input
+			break
+		}
+	}
+	if existHook == nil {
+		errMsg := fmt.Sprintf("registry hook %s does not exist", input.Name)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	if input.Secret == "" || input.Secret == setting.MaskValue {
+		input.Secret = existHook.Secret
+	}
+	// the polled tags are kept as long as the same tags are polled, or all the existing tags would trigger the workflow.
+	input.PolledTags = nil
+	if existHook.RegistryID == input.RegistryID && existHook.Repo == input.Repo && existHook.TagRegex == input.TagRegex {
+		input.PolledTags = existHook.PolledTags
+	}
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to update registry hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func ListRegistryHookForWorkflowV4(workflowName string, logger *zap.SugaredLogger) ([]*commonmodels.RegistryHook, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return []*commonmodels.RegistryHook{}, e.ErrListWebhook.AddErr(err)
+	}
+	maskRegistryHookSecrets(workflow.RegistryHooks)
+	return workflow.RegistryHooks, nil
+}
+
+func DeleteRegistryHookForWorkflowV4(workflowName, hookName string, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrDeleteWebhook.AddErr(err)
+	}
+	updatedHooks := []*commonmodels.RegistryHook{}
+	for _, hook := range workflow.RegistryHooks {
+		if hook.Name != hookName {
+			updatedHooks = append(updatedHooks, hook)
+		}
+	}
+	if len(updatedHooks) == len(workflow.RegistryHooks) {
+		errMsg := fmt.Sprintf("registry hook %s does not exist", hookName)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	workflow.RegistryHooks = updatedHooks
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to delete registry hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func lintRegistryHook(workflow *commonmodels.WorkflowV4, hook *commonmodels.RegistryHook, logger *zap.SugaredLogger) error {
+	if err := validateHookNames([]string{hook.Name}); err != nil {
+		return err
+	}
+	if hook.Repo == "" {
+		return fmt.Errorf("image repo should not be empty")
+	}
+	if _, err := regexp.Compile(hook.TagRegex); err != nil {
+		return fmt.Errorf("invalid tag regex: %v", err)
+	}
+	if _, _, err := commonservice.FindRegistryById(hook.RegistryID, false, logger); err != nil {
+		return fmt.Errorf("failed to find registry %s: %v", hook.RegistryID, err)
+	}
+	if hook.ServiceName == "" || hook.ServiceModule == "" {
+		return fmt.Errorf("service and service module should not be empty")
+	}
+	for _, stage := range workflow.Stages {
+		for _, j := range stage.Jobs {
+			if j.Name != hook.JobName {
+				continue
+			}
+			if j.JobType != config.JobZadigDeploy {
+				return fmt.Errorf("job %s is not a zadig deploy job", hook.JobName)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("job %s is not found", hook.JobName)
+}
+
+// registryHookMatched returns whether the tag pushed to the repo triggers the hook, repo is the full name of the repo.
+func registryHookMatched(hook *commonmodels.RegistryHook, registry *commonmodels.RegistryNamespace, repo, tag string) bool {
+	if repo != hook.Repo && repo != path.Join(registry.Namespace, hook.Repo) {
+		return false
+	}
+	return registryTagMatched(hook, tag)
+}
+
+func registryTagMatched(hook *commonmodels.RegistryHook, tag string) bool {
+	if hook.TagRegex == "" {
+		return true
+	}
+	matched, err := regexp.MatchString(hook.TagRegex, tag)
+	return err == nil && matched
+}
+
+func validRegistryHookSecret(secret string, header http.Header) bool {
+	token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// maskRegistryHookSecrets hides the secrets from the users who can only view the workflow.
+func maskRegistryHookSecrets(hooks []*commonmodels.RegistryHook) {
+	for _, hook := range hooks {
+		if hook.Secret != "" {
+			hook.Secret = setting.MaskValue
+		}
+	}
+}
+
+// TriggerWorkflowV4ByRegistryHook creates the tasks of the workflow for the tags pushed in the registry notification.
+func TriggerWorkflowV4ByRegistryHook(workflowName, hookName string, header http.Header, payload []byte, logger *zap.SugaredLogger) ([]*CreateTaskV4Resp, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return nil, e.ErrFindWorkflow.AddErr(err)
+	}
+	var hook *commonmodels.RegistryHook
+	for _, h := range workflow.RegistryHooks {
+		if h.Name == hookName {
+			hook = h
+			break
+		}
+	}
+	if hook == nil || !hook.Enabled {
+		return nil, e.ErrNotFound.AddDesc(fmt.Sprintf("registry hook %s of workflow %s is not found or disabled", hookName, workflowName))
+	}
+	if !validRegistryHookSecret(hook.Secret, header) {
+		return nil, e.ErrForbidden.AddDesc("invalid secret")
+	}
+	events, err := parseRegistryPushEvents(payload)
+	if err != nil {
+		return nil, e.ErrInvalidParam.AddDesc(fmt.Sprintf("invalid registry notification: %v", err))
+	}
+	registry, _, err := commonservice.FindRegistryById(hook.RegistryID, true, logger)
+	if err != nil {
+		return nil, e.ErrCreateTask.AddDesc(fmt.Sprintf("failed to find registry %s: %v", hook.RegistryID, err))
+	}
+
+	// the tags deployed by the notifications are recorded as polled, so the poller does not deploy them again.
+	recordPolled := hook.Polling && hook.PolledTags != nil
+	polled := sets.NewString(hook.PolledTags...)
+	resp := []*CreateTaskV4Resp{}
+	for _, event := range events {
+		if !registryHookMatched(hook, registry, event.Repo, event.Tag) || polled.Has(event.Tag) {
+			continue
+		}
+		if recordPolled {
+			claimed, err := commonrepo.NewWorkflowV4Coll().ClaimRegistryHookPolledTag(workflowName, hook.Name, event.Tag)
+			if err != nil {
+				return resp, e.ErrCreateTask.AddErr(err)
+			}
+			if !claimed {
+				continue
+			}
+		}
+		polled.Insert(event.Tag)
+		task, err := triggerWorkflowV4ByRegistryTag(workflowName, hook, GetImage(registry, hook.Repo+":"+event.Tag), logger)
+		if err != nil {
+			return resp, e.ErrCreateTask.AddErr(err)
+		}
+		resp = append(resp, task)
+	}
+	return resp, nil
+}
+
+// triggerWorkflowV4ByRegistryTag deploys the image by the zadig deploy job of the hook.
+func triggerWorkflowV4ByRegistryTag(workflowName string, hook *commonmodels.RegistryHook, image string, logger *zap.SugaredLogger) (*CreateTaskV4Resp, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		return nil, err
+	}
+	if err := job.MergeArgs(workflow, hook.WorkflowArg); err != nil {
+		return nil, fmt.Errorf("merge workflow args error: %v", err)
+	}
+	for _, stage := range workflow.Stages {
+		for _, j := range stage.Jobs {
+			if j.Name != hook.JobName || j.JobType != config.JobZadigDeploy {
+				continue
+			}
+			spec := &commonmodels.ZadigDeployJobSpec{}
+			if err := commonmodels.IToi(j.Spec, spec); err != nil {
+				return nil, err
+			}
+			spec.Source = config.SourceRuntime
+			spec.ServiceAndImages = []*commonmodels.ServiceAndImage{{
+				ServiceName:   hook.ServiceName,
+				ServiceModule: hook.ServiceModule,
+				Image:         image,
+			}}
+			j.Spec = spec
+		}
+	}
+	logger.Infof("workflow %s is triggered by registry hook %s, image: %s", workflowName, hook.Name, image)
+	return CreateWorkflowTaskV4(setting.RegistryHookTaskCreator, workflow, logger)
+}
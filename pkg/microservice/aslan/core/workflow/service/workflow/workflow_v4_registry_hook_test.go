@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing registry hook", func() {
+
+	Context("parseRegistryPushEvents", func() {
+		It("should parse harbor notifications", func() {
+			payload := `{"type":"PUSH_ARTIFACT","occur_at":1665360000,"operator":"admin","event_data":{"resources":[{"digest":"sha256:1f2e","tag":"v1.0.0","resource_url":"harbor.example.com/library/app:v1.0.0"}],"repository":{"name":"app","namespace":"library","repo_full_name":"library/app","repo_type":"private"}}}`
+			events, err := parseRegistryPushEvents([]byte(payload))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(events).To(Equal([]*registryPushEvent{{Repo: "library/app", Tag: "v1.0.0"}}))
+		})
+		It("should ignore other harbor events", func() {
+			payload := `{"type":"PULL_ARTIFACT","event_data":{"resources":[{"tag":"v1.0.0"}],"repository":{"repo_full_name":"library/app"}}}`
+			events, err := parseRegistryPushEvents([]byte(payload))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(events).To(BeEmpty())
+		})
+		It("should parse docker distribution notifications", func() {
+			payload := `{"events":[{"id":"1","action":"push","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","digest":"sha256:1f2e","repository":"library/app","tag":"v1.0.1"}},{"id":"2","action":"push","target":{"mediaType":"application/octet-stream","digest":"sha256:3c4d","repository":"library/app"}},{"id":"3","action":"pull","target":{"repository":"library/app","tag":"v1.0.0"}}]}`
+			events, err := parseRegistryPushEvents([]byte(payload))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(events).To(Equal([]*registryPushEvent{{Repo: "library/app", Tag: "v1.0.1"}}))
+		})
+		It("should raise error for invalid payload", func() {
+			_, err := parseRegistryPushEvents([]byte("push"))
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("registryHookMatched", func() {
+		registry := &commonmodels.RegistryNamespace{Namespace: "library"}
+		hook := &commonmodels.RegistryHook{Repo: "app", TagRegex: "^v[0-9.]+$"}
+
+		It("should match the repo in the namespace of the registry", func() {
+			Expect(registryHookMatched(hook, registry, "library/app", "v1.0.0")).To(BeTrue())
+			Expect(registryHookMatched(hook, registry, "app", "v1.0.0")).To(BeTrue())
+			Expect(registryHookMatched(hook, registry, "other/app", "v1.0.0")).To(BeFalse())
+		})
+		It("should filter the tags by regex", func() {
+			Expect(registryHookMatched(hook, registry, "library/app", "v1.0.0-rc1")).To(BeFalse())
+			Expect(registryHookMatched(&commonmodels.RegistryHook{Repo: "app"}, registry, "library/app", "latest")).To(BeTrue())
+		})
+	})
+
+	Context("newRegistryTags", func() {
+		It("should take nothing as new for the first polling", func() {
+			Expect(newRegistryTags(nil, []string{"v1", "v2"})).To(BeEmpty())
+		})
+		It("should return the tags not polled", func() {
+			Expect(newRegistryTags([]string{}, []string{"v1"})).To(Equal([]string{"v1"}))
+			Expect(newRegistryTags([]string{"v1", "v2"}, []string{"v3", "v2", "v1"})).To(Equal([]string{"v3"}))
+		})
+	})
+
+	Context("staleRegistryTags", func() {
+		It("should return the polled tags no longer in the registry", func() {
+			Expect(staleRegistryTags([]string{"v1", "v2", "v3"}, []string{"v3", "v4"})).To(Equal([]string{"v1", "v2"}))
+			Expect(staleRegistryTags([]string{"v1"}, []string{"v1", "v2"})).To(BeEmpty())
+		})
+	})
+
+	Context("validRegistryHookSecret", func() {
+		It("should accept the bearer token equal to the secret", func() {
+			header := http.Header{}
+			header.Set("Authorization", "Bearer secret")
+			Expect(validRegistryHookSecret("secret", header)).To(BeTrue())
+			Expect(validRegistryHookSecret("other", header)).To(BeFalse())
+		})
+		It("should reject the request without token", func() {
+			Expect(validRegistryHookSecret("", http.Header{})).To(BeFalse())
+		})
+	})
+
+	Context("maskRegistryHookSecrets", func() {
+		It("should mask the secrets which are set", func() {
+			hooks := []*commonmodels.RegistryHook{{Name: "a", Secret: "secret"}, {Name: "b"}}
+			maskRegistryHookSecrets(hooks)
+			Expect(hooks[0].Secret).To(Equal(setting.MaskValue))
+			Expect(hooks[1].Secret).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/setting"
+)
+
+var _ = Describe("Testing workflow v4", func() {
+
+	Context("lintJobDependency", func() {
+		It("should be passed for stages without dependency", func() {
+			stages := []*commonmodels.WorkflowStage{
+				{Name: "build", Parallel: true, Jobs: []*commonmodels.Job{{Name: "build-a"}, {Name: "build-b"}}},
+				{Name: "deploy", Jobs: []*commonmodels.Job{{Name: "deploy-a"}, {Name: "deploy-b"}}},
+			}
+			Expect(lintJobDependency(stages)).ShouldNot(HaveOccurred())
+		})
+		It("should be passed for dependencies across stages", func() {
+			stages := []*commonmodels.WorkflowStage{
+				{Name: "build", Parallel: true, Jobs: []*commonmodels.Job{{Name: "build-a"}, {Name: "build-b"}}},
+				{Name: "deploy", Parallel: true, Jobs: []*commonmodels.Job{
+					{Name: "deploy-a", DependsOn: []string{"build-a"}},
+					{Name: "deploy-b", DependsOn: []string{"build-b"}},
+				}},
+			}
+			Expect(lintJobDependency(stages)).ShouldNot(HaveOccurred())
+		})
+		It("should raise error for missing job", func() {
+			stages := []*commonmodels.WorkflowStage{
+				{Name: "deploy", Jobs: []*commonmodels.Job{{Name: "deploy-a", DependsOn: []string{"build-a"}}}},
+			}
+			Expect(lintJobDependency(stages)).Should(HaveOccurred())
+		})
+		It("should raise error for circular dependency", func() {
+			stages := []*commonmodels.WorkflowStage{
+				{Name: "build", Parallel: true, Jobs: []*commonmodels.Job{
+					{Name: "build-a", DependsOn: []string{"deploy-a"}},
+				}},
+				{Name: "deploy", Jobs: []*commonmodels.Job{{Name: "deploy-a"}}},
+			}
+			Expect(lintJobDependency(stages)).Should(HaveOccurred())
+		})
+		It("should raise error for self dependency", func() {
+			stages := []*commonmodels.WorkflowStage{
+				{Name: "build", Jobs: []*commonmodels.Job{{Name: "build-a", DependsOn: []string{"build-a"}}}},
+			}
+			Expect(lintJobDependency(stages)).Should(HaveOccurred())
+		})
+	})
+
+	Context("prometheus tokens", func() {
+		newWorkflow := func(token string) *commonmodels.WorkflowV4 {
+			return &commonmodels.WorkflowV4{Stages: []*commonmodels.WorkflowStage{{Name: "release", Jobs: []*commonmodels.Job{
+				{Name: "analysis", JobType: config.JobCanaryAnalysis, Spec: &commonmodels.CanaryAnalysisJobSpec{PrometheusAddress: "http://prometheus:9090", PrometheusToken: token}},
+				{Name: "deploy", JobType: config.JobZadigDeploy, Spec: &commonmodels.ZadigDeployJobSpec{Env: "dev"}},
+			}}}}
+		}
+		analysisSpec := func(workflow *commonmodels.WorkflowV4) *commonmodels.CanaryAnalysisJobSpec {
+			spec := &commonmodels.CanaryAnalysisJobSpec{}
+			Expect(commonmodels.IToi(workflow.Stages[0].Jobs[0].Spec, spec)).NotTo(HaveOccurred())
+			return spec
+		}
+
+		It("should mask the tokens of canary analysis jobs only", func() {
+			workflow := newWorkflow("secret")
+			maskPrometheusTokens(workflow)
+			Expect(analysisSpec(workflow).PrometheusToken).To(Equal(setting.MaskValue))
+			Expect(analysisSpec(workflow).PrometheusAddress).To(Equal("http://prometheus:9090"))
+			Expect(workflow.Stages[0].Jobs[1].Spec).To(Equal(&commonmodels.ZadigDeployJobSpec{Env: "dev"}))
+		})
+		It("should keep the empty tokens", func() {
+			workflow := newWorkflow("")
+			maskPrometheusTokens(workflow)
+			Expect(analysisSpec(workflow).PrometheusToken).To(BeEmpty())
+		})
+		It("should restore the masked tokens with the saved ones", func() {
+			workflow := newWorkflow(setting.MaskValue)
+			Expect(restorePrometheusTokens(workflow, newWorkflow("secret"))).NotTo(HaveOccurred())
+			Expect(analysisSpec(workflow).PrometheusToken).To(Equal("secret"))
+		})
+		It("should keep the tokens changed by the users", func() {
+			workflow := newWorkflow("new-secret")
+			Expect(restorePrometheusTokens(workflow, newWorkflow("secret"))).NotTo(HaveOccurred())
+			Expect(analysisSpec(workflow).PrometheusToken).To(Equal("new-secret"))
+		})
+
+		newDeployWorkflow := func(token string) *commonmodels.WorkflowV4 {
+			return &commonmodels.WorkflowV4{Stages: []*commonmodels.WorkflowStage{{Name: "deploy", Jobs: []*commonmodels.Job{
+				{Name: "deploy", JobType: config.JobZadigDeploy, Spec: &commonmodels.ZadigDeployJobSpec{Env: "dev", HealthCheck: &commonmodels.DeployHealthCheck{PrometheusAddress: "http://prometheus:9090", PrometheusToken: token}}},
+			}}}}
+		}
+		healthCheck := func(workflow *commonmodels.WorkflowV4) *commonmodels.DeployHealthCheck {
+			spec := &commonmodels.ZadigDeployJobSpec{}
+			Expect(commonmodels.IToi(workflow.Stages[0].Jobs[0].Spec, spec)).NotTo(HaveOccurred())
+			return spec.HealthCheck
+		}
+
+		It("should mask the tokens of health checks of deploy jobs", func() {
+			workflow := newDeployWorkflow("secret")
+			maskPrometheusTokens(workflow)
+			Expect(healthCheck(workflow).PrometheusToken).To(Equal(setting.MaskValue))
+			Expect(healthCheck(workflow).PrometheusAddress).To(Equal("http://prometheus:9090"))
+		})
+		It("should restore the masked tokens of health checks", func() {
+			workflow := newDeployWorkflow(setting.MaskValue)
+			Expect(restorePrometheusTokens(workflow, newDeployWorkflow("secret"))).NotTo(HaveOccurred())
+			Expect(healthCheck(workflow).PrometheusToken).To(Equal("secret"))
+		})
+		It("should mask the tokens of health checks in the deploy job tasks", func() {
+			check := &commonmodels.DeployHealthCheck{PrometheusToken: "secret"}
+			deploy := &commonmodels.JobTask{JobType: string(config.JobZadigDeploy), Spec: &commonmodels.JobTaskDeploySpec{HealthCheck: check}}
+			helmDeploy := &commonmodels.JobTask{JobType: string(config.JobZadigHelmDeploy), Spec: &commonmodels.JobTaskHelmDeploySpec{HealthCheck: check}}
+			maskJobTaskPrometheusToken(deploy)
+			maskJobTaskPrometheusToken(helmDeploy)
+			Expect(deploy.Spec.(*commonmodels.JobTaskDeploySpec).HealthCheck.PrometheusToken).To(Equal(setting.MaskValue))
+			Expect(helmDeploy.Spec.(*commonmodels.JobTaskHelmDeploySpec).HealthCheck.PrometheusToken).To(Equal(setting.MaskValue))
+			Expect(check.PrometheusToken).To(Equal("secret"))
+		})
+	})
+
+	Context("webhook notification secrets", func() {
+		newWorkflow := func(address, secret string) *commonmodels.WorkflowV4 {
+			return &commonmodels.WorkflowV4{NotifyCtls: []*commonmodels.NotifyCtl{
+				{WebHookType: "webhook", WebHookNotify: &commonmodels.WebhookNotify{Address: address, Secret: secret}},
+				{WebHookType: "dingding", DingDingWebHook: "http://dingding.example.com"},
+			}}
+		}
+
+		It("should mask the secrets and keep the empty ones", func() {
+			workflow := newWorkflow("http://hook.example.com", "secret")
+			maskNotifySecrets(workflow)
+			Expect(workflow.NotifyCtls[0].WebHookNotify.Secret).To(Equal(setting.MaskValue))
+			Expect(workflow.NotifyCtls[0].WebHookNotify.Address).To(Equal("http://hook.example.com"))
+
+			workflow = newWorkflow("http://hook.example.com", "")
+			maskNotifySecrets(workflow)
+			Expect(workflow.NotifyCtls[0].WebHookNotify.Secret).To(BeEmpty())
+		})
+		It("should restore the masked secrets with the saved ones", func() {
+			workflow := newWorkflow("http://hook.example.com", setting.MaskValue)
+			Expect(restoreNotifySecrets(workflow, newWorkflow("http://hook.example.com", "secret"))).NotTo(HaveOccurred())
+			Expect(workflow.NotifyCtls[0].WebHookNotify.Secret).To(Equal("secret"))
+		})
+		It("should keep the secrets changed by the users", func() {
+			workflow := newWorkflow("http://hook.example.com", "new-secret")
+			Expect(restoreNotifySecrets(workflow, newWorkflow("http://hook.example.com", "secret"))).NotTo(HaveOccurred())
+			Expect(workflow.NotifyCtls[0].WebHookNotify.Secret).To(Equal("new-secret"))
+		})
+		It("should raise error for masked secrets of new addresses", func() {
+			workflow := newWorkflow("http://other.example.com", setting.MaskValue)
+			Expect(restoreNotifySecrets(workflow, newWorkflow("http://hook.example.com", "secret"))).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,374 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/service/workflow/job"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/shared/client/policy"
+	e "github.com/koderover/zadig/pkg/tool/errors"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// maxTriggerChainLength limits the number of workflows triggered one by one by the upstream hooks.
+const maxTriggerChainLength = 10
+
+// upstreamHookStatuses are the statuses of the upstream task which are able to trigger the workflow.
+var upstreamHookStatuses = sets.NewString(string(config.StatusPassed), string(config.StatusFailed), string(config.StatusTimeout))
+
+func CreateUpstreamHookForWorkflowV4(workflowName, userID string, input *commonmodels.UpstreamHook, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrCreateWebhook.AddErr(err)
+	}
+	for _, hook := range workflow.UpstreamHooks {
+		if hook.Name == input.Name {
+			errMsg := fmt.Sprintf("upstream hook %s already exists", input.Name)
+			logger.Error(errMsg)
+			return e.ErrCreateWebhook.AddDesc(errMsg)
+		}
+	}
+	if err := lintUpstreamHook(workflowName, userID, input); err != nil {
+		logger.Errorf(err.Error())
+		return e.ErrCreateWebhook.AddErr(err)
+	}
+	workflow.UpstreamHooks = append(workflow.UpstreamHooks, input)
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to create upstream hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrCreateWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func UpdateUpstreamHookForWorkflowV4(workflowName, userID string, input *commonmodels.UpstreamHook, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	if err := lintUpstreamHook(workflowName, userID, input); err != nil {
+		logger.Errorf(err.Error())
+		return e.ErrUpdateWebhook.AddErr(err)
+	}
+	updated := false
+	for i, hook := range workflow.UpstreamHooks {
+		if hook.Name == input.Name {
+			workflow.UpstreamHooks[i] = input
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		errMsg := fmt.Sprintf("upstream hook %s does not exist", input.Name)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to update upstream hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrUpdateWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+func ListUpstreamHookForWorkflowV4(workflowName string, logger *zap.SugaredLogger) ([]*commonmodels.UpstreamHook, error) {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return []*commonmodels.UpstreamHook{}, e.ErrListWebhook.AddErr(err)
+	}
+	return workflow.UpstreamHooks, nil
+}
+
+func DeleteUpstreamHookForWorkflowV4(workflowName, hookName string, logger *zap.SugaredLogger) error {
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		logger.Errorf("Failed to find WorkflowV4: %s, the error is: %v", workflowName, err)
+		return e.ErrDeleteWebhook.AddErr(err)
+	}
+	updatedHooks := []*commonmodels.UpstreamHook{}
+	for _, hook := range workflow.UpstreamHooks {
+		if hook.Name != hookName {
+			updatedHooks = append(updatedHooks, hook)
+		}
+	}
+	if len(updatedHooks) == len(workflow.UpstreamHooks) {
+		errMsg := fmt.Sprintf("upstream hook %s does not exist", hookName)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	workflow.UpstreamHooks = updatedHooks
+	if err := commonrepo.NewWorkflowV4Coll().Update(workflow.ID.Hex(), workflow); err != nil {
+		errMsg := fmt.Sprintf("failed to delete upstream hook for workflow %s, the error is: %v", workflowName, err)
+		logger.Error(errMsg)
+		return e.ErrDeleteWebhook.AddDesc(errMsg)
+	}
+	return nil
+}
+
+// lintUpstreamHook checks the hook created by the user, who must be able to view the upstream workflow, otherwise the
+// outputs of the workflows in other projects are leaked by the mappings.
+func lintUpstreamHook(workflowName, userID string, hook *commonmodels.UpstreamHook) error {
+	if err := validateHookNames([]string{hook.Name}); err != nil {
+		return err
+	}
+	if hook.WorkflowName == "" {
+		return fmt.Errorf("upstream workflow should not be empty")
+	}
+	upstream, err := commonrepo.NewWorkflowV4Coll().Find(hook.WorkflowName)
+	if err != nil {
+		return fmt.Errorf("failed to find upstream workflow %s: %v", hook.WorkflowName, err)
+	}
+	if !canViewWorkflow(userID, upstream) {
+		return fmt.Errorf("permission denied to view upstream workflow %s", hook.WorkflowName)
+	}
+	if len(hook.Statuses) == 0 {
+		return fmt.Errorf("at least one status of the upstream task should be chosen")
+	}
+	for _, status := range hook.Statuses {
+		if !upstreamHookStatuses.Has(string(status)) {
+			return fmt.Errorf("status should be one of %s", strings.Join(upstreamHookStatuses.List(), ", "))
+		}
+	}
+	for _, mapping := range hook.Mappings {
+		if mapping.Key == "" {
+			return fmt.Errorf("the key of the mapping should not be empty")
+		}
+	}
+	path, err := findUpstreamHookLoop(workflowName, hook.WorkflowName, listDownstreamWorkflows)
+	if err != nil {
+		return err
+	}
+	if len(path) > 0 {
+		return fmt.Errorf("the workflows trigger each other in a loop: %s", strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+func canViewWorkflow(userID string, workflow *commonmodels.WorkflowV4) bool {
+	permissions, err := policy.NewDefault().GetResourcePermission(&policy.ResourcePermissionReq{
+		ProjectName:  workflow.Project,
+		Uid:          userID,
+		Resources:    []string{workflow.Name},
+		ResourceType: "Workflow",
+	})
+	if err != nil {
+		log.Errorf("failed to get the permission of user %s on workflow %s: %v", userID, workflow.Name, err)
+		return false
+	}
+	for _, verb := range permissions[workflow.Name] {
+		if verb == "*" || verb == "get_workflow" {
+			return true
+		}
+	}
+	return false
+}
+
+func listDownstreamWorkflows(workflowName string) ([]string, error) {
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{Upstream: workflowName}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp := []string{}
+	for _, workflow := range workflows {
+		resp = append(resp, workflow.Name)
+	}
+	return resp, nil
+}
+
+// findUpstreamHookLoop returns the path from the workflow back to the upstream workflow through the existing
+// upstream hooks, which turns into a loop once the workflow is triggered by the upstream workflow.
+func findUpstreamHookLoop(workflowName, upstream string, downstreams func(string) ([]string, error)) ([]string, error) {
+	visited := sets.NewString()
+	var visit func(name string) ([]string, error)
+	visit = func(name string) ([]string, error) {
+		if name == upstream {
+			return []string{name}, nil
+		}
+		if visited.Has(name) {
+			return nil, nil
+		}
+		visited.Insert(name)
+		names, err := downstreams(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, next := range names {
+			path, err := visit(next)
+			if err != nil {
+				return nil, err
+			}
+			if len(path) > 0 {
+				return append([]string{name}, path...), nil
+			}
+		}
+		return nil, nil
+	}
+	path, err := visit(workflowName)
+	if err != nil || len(path) == 0 {
+		return nil, err
+	}
+	return append(path, workflowName), nil
+}
+
+// upstreamTaskVars returns the variables of the upstream task for the mappings, including the workflow info,
+// the outputs of the jobs and the images built by the zadig build jobs.
+func upstreamTaskVars(task *commonmodels.WorkflowTask) map[string]string {
+	vars := map[string]string{
+		"upstream.project":  task.ProjectName,
+		"upstream.workflow": task.WorkflowName,
+		"upstream.task_id":  fmt.Sprintf("%d", task.TaskID),
+		"upstream.status":   string(task.Status),
+		"upstream.creator":  task.TaskCreator,
+	}
+	for k, v := range task.GlobalContext {
+		vars[k] = v
+	}
+	for _, stage := range task.Stages {
+		for _, jobTask := range stage.Jobs {
+			if jobTask.JobType != string(config.JobZadigBuild) || jobTask.Status != config.StatusPassed {
+				continue
+			}
+			spec := &commonmodels.JobTaskFreestyleSpec{}
+			if err := commonmodels.IToi(jobTask.Spec, spec); err != nil {
+				continue
+			}
+			envs := make(map[string]string)
+			for _, env := range spec.Properties.Envs {
+				envs[env.Key] = env.Value
+			}
+			if envs["IMAGE"] == "" {
+				continue
+			}
+			vars[strings.Join([]string{"job", jobTask.OriginName, envs["SERVICE"], envs["SERVICE_MODULE"], "IMAGE"}, ".")] = envs["IMAGE"]
+		}
+	}
+	return vars
+}
+
+// renderUpstreamHookMappings returns the values of the mappings, keyed by the param name, or <job name>.<key> for job variables.
+func renderUpstreamHookMappings(mappings []*commonmodels.UpstreamHookMapping, vars map[string]string) map[string]string {
+	resp := make(map[string]string)
+	for _, mapping := range mappings {
+		value := mapping.Value
+		for k, v := range vars {
+			value = strings.ReplaceAll(value, fmt.Sprintf(setting.RenderValueTemplate, k), v)
+		}
+		key := mapping.Key
+		if mapping.JobName != "" {
+			key = mapping.JobName + "." + mapping.Key
+		}
+		resp[key] = value
+	}
+	return resp
+}
+
+func upstreamHookMatched(hook *commonmodels.UpstreamHook, task *commonmodels.WorkflowTask) bool {
+	if !hook.Enabled || hook.WorkflowName != task.WorkflowName {
+		return false
+	}
+	for _, status := range hook.Statuses {
+		if status == task.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// TriggerWorkflowV4ByUpstream creates the tasks of the workflows whose upstream hooks match the finished task.
+func TriggerWorkflowV4ByUpstream(task *commonmodels.WorkflowTask, logger *zap.SugaredLogger) {
+	if !upstreamHookStatuses.Has(string(task.Status)) {
+		return
+	}
+	workflows, _, err := commonrepo.NewWorkflowV4Coll().List(&commonrepo.ListWorkflowV4Option{Upstream: task.WorkflowName}, 0, 0)
+	if err != nil {
+		logger.Errorf("failed to list downstream workflows of %s, the error is: %v", task.WorkflowName, err)
+		return
+	}
+	if len(workflows) == 0 {
+		return
+	}
+
+	chain := []string{}
+	if task.WorkflowArgs != nil {
+		chain = append(chain, task.WorkflowArgs.TriggerChain...)
+	}
+	chain = append(chain, task.WorkflowName)
+	if len(chain) > maxTriggerChainLength {
+		logger.Warnf("workflow %s:%d is not going to trigger the downstream workflows, the trigger chain is too long: %s", task.WorkflowName, task.TaskID, strings.Join(chain, " -> "))
+		return
+	}
+	triggered := sets.NewString(chain...)
+	vars := upstreamTaskVars(task)
+
+	for _, workflow := range workflows {
+		if triggered.Has(workflow.Name) {
+			logger.Warnf("workflow %s is not triggered by %s:%d to break the loop: %s", workflow.Name, task.WorkflowName, task.TaskID, strings.Join(chain, " -> "))
+			continue
+		}
+		for _, hook := range workflow.UpstreamHooks {
+			if !upstreamHookMatched(hook, task) {
+				continue
+			}
+			if err := triggerWorkflowV4ByUpstreamHook(workflow.Name, hook, chain, vars, logger); err != nil {
+				logger.Errorf("failed to trigger workflow %s by upstream hook %s, the error is: %v", workflow.Name, hook.Name, err)
+			}
+		}
+	}
+}
+
+func triggerWorkflowV4ByUpstreamHook(workflowName string, hook *commonmodels.UpstreamHook, chain []string, vars map[string]string, logger *zap.SugaredLogger) error {
+	// every hook creates the task from a fresh copy of the workflow.
+	workflow, err := commonrepo.NewWorkflowV4Coll().Find(workflowName)
+	if err != nil {
+		return err
+	}
+	if err := job.MergeArgs(workflow, hook.WorkflowArg); err != nil {
+		return fmt.Errorf("merge workflow args error: %v", err)
+	}
+	values := renderUpstreamHookMappings(hook.Mappings, vars)
+	for _, param := range workflow.Params {
+		if value, ok := values[param.Name]; ok {
+			param.Value = value
+		}
+	}
+	for _, stage := range workflow.Stages {
+		for _, j := range stage.Jobs {
+			if err := setJobKeyVals(j, j.Name+".", values); err != nil {
+				return err
+			}
+		}
+	}
+	workflow.TriggerChain = chain
+	resp, err := CreateWorkflowTaskV4(setting.UpstreamTaskCreator, workflow, logger)
+	if err != nil {
+		return err
+	}
+	logger.Infof("workflow %s:%d is triggered by upstream hook %s", workflowName, resp.TaskID, hook.Name)
+	return nil
+}
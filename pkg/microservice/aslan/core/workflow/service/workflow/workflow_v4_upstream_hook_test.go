@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflow
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+)
+
+var _ = Describe("Testing upstream hook", func() {
+
+	Context("findUpstreamHookLoop", func() {
+		// build -> deploy -> test
+		downstreams := func(name string) ([]string, error) {
+			return map[string][]string{
+				"build":  {"deploy"},
+				"deploy": {"test"},
+			}[name], nil
+		}
+
+		It("should be passed for a new downstream workflow", func() {
+			path, err := findUpstreamHookLoop("release", "test", downstreams)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(path).To(BeEmpty())
+		})
+		It("should find the loop", func() {
+			path, err := findUpstreamHookLoop("build", "test", downstreams)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(path).To(Equal([]string{"build", "deploy", "test", "build"}))
+		})
+		It("should find the workflow triggered by itself", func() {
+			path, err := findUpstreamHookLoop("build", "build", downstreams)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(path).To(Equal([]string{"build", "build"}))
+		})
+	})
+
+	Context("renderUpstreamHookMappings", func() {
+		It("should render the outputs and images of the upstream task", func() {
+			task := &commonmodels.WorkflowTask{
+				WorkflowName:  "build",
+				ProjectName:   "demo",
+				TaskID:        12,
+				Status:        config.StatusPassed,
+				GlobalContext: map[string]string{"job.build.output.VERSION": "1.0.0"},
+				Stages: []*commonmodels.StageTask{{Jobs: []*commonmodels.JobTask{{
+					OriginName: "build",
+					JobType:    string(config.JobZadigBuild),
+					Status:     config.StatusPassed,
+					Spec: &commonmodels.JobTaskFreestyleSpec{Properties: commonmodels.JobProperties{Envs: []*commonmodels.KeyVal{
+						{Key: "SERVICE", Value: "svc"},
+						{Key: "SERVICE_MODULE", Value: "app"},
+						{Key: "IMAGE", Value: "registry/app:20221010"},
+					}}},
+				}}}},
+			}
+			values := renderUpstreamHookMappings([]*commonmodels.UpstreamHookMapping{
+				{Key: "version", Value: "v{{.job.build.output.VERSION}}"},
+				{Key: "IMAGE", JobName: "deploy", Value: "{{.job.build.svc.app.IMAGE}}"},
+				{Key: "source", Value: "{{.upstream.workflow}}-{{.upstream.task_id}}"},
+			}, upstreamTaskVars(task))
+			Expect(values).To(Equal(map[string]string{
+				"version":      "v1.0.0",
+				"deploy.IMAGE": "registry/app:20221010",
+				"source":       "build-12",
+			}))
+		})
+	})
+})
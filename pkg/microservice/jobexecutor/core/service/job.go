@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -29,7 +30,11 @@ import (
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/config"
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/core/service/meta"
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/core/service/step"
+	"github.com/koderover/zadig/pkg/setting"
+	"github.com/koderover/zadig/pkg/tool/log"
+	"github.com/koderover/zadig/pkg/tool/s3"
 	"github.com/koderover/zadig/pkg/types/job"
+	steptypes "github.com/koderover/zadig/pkg/types/step"
 	"gopkg.in/yaml.v3"
 )
 
@@ -126,10 +131,20 @@ func (j *Job) Run(ctx context.Context) error {
 	if err := os.MkdirAll(job.JobOutputDir, os.ModePerm); err != nil {
 		return err
 	}
-	if err := step.RunSteps(ctx, j.Ctx.Steps, j.ActiveWorkspace, j.Ctx.Paths, j.getUserEnvs(), j.Ctx.SecretEnvs); err != nil {
+	results, err := step.RunSteps(ctx, j.Ctx.Steps, j.ActiveWorkspace, j.Ctx.Paths, j.Ctx.StepMarkerNonce, j.getUserEnvs(), j.Ctx.SecretEnvs)
+	if writeErr := writeStepResults(results); writeErr != nil {
+		log.Errorf("write step results error: %v", writeErr)
+	}
+	return err
+}
+
+// writeStepResults saves the results of steps for aslan, which reads them after the job finished.
+func writeStepResults(results []*job.StepResult) error {
+	content, err := json.Marshal(results)
+	if err != nil {
 		return err
 	}
-	return nil
+	return ioutil.WriteFile(job.JobStepResultFile, content, 0644)
 }
 func (j *Job) AfterRun(ctx context.Context) error {
 	return j.collectJobResult(ctx)
@@ -144,13 +159,24 @@ func (j *Job) collectJobResult(ctx context.Context) error {
 		} else if err != nil {
 			return err
 		}
-		outputs = append(outputs, &job.JobOutput{Name: outputName, Value: string(fileContents)})
+		output := &job.JobOutput{Name: outputName, Type: j.Ctx.OutputTypes[outputName], Value: string(fileContents)}
+		if output.Type == "" {
+			output.Type = job.OutputTypeString
+		}
+		if err := j.resolveOutput(output); err != nil {
+			return err
+		}
+		outputs = append(outputs, output)
 	}
 	jsonOutput, err := json.Marshal(outputs)
 	if err != nil {
 		return err
 	}
 
+	if j.Ctx.OutputStorage != nil {
+		return j.uploadOutputs(jsonOutput)
+	}
+
 	if len(jsonOutput) > MaxContainerTerminationMessageLength {
 		return fmt.Errorf("termination message is above max allowed size 4096, caused by large task result")
 	}
@@ -166,3 +192,68 @@ func (j *Job) collectJobResult(ctx context.Context) error {
 	}
 	return f.Sync()
 }
+
+// resolveOutput validates json outputs, and uploads the file referred by file outputs.
+func (j *Job) resolveOutput(output *job.JobOutput) error {
+	switch output.Type {
+	case job.OutputTypeJSON:
+		if !json.Valid([]byte(output.Value)) {
+			return fmt.Errorf("output %s is not valid json", output.Name)
+		}
+	case job.OutputTypeFile:
+		if j.Ctx.OutputStorage == nil {
+			return fmt.Errorf("output %s: no object storage to upload the file", output.Name)
+		}
+		filePath := strings.TrimSpace(output.Value)
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(j.ActiveWorkspace, filePath)
+		}
+		client, err := newOutputS3Client(j.Ctx.OutputStorage.S3)
+		if err != nil {
+			return err
+		}
+		objectKey := path.Join(j.Ctx.OutputStorage.ObjectDir, output.Name, filepath.Base(filePath))
+		if err := client.Upload(j.Ctx.OutputStorage.S3.Bucket, filePath, objectKey); err != nil {
+			return fmt.Errorf("upload file of output %s error: %v", output.Name, err)
+		}
+		output.Value = objectKey
+	}
+	return nil
+}
+
+func (j *Job) uploadOutputs(content []byte) error {
+	tempFile, err := ioutil.TempFile("", "outputs")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	client, err := newOutputS3Client(j.Ctx.OutputStorage.S3)
+	if err != nil {
+		return err
+	}
+	objectKey := path.Join(j.Ctx.OutputStorage.ObjectDir, job.JobOutputsFile)
+	if err := client.Upload(j.Ctx.OutputStorage.S3.Bucket, tempFile.Name(), objectKey); err != nil {
+		return fmt.Errorf("upload outputs error: %v", err)
+	}
+	return nil
+}
+
+func newOutputS3Client(storage *steptypes.S3) (*s3.Client, error) {
+	forcedPathStyle := true
+	if storage.Provider == setting.ProviderSourceAli {
+		forcedPathStyle = false
+	}
+	client, err := s3.NewClient(storage.Endpoint, storage.Ak, storage.Sk, storage.Insecure, forcedPathStyle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client to upload outputs, err: %s", err)
+	}
+	return client, nil
+}
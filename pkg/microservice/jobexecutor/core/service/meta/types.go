@@ -16,6 +16,10 @@ limitations under the License.
 
 package meta
 
+import (
+	"github.com/koderover/zadig/pkg/types/job"
+)
+
 type JobContext struct {
 	Name string `yaml:"name"`
 	// Workspace 容器工作目录 [必填]
@@ -33,13 +37,24 @@ type JobContext struct {
 
 	Steps   []*Step  `yaml:"steps"`
 	Outputs []string `yaml:"outputs"`
+	// OutputTypes is the type of outputs, outputs not in it are strings.
+	OutputTypes map[string]job.OutputType `yaml:"output_types"`
+	// OutputStorage is where the outputs are uploaded, outputs are written to the termination message if it's nil.
+	OutputStorage *job.OutputStorage `yaml:"output_storage"`
+	// StepMarkerNonce is printed in the step markers, so the output of steps cannot fake the markers.
+	StepMarkerNonce string `yaml:"step_marker_nonce"`
 }
 
 type Step struct {
-	Name      string      `yaml:"name"`
-	StepType  string      `yaml:"type"`
-	Onfailure bool        `yaml:"on_failure"`
-	Spec      interface{} `yaml:"spec"`
+	Name     string `yaml:"name"`
+	StepType string `yaml:"type"`
+	// Onfailure is kept for compatibility, it means run_if always when RunIf is empty.
+	Onfailure bool `yaml:"on_failure"`
+	// RunIf is one of success, failure and always, default success.
+	RunIf string `yaml:"run_if"`
+	// Timeout of the step in minutes, 0 means no limit.
+	Timeout int64       `yaml:"timeout"`
+	Spec    interface{} `yaml:"spec"`
 }
 
 type EnvVar []string
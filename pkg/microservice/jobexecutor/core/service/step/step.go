@@ -19,15 +19,20 @@ package step
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/config"
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/core/service/cmd"
 	"github.com/koderover/zadig/pkg/microservice/jobexecutor/core/service/meta"
 	"github.com/koderover/zadig/pkg/tool/log"
+	"github.com/koderover/zadig/pkg/types/job"
 	"github.com/koderover/zadig/pkg/util"
 )
 
@@ -35,19 +40,92 @@ type Step interface {
 	Run(ctx context.Context) error
 }
 
-func RunSteps(ctx context.Context, steps []*meta.Step, workspace, paths string, envs, secretEnvs []string) error {
+// RunSteps runs the steps in order and returns the result of every step, a step runs only
+// if its run_if matches the results of the previous steps, steps with run_if always run even if ctx is cancelled.
+func RunSteps(ctx context.Context, steps []*meta.Step, workspace, paths, markerNonce string, envs, secretEnvs []string) ([]*job.StepResult, error) {
+	results := []*job.StepResult{}
 	hasFailed := false
 	var respErr error
 	for _, stepInfo := range steps {
-		if hasFailed && !stepInfo.Onfailure {
+		result := &job.StepResult{Name: stepInfo.Name, Status: job.StepStatusSkipped}
+		results = append(results, result)
+
+		runIf := stepRunIf(stepInfo)
+		skip := false
+		switch {
+		case runIf == job.StepRunIfAlways:
+		case ctx.Err() != nil:
+			skip = true
+		case runIf == job.StepRunIfFailure && !hasFailed:
+			skip = true
+		case runIf == job.StepRunIfSuccess && hasFailed:
+			skip = true
+		}
+		if skip {
+			fmt.Print(job.StepEndLine(markerNonce, result))
 			continue
 		}
-		if err := runStep(ctx, stepInfo, workspace, paths, envs, secretEnvs); err != nil {
+
+		// the job was cancelled, give the step a context of its own so it still can clean up.
+		parentCtx := ctx
+		if ctx.Err() != nil {
+			parentCtx = context.Background()
+		}
+		var stepCtx context.Context
+		var cancel context.CancelFunc
+		if stepInfo.Timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(parentCtx, time.Duration(stepInfo.Timeout)*time.Minute)
+		} else {
+			stepCtx, cancel = context.WithCancel(parentCtx)
+		}
+		result.StartTime = time.Now().Unix()
+		fmt.Print(job.StepStartLine(markerNonce, &job.StepResult{Name: result.Name, StartTime: result.StartTime}))
+		err := runStep(stepCtx, stepInfo, workspace, paths, envs, secretEnvs)
+		result.EndTime = time.Now().Unix()
+		result.ExitCode = exitCode(err)
+		switch {
+		case err == nil:
+			result.Status = job.StepStatusPassed
+		case errors.Is(stepCtx.Err(), context.DeadlineExceeded):
+			result.Status = job.StepStatusTimeout
+			err = fmt.Errorf("step %s timeout after %d minutes", stepInfo.Name, stepInfo.Timeout)
+		case stepCtx.Err() != nil:
+			result.Status = job.StepStatusCancelled
+		default:
+			result.Status = job.StepStatusFailed
+		}
+		cancel()
+		if err != nil {
+			log.Errorf("step %s %s: %v", stepInfo.Name, result.Status, err)
+			result.Error = err.Error()
 			hasFailed = true
 			respErr = err
 		}
+		fmt.Print(job.StepEndLine(markerNonce, result))
+	}
+	return results, respErr
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func stepRunIf(step *meta.Step) job.StepRunIf {
+	switch job.StepRunIf(step.RunIf) {
+	case job.StepRunIfSuccess, job.StepRunIfFailure, job.StepRunIfAlways:
+		return job.StepRunIf(step.RunIf)
+	}
+	if step.Onfailure {
+		return job.StepRunIfAlways
 	}
-	return respErr
+	return job.StepRunIfSuccess
 }
 
 func runStep(ctx context.Context, step *meta.Step, workspace, paths string, envs, secretEnvs []string) error {
@@ -95,11 +173,43 @@ func runStep(ctx context.Context, step *meta.Step, workspace, paths string, envs
 		log.Error(err)
 		return err
 	}
-	if err := stepInstance.Run(ctx); err != nil {
-		log.Error(err)
+	return stepInstance.Run(ctx)
+}
+
+// startCmd starts the command in a process group of its own, and kills the whole group once ctx
+// is done, so the processes forked by scripts are stopped as well when the step times out or is cancelled.
+// The returned function waits for the command to exit.
+func startCmd(ctx context.Context, cmd *exec.Cmd) (func() error, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-exited:
+		}
+	}()
+	return func() error {
+		defer close(exited)
+		if err := cmd.Wait(); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%v: %w", ctx.Err(), err)
+			}
+			return err
+		}
+		return nil
+	}, nil
+}
+
+func runCmd(ctx context.Context, cmd *exec.Cmd) error {
+	wait, err := startCmd(ctx, cmd)
+	if err != nil {
 		return err
 	}
-	return nil
+	return wait()
 }
 
 func prepareScriptsEnv() []string {
@@ -64,7 +64,7 @@ func (s *DockerBuildStep) Run(ctx context.Context) error {
 	if err := s.dockerLogin(); err != nil {
 		return err
 	}
-	return s.runDockerBuild()
+	return s.runDockerBuild(ctx)
 }
 
 func (s DockerBuildStep) dockerLogin() error {
@@ -87,7 +87,7 @@ func (s DockerBuildStep) dockerLogin() error {
 	return nil
 }
 
-func (s *DockerBuildStep) runDockerBuild() error {
+func (s *DockerBuildStep) runDockerBuild(ctx context.Context) error {
 	if s.spec == nil {
 		return nil
 	}
@@ -112,8 +112,8 @@ func (s *DockerBuildStep) runDockerBuild() error {
 		c.Stderr = os.Stderr
 		c.Dir = s.workspace
 		c.Env = envs
-		if err := c.Run(); err != nil {
-			return fmt.Errorf("failed to run docker build: %s", err)
+		if err := runCmd(ctx, c); err != nil {
+			return fmt.Errorf("failed to run docker build: %w", err)
 		}
 	}
 	fmt.Printf("Docker build ended. Duration: %.2f seconds.\n", time.Since(startTimeDockerBuild).Seconds())
@@ -95,7 +95,7 @@ func (s *TarArchiveStep) Run(ctx context.Context) error {
 	_ = temp.Close()
 	cmd := exec.Command("tar", cmdAndArtifactFullPaths...)
 	cmd.Stderr = os.Stderr
-	if err = cmd.Run(); err != nil {
+	if err = runCmd(ctx, cmd); err != nil {
 		log.Errorf("failed to compress %s err:%s", tarName, err)
 		return err
 	}
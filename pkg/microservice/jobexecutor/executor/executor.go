@@ -80,11 +80,14 @@ func Execute(ctx context.Context) error {
 		return err
 	}
 	fmt.Printf("====================== %s Start ======================\n", excutor)
-	if err = j.Run(ctx); err != nil {
-		return err
-	}
-	if err = j.AfterRun(ctx); err != nil {
-		return err
+	err = j.Run(ctx)
+	// outputs are collected even if the job failed, so the following jobs can still use them.
+	if afterRunErr := j.AfterRun(ctx); afterRunErr != nil {
+		if err != nil {
+			log.Errorf("Failed to collect job result: %s.", afterRunErr)
+			return err
+		}
+		err = afterRunErr
 	}
-	return nil
+	return err
 }
@@ -112,6 +112,7 @@ func (*Router) Inject(router *gin.RouterGroup) {
 	{
 		policyUserPermission.GET("project/:name", GetUserRulesByProject)
 		policyUserPermission.GET("", GetUserRules)
+		policyUserPermission.POST("resources", GetUserResourcesPermission)
 
 	}
 }
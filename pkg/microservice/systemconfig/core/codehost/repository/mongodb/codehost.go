@@ -170,7 +170,7 @@ func (c *CodehostColl) UpdateCodeHost(host *models.CodeHost) (*models.CodeHost,
 		"alias":          host.Alias,
 		"updated_at":     time.Now().Unix(),
 	}
-	if host.Type == setting.SourceFromGerrit {
+	if host.Type == setting.SourceFromGerrit || host.Type == setting.SourceFromGitea || host.Type == setting.SourceFromBitbucketServer {
 		modifyValue["access_token"] = host.AccessToken
 	} else if host.Type == setting.SourceFromGitee || host.Type == setting.SourceFromGitlab {
 		modifyValue["access_token"] = host.AccessToken
@@ -41,7 +41,9 @@ import (
 const callback = "/api/directory/codehosts/callback"
 
 func CreateCodeHost(codehost *models.CodeHost, _ *zap.SugaredLogger) (*models.CodeHost, error) {
-	if codehost.Type == setting.SourceFromCodeHub || codehost.Type == setting.SourceFromOther {
+	// gitea and bitbucket server are authorized by personal access tokens instead of oauth.
+	if codehost.Type == setting.SourceFromCodeHub || codehost.Type == setting.SourceFromOther ||
+		codehost.Type == setting.SourceFromGitea || codehost.Type == setting.SourceFromBitbucketServer {
 		codehost.IsReady = "2"
 	}
 	if codehost.Type == setting.SourceFromGerrit {
@@ -254,6 +254,10 @@ const (
 	SourceFromCodeHub = "codehub"
 	// SourceFromGitee Configure the source as gitee
 	SourceFromGitee = "gitee"
+	// SourceFromGitea Configure the source as gitea
+	SourceFromGitea = "gitea"
+	// SourceFromBitbucketServer Configure the source as bitbucket server
+	SourceFromBitbucketServer = "bitbucket_server"
 	// SourceFromGitee Configure the source as other
 	SourceFromOther = "other"
 	// SourceFromChartTemplate The configuration source is helmTemplate
@@ -446,6 +450,12 @@ const (
 	WebhookTaskCreator = "webhook"
 	// CronTaskCreator ...
 	CronTaskCreator = "timer"
+	// GeneralHookTaskCreator ...
+	GeneralHookTaskCreator = "general_hook"
+	// UpstreamTaskCreator ...
+	UpstreamTaskCreator = "upstream_workflow"
+	// RegistryHookTaskCreator ...
+	RegistryHookTaskCreator = "registry_hook"
 	// DefaultTaskRevoker ...
 	DefaultTaskRevoker = "system" // default task revoker
 )
@@ -526,6 +536,7 @@ const (
 	TopicItReport     = "task.it.report"
 	TopicNotification = "task.notification"
 	TopicCronjob      = "cronjob"
+	TopicApprove      = "task.approve"
 )
 
 // S3 related constants
@@ -24,12 +24,14 @@ import (
 )
 
 const (
-	GitLabProvider  = "gitlab"
-	GitHubProvider  = "github"
-	GerritProvider  = "gerrit"
-	CodeHubProvider = "codehub"
-	GiteeProvider   = "gitee"
-	OtherProvider   = "other"
+	GitLabProvider          = "gitlab"
+	GitHubProvider          = "github"
+	GerritProvider          = "gerrit"
+	CodeHubProvider         = "codehub"
+	GiteeProvider           = "gitee"
+	GiteaProvider           = "gitea"
+	BitbucketServerProvider = "bitbucket_server"
+	OtherProvider           = "other"
 )
 
 type CodeHost struct {
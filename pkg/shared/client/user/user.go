@@ -71,7 +71,8 @@ func (c *Client) CreateUser(args *CreateUserArgs) (*CreateUserResp, error) {
 }
 
 type SearchUserArgs struct {
-	Account string `json:"account"`
+	Account      string `json:"account"`
+	IdentityType string `json:"identity_type,omitempty"`
 }
 
 type SearchUserResp struct {
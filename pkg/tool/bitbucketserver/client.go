@@ -0,0 +1,40 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucketserver
+
+import (
+	"strings"
+
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+type Client struct {
+	*httpclient.Client
+}
+
+// NewClient creates a client of the bitbucket server rest api 1.0, the access token is a personal or project
+// http access token sent as a bearer token.
+func NewClient(address, accessToken, proxyAddr string, enableProxy bool) *Client {
+	cfs := []httpclient.ClientFunc{
+		httpclient.SetHostURL(strings.TrimSuffix(address, "/") + "/rest/api/1.0"),
+		httpclient.SetAuthToken(accessToken),
+	}
+	if enableProxy {
+		cfs = append(cfs, httpclient.SetProxy(proxyAddr))
+	}
+	return &Client{Client: httpclient.New(cfs...)}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucketserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type EventType string
+
+const (
+	EventTypeRefsChanged      EventType = "repo:refs_changed"
+	EventTypePROpened         EventType = "pr:opened"
+	EventTypePRFromRefUpdated EventType = "pr:from_ref_updated"
+	EventTypePing             EventType = "diagnostics:ping"
+
+	EventHeader     = "X-Event-Key"
+	SignatureHeader = "X-Hub-Signature"
+
+	RefChangeTypeAdd    = "ADD"
+	RefChangeTypeUpdate = "UPDATE"
+	RefChangeTypeDelete = "DELETE"
+)
+
+type RefChange struct {
+	Ref      *Ref   `json:"ref"`
+	RefID    string `json:"refId"`
+	FromHash string `json:"fromHash"`
+	ToHash   string `json:"toHash"`
+	Type     string `json:"type"`
+}
+
+type RefsChangedEvent struct {
+	EventKey   string       `json:"eventKey"`
+	Actor      *User        `json:"actor"`
+	Repository *Repository  `json:"repository"`
+	Changes    []*RefChange `json:"changes"`
+}
+
+type PullRequestEvent struct {
+	EventKey    string       `json:"eventKey"`
+	Actor       *User        `json:"actor"`
+	PullRequest *PullRequest `json:"pullRequest"`
+}
+
+// HookEventType returns the event key of bitbucket server webhooks, bitbucket server always sends a
+// request id along, which tells it apart from bitbucket cloud.
+func HookEventType(r *http.Request) EventType {
+	if r.Header.Get("X-Request-Id") == "" {
+		return ""
+	}
+	return EventType(r.Header.Get(EventHeader))
+}
+
+func ParseHook(eventType EventType, payload []byte) (interface{}, error) {
+	var event interface{}
+	switch eventType {
+	case EventTypeRefsChanged:
+		event = &RefsChangedEvent{}
+	case EventTypePROpened, EventTypePRFromRefUpdated:
+		event = &PullRequestEvent{}
+	default:
+		return nil, fmt.Errorf("unexpected event type: %s", eventType)
+	}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucketserver
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+const (
+	PullRequestStateOpen = "OPEN"
+
+	RefTypeBranch = "BRANCH"
+	RefTypeTag    = "TAG"
+)
+
+type page struct {
+	Size          int  `json:"size"`
+	Limit         int  `json:"limit"`
+	IsLastPage    bool `json:"isLastPage"`
+	Start         int  `json:"start"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+type User struct {
+	Name         string `json:"name"`
+	EmailAddress string `json:"emailAddress"`
+	DisplayName  string `json:"displayName"`
+	Slug         string `json:"slug"`
+}
+
+type Project struct {
+	ID   int    `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type Repository struct {
+	ID      int      `json:"id"`
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Project *Project `json:"project"`
+}
+
+type Ref struct {
+	ID           string      `json:"id"`
+	DisplayID    string      `json:"displayId"`
+	Type         string      `json:"type"`
+	LatestCommit string      `json:"latestCommit"`
+	IsDefault    bool        `json:"isDefault"`
+	Repository   *Repository `json:"repository,omitempty"`
+}
+
+type PullRequest struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	State       string `json:"state"`
+	CreatedDate int64  `json:"createdDate"`
+	UpdatedDate int64  `json:"updatedDate"`
+	FromRef     *Ref   `json:"fromRef"`
+	ToRef       *Ref   `json:"toRef"`
+	Author      struct {
+		User *User `json:"user"`
+	} `json:"author"`
+}
+
+type Change struct {
+	Type string `json:"type"`
+	Path struct {
+		ToString string `json:"toString"`
+	} `json:"path"`
+}
+
+type Webhook struct {
+	ID            int               `json:"id,omitempty"`
+	Name          string            `json:"name"`
+	URL           string            `json:"url"`
+	Events        []string          `json:"events"`
+	Configuration map[string]string `json:"configuration"`
+	Active        bool              `json:"active"`
+}
+
+func pageParams(pageNum, perPage int) map[string]string {
+	params := map[string]string{}
+	if perPage > 0 {
+		params["limit"] = strconv.Itoa(perPage)
+		if pageNum > 1 {
+			params["start"] = strconv.Itoa((pageNum - 1) * perPage)
+		}
+	}
+	return params
+}
+
+func (c *Client) ListProjects(keyword string, pageNum, perPage int) ([]*Project, error) {
+	resp := &struct {
+		page
+		Values []*Project `json:"values"`
+	}{}
+	params := pageParams(pageNum, perPage)
+	if keyword != "" {
+		params["name"] = keyword
+	}
+	_, err := c.Get("/projects", httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+func (c *Client) ListRepositories(projectKey string, pageNum, perPage int) ([]*Repository, error) {
+	resp := &struct {
+		page
+		Values []*Repository `json:"values"`
+	}{}
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos", projectKey), httpclient.SetQueryParams(pageParams(pageNum, perPage)), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+func (c *Client) ListBranches(projectKey, repo, keyword string, pageNum, perPage int) ([]*Ref, error) {
+	resp := &struct {
+		page
+		Values []*Ref `json:"values"`
+	}{}
+	params := pageParams(pageNum, perPage)
+	params["filterText"] = keyword
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos/%s/branches", projectKey, repo), httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+func (c *Client) ListTags(projectKey, repo, keyword string, pageNum, perPage int) ([]*Ref, error) {
+	resp := &struct {
+		page
+		Values []*Ref `json:"values"`
+	}{}
+	params := pageParams(pageNum, perPage)
+	params["filterText"] = keyword
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos/%s/tags", projectKey, repo), httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+func (c *Client) ListPullRequests(projectKey, repo, state string, pageNum, perPage int) ([]*PullRequest, error) {
+	resp := &struct {
+		page
+		Values []*PullRequest `json:"values"`
+	}{}
+	params := pageParams(pageNum, perPage)
+	params["state"] = state
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos/%s/pull-requests", projectKey, repo), httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+// ListPullRequestChanges lists the files changed by the pull request, at most 1000 files are returned.
+func (c *Client) ListPullRequestChanges(projectKey, repo string, id int) ([]*Change, error) {
+	resp := &struct {
+		page
+		Values []*Change `json:"values"`
+	}{}
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos/%s/pull-requests/%d/changes", projectKey, repo, id), httpclient.SetQueryParam("limit", "1000"), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+// ListChanges lists the files changed between the two commits, the changes of the commit against its parent
+// are listed if since is empty. At most 1000 files are returned.
+func (c *Client) ListChanges(projectKey, repo, until, since string) ([]*Change, error) {
+	resp := &struct {
+		page
+		Values []*Change `json:"values"`
+	}{}
+	params := map[string]string{"until": until, "limit": "1000"}
+	if since != "" {
+		params["since"] = since
+	}
+	_, err := c.Get(fmt.Sprintf("/projects/%s/repos/%s/changes", projectKey, repo), httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Values, err
+}
+
+func (c *Client) CreateWebhook(projectKey, repo string, hook *Webhook) (*Webhook, error) {
+	created := &Webhook{}
+	_, err := c.Post(fmt.Sprintf("/projects/%s/repos/%s/webhooks", projectKey, repo), httpclient.SetBody(hook), httpclient.SetResult(created))
+	return created, err
+}
+
+func (c *Client) DeleteWebhook(projectKey, repo string, id int) error {
+	_, err := c.Delete(fmt.Sprintf("/projects/%s/repos/%s/webhooks/%d", projectKey, repo, id))
+	return err
+}
@@ -21,6 +21,14 @@ import (
 	"fmt"
 )
 
+const (
+	CommitStatePending  = "pending"
+	CommitStateRunning  = "running"
+	CommitStateSuccess  = "success"
+	CommitStateFailed   = "failed"
+	CommitStateCanceled = "canceled"
+)
+
 type CommitListResp struct {
 	Result CommitListResult `json:"result"`
 	Status string           `json:"status"`
@@ -63,3 +71,38 @@ func (c *CodeHubClient) GetLatestRepositoryCommit(repoOwner, repoName, branchNam
 
 	return nil, fmt.Errorf("get commit list failed")
 }
+
+type CommitStatus struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url"`
+	Description string `json:"description"`
+}
+
+type commitStatusResp struct {
+	Status string `json:"status"`
+	Error  struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *CodeHubClient) SetCommitStatus(repoOwner, repoName, sha string, status *CommitStatus) error {
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	body, err := c.sendRequest("POST", fmt.Sprintf("/v1/repositories/%s/%s/commits/%s/statuses", repoOwner, repoName, sha), payload)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	resp := new(commitStatusResp)
+	if err = json.NewDecoder(body).Decode(resp); err != nil {
+		return err
+	}
+	if resp.Status != "success" {
+		return fmt.Errorf("set commit status failed: %s", resp.Error.Message)
+	}
+	return nil
+}
@@ -167,6 +167,8 @@ func addEventsToProjectHookOptions(events []string, opts *gitlab.AddProjectHookO
 			opts.MergeRequestsEvents = boolptr.True()
 		case git.BranchOrTagCreateEvent:
 			opts.TagPushEvents = boolptr.True()
+		case git.CommentEvent:
+			opts.NoteEvents = boolptr.True()
 		}
 	}
 
@@ -182,6 +184,8 @@ func addEventsToProjectHookEditOptions(events []string, opts *gitlab.EditProject
 			opts.MergeRequestsEvents = boolptr.True()
 		case git.BranchOrTagCreateEvent:
 			opts.TagPushEvents = boolptr.True()
+		case git.CommentEvent:
+			opts.NoteEvents = boolptr.True()
 		}
 	}
 
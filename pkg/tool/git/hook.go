@@ -21,6 +21,7 @@ const (
 	PullRequestEvent       = "pull_request"
 	CheckRunEvent          = "check_run"
 	BranchOrTagCreateEvent = "create"
+	CommentEvent           = "issue_comment"
 )
 
 type Hook struct {
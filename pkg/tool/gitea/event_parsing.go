@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type EventType string
+
+const (
+	EventTypePush        EventType = "push"
+	EventTypePullRequest EventType = "pull_request"
+
+	// EventHeader is the header of gitea webhooks, gitea also sends the github headers for compatibility
+	// so it must be checked before github.
+	EventHeader     = "X-Gitea-Event"
+	SignatureHeader = "X-Gitea-Signature"
+)
+
+type PushCommit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+	Author   struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+}
+
+type PushEvent struct {
+	Ref        string        `json:"ref"`
+	Before     string        `json:"before"`
+	After      string        `json:"after"`
+	Commits    []*PushCommit `json:"commits"`
+	Repository *Repository   `json:"repository"`
+	Pusher     *User         `json:"pusher"`
+	Sender     *User         `json:"sender"`
+}
+
+type PullRequestEvent struct {
+	Action      string       `json:"action"`
+	Number      int          `json:"number"`
+	PullRequest *PullRequest `json:"pull_request"`
+	Repository  *Repository  `json:"repository"`
+	Sender      *User        `json:"sender"`
+}
+
+func HookEventType(r *http.Request) EventType {
+	return EventType(r.Header.Get(EventHeader))
+}
+
+func ParseHook(eventType EventType, payload []byte) (interface{}, error) {
+	var event interface{}
+	switch eventType {
+	case EventTypePush:
+		event = &PushEvent{}
+	case EventTypePullRequest:
+		event = &PullRequestEvent{}
+	default:
+		return nil, fmt.Errorf("unexpected event type: %s", eventType)
+	}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
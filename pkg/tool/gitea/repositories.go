@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+type User struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Email string `json:"email"`
+}
+
+type Organization struct {
+	ID       int64  `json:"id"`
+	UserName string `json:"username"`
+}
+
+type Repository struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	Description   string `json:"description"`
+	DefaultBranch string `json:"default_branch"`
+	Owner         *User  `json:"owner"`
+}
+
+type Branch struct {
+	Name      string `json:"name"`
+	Protected bool   `json:"protected"`
+}
+
+type Tag struct {
+	Name       string `json:"name"`
+	Message    string `json:"message"`
+	ZipballURL string `json:"zipball_url"`
+	TarballURL string `json:"tarball_url"`
+}
+
+type PRBranchInfo struct {
+	Ref  string      `json:"ref"`
+	Sha  string      `json:"sha"`
+	Repo *Repository `json:"repo"`
+}
+
+type PullRequest struct {
+	ID     int64         `json:"id"`
+	Number int           `json:"number"`
+	Title  string        `json:"title"`
+	State  string        `json:"state"`
+	User   *User         `json:"user"`
+	Head   *PRBranchInfo `json:"head"`
+	Base   *PRBranchInfo `json:"base"`
+}
+
+type ChangedFile struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"`
+}
+
+type Hook struct {
+	ID     int64             `json:"id,omitempty"`
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+	Events []string          `json:"events"`
+	Active bool              `json:"active"`
+}
+
+func pageParams(page, perPage int) map[string]string {
+	params := map[string]string{}
+	if page > 0 {
+		params["page"] = strconv.Itoa(page)
+	}
+	if perPage > 0 {
+		params["limit"] = strconv.Itoa(perPage)
+	}
+	return params
+}
+
+func (c *Client) GetAuthenticatedUser() (*User, error) {
+	user := &User{}
+	_, err := c.Get("/user", httpclient.SetResult(user))
+	return user, err
+}
+
+func (c *Client) ListOrganizations() ([]*Organization, error) {
+	var orgs []*Organization
+	_, err := c.Get("/user/orgs", httpclient.SetResult(&orgs))
+	return orgs, err
+}
+
+func (c *Client) ListOrgRepositories(org string, page, perPage int) ([]*Repository, error) {
+	var repos []*Repository
+	_, err := c.Get(fmt.Sprintf("/orgs/%s/repos", org), httpclient.SetQueryParams(pageParams(page, perPage)), httpclient.SetResult(&repos))
+	return repos, err
+}
+
+// SearchUserRepositories lists the repositories owned by the user whose name contains the keyword.
+func (c *Client) SearchUserRepositories(uid int64, keyword string, page, perPage int) ([]*Repository, error) {
+	resp := &struct {
+		Data []*Repository `json:"data"`
+	}{}
+	params := pageParams(page, perPage)
+	params["uid"] = strconv.FormatInt(uid, 10)
+	params["exclusive"] = "true"
+	params["q"] = keyword
+	_, err := c.Get("/repos/search", httpclient.SetQueryParams(params), httpclient.SetResult(resp))
+	return resp.Data, err
+}
+
+func (c *Client) ListBranches(owner, repo string, page, perPage int) ([]*Branch, error) {
+	var branches []*Branch
+	_, err := c.Get(fmt.Sprintf("/repos/%s/%s/branches", owner, repo), httpclient.SetQueryParams(pageParams(page, perPage)), httpclient.SetResult(&branches))
+	return branches, err
+}
+
+func (c *Client) ListTags(owner, repo string, page, perPage int) ([]*Tag, error) {
+	var tags []*Tag
+	_, err := c.Get(fmt.Sprintf("/repos/%s/%s/tags", owner, repo), httpclient.SetQueryParams(pageParams(page, perPage)), httpclient.SetResult(&tags))
+	return tags, err
+}
+
+func (c *Client) ListPullRequests(owner, repo, state string, page, perPage int) ([]*PullRequest, error) {
+	var prs []*PullRequest
+	params := pageParams(page, perPage)
+	params["state"] = state
+	_, err := c.Get(fmt.Sprintf("/repos/%s/%s/pulls", owner, repo), httpclient.SetQueryParams(params), httpclient.SetResult(&prs))
+	return prs, err
+}
+
+func (c *Client) ListPullRequestFiles(owner, repo string, number int) ([]*ChangedFile, error) {
+	var files []*ChangedFile
+	_, err := c.Get(fmt.Sprintf("/repos/%s/%s/pulls/%d/files", owner, repo, number), httpclient.SetResult(&files))
+	return files, err
+}
+
+func (c *Client) CreateHook(owner, repo string, hook *Hook) (*Hook, error) {
+	created := &Hook{}
+	_, err := c.Post(fmt.Sprintf("/repos/%s/%s/hooks", owner, repo), httpclient.SetBody(hook), httpclient.SetResult(created))
+	return created, err
+}
+
+func (c *Client) DeleteHook(owner, repo string, id int64) error {
+	_, err := c.Delete(fmt.Sprintf("/repos/%s/%s/hooks/%d", owner, repo, id))
+	return err
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitee
+
+import (
+	"fmt"
+
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+const (
+	CheckRunStatusQueued     = "queued"
+	CheckRunStatusInProgress = "in_progress"
+	CheckRunStatusCompleted  = "completed"
+
+	CheckRunConclusionSuccess   = "success"
+	CheckRunConclusionFailure   = "failure"
+	CheckRunConclusionCancelled = "cancelled"
+	CheckRunConclusionTimedOut  = "timed_out"
+)
+
+type CheckRun struct {
+	ID         int64           `json:"id,omitempty"`
+	Name       string          `json:"name"`
+	HeadSha    string          `json:"head_sha"`
+	DetailsURL string          `json:"details_url,omitempty"`
+	Status     string          `json:"status"`
+	Conclusion string          `json:"conclusion,omitempty"`
+	Output     *CheckRunOutput `json:"output,omitempty"`
+}
+
+type CheckRunOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+type checkRunList struct {
+	TotalCount int         `json:"total_count"`
+	CheckRuns  []*CheckRun `json:"check_runs"`
+}
+
+// UpsertCheckRun updates the check run of the commit with the same name, or creates one if not found,
+// so that a commit shows a single check for each workflow.
+func (c *Client) UpsertCheckRun(accessToken, owner, repo string, checkRun *CheckRun) error {
+	return upsertCheckRun(GiteeHOSTURL, accessToken, owner, repo, checkRun)
+}
+
+func upsertCheckRun(hostURL, accessToken, owner, repo string, checkRun *CheckRun) error {
+	httpClient := httpclient.New(
+		httpclient.SetHostURL(hostURL),
+	)
+	// api reference: https://gitee.com/api/v5/swagger#/getV5ReposOwnerRepoCommitsRefCheckRuns
+	url := fmt.Sprintf("/v5/repos/%s/%s/commits/%s/check-runs", owner, repo, checkRun.HeadSha)
+	list := &checkRunList{}
+	_, err := httpClient.Get(url, httpclient.SetQueryParams(map[string]string{
+		"access_token": accessToken,
+		"check_name":   checkRun.Name,
+	}), httpclient.SetResult(list))
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		AccessToken string `json:"access_token"`
+		*CheckRun
+	}{accessToken, checkRun}
+	for _, run := range list.CheckRuns {
+		if run.Name == checkRun.Name {
+			_, err = httpClient.Patch(fmt.Sprintf("/v5/repos/%s/%s/check-runs/%d", owner, repo, run.ID), httpclient.SetBody(body))
+			return err
+		}
+	}
+	_, err = httpClient.Post(fmt.Sprintf("/v5/repos/%s/%s/check-runs", owner, repo), httpclient.SetBody(body))
+	return err
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitee
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+func TestUpsertCheckRun(t *testing.T) {
+	log.Init(&log.Config{Level: "debug"})
+
+	type request struct {
+		method string
+		path   string
+		body   map[string]interface{}
+	}
+	type testcase struct {
+		existing string
+		requests []string
+	}
+	testcases := []testcase{
+		{
+			existing: `{"total_count":1,"check_runs":[{"id":7,"name":"zadig/build"}]}`,
+			requests: []string{"GET /v5/repos/owner/repo/commits/abc/check-runs", "PATCH /v5/repos/owner/repo/check-runs/7"},
+		},
+		{
+			existing: `{"total_count":0,"check_runs":[]}`,
+			requests: []string{"GET /v5/repos/owner/repo/commits/abc/check-runs", "POST /v5/repos/owner/repo/check-runs"},
+		},
+	}
+
+	for _, tc := range testcases {
+		var requests []*request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &request{method: r.Method, path: r.URL.Path}
+			requests = append(requests, req)
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodGet {
+				if r.URL.Query().Get("check_name") != "zadig/build" || r.URL.Query().Get("access_token") != "token" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write([]byte(tc.existing))
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+
+		err := upsertCheckRun(server.URL, "token", "owner", "repo", &CheckRun{
+			Name:       "zadig/build",
+			HeadSha:    "abc",
+			Status:     CheckRunStatusCompleted,
+			Conclusion: CheckRunConclusionSuccess,
+		})
+		server.Close()
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if len(requests) != len(tc.requests) {
+			t.Fatalf("Expected %d requests but got %d", len(tc.requests), len(requests))
+		}
+		for i, req := range requests {
+			if got := fmt.Sprintf("%s %s", req.method, req.path); got != tc.requests[i] {
+				t.Errorf("Expected request <%s> but got <%s>", tc.requests[i], got)
+			}
+		}
+		body := requests[len(requests)-1].body
+		if body["access_token"] != "token" || body["name"] != "zadig/build" || body["head_sha"] != "abc" ||
+			body["status"] != CheckRunStatusCompleted || body["conclusion"] != CheckRunConclusionSuccess {
+			t.Errorf("Unexpected check run body %v", body)
+		}
+	}
+}
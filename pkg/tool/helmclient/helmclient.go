@@ -31,6 +31,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	cm "github.com/chartmuseum/helm-push/pkg/chartmuseum"
 	hc "github.com/mittwald/go-helm-client"
@@ -40,6 +41,7 @@ import (
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/plugin"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/repo"
@@ -470,6 +472,7 @@ func (hClient *HelmClient) installChart(ctx context.Context, spec *hc.ChartSpec)
 				Getters:          c.Providers,
 				RepositoryConfig: generalSettings.RepositoryConfig,
 				RepositoryCache:  generalSettings.RepositoryCache,
+				RegistryClient:   c.ActionConfig.RegistryClient,
 			}
 			if err := man.Update(); err != nil {
 				return nil, err
@@ -547,6 +550,17 @@ func (hClient *HelmClient) InstallOrUpgradeChart(ctx context.Context, spec *hc.C
 	}
 }
 
+// RollbackToRevision works like executing `helm rollback <release> <revision> --wait=<wait> --timeout <timeout>`
+func (hClient *HelmClient) RollbackToRevision(releaseName string, revision int, wait bool, timeout time.Duration) error {
+	rollback := action.NewRollback(hClient.ActionConfig)
+	rollback.Version = revision
+	rollback.Wait = wait
+	rollback.Timeout = timeout
+	rollback.CleanupOnFail = true
+	rollback.MaxHistory = 10
+	return rollback.Run(releaseName)
+}
+
 // UpdateChartRepo works like executing `helm repo update`
 // environment `HELM_REPO_USERNAME` and `HELM_REPO_PASSWORD` are only required for ali acr repos
 func (hClient *HelmClient) UpdateChartRepo(repoEntry *repo.Entry) (string, error) {
@@ -596,26 +610,93 @@ func (hClient *HelmClient) FetchIndexYaml(repoEntry *repo.Entry) (*repo.IndexFil
 	return repoIndex, err
 }
 
+// IsOCIRepo returns whether the charts of the repo are stored as OCI artifacts, the url of such repo is like oci://harbor.example.com/library
+func IsOCIRepo(repoEntry *repo.Entry) bool {
+	return registry.IsOCI(repoEntry.URL)
+}
+
+// ChartRef returns the reference of the chart in the repo, which is used to download the chart
+func ChartRef(repoEntry *repo.Entry, chartName string) string {
+	if IsOCIRepo(repoEntry) {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(repoEntry.URL, "/"), chartName)
+	}
+	return fmt.Sprintf("%s/%s", repoEntry.Name, chartName)
+}
+
+// newRegistryClient logs in the OCI registry of the repo, the credentials are saved in the registry config
+// shared with the clients installing charts, so the charts and dependencies in the registry can be pulled when deploying
+func (hClient *HelmClient) newRegistryClient(repoEntry *repo.Entry) (*registry.Client, error) {
+	registryClient, err := registry.NewClient(registry.ClientOptCredentialsFile(hClient.Settings.RegistryConfig))
+	if err != nil {
+		return nil, err
+	}
+	if repoEntry.Username == "" && repoEntry.Password == "" {
+		return registryClient, nil
+	}
+	repoUrl, err := url.Parse(repoEntry.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repo url: %s, err: %w", repoEntry.URL, err)
+	}
+	if err := registryClient.Login(repoUrl.Host, registry.LoginOptBasicAuth(repoEntry.Username, repoEntry.Password)); err != nil {
+		return nil, fmt.Errorf("failed to login registry: %s, err: %w", repoUrl.Host, err)
+	}
+	return registryClient, nil
+}
+
+// FetchOCIIndex builds the index of the charts from the tags in the OCI registry, since there is no index.yaml
+// in OCI registries the charts can only be found by their names
+func (hClient *HelmClient) FetchOCIIndex(repoEntry *repo.Entry, chartNames []string) (*repo.IndexFile, error) {
+	hClient.lock.Lock()
+	defer hClient.lock.Unlock()
+	registryClient, err := hClient.newRegistryClient(repoEntry)
+	if err != nil {
+		return nil, err
+	}
+	index := repo.NewIndexFile()
+	for _, chartName := range chartNames {
+		chartRef := ChartRef(repoEntry, chartName)
+		// tags are sorted by semver in descending order
+		tags, err := registryClient.Tags(strings.TrimPrefix(chartRef, fmt.Sprintf("%s://", registry.OCIScheme)))
+		if err != nil {
+			// the chart which has never been pushed is not found
+			log.Warnf("failed to list tags of chart: %s, err: %s", chartRef, err)
+			continue
+		}
+		for _, tag := range tags {
+			index.Entries[chartName] = append(index.Entries[chartName], &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: chartName, Version: tag},
+				URLs:     []string{fmt.Sprintf("%s:%s", chartRef, tag)},
+			})
+		}
+	}
+	return index, nil
+}
+
 // DownloadChart works like executing `helm pull repoName/chartName --version=version'
-// since pulling from OCI Registry is still considered as an EXPERIMENTAL feature
-// we DO NOT support pulling charts by pulling OCI Artifacts from OCI Registry
+// charts in OCI registries are pulled by the reference like oci://harbor.example.com/library/chartName, see ChartRef
 // NOTE consider using os.execCommand('helm pull') to reduce code complexity of offering compatibility since third-party plugins CANNOT be used as SDK
 func (hClient *HelmClient) DownloadChart(repoEntry *repo.Entry, chartRef string, chartVersion string, destDir string, unTar bool) error {
 	hClient.lock.Lock()
 	defer hClient.lock.Unlock()
-	_, err := hClient.UpdateChartRepo(repoEntry)
-	if err != nil {
-		return nil
+	cfg := &action.Configuration{}
+	if IsOCIRepo(repoEntry) {
+		registryClient, err := hClient.newRegistryClient(repoEntry)
+		if err != nil {
+			return err
+		}
+		cfg.RegistryClient = registryClient
+	} else if _, err := hClient.UpdateChartRepo(repoEntry); err != nil {
+		return err
 	}
-	pull := action.NewPullWithOpts(action.WithConfig(&action.Configuration{}))
-	pull.Password = repoEntry.Username
-	pull.Username = repoEntry.Password
+	pull := action.NewPullWithOpts(action.WithConfig(cfg))
+	pull.Username = repoEntry.Username
+	pull.Password = repoEntry.Password
 	pull.Version = chartVersion
 	pull.Settings = generalSettings
 	pull.DestDir = destDir
 	pull.UntarDir = destDir
 	pull.Untar = unTar
-	_, err = pull.Run(chartRef)
+	_, err := pull.Run(chartRef)
 	return err
 }
 
@@ -636,6 +717,20 @@ func (hClient *HelmClient) pushAcrChart(repoEntry *repo.Entry, chartPath string)
 	return nil
 }
 
+func (hClient *HelmClient) pushOCIChart(repoEntry *repo.Entry, chartPath string) error {
+	registryClient, err := hClient.newRegistryClient(repoEntry)
+	if err != nil {
+		return err
+	}
+	push := action.NewPushWithOpts(action.WithPushConfig(&action.Configuration{RegistryClient: registryClient}))
+	push.Settings = hClient.Settings
+	if _, err := push.Run(chartPath, repoEntry.URL); err != nil {
+		return fmt.Errorf("failed to push chart: %s, error: %w", chartPath, err)
+	}
+	log.Info("push chart to oci registry done")
+	return nil
+}
+
 func (hClient *HelmClient) pushChartMuseum(repoEntry *repo.Entry, chartPath string) error {
 	chartClient, err := cm.NewClient(
 		cm.URL(repoEntry.URL),
@@ -685,9 +780,12 @@ func handlePushResponse(resp *http.Response) error {
 func (hClient *HelmClient) PushChart(repoEntry *repo.Entry, chartPath string) error {
 	hClient.lock.Lock()
 	defer hClient.lock.Unlock()
+	if IsOCIRepo(repoEntry) {
+		return hClient.pushOCIChart(repoEntry, chartPath)
+	}
 	_, err := hClient.UpdateChartRepo(repoEntry)
 	if err != nil {
-		return nil
+		return err
 	}
 	repoUrl, err := url.Parse(repoEntry.URL)
 	if err != nil {
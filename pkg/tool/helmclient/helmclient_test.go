@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var _ = Describe("Testing helm client", func() {
+
+	Context("IsOCIRepo", func() {
+		It("should tell the repos by the scheme of the url", func() {
+			Expect(IsOCIRepo(&repo.Entry{URL: "oci://harbor.example.com/library"})).To(BeTrue())
+			Expect(IsOCIRepo(&repo.Entry{URL: "https://charts.example.com"})).To(BeFalse())
+			Expect(IsOCIRepo(&repo.Entry{URL: "acr://repo.example.com"})).To(BeFalse())
+		})
+	})
+
+	Context("ChartRef", func() {
+		It("should refer to the chart by the url of OCI repos", func() {
+			Expect(ChartRef(&repo.Entry{Name: "harbor", URL: "oci://harbor.example.com/library/"}, "app")).To(Equal("oci://harbor.example.com/library/app"))
+		})
+		It("should refer to the chart by the name of other repos", func() {
+			Expect(ChartRef(&repo.Entry{Name: "stable", URL: "https://charts.example.com"}, "app")).To(Equal("stable/app"))
+		})
+	})
+
+	Context("FetchOCIIndex", func() {
+		var server *httptest.Server
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case "/v2/library/app/tags/list":
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "library/app", "tags": []string{"1.0.0", "latest", "1.1.0"}})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should index the semver tags of the charts", func() {
+			client, err := NewClient()
+			Expect(err).NotTo(HaveOccurred())
+			repoEntry := &repo.Entry{Name: "local", URL: "oci://" + strings.TrimPrefix(server.URL, "http://") + "/library"}
+			index, err := client.FetchOCIIndex(repoEntry, []string{"app", "missing"})
+			Expect(err).NotTo(HaveOccurred())
+
+			// the tags which are not semver are ignored, and the chart never pushed is skipped
+			Expect(index.Entries).To(HaveLen(1))
+			versions := index.Entries["app"]
+			Expect(versions).To(HaveLen(2))
+			Expect(versions[0].Version).To(Equal("1.1.0"))
+			Expect(versions[0].URLs).To(Equal([]string{repoEntry.URL + "/app:1.1.0"}))
+			Expect(versions[1].Version).To(Equal("1.0.0"))
+		})
+	})
+})
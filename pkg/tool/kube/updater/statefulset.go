@@ -82,3 +82,12 @@ func ScaleStatefulSet(ns, name string, replicas int, cl client.Client) error {
 func CreateOrPatchStatefulSet(sts *appsv1.StatefulSet, cl client.Client) error {
 	return createOrPatchObject(sts, cl)
 }
+
+func DeleteStatefulSetAndWait(ns, name string, cl client.Client) error {
+	return deleteObjectAndWait(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+	}, cl)
+}
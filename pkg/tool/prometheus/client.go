@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/koderover/zadig/pkg/tool/httpclient"
+)
+
+// Client queries the Prometheus compatible HTTP API.
+type Client struct {
+	*httpclient.Client
+}
+
+// NewClient returns the client of the Prometheus at the address, the token is sent as bearer token if not empty.
+func NewClient(address, token string) *Client {
+	cfs := []httpclient.ClientFunc{httpclient.SetHostURL(address)}
+	if token != "" {
+		cfs = append(cfs, httpclient.SetAuthToken(token))
+	}
+	return &Client{Client: httpclient.New(cfs...)}
+}
+
+type queryResponse struct {
+	Status    string    `json:"status"`
+	ErrorType string    `json:"errorType"`
+	Error     string    `json:"error"`
+	Data      queryData `json:"data"`
+}
+
+type queryData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type vectorSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// Query evaluates the instant query at the time, the query should result in a scalar or a single sample.
+func (c *Client) Query(query string, ts time.Time) (float64, error) {
+	resp := &queryResponse{}
+	_, err := c.Get("/api/v1/query",
+		httpclient.SetQueryParams(map[string]string{
+			"query": query,
+			"time":  strconv.FormatInt(ts.Unix(), 10),
+		}),
+		httpclient.SetResult(resp),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Status != "success" {
+		return 0, fmt.Errorf("query failed, %s: %s", resp.ErrorType, resp.Error)
+	}
+
+	var value []interface{}
+	switch resp.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(resp.Data.Result, &value); err != nil {
+			return 0, err
+		}
+	case "vector":
+		samples := []*vectorSample{}
+		if err := json.Unmarshal(resp.Data.Result, &samples); err != nil {
+			return 0, err
+		}
+		if len(samples) == 0 {
+			return 0, fmt.Errorf("query returned no data")
+		}
+		if len(samples) > 1 {
+			return 0, fmt.Errorf("query returned %d samples, only one is expected", len(samples))
+		}
+		value = samples[0].Value
+	default:
+		return 0, fmt.Errorf("result type %s is not supported", resp.Data.ResultType)
+	}
+	return sampleValue(value)
+}
+
+// sampleValue parses the sample like [1435781451.781, "1"].
+func sampleValue(value []interface{}) (float64, error) {
+	if len(value) != 2 {
+		return 0, fmt.Errorf("invalid sample: %v", value)
+	}
+	s, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid sample value: %v", value[1])
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+func TestQuery(t *testing.T) {
+	log.Init(&log.Config{Level: "debug"})
+	responses := map[string]string{
+		"error_rate":  `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1435781451.781,"0.05"]}]}}`,
+		"scalar(1)":   `{"status":"success","data":{"resultType":"scalar","result":[1435781451.781,"1"]}}`,
+		"empty":       `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		"multiple":    `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"a":"1"},"value":[1,"1"]},{"metric":{"a":"2"},"value":[1,"2"]}]}}`,
+		"matrix":      `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+		"bad_query((": `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(responses[r.URL.Query().Get("query")]))
+	}))
+	defer server.Close()
+
+	type testcase struct {
+		query   string
+		value   float64
+		success bool
+	}
+	testcases := []testcase{
+		{"error_rate", 0.05, true},
+		{"scalar(1)", 1, true},
+		{"empty", 0, false},
+		{"multiple", 0, false},
+		{"matrix", 0, false},
+		{"bad_query((", 0, false},
+	}
+
+	client := NewClient(server.URL, "token")
+	for _, tc := range testcases {
+		value, err := client.Query(tc.query, time.Now())
+		if (err == nil) != tc.success {
+			t.Errorf("Expected query <%s> to succeed: %v, but got error: %v", tc.query, tc.success, err)
+			continue
+		}
+		if value != tc.value {
+			t.Errorf("Expected result for query <%s> to be <%v> but got <%v>", tc.query, tc.value, value)
+		}
+	}
+}
@@ -16,12 +16,71 @@ limitations under the License.
 
 package job
 
+import (
+	"github.com/koderover/zadig/pkg/types/step"
+)
+
 const (
 	JobOutputDir       = "/zadig/results/"
 	JobTerminationFile = "/zadig/termination"
+	// JobStepResultFile records the results of steps, it is read by aslan before the job container exits.
+	JobStepResultFile = "/zadig/step-results"
+	// JobOutputsFile is the name of the object holding the outputs of a job in OutputStorage.
+	JobOutputsFile = "outputs.json"
+)
+
+type OutputType string
+
+const (
+	OutputTypeString OutputType = "string"
+	// OutputTypeJSON is a string which must be valid json.
+	OutputTypeJSON OutputType = "json"
+	// OutputTypeFile means the output file holds the path of a file in the workspace, the file is uploaded to
+	// OutputStorage and the value of the output is its object key.
+	OutputTypeFile OutputType = "file"
+)
+
+// OutputStorage is the object storage where the job executor uploads the outputs of the job,
+// so the outputs are not limited by the size of the container termination message.
+type OutputStorage struct {
+	S3        *step.S3 `yaml:"s3"`
+	ObjectDir string   `yaml:"object_dir"`
+}
+
+// StepRunIf decides whether a step runs according to the results of the previous steps.
+type StepRunIf string
+
+const (
+	// StepRunIfSuccess runs the step only if all previous steps passed, it is the default.
+	StepRunIfSuccess StepRunIf = "success"
+	// StepRunIfFailure runs the step only if a previous step failed or timed out.
+	StepRunIfFailure StepRunIf = "failure"
+	// StepRunIfAlways runs the step even if the job was cancelled.
+	StepRunIfAlways StepRunIf = "always"
+)
+
+type StepStatus string
+
+const (
+	StepStatusPassed    StepStatus = "passed"
+	StepStatusFailed    StepStatus = "failed"
+	StepStatusTimeout   StepStatus = "timeout"
+	StepStatusCancelled StepStatus = "cancelled"
+	StepStatusSkipped   StepStatus = "skipped"
 )
 
 type JobOutput struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name  string     `json:"name"`
+	Type  OutputType `json:"type,omitempty"`
+	Value string     `json:"value"`
+}
+
+type StepResult struct {
+	Name   string     `json:"name"`
+	Status StepStatus `json:"status,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	// ExitCode is the exit code of the failed command, -1 if the step failed without a command exited.
+	ExitCode  int   `json:"exit_code"`
+	StartTime int64 `json:"start_time,omitempty"`
+	EndTime   int64 `json:"end_time,omitempty"`
 }
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The job executor prints a start marker before a step runs and an end marker after it finished,
+// each followed by the StepResult of the step in json, so the job log can be split by steps.
+// The markers carry a nonce generated for every run, so the output of user scripts cannot fake them.
+const (
+	StepStartMarker = "##[zadig-step-start"
+	StepEndMarker   = "##[zadig-step-end"
+)
+
+type StepLog struct {
+	*StepResult
+	Log string
+}
+
+func StepStartLine(nonce string, result *StepResult) string {
+	return stepMarkerLine(stepMarker(StepStartMarker, nonce), result)
+}
+
+func StepEndLine(nonce string, result *StepResult) string {
+	return stepMarkerLine(stepMarker(StepEndMarker, nonce), result)
+}
+
+// stepMarker returns the marker with the nonce, logs of the runs without nonce use the bare marker.
+func stepMarker(marker, nonce string) string {
+	if nonce == "" {
+		return marker + "]"
+	}
+	return fmt.Sprintf("%s:%s]", marker, nonce)
+}
+
+func stepMarkerLine(marker string, result *StepResult) string {
+	content, _ := json.Marshal(result)
+	return fmt.Sprintf("%s %s\n", marker, content)
+}
+
+// SplitStepLogs splits the job log by the step markers with the nonce, the result of a step comes from its end marker,
+// or from its start marker if the step did not end, lines out of any step are dropped.
+func SplitStepLogs(content, nonce string) []*StepLog {
+	startMarker := stepMarker(StepStartMarker, nonce)
+	endMarker := stepMarker(StepEndMarker, nonce)
+	resp := []*StepLog{}
+	var current *StepLog
+	var lines []string
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, startMarker):
+			result := &StepResult{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(trimmed, startMarker)), result); err != nil {
+				break
+			}
+			if current != nil {
+				current.Log = strings.Join(lines, "")
+			}
+			current = &StepLog{StepResult: result}
+			lines = []string{}
+			resp = append(resp, current)
+			continue
+		case strings.HasPrefix(trimmed, endMarker):
+			result := &StepResult{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(trimmed, endMarker)), result); err != nil {
+				break
+			}
+			if current == nil || current.Name != result.Name {
+				// steps skipped only have an end marker.
+				resp = append(resp, &StepLog{StepResult: result})
+				continue
+			}
+			current.StepResult = result
+			current.Log = strings.Join(lines, "")
+			current = nil
+			continue
+		}
+		if current != nil {
+			lines = append(lines, line)
+		}
+	}
+	if current != nil {
+		current.Log = strings.Join(lines, "")
+	}
+	return resp
+}
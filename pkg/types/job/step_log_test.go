@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package job
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing step log", func() {
+	const nonce = "3f1c9a2e"
+
+	It("splits the job log by step markers", func() {
+		content := "====================== job-executor Start ======================\n" +
+			StepStartLine(nonce, &StepResult{Name: "git", StartTime: 100}) +
+			"Start git clone.\n" +
+			"Git clone ended.\n" +
+			StepEndLine(nonce, &StepResult{Name: "git", Status: StepStatusPassed, StartTime: 100, EndTime: 105}) +
+			StepStartLine(nonce, &StepResult{Name: "shell", StartTime: 105}) +
+			"make build\n" +
+			StepEndLine(nonce, &StepResult{Name: "shell", Status: StepStatusFailed, ExitCode: 2, StartTime: 105, EndTime: 110}) +
+			StepEndLine(nonce, &StepResult{Name: "docker-build", Status: StepStatusSkipped}) +
+			"Job Status: fail\n"
+
+		stepLogs := SplitStepLogs(content, nonce)
+		Expect(stepLogs).To(HaveLen(3))
+
+		Expect(stepLogs[0].Name).To(Equal("git"))
+		Expect(stepLogs[0].Status).To(Equal(StepStatusPassed))
+		Expect(stepLogs[0].Log).To(Equal("Start git clone.\nGit clone ended.\n"))
+
+		Expect(stepLogs[1].Name).To(Equal("shell"))
+		Expect(stepLogs[1].Status).To(Equal(StepStatusFailed))
+		Expect(stepLogs[1].ExitCode).To(Equal(2))
+		Expect(stepLogs[1].EndTime - stepLogs[1].StartTime).To(Equal(int64(5)))
+		Expect(stepLogs[1].Log).To(Equal("make build\n"))
+
+		Expect(stepLogs[2].Name).To(Equal("docker-build"))
+		Expect(stepLogs[2].Status).To(Equal(StepStatusSkipped))
+		Expect(stepLogs[2].Log).To(BeEmpty())
+	})
+
+	It("ignores markers printed without the nonce", func() {
+		content := StepStartLine(nonce, &StepResult{Name: "shell", StartTime: 100}) +
+			StepEndLine("", &StepResult{Name: "shell", Status: StepStatusPassed}) +
+			StepStartLine("fake", &StepResult{Name: "fake"}) +
+			StepEndLine(nonce, &StepResult{Name: "shell", Status: StepStatusFailed, ExitCode: 1, StartTime: 100, EndTime: 101})
+
+		stepLogs := SplitStepLogs(content, nonce)
+		Expect(stepLogs).To(HaveLen(1))
+		Expect(stepLogs[0].Name).To(Equal("shell"))
+		Expect(stepLogs[0].Status).To(Equal(StepStatusFailed))
+		Expect(stepLogs[0].Log).To(Equal(StepEndLine("", &StepResult{Name: "shell", Status: StepStatusPassed}) +
+			StepStartLine("fake", &StepResult{Name: "fake"})))
+	})
+
+	It("keeps the log of the step not ended", func() {
+		content := StepStartLine(nonce, &StepResult{Name: "shell", StartTime: 100}) + "sleep 1000\n"
+
+		stepLogs := SplitStepLogs(content, nonce)
+		Expect(stepLogs).To(HaveLen(1))
+		Expect(stepLogs[0].Status).To(BeEmpty())
+		Expect(stepLogs[0].Log).To(Equal("sleep 1000\n"))
+	})
+})
@@ -136,6 +136,12 @@ const (
 	// ProviderGitee
 	ProviderGitee = "gitee"
 
+	// ProviderGitea
+	ProviderGitea = "gitea"
+
+	// ProviderBitbucketServer
+	ProviderBitbucketServer = "bitbucket_server"
+
 	// ProviderOther
 	ProviderOther = "other"
 )
@@ -150,6 +156,8 @@ func (r *Repository) PRRef() string {
 		return fmt.Sprintf("merge-requests/%d/head", r.PR)
 	} else if strings.ToLower(r.Source) == ProviderGerrit {
 		return r.CheckoutRef
+	} else if strings.ToLower(r.Source) == ProviderBitbucketServer {
+		return fmt.Sprintf("refs/pull-requests/%d/from", r.PR)
 	}
 	return fmt.Sprintf("refs/pull/%d/head", r.PR)
 }
@@ -0,0 +1,237 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package condition evaluates the run conditions of workflow stages and jobs, for example:
+//
+//	{{.workflow.trigger.branch}} == main && {{.workflow.build.SHOULD_DEPLOY}} == "true"
+//
+// Variables are referred as {{.name}} and rendered as strings, also inside quoted values, undefined variables are empty.
+// Supported operators are ==, !=, =~ (regular expression match), !~, !, && and ||, with parentheses for grouping.
+// Values containing spaces, parentheses or operators should be quoted with " or '.
+// A single operand is true unless it is empty, "false" or "0".
+package condition
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	tokenValue tokenType = iota
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	typ   tokenType
+	value string
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "&&", "||", "!"}
+
+var variableRegex = regexp.MustCompile(`{{\s*\.?([^{}\s]+)\s*}}`)
+
+// Evaluate returns the result of the expression, an empty expression is always true.
+func Evaluate(expr string, vars map[string]string) (bool, error) {
+	if strings.TrimSpace(expr) == "" {
+		return true, nil
+	}
+	tokens, err := tokenize(expr, vars)
+	if err != nil {
+		return false, err
+	}
+	p := &parser{tokens: tokens}
+	result, err := p.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.tokens) {
+		return false, fmt.Errorf("unexpected %q in condition %q", p.tokens[p.pos].value, expr)
+	}
+	return result, nil
+}
+
+func tokenize(expr string, vars map[string]string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{typ: tokenLeftParen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{typ: tokenRightParen, value: ")"})
+			i++
+		case strings.HasPrefix(expr[i:], "{{"):
+			end := strings.Index(expr[i:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed variable in condition %q", expr)
+			}
+			name := strings.TrimPrefix(strings.TrimSpace(expr[i+2:i+end]), ".")
+			tokens = append(tokens, token{typ: tokenValue, value: vars[name]})
+			i += end + 2
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed string in condition %q", expr)
+			}
+			value := variableRegex.ReplaceAllStringFunc(expr[i+1:i+1+end], func(v string) string {
+				return vars[variableRegex.FindStringSubmatch(v)[1]]
+			})
+			tokens = append(tokens, token{typ: tokenValue, value: value})
+			i += end + 2
+		default:
+			operator := ""
+			for _, op := range operators {
+				if strings.HasPrefix(expr[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator != "" {
+				tokens = append(tokens, token{typ: tokenOperator, value: operator})
+				i += len(operator)
+				continue
+			}
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\r\n()!=&|\"'", rune(expr[i])) && !strings.HasPrefix(expr[i:], "{{") {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected %q in condition %q", expr[i], expr)
+			}
+			tokens = append(tokens, token{typ: tokenValue, value: expr[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *parser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for t := p.peek(); t != nil && t.typ == tokenOperator && t.value == "||"; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (p *parser) parseAnd() (bool, error) {
+	result, err := p.parseUnary()
+	if err != nil {
+		return false, err
+	}
+	for t := p.peek(); t != nil && t.typ == tokenOperator && t.value == "&&"; t = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+func (p *parser) parseUnary() (bool, error) {
+	t := p.peek()
+	if t == nil {
+		return false, fmt.Errorf("unexpected end of condition")
+	}
+	switch {
+	case t.typ == tokenOperator && t.value == "!":
+		p.pos++
+		result, err := p.parseUnary()
+		return !result, err
+	case t.typ == tokenLeftParen:
+		p.pos++
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if t := p.peek(); t == nil || t.typ != tokenRightParen {
+			return false, fmt.Errorf("missing ) in condition")
+		}
+		p.pos++
+		return result, nil
+	case t.typ == tokenValue:
+		return p.parseComparison()
+	}
+	return false, fmt.Errorf("unexpected %q in condition", t.value)
+}
+
+func (p *parser) parseComparison() (bool, error) {
+	left := p.tokens[p.pos].value
+	p.pos++
+	t := p.peek()
+	if t == nil || t.typ != tokenOperator || (t.value != "==" && t.value != "!=" && t.value != "=~" && t.value != "!~") {
+		return isTrue(left), nil
+	}
+	operator := t.value
+	p.pos++
+	t = p.peek()
+	if t == nil || t.typ != tokenValue {
+		return false, fmt.Errorf("missing right operand of %s in condition", operator)
+	}
+	right := t.value
+	p.pos++
+
+	switch operator {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+	reg, err := regexp.Compile(right)
+	if err != nil {
+		return false, fmt.Errorf("invalid regular expression %q in condition: %v", right, err)
+	}
+	if operator == "=~" {
+		return reg.MatchString(left), nil
+	}
+	return !reg.MatchString(left), nil
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "0":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package condition
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var vars = map[string]string{
+	"workflow.trigger.branch":        "main",
+	"workflow.trigger.event":         "push",
+	"workflow.trigger.changed_files": "charts/values.yaml,README.md",
+	"workflow.build.SHOULD_DEPLOY":   "true",
+	"workflow.params.message":        "hello world",
+}
+
+var _ = Describe("Testing condition", func() {
+
+	DescribeTable("Evaluate",
+		func(expr string, expected bool) {
+			result, err := Evaluate(expr, vars)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(result).To(Equal(expected))
+		},
+		Entry("empty expression", "", true),
+		Entry("equal", "{{.workflow.trigger.branch}} == main", true),
+		Entry("not equal", "{{.workflow.trigger.branch}} != main", false),
+		Entry("quoted value", `{{.workflow.params.message}} == "hello world"`, true),
+		Entry("variable in quoted value", `"{{.workflow.params.message}}" == "hello world"`, true),
+		Entry("undefined variable", "{{.workflow.params.undefined}} == ''", true),
+		Entry("single operand", "{{.workflow.build.SHOULD_DEPLOY}}", true),
+		Entry("undefined single operand", "{{.workflow.params.undefined}}", false),
+		Entry("regexp match", `{{.workflow.trigger.changed_files}} =~ "(^|,)charts/"`, true),
+		Entry("regexp not match", `{{.workflow.trigger.changed_files}} !~ "(^|,)src/"`, true),
+		Entry("and", "{{.workflow.trigger.branch}} == main && {{.workflow.build.SHOULD_DEPLOY}} == true", true),
+		Entry("or", "{{.workflow.trigger.branch}} == dev || {{.workflow.trigger.event}} == push", true),
+		Entry("not", "!({{.workflow.trigger.branch}} == dev)", true),
+		Entry("precedence", "{{.workflow.trigger.branch}} == dev && {{.workflow.trigger.event}} == push || true", true),
+	)
+
+	DescribeTable("Evaluate with invalid expression",
+		func(expr string) {
+			_, err := Evaluate(expr, vars)
+			Expect(err).Should(HaveOccurred())
+		},
+		Entry("unclosed variable", "{{.workflow.trigger.branch == main"),
+		Entry("unclosed string", `{{.workflow.trigger.branch}} == "main`),
+		Entry("missing right operand", "{{.workflow.trigger.branch}} =="),
+		Entry("missing right paren", "({{.workflow.trigger.branch}} == main"),
+		Entry("invalid regexp", `{{.workflow.trigger.branch}} =~ "["`),
+		Entry("dangling operator", "{{.workflow.trigger.branch}} == main &&"),
+	)
+})